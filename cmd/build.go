@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
@@ -11,17 +14,30 @@ import (
 	"github.com/eezhee/eezhee/pkg/config"
 	"github.com/eezhee/eezhee/pkg/core"
 	"github.com/eezhee/eezhee/pkg/k3s"
+	"github.com/eezhee/eezhee/pkg/provider"
 	homedir "github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 )
 
-const statusCheckDelay = 2 * time.Second // time between checks on status of VM
-const launchDelay = 10 * time.Second     // time from when provider says vm ready to us ssh'ing in
+// note: these are vars so tests against the fake cloud can shorten them
+var statusCheckDelay = 2 * time.Second // time between checks on status of VM
+var launchDelay = 10 * time.Second     // time from when provider says vm ready to us ssh'ing in
+
+// how long each phase of a build can take (unless --timeout is hit first)
+var setupTimeout = 5 * time.Minute         // looking up releases, uploading ssh key & picking a region
+var createTimeout = 5 * time.Minute        // cloud accepting the request for a new VM or cluster
+var vmReadyTimeout = 10 * time.Minute      // VM booting up & getting an ip
+var installTimeout = 10 * time.Minute      // installing k3s & getting the kubeconfig
+var clusterReadyTimeout = 30 * time.Minute // managed cluster coming up & getting the kubeconfig
+var rollbackTimeout = 5 * time.Minute      // deleting what was created when a build is stopped
+
+var buildTimeout time.Duration // set with --timeout
 
 func init() {
 	rootCmd.AddCommand(buildCmd)
+	buildCmd.Flags().DurationVar(&buildTimeout, "timeout", 45*time.Minute, "give up if the cluster isn't built in this long")
 }
 
 var buildCmd = &cobra.Command{
@@ -29,27 +45,35 @@ var buildCmd = &cobra.Command{
 	Short: "Print the version number of Eezhee",
 	Long:  `All software has versions. This is Eezhee's`,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := buildCluster()
+
+		// ctrl-c stops the build rather than eezhee so we can clean up
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+
+		deployState := config.NewDeployState()
+		err := buildCluster(ctx, deployState)
+		stopped := ctx.Err() != nil
+		cancel()
+		stop() // so a second ctrl-c exits right away
 		if err != nil {
 			log.Error(err)
+			if stopped {
+				offerRollback(deployState)
+			}
 			os.Exit(1)
 		}
 	},
 }
 
 // buildVM will create a cluster
-func buildCluster() error {
+// deployState is saved as soon as something is created so it can be rolled back
+func buildCluster(ctx context.Context, deployState *config.DeployState) error {
 
 	// see which cloud we have an api token for
 	defaultCloud := AppConfig.GetDefaultCloud()
-	if len(defaultCloud) == 0 {
-		// opps, no api keys specified so can't proceed until resolved
-		return errors.New("no cloud provider configured. User 'eezhee auth add'")
-	}
 
 	// make sure the cluster doesn't already exist
 	// is there a deploy state file
-	deployState := config.NewDeployState()
 	if deployState.FileExists() {
 		return errors.New("cluster already running (as per deploy-state file)")
 	}
@@ -73,21 +97,7 @@ func buildCluster() error {
 	}
 
 	// load ssh key we will use
-	var sshKey core.SSHKey
-
-	dir, _ := homedir.Dir()
-	publicKeyFile := dir + "/.ssh/id_rsa.pub"
-
-	// see if file exists
-	_, err := os.Stat(publicKeyFile)
-	if os.IsNotExist(err) {
-		// need to generate an ssh key
-		err = sshKey.GenerateNewKey(publicKeyFile)
-		if err != nil {
-			return err
-		}
-	}
-	err = sshKey.LoadPublicKey(publicKeyFile)
+	sshKey, err := loadSSHKey()
 	if err != nil {
 		return err
 	}
@@ -96,37 +106,50 @@ func buildCluster() error {
 	// does config specify which cloud to use
 	// if not, use one that we have credentials for
 	if len(deployConfig.Cloud) == 0 {
+		if len(defaultCloud) == 0 {
+			// opps, no api keys specified so can't proceed until resolved
+			return errors.New("no cloud provider configured. User 'eezhee auth add'")
+		}
 		deployConfig.Cloud = defaultCloud
 	}
 
 	// make sure we have a valid cloud
-	switch deployConfig.Cloud {
-	case "digitalocean", "linode", "vultr":
-	// case "gcloud":
-	// case "azure":
-	// case "aws":
-	default:
-		return errors.New("no or invalid cloud specified")
+	cloudProvider, err := provider.Get(deployConfig.Cloud)
+	if err != nil {
+		return err
 	}
 	log.Info("deploying to ", deployConfig.Cloud)
 
-	// has a release of k3s been specified?
-	// if not, use latest stable release
-	if len(deployConfig.K3sVersion) == 0 {
-		deployConfig.K3sVersion = "stable"
+	// translate generic regions (ie us-east or near: toronto) to the cloud's own region
+	err = resolveRegion(cloudProvider, deployConfig)
+	if err != nil {
+		return err
 	}
 
-	// we're pretty flexibly in how release is specified.
-	// could be 'stable', 'latest', validChannelName (v1.19) or validReleaseName (v1.19.3)
-	// as a result, we need to translate it to exactly which release to install
-	k3sManager := k3s.NewManager()
-	release, err := k3sManager.Releases.Translate(deployConfig.K3sVersion)
+	// same for generic sizes (ie 2cpu4gb)
+	err = resolveSize(cloudProvider, deployConfig)
 	if err != nil {
 		return err
 	}
-	deployConfig.K3sVersion = release
 
-	// ok validation completed, time to get building
+	// use the cloud's kubernetes service rather than installing k3s
+	switch deployConfig.Type {
+	case "", "k3s":
+	case "managed":
+		return buildManagedCluster(ctx, deployConfig, deployState)
+	default:
+		return errors.New("invalid cluster type. use 'k3s' or 'managed'")
+	}
+	if len(deployConfig.Image) > 0 && deployConfig.Image != "baked" {
+		return errors.New("invalid image. use 'baked' or leave it out")
+	}
+
+	// has a release of k3s been specified?
+	// if not, use latest stable release
+	pinnedVersion := len(deployConfig.K3sVersion) > 0
+	if len(deployConfig.K3sVersion) == 0 {
+		deployConfig.K3sVersion = "stable"
+	}
 
 	// create a manager for desired cloud
 	vmManager, err := GetManager(deployConfig.Cloud)
@@ -135,84 +158,98 @@ func buildCluster() error {
 		return err
 	}
 
-	// TODO: for DO, should upload it if not there yet
-	// make sure this ssh key is loaded into cloud platform
-	_, err = vmManager.IsSSHKeyUploaded(sshKey)
-	if err != nil {
-		_, err = vmManager.UploadSSHKey("eezhee", sshKey)
-		if err != nil {
-			return err
-		}
-		// else we're all good and can continue
+	// note: plugins pick their own defaults when size is empty
+	if len(deployConfig.Size) == 0 {
+		deployConfig.Size = cloudProvider.DefaultSize
 	}
 
-	// TODO: need to valide if it a valid region for given cloud
-	// set rest of details for new VM
-	if len(deployConfig.Region) == 0 {
-		log.Info("selecting closest region")
-		deployConfig.Region, err = vmManager.SelectClosestRegion()
+	var k3sManager *k3s.Manager
+	var imageName string
+	err = runPhase(ctx, "getting ready to build", setupTimeout, func(ctx context.Context) error {
+
+		// we're pretty flexibly in how release is specified.
+		// could be 'stable', 'latest', validChannelName (v1.19) or validReleaseName (v1.19.3)
+		// as a result, we need to translate it to exactly which release to install
+		k3sManager = newK3sManager(ctx, cloudProvider)
+		release, err := k3sManager.Releases.Translate(deployConfig.K3sVersion)
 		if err != nil {
 			return err
 		}
-		log.Info("using ", deployConfig.Region)
-	}
+		deployConfig.K3sVersion = release
 
-	// TODO - allow config to specify size/type
-	// TODO - translate generic size/type to provider specific
-	var imageName string
-	switch deployConfig.Cloud {
-	case "digitalocean":
-		if len(deployConfig.Size) == 0 {
-			deployConfig.Size = "s-1vcpu-1gb"
+		// ok validation completed, time to get building
+
+		// TODO: for DO, should upload it if not there yet
+		// make sure this ssh key is loaded into cloud platform
+		_, err = vmManager.IsSSHKeyUploaded(ctx, sshKey)
+		if err != nil {
+			_, err = vmManager.UploadSSHKey(ctx, "eezhee", sshKey)
+			if err != nil {
+				return err
+			}
+			// else we're all good and can continue
 		}
-		imageName = "ubuntu-20-04-x64"
-	case "linode":
-		if len(deployConfig.Size) == 0 {
-			deployConfig.Size = "g6-nanode-1"
+
+		// TODO: need to valide if it a valid region for given cloud
+		// set rest of details for new VM
+		if len(deployConfig.Region) == 0 {
+			log.Info("selecting closest region")
+			deployConfig.Region, err = vmManager.SelectClosestRegion(ctx)
+			if err != nil {
+				return err
+			}
+			log.Info("using ", deployConfig.Region)
 		}
-		imageName = "linode/ubuntu20.04"
-	case "vultr":
-		if len(deployConfig.Size) == 0 {
-			deployConfig.Size = "vc2-1c-1gb" // $5/month
+
+		// images made by 'eezhee image bake' already have k3s on them
+		if deployConfig.Image == "baked" {
+			imageName, err = findBakedImage(cloudProvider, deployConfig, pinnedVersion)
+			return err
 		}
-		imageName = "387" // ubuntu 20.04
+
+		// find the current image of the os
+		imageName, err = resolveImage(ctx, cloudProvider, vmManager, deployConfig)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
 	// time to create the VM
+	// note: this isn't cancelled part way as we'd have no way to know if the VM
+	// was created. once we have its id, it is saved so it can be rolled back
 	log.Info("creating a VM")
+	createCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), createTimeout)
 	vmInfo, err := vmManager.CreateVM(
-		deployConfig.Name, imageName, deployConfig.Size,
+		createCtx, deployConfig.Name, imageName, deployConfig.Size,
 		deployConfig.Region, sshKey,
 	)
+	cancel()
 	if err != nil {
 		return err
 	}
-	vmID := vmInfo.ID
-	status := vmInfo.Status
 
-	// see if vm ready.  if not need to wait as don't have IP yet
-
-	// all providers have their own status messages
-	// the only one we standardize is the final one
-	// provider needs to convert to "running"
-
-	lastStatus := ""
-	for strings.Compare(status, "running") != 0 {
-
-		// wait a bit
-		time.Sleep(statusCheckDelay)
-		vmInfo, err = vmManager.GetVMInfo(vmID)
-		if err != nil {
-			// TODO: vm has been created, really should delete (or should we add retry to getVMInfo?)
-			return err
-		}
-		status = vmInfo.Status
+	// save state right away so the VM can be torn down if something goes wrong
+	deployState.Cloud = deployConfig.Cloud
+	deployState.ID = vmInfo.ID
+	deployState.Name = vmInfo.Name
+	deployState.Region = deployConfig.Region
+	deployState.Size = deployConfig.Size
+	deployState.OS = deployConfig.OS
+	// TODO save public key
+	deployState.SSHPublicKey = deployConfig.SSHPublicKey
+	err = deployState.Save()
+	if err != nil {
+		return err
+	}
 
-		// print status if it has changed since last time
-		if strings.Compare(lastStatus, status) != 0 {
-			log.Info("vm in ", status, " state")
-			lastStatus = status
-		}
+	// see if vm ready.  if not need to wait as don't have IP yet
+	err = runPhase(ctx, "waiting for the VM to start", vmReadyTimeout, func(ctx context.Context) error {
+		vmInfo, err = waitForVM(ctx, vmManager, vmInfo)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
 	// some VMs have multiple IPs (internal and public)
@@ -223,28 +260,36 @@ func buildCluster() error {
 	}
 
 	// save current state
-	deployState.Cloud = deployConfig.Cloud
-	deployState.ID = vmInfo.ID
 	deployState.Name = vmInfo.Name
 	deployState.Region = vmInfo.Region.Slug
 	deployState.Size = vmInfo.Size.Slug
 	deployState.IP = vmPublicIP
-	// TODO save public key
-	deployState.SSHPublicKey = deployConfig.SSHPublicKey
 	err = deployState.Save()
 	if err != nil {
 		return err
 	}
 
-	// pause as ssh might not be ready
-	time.Sleep(launchDelay)
-
 	// TODO: refactor this into another function
 
 	// install k3s on the VM
 	k3sVersion := deployConfig.K3sVersion
-	log.Info("installing k3s release ", k3sVersion)
-	k3sManager.Install(vmPublicIP, k3sVersion, deployConfig.Name)
+	err = runPhase(ctx, "installing k3s", installTimeout, func(ctx context.Context) error {
+
+		// pause as ssh might not be ready
+		err := sleep(ctx, launchDelay)
+		if err != nil {
+			return err
+		}
+
+		log.Info("installing k3s release ", k3sVersion)
+		if deployConfig.Image == "baked" {
+			return k3sManager.InstallBaked(ctx, vmPublicIP, k3sVersion, deployConfig.Name)
+		}
+		return k3sManager.Install(ctx, vmPublicIP, k3sVersion, deployConfig.Name)
+	})
+	if err != nil {
+		return err
+	}
 
 	// done, cluster up and running
 
@@ -256,11 +301,290 @@ func buildCluster() error {
 	}
 	log.Info("saved cluster details to 'deploy-state.yaml'")
 
+	// setup any registries the cluster should pull from
+	err = setupRegistries(deployConfig, deployState)
+	if err != nil {
+		return err
+	}
+
+	// create secrets app needs
+	err = applySecrets(deployConfig, deployState)
+	if err != nil {
+		return err
+	}
+
+	// have cluster pull manifests from git
+	err = bootstrapGitOps(deployConfig, deployState)
+	if err != nil {
+		return err
+	}
+
 	// TODO: what about installing ingress?
 
 	return nil
 }
 
+// resolveRegion translates the region in the deploy file to the name the cloud uses for it
+// the region is left alone if it is empty as the closest region is picked later
+func resolveRegion(cloudProvider provider.Provider, deployConfig *config.DeployConfig) error {
+
+	if len(deployConfig.Region) == 0 && len(deployConfig.Near) == 0 {
+		return nil
+	}
+	if cloudProvider.Regions == nil {
+		if len(deployConfig.Near) > 0 {
+			return fmt.Errorf("near is not supported on %s. set region in deploy file instead", cloudProvider.Name)
+		}
+		return nil
+	}
+
+	region, err := core.ResolveRegion(cloudProvider.Regions, deployConfig.Region, deployConfig.Near)
+	if err != nil {
+		return fmt.Errorf("invalid region for %s: %w", cloudProvider.Name, err)
+	}
+	if region != deployConfig.Region {
+		log.Info("using ", cloudProvider.Name, " region ", region)
+	}
+	deployConfig.Region = region
+
+	return nil
+}
+
+// resolveSize translates generic sizes in the deploy file (for the VM and any node pools) to the cloud's own sizes
+func resolveSize(cloudProvider provider.Provider, deployConfig *config.DeployConfig) error {
+
+	arch := deployConfig.Arch
+	if len(arch) > 0 && arch != "amd64" && arch != "arm64" {
+		return fmt.Errorf("invalid arch %s. use amd64 or arm64", arch)
+	}
+	if cloudProvider.Sizes == nil {
+		return nil
+	}
+
+	// without a size, the default size is swapped for the same size in the arch
+	if len(arch) > 0 && len(deployConfig.Size) == 0 && len(cloudProvider.DefaultSize) > 0 {
+		info, err := cloudProvider.Sizes.GetInfo(cloudProvider.DefaultSize)
+		if err == nil && info.Arch != arch {
+			deployConfig.Size = info.Name
+		}
+	}
+
+	resolve := func(size string) (string, error) {
+		if len(size) == 0 {
+			return size, nil
+		}
+		slug, err := core.ResolveSize(cloudProvider.Sizes, size, arch)
+		if err != nil {
+			return "", fmt.Errorf("invalid size for %s: %w", cloudProvider.Name, err)
+		}
+		info, err := cloudProvider.Sizes.GetInfo(slug)
+		if err == nil && len(arch) > 0 && info.Arch != arch {
+			return "", fmt.Errorf("size %s is %s but arch is %s", slug, info.Arch, arch)
+		}
+		return slug, nil
+	}
+
+	var err error
+	deployConfig.Size, err = resolve(deployConfig.Size)
+	if err != nil {
+		return err
+	}
+	for i := range deployConfig.NodePools {
+		deployConfig.NodePools[i].Size, err = resolve(deployConfig.NodePools[i].Size)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveImage works out which image to create the VM from
+// the os in the deploy file (or the cloud's default) is looked up for the arch of the VM's size.
+// clouds that can't list their images are given the os (ie ubuntu-24.04) and find the image themselves
+func resolveImage(ctx context.Context, cloudProvider provider.Provider, vmManager core.VMManager, deployConfig *config.DeployConfig) (string, error) {
+
+	osName := deployConfig.OS
+	if len(osName) == 0 {
+		osName = cloudProvider.DefaultImage
+	}
+	if len(osName) == 0 {
+		// note: plugins pick their own image
+		return "", nil
+	}
+	_, err := core.GetOperatingSystem(osName)
+	if err != nil {
+		return "", err
+	}
+	deployConfig.OS = osName
+
+	arch := sizeArch(cloudProvider, deployConfig)
+
+	lister, ok := core.Supports[core.ImageLister](vmManager)
+	if !ok {
+		return osName, nil
+	}
+
+	images, err := lister.ListImages(ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not get images from %s: %w", cloudProvider.Name, err)
+	}
+	image, err := core.FindImage(images, osName, arch)
+	if err != nil {
+		return "", fmt.Errorf("%s has %w", cloudProvider.Name, err)
+	}
+	log.Info("using ", osName, " image ", image.Slug)
+
+	return image.Slug, nil
+}
+
+// sizeArch returns the arch of the VM's size (or the arch in the deploy file if the size isn't in the catalog)
+func sizeArch(cloudProvider provider.Provider, deployConfig *config.DeployConfig) string {
+
+	if cloudProvider.Sizes != nil {
+		info, err := cloudProvider.Sizes.GetInfo(deployConfig.Size)
+		if err == nil {
+			return info.Arch
+		}
+	}
+	if len(deployConfig.Arch) > 0 {
+		return deployConfig.Arch
+	}
+
+	return "amd64"
+}
+
+// loadSSHKey loads the ssh key VMs are created with (creating one if needed)
+func loadSSHKey() (core.SSHKey, error) {
+
+	var sshKey core.SSHKey
+
+	dir, _ := homedir.Dir()
+	publicKeyFile := dir + "/.ssh/id_rsa.pub"
+
+	// see if file exists
+	_, err := os.Stat(publicKeyFile)
+	if os.IsNotExist(err) {
+		// need to generate an ssh key
+		err = sshKey.GenerateNewKey(publicKeyFile)
+		if err != nil {
+			return sshKey, err
+		}
+	}
+	err = sshKey.LoadPublicKey(publicKeyFile)
+	if err != nil {
+		return sshKey, err
+	}
+
+	return sshKey, nil
+}
+
+// newK3sManager creates a k3s manager with the releases that can be installed on the cloud
+// clouds used offline have their own list as releases can't be looked up
+func newK3sManager(ctx context.Context, cloudProvider provider.Provider) *k3s.Manager {
+
+	if cloudProvider.Releases != nil {
+		return &k3s.Manager{Releases: cloudProvider.Releases()}
+	}
+
+	return k3s.NewManager(ctx)
+}
+
+// waitForVM polls a newly created VM until it is running
+func waitForVM(ctx context.Context, vmManager core.VMManager, vmInfo core.VMInfo) (core.VMInfo, error) {
+
+	// all providers have their own status messages
+	// the only one we standardize is the final one
+	// provider needs to convert to "running"
+	vmID := vmInfo.ID
+	lastStatus := ""
+	for strings.Compare(vmInfo.Status, "running") != 0 {
+
+		// wait a bit
+		err := sleep(ctx, statusCheckDelay)
+		if err != nil {
+			return vmInfo, err
+		}
+		vmInfo, err = vmManager.GetVMInfo(ctx, vmID)
+		if err != nil {
+			return vmInfo, err
+		}
+
+		// print status if it has changed since last time
+		if strings.Compare(lastStatus, vmInfo.Status) != 0 {
+			log.Info("vm in ", vmInfo.Status, " state")
+			lastStatus = vmInfo.Status
+		}
+	}
+
+	return vmInfo, nil
+}
+
+// runPhase runs one step of a build with its own timeout
+// if the step is stopped part way, the error says why and which step it was
+func runPhase(ctx context.Context, phase string, timeout time.Duration, fn func(ctx context.Context) error) error {
+
+	phaseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(phaseCtx)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("build interrupted while %s", phase)
+	case ctx.Err() != nil:
+		return fmt.Errorf("build took longer than %s. timed out while %s", buildTimeout, phase)
+	case phaseCtx.Err() != nil:
+		return fmt.Errorf("timed out after %s while %s", timeout, phase)
+	}
+
+	return err
+}
+
+// sleep waits for the given time unless the context is done first
+func sleep(ctx context.Context, delay time.Duration) error {
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// offerRollback asks if what was created before a build was stopped should be deleted
+// if not, deploy-state.yaml is kept so it can be deleted later with 'eezhee teardown'
+func offerRollback(deployState *config.DeployState) {
+
+	// nothing was created yet
+	if len(deployState.ID) == 0 {
+		return
+	}
+
+	response := ""
+	fmt.Printf("%s was only partly built. roll back and delete it (y/N)? ", deployState.Name)
+	fmt.Scanln(&response)
+	if strings.ToLower(response) != "y" {
+		log.Info("saved details of what was built to 'deploy-state.yaml'. use 'eezhee teardown' to delete it")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	err := destroyCluster(ctx, deployState)
+	if err != nil {
+		log.Error("could not roll back: ", err)
+		log.Info("use 'eezhee teardown' to try again")
+		return
+	}
+	log.Info("rolled back")
+}
+
 // figure out what to call k3s cluster
 // based on combo of app name and git branch (if not master
 // eg webapp, webapp-staging, webapp-newFeatureBranch)
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// useFakeCloud sets up an empty home directory and an app directory that deploys to the fake cloud
+func useFakeCloud(t *testing.T) {
+
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	t.Setenv("HOME", t.TempDir())
+
+	// make sure no real cloud is used when listing
+	for _, name := range []string{"HCLOUD_TOKEN", "LINODE_CLI_TOKEN", "VULTR_API_KEY"} {
+		t.Setenv(name, "")
+	}
+
+	// deploy & state files are read from the current directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	err = os.WriteFile("deploy.yaml", []byte("name: webapp\ncloud: fake\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	AppConfig = config.NewAppConfig()
+	err = AppConfig.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// VMs on the fake cloud are ready right away
+	delays := []*time.Duration{&statusCheckDelay, &launchDelay}
+	for _, delay := range delays {
+		saved := *delay
+		*delay = time.Millisecond
+		t.Cleanup(func() { *delay = saved })
+	}
+
+	restartFakeCloud(t)
+}
+
+// restartFakeCloud makes the next command start a new fake cloud (and ssh server)
+// like it would if it was run in a new process
+func restartFakeCloud(t *testing.T) {
+
+	if fakeSSHServer != nil {
+		fakeSSHServer.Close()
+	}
+	fakeCloudOnce = sync.Once{}
+	fakeCloud, fakeSSHServer, fakeCloudError = nil, nil, nil
+
+	t.Cleanup(func() {
+		if fakeSSHServer != nil {
+			fakeSSHServer.Close()
+		}
+		fakeCloudOnce = sync.Once{}
+		fakeCloud, fakeSSHServer, fakeCloudError = nil, nil, nil
+	})
+}
+
+// captureOutput returns what fn printed
+func captureOutput(t *testing.T, fn func()) string {
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	fn()
+	os.Stdout = stdout
+	writer.Close()
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestBuildListTeardown(t *testing.T) {
+
+	useFakeCloud(t)
+	t.Setenv("EEZHEE_FAKE_LATENCY", "1ms")
+	ctx := context.Background()
+
+	err := buildCluster(ctx, config.NewDeployState())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k3s was installed over ssh and the kubeconfig saved
+	if !fakeSSHServer.Installed() {
+		t.Fatal("expected k3s to be installed. commands run: ", fakeSSHServer.Commands())
+	}
+	kubeConfig, err := os.ReadFile("kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(kubeConfig), "name: webapp") {
+		t.Fatal("expected kubeconfig context to be named after the app, got ", string(kubeConfig))
+	}
+
+	deployState := config.NewDeployState()
+	err = deployState.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployState.Cloud != "fake" || len(deployState.ID) == 0 || deployState.IP != "127.0.0.1" {
+		t.Fatalf("unexpected deploy state %+v", deployState)
+	}
+	if deployState.K3sVersion != "v1.30.5+k3s1" {
+		t.Fatal("expected stable release to be installed, got ", deployState.K3sVersion)
+	}
+
+	// the VM is saved so the next command can see it
+	home, _ := homedir.Dir()
+	data, err := os.ReadFile(filepath.Join(home, ".eezhee", "fake-cloud.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved struct {
+		VMs []struct{ Info core.VMInfo }
+	}
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.VMs) != 1 || saved.VMs[0].Info.ID != deployState.ID || saved.VMs[0].Info.Status != "running" {
+		t.Fatalf("expected running VM %s in fake cloud state, got %+v", deployState.ID, saved.VMs)
+	}
+
+	restartFakeCloud(t)
+	output := captureOutput(t, func() { listVMs(ctx) })
+	if !strings.Contains(output, "webapp ("+deployState.ID+")  status: running") {
+		t.Fatal("expected cluster to be listed, got ", output)
+	}
+
+	// answer the prompt
+	restartFakeCloud(t)
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.WriteString("y\n")
+	writer.Close()
+	stdin := os.Stdin
+	os.Stdin = reader
+	t.Cleanup(func() { os.Stdin = stdin })
+
+	captureOutput(t, func() { err = teardownVM(ctx) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployState.FileExists() {
+		t.Fatal("expected deploy state to be removed")
+	}
+	if _, err := os.Stat("kubeconfig"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected kubeconfig to be removed")
+	}
+
+	vms, err := fakeCloud.ListVMs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 0 {
+		t.Fatalf("expected VM to be deleted, got %+v", vms)
+	}
+}
+
+func TestBuildFailure(t *testing.T) {
+
+	useFakeCloud(t)
+	t.Setenv("EEZHEE_FAKE_FAIL", "CreateVM=quota")
+
+	err := buildCluster(context.Background(), config.NewDeployState())
+	if !errors.Is(err, core.ErrQuota) {
+		t.Fatal("expected quota error, got ", err)
+	}
+
+	// nothing was created so there is nothing to roll back
+	if config.NewDeployState().FileExists() {
+		t.Fatal("expected no deploy state")
+	}
+	if fakeSSHServer.Installed() {
+		t.Fatal("expected k3s not to be installed")
+	}
+}
+
+func TestInvalidFakeSettings(t *testing.T) {
+
+	useFakeCloud(t)
+	t.Setenv("EEZHEE_FAKE_FAIL", "CreateVM=flaky")
+
+	_, err := GetManager("fake")
+	if err == nil || !strings.Contains(err.Error(), "EEZHEE_FAKE_FAIL") {
+		t.Fatal("expected invalid EEZHEE_FAKE_FAIL error, got ", err)
+	}
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var catalogOutput string
+
+func init() {
+	rootCmd.AddCommand(catalogCmd)
+	catalogCmd.AddCommand(catalogRefreshCmd)
+	catalogCmd.AddCommand(catalogDiffCmd)
+	catalogDiffCmd.Flags().StringVarP(&catalogOutput, "output", "o", "table", "output format (table or json)")
+}
+
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Update the regions and sizes eezhee knows about",
+	Long: `The regions and VM sizes of each cloud are compiled into eezhee.  'eezhee catalog refresh' gets the latest
+from the clouds' apis and keeps them in ~/.eezhee/catalog-cache.yaml, which is used instead of what is compiled in`,
+}
+
+var catalogRefreshCmd = &cobra.Command{
+	Use:   "refresh [cloud...]",
+	Short: "Get the latest regions, sizes and images from the clouds",
+	Long: `Get the latest regions, sizes and images from each cloud's api and save them in the catalog cache.
+Sizes are filtered to the families eezhee supports and regions to the ones that are available.
+Without a cloud, every configured cloud whose api can list its sizes is refreshed (digitalocean, hetzner, linode and vultr)`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := refreshCatalog(cmd.Context(), args)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var catalogDiffCmd = &cobra.Command{
+	Use:   "diff [cloud...]",
+	Short: "Show what changed since the catalog compiled into eezhee",
+	Long: `Compare the catalog cache with the catalog compiled into eezhee.  Shows new and retired regions,
+new and retired sizes and price changes.  New regions in a city eezhee doesn't know about can't be used
+until the city is added to the catalog`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := diffCatalog(args)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// refreshCatalog gets the latest catalog of each cloud and saves it in the cache
+func refreshCatalog(ctx context.Context, clouds []string) error {
+
+	cache, err := core.LoadCatalogCache()
+	if err != nil {
+		log.Debug("starting a new catalog cache. ", err)
+	}
+	if !cache.Current() && len(cache.Clouds) > 0 {
+		// clouds that aren't refreshed now would be out of date
+		log.Info("catalog cache was refreshed with another version of eezhee. starting a new one")
+		cache.Clouds = map[string]core.CloudCatalog{}
+	}
+
+	explicit := len(clouds) > 0
+	if !explicit {
+		clouds = provider.List()
+	}
+
+	var refreshed int
+	for _, name := range clouds {
+		cloudCatalog, err := fetchCloudCatalog(ctx, name)
+		if err != nil {
+			if explicit {
+				return err
+			}
+			log.Debug("skipping ", name, ": ", err)
+			continue
+		}
+		cache.Clouds[name] = cloudCatalog
+		refreshed++
+		log.Info(fmt.Sprintf("%s has %d regions, %d sizes and %d images", name,
+			len(cloudCatalog.Regions), len(cloudCatalog.Sizes), len(cloudCatalog.Images)))
+	}
+	if refreshed == 0 {
+		return errors.New("no clouds could be refreshed. add one with 'eezhee clouds'")
+	}
+
+	err = cache.Save()
+	if err != nil {
+		return fmt.Errorf("could not save catalog cache: %w", err)
+	}
+	log.Info("use 'eezhee catalog diff' to see what changed")
+
+	return nil
+}
+
+// fetchCloudCatalog gets a cloud's regions, sizes & images from its api
+func fetchCloudCatalog(ctx context.Context, name string) (core.CloudCatalog, error) {
+
+	cloudProvider, err := provider.Get(name)
+	if err != nil {
+		return core.CloudCatalog{}, err
+	}
+	if cloudProvider.Sizes == nil {
+		return core.CloudCatalog{}, fmt.Errorf("%s isn't in the catalog", name)
+	}
+
+	vmManager, err := GetManager(name)
+	if err != nil {
+		return core.CloudCatalog{}, err
+	}
+	regionLister, listsRegions := core.Supports[core.RegionLister](vmManager)
+	sizeLister, listsSizes := core.Supports[core.SizeLister](vmManager)
+	if !listsRegions || !listsSizes {
+		return core.CloudCatalog{}, fmt.Errorf("%s api can't list its regions and sizes so the built in catalog is used", name)
+	}
+
+	regions, err := regionLister.ListRegions(ctx)
+	if err != nil {
+		return core.CloudCatalog{}, fmt.Errorf("could not get regions from %s: %w", name, err)
+	}
+	sizes, err := sizeLister.ListSizes(ctx)
+	if err != nil {
+		return core.CloudCatalog{}, fmt.Errorf("could not get sizes from %s: %w", name, err)
+	}
+	var images []core.ImageInfo
+	if imageLister, ok := core.Supports[core.ImageLister](vmManager); ok {
+		images, err = imageLister.ListImages(ctx)
+		if err != nil {
+			return core.CloudCatalog{}, fmt.Errorf("could not get images from %s: %w", name, err)
+		}
+	}
+
+	return core.NewCloudCatalog(name, regions, sizes, images)
+}
+
+// diffCatalog shows what changed in each refreshed cloud
+func diffCatalog(clouds []string) error {
+
+	if catalogOutput != "table" && catalogOutput != "json" {
+		return fmt.Errorf("invalid output format %s. use table or json", catalogOutput)
+	}
+
+	cache, err := core.LoadCatalogCache()
+	if err != nil {
+		return err
+	}
+	if len(cache.Clouds) == 0 {
+		return errors.New("no clouds have been refreshed. use 'eezhee catalog refresh'")
+	}
+	if !cache.Current() {
+		log.Warn("catalog cache was refreshed with another version of eezhee so isn't used. run 'eezhee catalog refresh'")
+	}
+
+	if len(clouds) == 0 {
+		for name := range cache.Clouds {
+			clouds = append(clouds, name)
+		}
+		sort.Strings(clouds)
+	}
+
+	var diffs []core.CatalogDiff
+	for _, name := range clouds {
+		cloudCatalog, found := cache.Clouds[name]
+		if !found {
+			return fmt.Errorf("%s hasn't been refreshed. use 'eezhee catalog refresh %s'", name, name)
+		}
+		diff, err := core.DiffCatalog(name, cloudCatalog)
+		if err != nil {
+			return err
+		}
+		diffs = append(diffs, diff)
+	}
+
+	if catalogOutput == "json" {
+		return printJSON(diffs)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "CLOUD\tCHANGE\tNAME\tDETAILS")
+	for _, diff := range diffs {
+		if diff.Empty() {
+			fmt.Fprintf(writer, "%s\tnone\t-\trefreshed %s\n", diff.Cloud, diff.Refreshed.Format(time.RFC3339))
+			continue
+		}
+		for _, region := range diff.NewRegions {
+			city := region.City
+			if len(city) == 0 {
+				city = "city not in catalog"
+			}
+			fmt.Fprintf(writer, "%s\tnew region\t%s\t%s (%s)\n", diff.Cloud, region.Slug, region.Name, city)
+		}
+		for _, region := range diff.RetiredRegions {
+			fmt.Fprintf(writer, "%s\tretired region\t%s\t%s\n", diff.Cloud, region.Slug, region.Name)
+		}
+		for _, size := range diff.NewSizes {
+			fmt.Fprintf(writer, "%s\tnew size\t%s\t%s %s %s/month\n", diff.Cloud, size.Slug, size.Name, size.Arch, formatCloudPrice(diff.Cloud, size.PriceMonthly))
+		}
+		for _, size := range diff.RetiredSizes {
+			fmt.Fprintf(writer, "%s\tretired size\t%s\t%s %s\n", diff.Cloud, size.Slug, size.Name, size.Arch)
+		}
+		for _, change := range diff.PriceChanges {
+			fmt.Fprintf(writer, "%s\tprice\t%s\t%s -> %s/month\n", diff.Cloud, change.Size, formatCloudPrice(diff.Cloud, change.OldPrice), formatCloudPrice(diff.Cloud, change.NewPrice))
+		}
+	}
+	writer.Flush()
+
+	return nil
+}
@@ -3,22 +3,36 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"strings"
 
+	"github.com/eezhee/eezhee/pkg/aws"
+	"github.com/eezhee/eezhee/pkg/azure"
+	"github.com/eezhee/eezhee/pkg/cloudflare"
 	"github.com/eezhee/eezhee/pkg/core"
-	"github.com/eezhee/eezhee/pkg/digitalocean"
-	"github.com/eezhee/eezhee/pkg/linode"
-	"github.com/eezhee/eezhee/pkg/vultr"
+	"github.com/eezhee/eezhee/pkg/gcp"
+	"github.com/eezhee/eezhee/pkg/provider"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var gcpProject string
+var azureTenantID, azureClientID, azureClientSecret string
+var azureSubscription string // set once credentials validated
+
 func init() {
 	rootCmd.AddCommand(cloudsCmd)
 	cloudsCmd.AddCommand(listCloudsCmd)
+	cloudsCmd.AddCommand(awsProfileCmd)
 	cloudsCmd.AddCommand(digitaloceanApiKeyCmd)
+	cloudsCmd.AddCommand(azureCmd)
+	cloudsCmd.AddCommand(gcpCredentialsCmd)
+	cloudsCmd.AddCommand(hetznerApiKeyCmd)
 	cloudsCmd.AddCommand(linodeApiKeyCmd)
 	cloudsCmd.AddCommand(vultrApiKeyCmd)
+	cloudsCmd.AddCommand(cloudflareApiKeyCmd)
+	azureCmd.Flags().StringVar(&azureTenantID, "tenant-id", "", "tenant of service principal")
+	azureCmd.Flags().StringVar(&azureClientID, "client-id", "", "client (app) id of service principal (default use azure cli login)")
+	azureCmd.Flags().StringVar(&azureClientSecret, "client-secret", "", "secret of service principal")
+	gcpCredentialsCmd.Flags().StringVar(&gcpProject, "project", "", "gcp project to use (default project of credentials or gcloud config)")
 }
 
 var cloudsCmd = &cobra.Command{
@@ -38,12 +52,11 @@ var listCloudsCmd = &cobra.Command{
 
 		// go through each cloud and see if enabled
 		numEnabled := 0
-		clouds := []string{"digitalocean", "linode", "vultr"}
-		for _, cloud := range clouds {
+		for _, cloud := range provider.List() {
 			_, err := GetManager(cloud)
 			if err == nil {
 				fmt.Println("  ", cloud)
-				// _, err := manager.ListVMs()
+				// _, err := manager.ListVMs(cmd.Context())
 				numEnabled = numEnabled + 1
 			}
 
@@ -53,11 +66,20 @@ var listCloudsCmd = &cobra.Command{
 		}
 
 		if numEnabled == 0 {
-			fmt.Println("no clouds enabled.  use `eezhee clouds [digitalocean|linode|vultr] [api_key]` to set")
+			fmt.Println("no clouds enabled.  use `eezhee clouds [digitalocean|hetzner|linode|vultr] [api_key]` or `eezhee clouds [aws|azure|gcp]` to set")
 		}
 	},
 }
 
+var awsProfileCmd = &cobra.Command{
+	Use:   "aws [profile]",
+	Short: "Enable aws ",
+	Long: `Enable aws.  Credentials come from the standard aws chain (environment variables,
+~/.aws/credentials or the given profile)`,
+	Args: validateAWSArguments,
+	Run:  saveApiKey,
+}
+
 var digitaloceanApiKeyCmd = &cobra.Command{
 	Use:     "digitalocean [api_key]",
 	Aliases: []string{"do"},
@@ -67,6 +89,32 @@ var digitaloceanApiKeyCmd = &cobra.Command{
 	Run:     saveApiKey,
 }
 
+var azureCmd = &cobra.Command{
+	Use:   "azure [subscription_id]",
+	Short: "Enable azure ",
+	Long: `Enable azure.  Uses the azure cli login (az login) unless a service principal is given.
+If no subscription is given, the default subscription of the azure cli is used`,
+	Args: validateAzureArguments,
+	Run:  saveApiKey,
+}
+
+var gcpCredentialsCmd = &cobra.Command{
+	Use:   "gcp [credentials_file]",
+	Short: "Enable gcp ",
+	Long: `Enable gcp.  Uses the given service account json file or, if none given,
+application-default credentials (gcloud auth application-default login)`,
+	Args: validateGCPArguments,
+	Run:  saveApiKey,
+}
+
+var hetznerApiKeyCmd = &cobra.Command{
+	Use:   "hetzner [api_key]",
+	Short: "Set hetzner api token ",
+	Long:  `Set hetzner cloud api token eezhee should use`,
+	Args:  validateArguments,
+	Run:   saveApiKey,
+}
+
 var linodeApiKeyCmd = &cobra.Command{
 	Use:   "linode [api_key]",
 	Short: "Set linode api key ",
@@ -83,6 +131,14 @@ var vultrApiKeyCmd = &cobra.Command{
 	Run:   saveApiKey,
 }
 
+var cloudflareApiKeyCmd = &cobra.Command{
+	Use:   "cloudflare [api_key]",
+	Short: "Set cloudflare api token ",
+	Long:  `Set cloudflare api token eezhee should use to manage dns records`,
+	Args:  validateDNSArguments,
+	Run:   saveApiKey,
+}
+
 // validateArguments will make sure api key is valid
 func validateArguments(cmd *cobra.Command, args []string) (err error) {
 
@@ -97,32 +153,128 @@ func validateArguments(cmd *cobra.Command, args []string) (err error) {
 	apiKey := args[0]
 
 	// need to know which cloud
-	var manager core.VMManager
-	if strings.HasPrefix(cmd.Use, "digitalocean") || strings.HasPrefix(cmd.Use, "do") {
-		manager, err = digitalocean.NewManager(apiKey)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(cmd.Use, "linode") {
-		manager, err = linode.NewManager(apiKey)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(cmd.Use, "vultr") {
-		manager, err = vultr.NewManager(apiKey)
-		if err != nil {
-			return err
-		}
-	} else {
+	cloudProvider, err := provider.Get(cmd.Name())
+	if err != nil || cloudProvider.SetCredentials == nil {
 		// cobra will make sure this never is allowed
 		// ie this code should never be called
-		log.Error("invalid cloud name")
+		return errors.New("invalid cloud name")
 	}
 
-	// validate api key
-	_, err = manager.ListVMs()
+	// try the key without touching the real app config
+	appConfig := *AppConfig
+	cloudProvider.SetCredentials(&appConfig, apiKey)
+	manager, err := cloudProvider.New(&appConfig)
 	if err != nil {
+		return err
+	}
+
+	// validate api key
+	_, err = core.WithRetry(manager, core.DefaultRetryPolicy).ListVMs(cmd.Context())
+	if errors.Is(err, core.ErrAuth) {
 		return errors.New("invalid api key specified")
+	} else if err != nil {
+		return fmt.Errorf("could not validate api key: %w", err)
+	}
+
+	return nil
+}
+
+// validateAWSArguments will make sure aws accepts the credentials for the profile
+func validateAWSArguments(cmd *cobra.Command, args []string) (err error) {
+
+	if len(args) > 1 {
+		return errors.New("too many arguments specified. only a profile name is allowed")
+	}
+
+	profile := "default"
+	if len(args) == 1 {
+		profile = args[0]
+	}
+
+	manager, err := aws.NewManager(profile)
+	if err != nil {
+		return err
+	}
+
+	// validate credentials
+	err = manager.(*aws.Manager).ValidateCredentials()
+	if err != nil {
+		return fmt.Errorf("invalid aws credentials: %w", err)
+	}
+
+	return nil
+}
+
+// validateAzureArguments will make sure azure accepts the credentials
+func validateAzureArguments(cmd *cobra.Command, args []string) (err error) {
+
+	if len(args) > 1 {
+		return errors.New("too many arguments specified. only a subscription id is allowed")
+	}
+
+	subscription := ""
+	if len(args) == 1 {
+		subscription = args[0]
+	}
+
+	manager, err := azure.NewManager(subscription, azureTenantID, azureClientID, azureClientSecret)
+	if err != nil {
+		return err
+	}
+
+	// validate credentials
+	_, err = manager.ListVMs(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("invalid azure credentials: %w", err)
+	}
+	azureSubscription = manager.(*azure.Manager).SubscriptionID
+
+	return nil
+}
+
+// validateGCPArguments will make sure gcp accepts the credentials
+func validateGCPArguments(cmd *cobra.Command, args []string) (err error) {
+
+	if len(args) > 1 {
+		return errors.New("too many arguments specified. only a credentials file is allowed")
+	}
+
+	credentials := "default"
+	if len(args) == 1 {
+		credentials = args[0]
+	}
+
+	manager, err := gcp.NewManager(credentials, gcpProject)
+	if err != nil {
+		return err
+	}
+
+	// validate credentials
+	_, err = manager.ListVMs(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("invalid gcp credentials: %w", err)
+	}
+
+	return nil
+}
+
+// validateDNSArguments will make sure dns provider api key is valid
+func validateDNSArguments(cmd *cobra.Command, args []string) (err error) {
+
+	// make sure only one argument
+	if len(args) != 1 {
+		return errors.New("an api token is required")
+	}
+
+	manager, err := cloudflare.NewDNSManager(args[0])
+	if err != nil {
+		return err
+	}
+
+	// validate api key
+	err = manager.Verify()
+	if err != nil {
+		return errors.New("invalid api token specified")
 	}
 
 	return nil
@@ -132,26 +284,32 @@ func validateArguments(cmd *cobra.Command, args []string) (err error) {
 func saveApiKey(cmd *cobra.Command, args []string) {
 
 	// get api key user provided
-	apiKey := args[0]
+	// note: aws profile is optional
+	apiKey := "default"
+	if len(args) > 0 {
+		apiKey = args[0]
+	}
 
 	// store api key in app config
 	// need to know which cloud
-	if strings.HasPrefix(cmd.Use, "digitalocean") || strings.HasPrefix(cmd.Use, "do") {
-		AppConfig.DigitalOceanAPIKey = apiKey
-	} else if strings.HasPrefix(cmd.Use, "linode") {
-		AppConfig.LinodeAPIKey = apiKey
-	} else if strings.HasPrefix(cmd.Use, "vultr") {
-		AppConfig.VultrAPIKey = apiKey
+	if cmd.Name() == "cloudflare" {
+		// dns provider rather than a cloud
+		AppConfig.CloudFlareAPIKey = apiKey
 	} else {
-		// cobra will make sure this never is allowed
-		// ie this code should never be called
-		log.Error("invalid cloud name")
+		cloudProvider, err := provider.Get(cmd.Name())
+		if err != nil || cloudProvider.SetCredentials == nil {
+			// cobra will make sure this never is allowed
+			// ie this code should never be called
+			log.Error("invalid cloud name")
+			return
+		}
+		cloudProvider.SetCredentials(AppConfig, apiKey)
 	}
 
 	// now save to disk
 	err := AppConfig.Save()
 	if err != nil {
-		log.Error("could not save api key to config file")
+		log.Error("could not save api key. ", err)
 		return
 	}
 
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/sshcloud"
+)
+
+// loadDeployState will load the state of the cluster running in the current directory
+func loadDeployState() (*config.DeployState, error) {
+
+	// see if there is a state file (so we know which cluster to talk to)
+	deployState := config.NewDeployState()
+	if !deployState.FileExists() {
+		return nil, errors.New("app is not deployed. use 'eezhee build' first")
+	}
+
+	err := deployState.Load()
+	if err != nil {
+		return nil, errors.New("error reading deploy state file")
+	}
+
+	return deployState, nil
+}
+
+// getClusterNodes returns the public IP of every node in the cluster
+func getClusterNodes(deployState *config.DeployState) ([]string, error) {
+
+	// we can't ssh into the nodes of a managed cluster
+	if deployState.Type == "managed" {
+		return nil, errors.New("not supported on managed clusters as it needs ssh access to the nodes")
+	}
+
+	// clusters are currently a single VM
+	if len(deployState.IP) == 0 {
+		return nil, errors.New("deploy state file does not have an IP for the cluster")
+	}
+
+	// servers we didn't create might need a different login
+	if deployState.Cloud == "ssh" {
+		servers, err := loadSSHServers()
+		if err != nil {
+			return nil, err
+		}
+		sshcloud.SetLogins(servers)
+	}
+
+	return []string{deployState.IP}, nil
+}
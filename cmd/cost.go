@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var costCloud string
+var costCompare bool
+var costMaxLatency time.Duration
+var costShape core.ClusterShape // volumes, load balancers & transfer come from flags
+var costOutput string
+
+func init() {
+	rootCmd.AddCommand(costCmd)
+	costCmd.Flags().StringVar(&costCloud, "cloud", "", "cloud to price cluster on (default cloud in deploy file or default cloud)")
+	costCmd.Flags().BoolVar(&costCompare, "compare", false, "price the cluster on every configured cloud and region")
+	costCmd.Flags().DurationVar(&costMaxLatency, "max-latency", 100*time.Millisecond, "with --compare, only use regions this close (0 for any region)")
+	costCmd.Flags().IntVar(&costShape.VolumeGB, "volume-gb", 0, "GB of block storage the cluster uses")
+	costCmd.Flags().IntVar(&costShape.LoadBalancers, "load-balancers", 0, "number of cloud load balancers the cluster uses")
+	costCmd.Flags().IntVar(&costShape.TransferGB, "transfer-gb", 0, "GB of outbound transfer per month")
+	costCmd.Flags().StringVarP(&costOutput, "output", "o", "table", "output format (table or json)")
+}
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Estimate the monthly cost of the cluster",
+	Long: `Estimate the monthly cost of the cluster described in deploy.yaml using the prices built into eezhee.
+VMs (and managed control planes) are always counted. Add volumes, load balancers and transfer with flags.
+With --compare, the same generic shape (ie 2cpu4gb) is priced on every configured cloud and the cheapest
+region within --max-latency is recommended. Prices are list prices in USD and don't vary by region.
+Clouds that bill in another currency (ie hetzner in euros) are converted at the rate in the price catalog`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := estimateCost(cmd.Context())
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// placement is a cloud & region a cluster could be deployed to
+type placement struct {
+	Cloud      string            `json:"cloud"`
+	Region     string            `json:"region"`
+	RegionName string            `json:"region_name"`
+	Sizes      []string          `json:"sizes"`
+	LatencyMS  int64             `json:"latency_ms,omitempty"` // missing if latency not measured
+	Estimate   core.CostEstimate `json:"estimate"`
+}
+
+// estimateCost prints the cost of the cluster in the deploy file
+func estimateCost(ctx context.Context) error {
+
+	if costOutput != "table" && costOutput != "json" {
+		return fmt.Errorf("invalid output format %s. use table or json", costOutput)
+	}
+
+	deployConfig := config.NewDeployConfig()
+	if deployConfig.FileExists() {
+		err := deployConfig.Load()
+		if err != nil {
+			return err
+		}
+	}
+	cloudProvider, err := selectCloud(costCloud, deployConfig)
+	if err != nil {
+		return err
+	}
+	deployConfig.Cloud = cloudProvider.Name
+
+	err = resolveSize(cloudProvider, deployConfig)
+	if err != nil {
+		return err
+	}
+	shape, err := getClusterShape(cloudProvider, deployConfig)
+	if err != nil {
+		return err
+	}
+
+	if costCompare {
+		return comparePlacements(ctx, cloudProvider, shape)
+	}
+
+	estimate, err := core.EstimateCost(cloudProvider.Name, cloudProvider.Sizes, shape)
+	if err != nil {
+		return err
+	}
+
+	if costOutput == "json" {
+		return printJSON(estimate)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ITEM\tQUANTITY\tPRICE\tMONTHLY")
+	for _, item := range estimate.Items {
+		fmt.Fprintf(writer, "%s\t%g%s\t%s\t%s\n", item.Name, item.Quantity, item.Unit,
+			formatPrice(item.UnitPrice), formatPrice(item.Monthly))
+	}
+	fmt.Fprintf(writer, "total (%s)\t\t\t%s\n", estimate.Cloud, formatPrice(estimate.Monthly))
+	writer.Flush()
+	if len(estimate.ConvertedFrom) > 0 {
+		fmt.Printf("\n%s prices converted from %s at %g USD\n", estimate.Cloud, estimate.ConvertedFrom, estimate.ExchangeRate)
+	}
+
+	return nil
+}
+
+// getClusterShape works out the VMs the cluster in the deploy file would have
+func getClusterShape(cloudProvider provider.Provider, deployConfig *config.DeployConfig) (core.ClusterShape, error) {
+
+	shape := costShape
+
+	switch deployConfig.Type {
+	case "", "k3s":
+		size := deployConfig.Size
+		if len(size) == 0 {
+			size = cloudProvider.DefaultSize
+		}
+		shape.Nodes = []core.NodePool{{Name: deployConfig.Name, Size: size, Count: 1}}
+	case "managed":
+		shape.Managed = true
+		shape.Nodes = getNodePools(deployConfig)
+	default:
+		return shape, errors.New("invalid cluster type. use 'k3s' or 'managed'")
+	}
+
+	return shape, nil
+}
+
+// comparePlacements prices the cluster on every configured cloud and recommends the cheapest region
+// sizes are translated to generic sizes so the same shape is priced everywhere
+func comparePlacements(ctx context.Context, cloudProvider provider.Provider, shape core.ClusterShape) error {
+
+	var genericSizes, archs []string
+	for _, pool := range shape.Nodes {
+		if cloudProvider.Sizes == nil {
+			return fmt.Errorf("%s sizes are not in catalog so can't be compared", cloudProvider.Name)
+		}
+		info, err := cloudProvider.Sizes.GetInfo(pool.Size)
+		if err != nil {
+			return err
+		}
+		genericSizes = append(genericSizes, info.Name)
+		archs = append(archs, info.Arch)
+	}
+	log.Info("comparing ", strings.Join(genericSizes, ", "), " on every configured cloud")
+
+	var placements []placement
+	var unmeasured []string
+	for _, name := range provider.List() {
+		cloud, err := provider.Get(name)
+		if err != nil || cloud.Sizes == nil || cloud.Regions == nil {
+			continue
+		}
+		vmManager, err := cloud.New(AppConfig)
+		if err != nil {
+			continue
+		}
+		if _, ok := vmManager.(core.ClusterManager); shape.Managed && !ok {
+			continue
+		}
+
+		// same shape using the cloud's sizes
+		cloudShape := shape
+		cloudShape.Nodes = nil
+		var sizes []string
+		for i, pool := range shape.Nodes {
+			pool.Size, err = core.ResolveSize(cloud.Sizes, genericSizes[i], archs[i])
+			if err != nil {
+				break
+			}
+			cloudShape.Nodes = append(cloudShape.Nodes, pool)
+			sizes = append(sizes, pool.Size)
+		}
+		if err != nil {
+			log.Debug("skipping ", name, ": ", err)
+			continue
+		}
+		estimate, err := core.EstimateCost(name, cloud.Sizes, cloudShape)
+		if err != nil {
+			log.Debug("skipping ", name, ": ", err)
+			continue
+		}
+
+		regions, err := cloud.Regions.GetList()
+		if err != nil {
+			return err
+		}
+		latencies := measureLatency(ctx, cloud)
+		if latencies == nil && costMaxLatency > 0 {
+			unmeasured = append(unmeasured, name)
+			continue
+		}
+		for _, region := range regions {
+			latency, measured := latencies[region.Slug]
+			if costMaxLatency > 0 && (!measured || latency > costMaxLatency) {
+				continue
+			}
+			placements = append(placements, placement{
+				Cloud:      name,
+				Region:     region.Slug,
+				RegionName: region.Name,
+				Sizes:      sizes,
+				LatencyMS:  latency.Milliseconds(),
+				Estimate:   estimate,
+			})
+		}
+	}
+	if len(unmeasured) > 0 {
+		log.Warn("latency to ", strings.Join(unmeasured, ", "), " regions can't be measured so they are left out. use --max-latency 0 to include them")
+	}
+	if len(placements) == 0 {
+		return fmt.Errorf("no configured cloud has a region within %s. try a larger --max-latency", costMaxLatency)
+	}
+
+	// cheapest first, then closest
+	sort.SliceStable(placements, func(i, j int) bool {
+		if placements[i].Estimate.Monthly != placements[j].Estimate.Monthly {
+			return placements[i].Estimate.Monthly < placements[j].Estimate.Monthly
+		}
+		return placements[i].LatencyMS < placements[j].LatencyMS
+	})
+
+	if costOutput == "json" {
+		return printJSON(placements)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "CLOUD\tREGION\tNAME\tSIZE\tLATENCY\tMONTHLY")
+	for _, option := range placements {
+		latency := "-"
+		if option.LatencyMS > 0 {
+			latency = (time.Duration(option.LatencyMS) * time.Millisecond).String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", option.Cloud, option.Region, option.RegionName,
+			strings.Join(option.Sizes, ","), latency, formatPrice(option.Estimate.Monthly))
+	}
+	writer.Flush()
+
+	converted := map[string]bool{}
+	for _, option := range placements {
+		estimate := option.Estimate
+		if len(estimate.ConvertedFrom) > 0 && !converted[option.Cloud] {
+			fmt.Printf("\n%s prices converted from %s at %g USD\n", option.Cloud, estimate.ConvertedFrom, estimate.ExchangeRate)
+			converted[option.Cloud] = true
+		}
+	}
+
+	best := placements[0]
+	fmt.Printf("\ncheapest: %s in %s (%s) for %s/month\n", best.Cloud, best.Region,
+		strings.Join(best.Sizes, ","), formatPrice(best.Estimate.Monthly))
+	fmt.Printf("use 'cloud: %s', 'region: %s' and 'size: %s' in deploy.yaml\n", best.Cloud, best.Region, best.Sizes[0])
+
+	return nil
+}
+
+// measureLatency gets the latency to each of a cloud's regions
+// nil if the cloud has no hosts to probe (or none could be reached)
+func measureLatency(ctx context.Context, cloudProvider provider.Provider) map[string]time.Duration {
+
+	catalog, ok := cloudProvider.Regions.(*core.RegionCatalog)
+	if !ok || len(catalog.PingHosts) == 0 {
+		return nil
+	}
+
+	ranked, err := core.RankRegions(ctx, cloudProvider.Name, catalog.PingHosts)
+	if err != nil {
+		log.Warn("could not measure latency to ", cloudProvider.Name, ": ", err)
+		return nil
+	}
+
+	latencies := map[string]time.Duration{}
+	for _, latency := range ranked {
+		if latency.Reachable() {
+			latencies[latency.ID] = latency.Latency
+		}
+	}
+
+	return latencies
+}
+
+// formatPrice shows a price in dollars
+func formatPrice(price float32) string {
+	return fmt.Sprintf("$%.2f", price)
+}
+
+// formatCloudPrice shows a price in the currency the cloud bills in
+func formatCloudPrice(cloud string, price float32) string {
+
+	cloudPrices, err := core.GetPrices(cloud)
+	if err != nil || len(cloudPrices.Currency) == 0 || cloudPrices.Currency == "USD" {
+		return formatPrice(price)
+	}
+
+	return fmt.Sprintf("%.2f %s", price, cloudPrices.Currency)
+}
+
+// printJSON prints a value as indented json
+func printJSON(value interface{}) error {
+
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	return nil
+}
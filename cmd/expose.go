@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/k3s"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exposePort      int
+	exposeHost      string
+	exposeNamespace string
+	exposeForce     bool
+)
+
+func init() {
+	rootCmd.AddCommand(exposeCmd)
+	rootCmd.AddCommand(unexposeCmd)
+	exposeCmd.Flags().IntVarP(&exposePort, "port", "p", 80, "port the deployment listens on")
+	exposeCmd.Flags().StringVar(&exposeHost, "host", "", "hostname to publish deployment as (default <deployment>.<ip>.sslip.io)")
+	exposeCmd.Flags().StringVarP(&exposeNamespace, "namespace", "n", "default", "namespace of the deployment")
+	exposeCmd.Flags().BoolVar(&exposeForce, "force", false, "point an existing dns record eezhee didn't create at the cluster")
+	unexposeCmd.Flags().StringVarP(&exposeNamespace, "namespace", "n", "default", "namespace of the deployment")
+	unexposeCmd.Flags().BoolVar(&exposeForce, "force", false, "delete the dns record even if it was changed outside of eezhee")
+}
+
+var exposeCmd = &cobra.Command{
+	Use:   "expose [deployment]",
+	Short: "Publish a deployment to the internet",
+	Long: `Create a service and ingress for a deployment, point dns for the host at the cluster
+and request a Let's Encrypt certificate for it`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := exposeDeployment(args[0])
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var unexposeCmd = &cobra.Command{
+	Use:   "unexpose [deployment]",
+	Short: "Stop publishing a deployment",
+	Long:  `Remove the service, ingress and dns record created by 'eezhee expose'`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := unexposeDeployment(args[0])
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// exposeDeployment will make a deployment reachable at https://host
+func exposeDeployment(deployment string) error {
+
+	if exposePort < 1 || exposePort > 65535 {
+		return errors.New("invalid port")
+	}
+
+	deployState, err := loadDeployState()
+	if err != nil {
+		return err
+	}
+	nodes, err := getClusterNodes(deployState)
+	if err != nil {
+		return err
+	}
+
+	// sslip.io resolves to the ip in the name so no dns changes needed
+	host := exposeHost
+	if len(host) == 0 {
+		host = deployment + "." + nodes[0] + ".sslip.io"
+	}
+	if !k3s.ValidHost(host) {
+		return fmt.Errorf("invalid host: %s", host)
+	}
+
+	service := config.ExposedService{
+		Deployment: deployment,
+		Namespace:  exposeNamespace,
+		Port:       exposePort,
+		Host:       host,
+	}
+
+	// point dns at the cluster first so Let's Encrypt can reach us
+	if len(exposeHost) > 0 {
+		service.DNSRecord, err = updateDNSRecord(host, nodes[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := k3s.Connect(nodes[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = k3s.Expose(conn, exposeNamespace, deployment, exposePort, host, AppConfig.ACMEEmail)
+	if err != nil {
+		return err
+	}
+
+	// remember what we did so unexpose can undo it
+	exposed := []config.ExposedService{service}
+	for _, existing := range deployState.Exposed {
+		if existing.Deployment != deployment || existing.Namespace != exposeNamespace {
+			exposed = append(exposed, existing)
+		}
+	}
+	deployState.Exposed = exposed
+	err = deployState.Save()
+	if err != nil {
+		return err
+	}
+
+	log.Info(deployment, " available at https://", host)
+	return nil
+}
+
+// updateDNSRecord will point host at the given ip
+// returns the id of the record if we created it
+func updateDNSRecord(host string, ipAddress string) (string, error) {
+
+	dnsProvider, err := GetDNSProvider()
+	if err != nil {
+		log.Warn(err)
+		log.Warn("add a dns A record for ", host, " pointing to ", ipAddress)
+		return "", nil
+	}
+
+	record, err := dnsProvider.GetHostRecord(host)
+	if err != nil && !errors.Is(err, core.ErrNotFound) {
+		// can't tell if there is a record so don't risk adding a second one
+		return "", err
+	}
+	if err == nil {
+		// record exists. only records eezhee created are changed unless forced
+		// note: a record we didn't create is left alone by unexpose
+		if !record.Owned && record.IP != ipAddress && !exposeForce {
+			return "", fmt.Errorf("dns record for %s (pointing at %s) wasn't created by eezhee. use --force to point it at the cluster", host, record.IP)
+		}
+		if record.IP != ipAddress {
+			record.IP = ipAddress
+			err = dnsProvider.UpdateHostRecord(*record)
+			if err != nil {
+				return "", err
+			}
+			log.Info("updated dns for ", host)
+		}
+		if record.Owned {
+			return record.ID, nil
+		}
+		return "", nil
+	}
+
+	err = dnsProvider.AddHostRecord(core.HostInfo{Name: host, IP: ipAddress})
+	if err != nil {
+		return "", err
+	}
+	log.Info("created dns record for ", host)
+
+	// need id so we can delete it later
+	record, err = dnsProvider.GetHostRecord(host)
+	if err != nil {
+		return "", err
+	}
+
+	return record.ID, nil
+}
+
+// unexposeDeployment will remove what exposeDeployment created
+func unexposeDeployment(deployment string) error {
+
+	deployState, err := loadDeployState()
+	if err != nil {
+		return err
+	}
+	nodes, err := getClusterNodes(deployState)
+	if err != nil {
+		return err
+	}
+
+	conn, err := k3s.Connect(nodes[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = k3s.Unexpose(conn, exposeNamespace, deployment)
+	if err != nil {
+		return err
+	}
+
+	var remaining []config.ExposedService
+	for _, service := range deployState.Exposed {
+		if service.Deployment != deployment || service.Namespace != exposeNamespace {
+			remaining = append(remaining, service)
+			continue
+		}
+
+		if len(service.DNSRecord) > 0 {
+			err = deleteDNSRecord(service, exposeForce)
+			if err != nil {
+				return err
+			}
+			log.Info("removed dns record for ", service.Host)
+		}
+	}
+
+	deployState.Exposed = remaining
+	err = deployState.Save()
+	if err != nil {
+		return err
+	}
+
+	log.Info(deployment, " is no longer exposed")
+	return nil
+}
+
+// deleteDNSRecord removes the dns record expose created for a service
+// the record is only deleted if it is still the one eezhee created, unless forced
+func deleteDNSRecord(service config.ExposedService, force bool) error {
+
+	dnsProvider, err := GetDNSProvider()
+	if err != nil {
+		return err
+	}
+
+	record, err := dnsProvider.GetHostRecord(service.Host)
+	if errors.Is(err, core.ErrNotFound) {
+		// already gone
+		log.Debug("no dns record for ", service.Host)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if (record.ID != service.DNSRecord || !record.Owned) && !force {
+		return fmt.Errorf("dns record for %s was changed outside of eezhee so was left alone. use --force to delete it", service.Host)
+	}
+
+	return dnsProvider.DeleteHostRecord(*record)
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/k3s"
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(gitopsCmd)
+	gitopsCmd.AddCommand(gitopsBootstrapCmd)
+	gitopsCmd.AddCommand(gitopsKeyCmd)
+}
+
+var gitopsCmd = &cobra.Command{
+	Use:   "gitops",
+	Short: "Have the cluster pull its manifests from git",
+	Long:  `Install flux or argo cd and point it at the repo in the 'gitops' section of deploy.yaml`,
+}
+
+var gitopsBootstrapCmd = &cobra.Command{
+	Use:   "bootstrap",
+	Short: "Install the gitops controller on a running cluster",
+	Long:  `Install flux or argo cd, create the objects that point it at your repo and print the deploy key to add to your git host`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		deployState, err := loadDeployState()
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		deployConfig, err := loadGitOpsConfig()
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+
+		err = bootstrapGitOps(deployConfig, deployState)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var gitopsKeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Print the public deploy key",
+	Long:  `Print the public key the cluster uses to read your git repo`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		deployConfig, err := loadGitOpsConfig()
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+
+		var deployKey core.SSHKey
+		err = deployKey.LoadPublicKey(getDeployKeyFile(deployConfig) + ".pub")
+		if err != nil {
+			log.Error("no deploy key. use 'eezhee gitops bootstrap' to create one")
+			os.Exit(1)
+		}
+		fmt.Println(deployKey.GetPublicKey())
+	},
+}
+
+// loadGitOpsConfig loads the deploy file and makes sure it has gitops settings
+func loadGitOpsConfig() (*config.DeployConfig, error) {
+
+	deployConfig := config.NewDeployConfig()
+	if !deployConfig.FileExists() {
+		return nil, errors.New("no deploy.yaml file so no gitops settings")
+	}
+	err := deployConfig.Load()
+	if err != nil {
+		return nil, err
+	}
+	if len(deployConfig.GitOps.Engine) == 0 {
+		return nil, errors.New("no gitops section in deploy.yaml")
+	}
+	if len(deployConfig.Name) == 0 {
+		deployConfig.Name, _ = buildClusterName()
+	}
+
+	return deployConfig, nil
+}
+
+// getDeployKeyFile returns where the private deploy key is kept
+// by default each cluster gets its own key in ~/.eezhee/deploy-keys
+func getDeployKeyFile(deployConfig *config.DeployConfig) string {
+
+	if len(deployConfig.GitOps.DeployKey) > 0 {
+		keyFile, _ := homedir.Expand(deployConfig.GitOps.DeployKey)
+		return keyFile
+	}
+
+	home, _ := homedir.Dir()
+	return filepath.Join(home, ".eezhee", "deploy-keys", deployConfig.Name)
+}
+
+// bootstrapGitOps will install the gitops controller and point it at the repo
+func bootstrapGitOps(deployConfig *config.DeployConfig, deployState *config.DeployState) error {
+
+	settings := deployConfig.GitOps
+	if len(settings.Engine) == 0 {
+		// gitops not being used
+		return nil
+	}
+	if !k3s.ValidGitOpsEngine(settings.Engine) {
+		return fmt.Errorf("unsupported gitops engine: %s. use 'flux' or 'argocd'", settings.Engine)
+	}
+	if len(settings.Repo) == 0 {
+		return errors.New("gitops needs a repo")
+	}
+
+	// generate a deploy key the first time
+	keyFile := getDeployKeyFile(deployConfig)
+	var deployKey core.SSHKey
+	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(keyFile), 0700)
+		if err != nil {
+			return err
+		}
+		err = deployKey.GenerateNewKey(keyFile + ".pub")
+		if err != nil {
+			return err
+		}
+		log.Info("generated deploy key ", keyFile)
+	}
+	err := deployKey.LoadPublicKey(keyFile + ".pub")
+	if err != nil {
+		return err
+	}
+	privateKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := getClusterNodes(deployState)
+	if err != nil {
+		return err
+	}
+	conn, err := k3s.Connect(nodes[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = k3s.InstallGitOps(conn, k3s.GitOps{
+		Engine:     settings.Engine,
+		Repo:       settings.Repo,
+		Branch:     settings.Branch,
+		Path:       settings.Path,
+		PrivateKey: string(privateKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("add this deploy key (read-only) to", settings.Repo)
+	fmt.Println(deployKey.GetPublicKey())
+
+	return nil
+}
@@ -0,0 +1,429 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/k3s"
+	"github.com/eezhee/eezhee/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var snapshotTimeout = 30 * time.Minute // cloud saving the VM as an image
+
+var bakeCloud string
+var bakeRegion string
+var bakeOS string
+var bakeSize string
+var bakeK3sVersion string
+var pruneAll bool
+
+func init() {
+	rootCmd.AddCommand(imageCmd)
+	imageCmd.AddCommand(imageBakeCmd)
+	imageCmd.AddCommand(imageListCmd)
+	imageCmd.AddCommand(imagePruneCmd)
+	imageBakeCmd.Flags().StringVar(&bakeCloud, "cloud", "", "cloud to bake image on (default cloud in deploy file or default cloud)")
+	imageBakeCmd.Flags().StringVar(&bakeRegion, "region", "", "region to bake image in (default region in deploy file or closest region)")
+	imageBakeCmd.Flags().StringVar(&bakeOS, "os", "", "os of the image (default os in deploy file or ubuntu-24.04)")
+	imageBakeCmd.Flags().StringVar(&bakeSize, "size", "", "size of VM used to bake the image. its arch is the image's arch")
+	imageBakeCmd.Flags().StringVar(&bakeK3sVersion, "k3s-version", "", "k3s version to put on the image (default version in deploy file or stable)")
+	// note: shares the build timeout as baking uses the same phases
+	imageBakeCmd.Flags().DurationVar(&buildTimeout, "timeout", 45*time.Minute, "give up if the image isn't baked in this long")
+	imagePruneCmd.Flags().BoolVar(&pruneAll, "all", false, "delete every baked image, not just old ones")
+}
+
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Bake images with k3s on them so clusters build faster",
+	Long: `Bake a cloud image with k3s and its container images already on it.
+Set 'image: baked' in deploy.yaml to build clusters from it.  Baked images are tracked in ~/.eezhee/baked-images.yaml.
+To see the operating systems VMs can be created with, use 'eezhee images'`,
+}
+
+var imageBakeCmd = &cobra.Command{
+	Use:   "bake",
+	Short: "Bake an image with k3s on it",
+	Long: `Create a VM, download k3s and its airgap images onto it, clean out anything specific to the VM and save it as an image.
+The VM is deleted once the image is saved.  Supported on digitalocean (snapshots), linode (private images) and vultr (snapshots)`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// ctrl-c stops the bake so the VM can be deleted
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+		defer cancel()
+
+		err := bakeImage(ctx)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var imageListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List baked images",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := listBakedImages()
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var imagePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old baked images",
+	Long: `Delete baked images that have been replaced by a newer one (same cloud, os, arch and regions).
+Use --all to delete every baked image`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := pruneBakedImages(cmd.Context())
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// bakeImage creates a VM, puts k3s on it and saves it as an image
+func bakeImage(ctx context.Context) error {
+
+	// bake what a build would use unless flags say otherwise
+	deployConfig := config.NewDeployConfig()
+	if deployConfig.FileExists() {
+		err := deployConfig.Load()
+		if err != nil {
+			return err
+		}
+	}
+	cloudProvider, err := selectCloud(bakeCloud, deployConfig)
+	if err != nil {
+		return err
+	}
+	deployConfig.Cloud = cloudProvider.Name
+	if len(bakeRegion) > 0 {
+		deployConfig.Region = bakeRegion
+		deployConfig.Near = ""
+	}
+	if len(bakeOS) > 0 {
+		deployConfig.OS = bakeOS
+	}
+	if len(bakeSize) > 0 {
+		deployConfig.Size = bakeSize
+	}
+	if len(bakeK3sVersion) > 0 {
+		deployConfig.K3sVersion = bakeK3sVersion
+	}
+	if len(deployConfig.K3sVersion) == 0 {
+		deployConfig.K3sVersion = "stable"
+	}
+
+	err = resolveRegion(cloudProvider, deployConfig)
+	if err != nil {
+		return err
+	}
+	err = resolveSize(cloudProvider, deployConfig)
+	if err != nil {
+		return err
+	}
+	if len(deployConfig.Size) == 0 {
+		deployConfig.Size = cloudProvider.DefaultSize
+	}
+
+	vmManager, err := GetManager(cloudProvider.Name)
+	if err != nil {
+		return err
+	}
+	snapshotter, ok := core.Supports[core.VMSnapshotter](vmManager)
+	if !ok {
+		return fmt.Errorf("baking images is not supported on %s", cloudProvider.Name)
+	}
+	sshKey, err := loadSSHKey()
+	if err != nil {
+		return err
+	}
+
+	var k3sManager *k3s.Manager
+	var imageName string
+	err = runPhase(ctx, "getting ready to bake", setupTimeout, func(ctx context.Context) error {
+
+		k3sManager = newK3sManager(ctx, cloudProvider)
+		release, err := k3sManager.Releases.Translate(deployConfig.K3sVersion)
+		if err != nil {
+			return err
+		}
+		deployConfig.K3sVersion = release
+
+		_, err = vmManager.IsSSHKeyUploaded(ctx, sshKey)
+		if err != nil {
+			_, err = vmManager.UploadSSHKey(ctx, "eezhee", sshKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(deployConfig.Region) == 0 {
+			deployConfig.Region, err = vmManager.SelectClosestRegion(ctx)
+			if err != nil {
+				return err
+			}
+			log.Info("using ", deployConfig.Region)
+		}
+
+		imageName, err = resolveImage(ctx, cloudProvider, vmManager, deployConfig)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	arch := sizeArch(cloudProvider, deployConfig)
+
+	// image is named after what is on it. ie eezhee-v1.30.5-k3s1-ubuntu-24.04-1760870000
+	// note: linode labels can only be 50 characters
+	name := fmt.Sprintf("eezhee-%s-%s-%d", strings.ReplaceAll(deployConfig.K3sVersion, "+", "-"),
+		deployConfig.OS, time.Now().Unix())
+
+	log.Info("creating a VM to bake ", name)
+	createCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), createTimeout)
+	vmInfo, err := vmManager.CreateVM(createCtx, name, imageName, deployConfig.Size, deployConfig.Region, sshKey)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	// the VM is only needed until it has been saved
+	defer func() {
+		deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		defer cancel()
+		err := vmManager.DeleteVM(deleteCtx, vmInfo.ID)
+		if err != nil {
+			log.Warn("could not delete VM ", name, ". delete it in the ", cloudProvider.Name, " console: ", err)
+			return
+		}
+		log.Info("deleted VM ", name)
+	}()
+
+	err = runPhase(ctx, "waiting for the VM to start", vmReadyTimeout, func(ctx context.Context) error {
+		vmInfo, err = waitForVM(ctx, vmManager, vmInfo)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	vmPublicIP, err := vmInfo.GetPublicIP()
+	if err != nil {
+		return err
+	}
+
+	err = runPhase(ctx, "installing k3s", installTimeout, func(ctx context.Context) error {
+
+		// pause as ssh might not be ready
+		err := sleep(ctx, launchDelay)
+		if err != nil {
+			return err
+		}
+		return k3sManager.Bake(ctx, vmPublicIP, deployConfig.K3sVersion, arch)
+	})
+	if err != nil {
+		return err
+	}
+
+	// note: like creating the VM, this isn't cancelled part way as we'd have no way to know
+	// if the image was created. once we have its id, it is saved so it can be pruned
+	log.Info("saving VM as an image")
+	snapshotCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), snapshotTimeout)
+	image, err := snapshotter.SnapshotVM(snapshotCtx, vmInfo.ID, name)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	bakedImages := config.NewBakedImages()
+	err = bakedImages.Load()
+	if err != nil {
+		return err
+	}
+	bakedImage := config.BakedImage{
+		Cloud:      cloudProvider.Name,
+		ID:         image.Slug,
+		Name:       name,
+		Regions:    image.Regions,
+		OS:         deployConfig.OS,
+		Arch:       arch,
+		K3sVersion: deployConfig.K3sVersion,
+		Created:    time.Now().UTC().Format(time.RFC3339),
+	}
+	bakedImages.Add(bakedImage)
+	err = bakedImages.Save()
+	if err != nil {
+		return err
+	}
+
+	err = runPhase(ctx, "saving the image", snapshotTimeout, func(ctx context.Context) error {
+		image, err = snapshotter.WaitForImage(ctx, bakedImage.ID)
+		return err
+	})
+	if err != nil {
+		log.Warn("image ", name, " may still be saving. it is in 'eezhee image list' so it can be pruned later")
+		return err
+	}
+
+	// some clouds only know which regions the image is in once it is saved
+	if len(image.Regions) > 0 {
+		bakedImages.Remove(bakedImage.Cloud, bakedImage.ID)
+		bakedImage.Regions = image.Regions
+		bakedImages.Add(bakedImage)
+		err = bakedImages.Save()
+		if err != nil {
+			return err
+		}
+	}
+	log.Info("baked image ", name, ". use 'image: baked' in deploy.yaml to build clusters from it")
+
+	return nil
+}
+
+// findBakedImage picks the image made by 'eezhee image bake' to build the cluster from
+// unless the deploy file pins a k3s version, the newest image is used and its k3s version is installed
+func findBakedImage(cloudProvider provider.Provider, deployConfig *config.DeployConfig, pinnedVersion bool) (string, error) {
+
+	if len(deployConfig.OS) == 0 {
+		deployConfig.OS = cloudProvider.DefaultImage
+	}
+	arch := sizeArch(cloudProvider, deployConfig)
+	version := ""
+	if pinnedVersion {
+		version = deployConfig.K3sVersion
+	}
+
+	bakedImages := config.NewBakedImages()
+	err := bakedImages.Load()
+	if err != nil {
+		return "", err
+	}
+	image, found := bakedImages.Find(cloudProvider.Name, deployConfig.OS, arch, deployConfig.Region, version)
+	if !found {
+		wanted := deployConfig.OS + " " + arch
+		if pinnedVersion {
+			wanted += " k3s " + version
+		}
+		return "", fmt.Errorf("no baked %s image on %s that can be used in %s. use 'eezhee image bake'",
+			wanted, cloudProvider.Name, deployConfig.Region)
+	}
+	deployConfig.K3sVersion = image.K3sVersion
+	log.Info("using baked image ", image.Name)
+
+	return image.ID, nil
+}
+
+// listBakedImages prints the images made by 'eezhee image bake'
+func listBakedImages() error {
+
+	bakedImages := config.NewBakedImages()
+	err := bakedImages.Load()
+	if err != nil {
+		return err
+	}
+	if len(bakedImages.Images) == 0 {
+		log.Info("no baked images. use 'eezhee image bake' to create one")
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "CLOUD\tID\tOS\tARCH\tK3S\tREGIONS\tCREATED")
+	for _, image := range bakedImages.Images {
+		regions := "any"
+		if len(image.Regions) > 0 {
+			regions = strings.Join(image.Regions, ",")
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", image.Cloud, image.ID, image.OS, image.Arch,
+			image.K3sVersion, regions, image.Created)
+	}
+	writer.Flush()
+
+	return nil
+}
+
+// pruneBakedImages deletes baked images that a newer one has replaced (or all of them)
+func pruneBakedImages(ctx context.Context) error {
+
+	bakedImages := config.NewBakedImages()
+	err := bakedImages.Load()
+	if err != nil {
+		return err
+	}
+
+	// newest first so the first image of each kind is the one to keep
+	images := append([]config.BakedImage{}, bakedImages.Images...)
+	sort.SliceStable(images, func(i, j int) bool { return images[i].Created > images[j].Created })
+	var stale []config.BakedImage
+	newest := map[string]bool{}
+	for _, image := range images {
+		kind := strings.Join([]string{image.Cloud, image.OS, image.Arch, strings.Join(image.Regions, ",")}, "/")
+		if !newest[kind] && !pruneAll {
+			newest[kind] = true
+			continue
+		}
+		stale = append(stale, image)
+	}
+	if len(stale) == 0 {
+		log.Info("no baked images to prune")
+		return nil
+	}
+
+	response := ""
+	fmt.Printf("delete %d baked images (y/N)? ", len(stale))
+	fmt.Scanln(&response)
+	if strings.ToLower(response) != "y" {
+		return errors.New("prune aborted")
+	}
+
+	for _, image := range stale {
+		err = deleteBakedImage(ctx, image)
+		if err != nil {
+			log.Warn("could not delete ", image.Name, ": ", err)
+			continue
+		}
+		log.Info("deleted ", image.Name)
+		bakedImages.Remove(image.Cloud, image.ID)
+	}
+
+	return bakedImages.Save()
+}
+
+// deleteBakedImage deletes an image from its cloud
+// an image that has already been deleted (ie in the cloud's console) is not an error
+func deleteBakedImage(ctx context.Context, image config.BakedImage) error {
+
+	vmManager, err := GetManager(image.Cloud)
+	if err != nil {
+		return err
+	}
+	snapshotter, ok := core.Supports[core.VMSnapshotter](vmManager)
+	if !ok {
+		return fmt.Errorf("deleting images is not supported on %s", image.Cloud)
+	}
+
+	err = snapshotter.DeleteImage(ctx, image.ID)
+	if errors.Is(err, core.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
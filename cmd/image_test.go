@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eezhee/eezhee/pkg/config"
+)
+
+func TestBakeImage(t *testing.T) {
+
+	useFakeCloud(t)
+	ctx := context.Background()
+
+	err := bakeImage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bakedImages := config.NewBakedImages()
+	err = bakedImages.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bakedImages.Images) != 1 || bakedImages.Images[0].Cloud != "fake" || bakedImages.Images[0].K3sVersion != "v1.30.5+k3s1" {
+		t.Fatalf("expected baked image to be recorded, got %+v", bakedImages.Images)
+	}
+
+	// the VM is only needed until the image is saved
+	vms, err := fakeCloud.ListVMs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 0 {
+		t.Fatalf("expected VM to be deleted, got %+v", vms)
+	}
+}
+
+func TestBakeImageRecordedBeforeSaved(t *testing.T) {
+
+	useFakeCloud(t)
+	t.Setenv("EEZHEE_FAKE_FAIL", "WaitForImage")
+
+	err := bakeImage(context.Background())
+	if err == nil {
+		t.Fatal("expected bake to fail")
+	}
+
+	// the cloud may still finish the image so it has to be recorded for prune
+	bakedImages := config.NewBakedImages()
+	err = bakedImages.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bakedImages.Images) != 1 || len(bakedImages.Images[0].ID) == 0 {
+		t.Fatalf("expected image to be recorded, got %+v", bakedImages.Images)
+	}
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var imagesCloud string
+var imagesOutput string
+
+func init() {
+	rootCmd.AddCommand(imagesCmd)
+	imagesCmd.Flags().StringVar(&imagesCloud, "cloud", "", "cloud to list images of (default cloud in deploy file or default cloud)")
+	imagesCmd.Flags().StringVarP(&imagesOutput, "output", "o", "table", "output format (table or json)")
+}
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "List the operating systems VMs can be created with",
+	Long: `List the operating systems that can be used for 'os' in deploy.yaml and the image of each on a cloud.
+Images are looked up with the cloud's api (if it has credentials) so they are always the latest release.
+Some clouds (aws, azure and gcp) only look up the image when the VM is created`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := listImages(cmd.Context())
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// imageRow is an os & arch as shown by 'eezhee images'
+type imageRow struct {
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	Default bool   `json:"default"`
+	Image   string `json:"image,omitempty"` // what the cloud calls it. missing if not known
+	Name    string `json:"name,omitempty"`
+}
+
+// listImages prints the supported operating systems and the cloud's image for each
+func listImages(ctx context.Context) error {
+
+	if imagesOutput != "table" && imagesOutput != "json" {
+		return fmt.Errorf("invalid output format %s. use table or json", imagesOutput)
+	}
+
+	deployConfig := config.NewDeployConfig()
+	if deployConfig.FileExists() {
+		err := deployConfig.Load()
+		if err != nil {
+			return err
+		}
+	}
+	cloudProvider, err := selectCloud(imagesCloud, deployConfig)
+	if err != nil {
+		return err
+	}
+
+	images, err := listCloudImages(ctx, cloudProvider)
+	if err != nil {
+		log.Warn("showing operating systems only. ", err)
+	}
+
+	var rows []imageRow
+	for _, operatingSystem := range core.OperatingSystems {
+		for _, arch := range cloudArchs(cloudProvider) {
+			row := imageRow{
+				OS:      operatingSystem.Name,
+				Arch:    arch,
+				Default: operatingSystem.Name == cloudProvider.DefaultImage,
+			}
+			image, err := core.FindImage(images, operatingSystem.Name, arch)
+			if err == nil {
+				row.Image = image.Slug
+				row.Name = image.Name
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if imagesOutput == "json" {
+		return printJSON(rows)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "OS\tARCH\tIMAGE\tNAME")
+	for _, row := range rows {
+		name := row.OS
+		if row.Default {
+			name += " (default)"
+		}
+		image := "-"
+		if len(row.Image) > 0 {
+			image = row.Image
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", name, row.Arch, image, row.Name)
+	}
+	writer.Flush()
+
+	return nil
+}
+
+// listCloudImages gets the current image of each os from the cloud's api
+// nil if the cloud looks up images when VMs are created
+func listCloudImages(ctx context.Context, cloudProvider provider.Provider) ([]core.ImageInfo, error) {
+
+	vmManager, err := GetManager(cloudProvider.Name)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := core.Supports[core.ImageLister](vmManager)
+	if !ok {
+		log.Info(cloudProvider.Name, " looks up the image when the VM is created")
+		return nil, nil
+	}
+
+	images, err := lister.ListImages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get images from %s: %w", cloudProvider.Name, err)
+	}
+
+	return images, nil
+}
+
+// cloudArchs returns the archs a cloud has sizes for
+func cloudArchs(cloudProvider provider.Provider) []string {
+
+	if cloudProvider.Sizes == nil {
+		return []string{"amd64"}
+	}
+	sizes, err := cloudProvider.Sizes.GetList()
+	if err != nil {
+		return []string{"amd64"}
+	}
+
+	var archs []string
+	for _, size := range sizes {
+		if !containsString(archs, size.Arch) {
+			archs = append(archs, size.Arch)
+		}
+	}
+
+	return archs
+}
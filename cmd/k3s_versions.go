@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -19,7 +20,7 @@ var versionsCmd = &cobra.Command{
 	Short: "List the versions of k3s that can be used",
 	Long:  `Will check the k3s repo on github and get a list of all the releases available`,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := getK3sVersions()
+		err := getK3sVersions(cmd.Context())
 		if err != nil {
 			log.Error(err)
 			os.Exit(1)
@@ -27,9 +28,9 @@ var versionsCmd = &cobra.Command{
 	},
 }
 
-func getK3sVersions() error {
+func getK3sVersions(ctx context.Context) error {
 
-	k3sManager := k3s.NewManager()
+	k3sManager := k3s.NewManager(ctx)
 
 	// get list of channels
 	channels, err := k3sManager.Releases.GetChannels()
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/provider"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -18,13 +22,21 @@ var listCmd = &cobra.Command{
 	Short: "List all your running clusters",
 	Long:  `All software has versions. This is Eezhee's`,
 	Run: func(cmd *cobra.Command, args []string) {
-		listVMs()
+		listVMs(cmd.Context())
 	},
 }
 
-func listVMs() {
+func listVMs(ctx context.Context) {
 
-	clouds := []string{"digitalocean", "linode", "vultr"}
+	clouds := provider.List()
+
+	// hidden clouds (ie fake) are only listed when the app in this directory is deployed to one
+	deployState := config.NewDeployState()
+	if deployState.FileExists() && deployState.Load() == nil && len(deployState.Cloud) > 0 {
+		if !containsString(clouds, deployState.Cloud) {
+			clouds = append(clouds, deployState.Cloud)
+		}
+	}
 
 	// // see which cloud we have an api token for
 	// cloud := AppConfig.GetDefaultCloud()
@@ -45,7 +57,7 @@ func listVMs() {
 		}
 
 		// get all VMs in our account
-		vmInfo, err := manager.ListVMs()
+		vmInfo, err := manager.ListVMs(ctx)
 		if err != nil {
 			log.Error(err)
 		}
@@ -58,29 +70,49 @@ func listVMs() {
 					for _, tag := range vmInfo[i].Tags {
 						if strings.Compare(tag, "eezhee") == 0 {
 							// we created this VM
-							// TODO: this conversion should probalby be done in the provider
+							// providers give times in RFC3339 (ssh servers don't have one)
 							var createdTimestamp time.Time
-							switch cloud {
-							case "digitalocean":
-								createdTimestamp, err = time.Parse(time.RFC3339, vmInfo[i].CreatedAt)
-							case "linode":
-								createdTimestamp, err = time.Parse("2006-01-02 15:04:05 +0000 UTC", vmInfo[i].CreatedAt)
-							case "vultr":
+							if len(vmInfo[i].CreatedAt) > 0 {
 								createdTimestamp, err = time.Parse(time.RFC3339, vmInfo[i].CreatedAt)
-							default:
+								if err != nil {
+									fmt.Println("error: ", err)
+									continue
+								}
 							}
-							if err != nil {
-								fmt.Println("error: ", err)
-								continue
+							createdAt := "-"
+							if !createdTimestamp.IsZero() {
+								createdAt = createdTimestamp.Format("2006-01-02 15:04")
 							}
 							fmt.Printf("  %s (%s)  status: %s  created at: %s\n", vmInfo[i].Name, vmInfo[i].ID, vmInfo[i].Status,
-								createdTimestamp.Format("2006-01-02 15:04"))
+								createdAt)
 							numClusters = numClusters + 1
 						}
 					}
 				}
 			}
 		}
+
+		// clouds with a kubernetes service might have managed clusters as well
+		clusterManager, ok := manager.(core.ClusterManager)
+		if !ok {
+			continue
+		}
+		clusterInfo, err := clusterManager.ListClusters(ctx)
+		if err != nil {
+			log.Error(err)
+		}
+		if len(clusterInfo) > 0 {
+			fmt.Println(cloud, "(managed):")
+			for _, cluster := range clusterInfo {
+				createdAt := "-"
+				createdTimestamp, err := time.Parse(time.RFC3339, cluster.CreatedAt)
+				if err == nil {
+					createdAt = createdTimestamp.Format("2006-01-02 15:04")
+				}
+				fmt.Printf("  %s (%s)  status: %s  created at: %s\n", cluster.Name, cluster.ID, cluster.Status, createdAt)
+				numClusters = numClusters + 1
+			}
+		}
 	}
 
 	if numClusters == 0 {
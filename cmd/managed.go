@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const clusterStatusDelay = 15 * time.Second // time between checks on status of a managed cluster
+const kubeConfigRetries = 10                // kubeconfig can take a bit longer than the cluster to be ready
+
+// getClusterManager will create a manager for a cloud's managed kubernetes service
+func getClusterManager(cloud string) (core.ClusterManager, error) {
+
+	vmManager, err := GetManager(cloud)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterManager, ok := vmManager.(core.ClusterManager)
+	if !ok {
+		return nil, fmt.Errorf("managed clusters are not supported on %s", cloud)
+	}
+
+	return clusterManager, nil
+}
+
+// buildManagedCluster will create a cluster with the cloud's kubernetes service
+func buildManagedCluster(ctx context.Context, deployConfig *config.DeployConfig, deployState *config.DeployState) error {
+
+	// these all need ssh access to the nodes
+	if deployConfig.Registry.Enabled || len(deployConfig.Registry.External) > 0 ||
+		len(deployConfig.Secrets) > 0 || len(deployConfig.GitOps.Engine) > 0 {
+		return errors.New("registry, secrets and gitops settings are not supported on managed clusters yet")
+	}
+
+	clusterManager, err := getClusterManager(deployConfig.Cloud)
+	if err != nil {
+		return err
+	}
+
+	if len(deployConfig.Region) == 0 {
+		err = runPhase(ctx, "selecting a region", setupTimeout, func(ctx context.Context) error {
+			log.Info("selecting closest region")
+			vmManager := clusterManager.(core.VMManager)
+			deployConfig.Region, err = vmManager.SelectClosestRegion(ctx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		log.Info("using ", deployConfig.Region)
+	}
+
+	nodePools := getNodePools(deployConfig)
+
+	// note: not cancelled part way so we always find out the id of the cluster
+	log.Info("creating a managed cluster")
+	createCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), createTimeout)
+	clusterInfo, err := clusterManager.CreateCluster(createCtx, deployConfig.Name, deployConfig.K8sVersion,
+		deployConfig.Region, nodePools)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	// save state right away so the cluster can be torn down if something goes wrong
+	deployState.Cloud = deployConfig.Cloud
+	deployState.Type = "managed"
+	deployState.ID = clusterInfo.ID
+	deployState.Name = clusterInfo.Name
+	deployState.Region = clusterInfo.Region
+	deployState.Size = nodePools[0].Size
+	deployState.K8sVersion = clusterInfo.Version
+	err = deployState.Save()
+	if err != nil {
+		return err
+	}
+
+	// managed clusters take several minutes to come up
+	var kubeConfig []byte
+	err = runPhase(ctx, "waiting for the cluster to start", clusterReadyTimeout, func(ctx context.Context) error {
+
+		lastStatus := ""
+		for clusterInfo.Status != "running" {
+
+			// the cloud won't finish it so there is no point waiting
+			if clusterInfo.Status == "failed" {
+				return fmt.Errorf("%s could not create the cluster", deployConfig.Cloud)
+			}
+
+			err := sleep(ctx, clusterStatusDelay)
+			if err != nil {
+				return err
+			}
+			clusterInfo, err = clusterManager.GetClusterInfo(ctx, deployState.ID)
+			if err != nil {
+				return err
+			}
+
+			// print status if it has changed since last time
+			if lastStatus != clusterInfo.Status {
+				log.Info("cluster in ", clusterInfo.Status, " state")
+				lastStatus = clusterInfo.Status
+			}
+		}
+
+		// get kubectl config
+		var err error
+		for retries := 0; retries < kubeConfigRetries; retries++ {
+			kubeConfig, err = clusterManager.GetKubeConfig(ctx, deployState.ID)
+			if err == nil {
+				break
+			}
+			log.Debug(err)
+			if sleep(ctx, statusCheckDelay) != nil {
+				break
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// use the cluster name as the context like we do for k3s
+	kubeConfig, err = renameKubeContext(kubeConfig, deployConfig.Name)
+	if err != nil {
+		return err
+	}
+
+	absPath, _ := filepath.Abs("kubeconfig")
+	err = os.WriteFile(absPath, kubeConfig, 0600)
+	if err != nil {
+		return err
+	}
+	log.Info("kubeconfig saved to ", absPath)
+
+	// update state file & re-save
+	deployState.K8sVersion = clusterInfo.Version
+	err = deployState.Save()
+	if err != nil {
+		return err
+	}
+	log.Info("saved cluster details to 'deploy-state.yaml'")
+
+	return nil
+}
+
+// getNodePools returns the node pools from the deploy file (with defaults filled in)
+func getNodePools(deployConfig *config.DeployConfig) []core.NodePool {
+
+	defaultSize := deployConfig.Size
+	if len(defaultSize) == 0 {
+		cloudProvider, err := provider.Get(deployConfig.Cloud)
+		if err == nil {
+			defaultSize = cloudProvider.DefaultNodeSize
+		}
+	}
+
+	poolConfigs := deployConfig.NodePools
+	if len(poolConfigs) == 0 {
+		poolConfigs = []config.NodePoolConfig{{}}
+	}
+
+	var nodePools []core.NodePool
+	for i, poolConfig := range poolConfigs {
+		pool := core.NodePool{
+			Name:  poolConfig.Name,
+			Size:  poolConfig.Size,
+			Count: poolConfig.Count,
+		}
+		if len(pool.Name) == 0 {
+			pool.Name = deployConfig.Name + "-pool"
+			if i > 0 {
+				pool.Name = fmt.Sprintf("%s-%d", pool.Name, i+1)
+			}
+		}
+		if len(pool.Size) == 0 {
+			pool.Size = defaultSize
+		}
+		if pool.Count == 0 {
+			pool.Count = 1
+		}
+		nodePools = append(nodePools, pool)
+	}
+
+	return nodePools
+}
+
+// renameKubeContext sets the name of the (only) context in a kubeconfig
+func renameKubeContext(kubeConfig []byte, name string) ([]byte, error) {
+
+	var settings map[string]interface{}
+	err := yaml.Unmarshal(kubeConfig, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig from cloud: %w", err)
+	}
+
+	contexts, _ := settings["contexts"].([]interface{})
+	if len(contexts) != 1 {
+		// don't know which one to rename
+		return kubeConfig, nil
+	}
+	kubeContext, ok := contexts[0].(map[string]interface{})
+	if !ok {
+		return kubeConfig, nil
+	}
+	kubeContext["name"] = name
+	settings["current-context"] = name
+
+	return yaml.Marshal(settings)
+}
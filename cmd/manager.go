@@ -2,49 +2,153 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
-	"github.com/eezhee/eezhee/pkg/aws"
+	"github.com/eezhee/eezhee/pkg/cloudflare"
+	"github.com/eezhee/eezhee/pkg/config"
 	"github.com/eezhee/eezhee/pkg/core"
-	"github.com/eezhee/eezhee/pkg/digitalocean"
-	"github.com/eezhee/eezhee/pkg/linode"
-	"github.com/eezhee/eezhee/pkg/vultr"
+	"github.com/eezhee/eezhee/pkg/fake"
+	"github.com/eezhee/eezhee/pkg/provider"
+	"github.com/eezhee/eezhee/pkg/sshcloud"
+	homedir "github.com/mitchellh/go-homedir"
 )
 
 // GetManager will create a new manager object for the desired public cloud
 func GetManager(cloud string) (core.VMManager, error) {
 
-	var vmManager core.VMManager
+	cloudProvider, err := provider.Get(cloud)
+	if err != nil {
+		return nil, err
+	}
 
-	switch cloud {
-	case "aws":
-		// TODO: work out how to authenticate for aws
-		manager, err := aws.NewManager(AppConfig.LinodeAPIKey)
-		vmManager = manager
-		if err != nil {
-			return vmManager, errors.New("could not create aws client")
+	vmManager, err := cloudProvider.New(AppConfig)
+	if err != nil {
+		return vmManager, err
+	}
+
+	// rate limits and server errors are retried for every cloud
+	return core.WithRetry(vmManager, core.DefaultRetryPolicy), nil
+}
+
+// selectCloud picks the cloud a command works with
+// it is the one given on the command line, the one in the deploy file or the default cloud
+func selectCloud(cloud string, deployConfig *config.DeployConfig) (provider.Provider, error) {
+
+	if len(cloud) == 0 {
+		cloud = deployConfig.Cloud
+	}
+	if len(cloud) == 0 {
+		cloud = AppConfig.GetDefaultCloud()
+	}
+	if len(cloud) == 0 {
+		return provider.Provider{}, errors.New("no cloud selected. use --cloud")
+	}
+
+	return provider.Get(cloud)
+}
+
+// the fake cloud's ssh server only lives as long as the process so all callers share it
+// note: its VMs are saved in ~/.eezhee/fake-cloud.json so later commands can see them
+var (
+	fakeCloudOnce  sync.Once
+	fakeCloud      *fake.Cloud
+	fakeSSHServer  *fake.SSHServer
+	fakeCloudError error
+)
+
+// getFakeCloud will start the fake cloud (and the ssh server its VMs run on) the first time it is used
+// EEZHEE_FAKE_LATENCY slows down every call (ie 500ms) and EEZHEE_FAKE_FAIL makes calls
+// fail (ie CreateVM=quota,DeleteVM. see fake.ParseFailures)
+func getFakeCloud() (*fake.Cloud, error) {
+
+	fakeCloudOnce.Do(func() {
+		options := fake.Options{}
+
+		var err error
+		if latency := os.Getenv("EEZHEE_FAKE_LATENCY"); len(latency) > 0 {
+			options.Latency, err = time.ParseDuration(latency)
+			if err != nil {
+				fakeCloudError = fmt.Errorf("invalid EEZHEE_FAKE_LATENCY: %w", err)
+				return
+			}
 		}
-	case "digitalocean":
-		manager, err := digitalocean.NewManager(AppConfig.DigitalOceanAPIKey)
-		vmManager = manager
+		options.Failures, err = fake.ParseFailures(os.Getenv("EEZHEE_FAKE_FAIL"))
 		if err != nil {
-			return vmManager, errors.New("could not create digitalocean client")
+			fakeCloudError = fmt.Errorf("invalid EEZHEE_FAKE_FAIL: %w", err)
+			return
 		}
-	case "linode":
-		manager, err := linode.NewManager(AppConfig.LinodeAPIKey)
-		vmManager = manager
+
+		homeDir, err := homedir.Dir()
 		if err != nil {
-			return vmManager, errors.New("could not create linode client")
+			fakeCloudError = err
+			return
 		}
-	case "vultr":
-		manager, err := vultr.NewManager(AppConfig.VultrAPIKey)
-		vmManager = manager
+		options.StateFile = filepath.Join(homeDir, ".eezhee", "fake-cloud.json")
+
+		fakeSSHServer, err = fake.StartSSHServer()
 		if err != nil {
-			return vmManager, errors.New("could not create vultr client")
+			fakeCloudError = err
+			return
 		}
-		// should never get here (but lets play it safe)
-	default:
-		return nil, errors.New("invalid cloud type")
+		options.SSHPort = fakeSSHServer.Port()
+
+		fakeCloud = fake.NewCloud(options)
+	})
+
+	return fakeCloud, fakeCloudError
+}
+
+// newSSHManager creates a manager for the servers listed in the deploy file
+func newSSHManager() (core.VMManager, error) {
+
+	servers, err := loadSSHServers()
+	if err != nil {
+		return nil, err
+	}
+
+	return sshcloud.NewManager(servers)
+}
+
+// loadSSHServers gets the servers listed in the deploy file
+func loadSSHServers() ([]sshcloud.Server, error) {
+
+	deployConfig := config.NewDeployConfig()
+	if !deployConfig.FileExists() {
+		return nil, errors.New("ssh cloud needs servers listed in deploy.yaml")
+	}
+	err := deployConfig.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []sshcloud.Server
+	for _, server := range deployConfig.Servers {
+		servers = append(servers, sshcloud.Server{
+			Host:    server.Host,
+			User:    server.User,
+			Port:    server.Port,
+			KeyFile: server.Key,
+		})
+	}
+
+	return servers, nil
+}
+
+// GetDNSProvider will create a manager for the dns provider that has been configured
+func GetDNSProvider() (core.DNSProvider, error) {
+
+	if len(AppConfig.CloudFlareAPIKey) == 0 {
+		return nil, errors.New("no dns provider configured. use 'eezhee clouds cloudflare [api_key]'")
+	}
+
+	manager, err := cloudflare.NewDNSManager(AppConfig.CloudFlareAPIKey)
+	if err != nil {
+		return nil, errors.New("could not create cloudflare client")
 	}
 
-	return vmManager, nil
+	return &manager, nil
 }
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/eezhee/eezhee/pkg/aws"
+	"github.com/eezhee/eezhee/pkg/azure"
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/digitalocean"
+	"github.com/eezhee/eezhee/pkg/fake"
+	"github.com/eezhee/eezhee/pkg/gcp"
+	"github.com/eezhee/eezhee/pkg/hetzner"
+	"github.com/eezhee/eezhee/pkg/linode"
+	"github.com/eezhee/eezhee/pkg/provider"
+	"github.com/eezhee/eezhee/pkg/vultr"
+)
+
+// register the clouds built into eezhee
+// note: other clouds can be added with an eezhee-provider-<name> plugin
+func init() {
+
+	provider.Register(provider.Provider{
+		Name: "aws",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			// aws credentials could be anywhere so only use aws if user has enabled it
+			if len(appConfig.AWSProfile) == 0 {
+				return nil, errors.New("aws not configured. use 'eezhee clouds aws [profile]'")
+			}
+			manager, err := aws.NewManager(appConfig.AWSProfile)
+			if err != nil {
+				return manager, errors.New("could not create aws client")
+			}
+			return manager, nil
+		},
+		SetCredentials: func(appConfig *config.AppConfig, profile string) {
+			appConfig.AWSProfile = profile
+		},
+		Regions:      aws.Regions,
+		Sizes:        aws.Sizes,
+		DefaultSize:  "t3.micro",
+		DefaultImage: core.DefaultOS, // ami looked up in region
+	})
+
+	provider.Register(provider.Provider{
+		Name: "azure",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			// like aws, only use azure if user has enabled it
+			if len(appConfig.AzureSubscription) == 0 {
+				return nil, errors.New("azure not configured. use 'eezhee clouds azure [subscription_id]'")
+			}
+			manager, err := azure.NewManager(appConfig.AzureSubscription, appConfig.AzureTenantID,
+				appConfig.AzureClientID, appConfig.AzureClientSecret)
+			if err != nil {
+				return manager, errors.New("could not create azure client")
+			}
+			return manager, nil
+		},
+		SetCredentials: func(appConfig *config.AppConfig, _ string) {
+			// subscription is looked up while validating the credentials
+			appConfig.AzureSubscription = azureSubscription
+			appConfig.AzureTenantID = azureTenantID
+			appConfig.AzureClientID = azureClientID
+			appConfig.AzureClientSecret = azureClientSecret
+		},
+		Regions:      azure.Regions,
+		Sizes:        azure.Sizes,
+		DefaultSize:  "Standard_B2s",
+		DefaultImage: core.DefaultOS, // latest version of the image is used
+	})
+
+	provider.Register(provider.Provider{
+		Name: "digitalocean",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			manager, err := digitalocean.NewManager(appConfig.DigitalOceanAPIKey)
+			if err != nil {
+				return manager, errors.New("could not create digitalocean client")
+			}
+			return manager, nil
+		},
+		SetCredentials: func(appConfig *config.AppConfig, apiKey string) {
+			appConfig.DigitalOceanAPIKey = apiKey
+		},
+		Regions:         digitalocean.Regions,
+		Sizes:           digitalocean.Sizes,
+		DefaultSize:     "s-1vcpu-1gb",
+		DefaultImage:    core.DefaultOS,
+		DefaultNodeSize: "s-2vcpu-4gb",
+	})
+
+	provider.Register(provider.Provider{
+		Name: "fake",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			// in-memory cloud for running offline (ie end to end tests)
+			manager, err := getFakeCloud()
+			if err != nil {
+				return nil, err
+			}
+			return manager, nil
+		},
+		Regions:      fake.Regions,
+		Sizes:        fake.Sizes,
+		Releases:     fake.Releases,
+		DefaultSize:  "fake-small",
+		DefaultImage: core.DefaultOS,
+		Hidden:       true,
+	})
+
+	provider.Register(provider.Provider{
+		Name: "gcp",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			// like aws, only use gcp if user has enabled it
+			if len(appConfig.GCPCredentials) == 0 {
+				return nil, errors.New("gcp not configured. use 'eezhee clouds gcp [credentials_file]'")
+			}
+			manager, err := gcp.NewManager(appConfig.GCPCredentials, appConfig.GCPProject)
+			if err != nil {
+				return manager, errors.New("could not create gcp client")
+			}
+			return manager, nil
+		},
+		SetCredentials: func(appConfig *config.AppConfig, credentials string) {
+			// file could be relative to current directory
+			if credentials != "default" {
+				credentials, _ = filepath.Abs(credentials)
+			}
+			appConfig.GCPCredentials = credentials
+			appConfig.GCPProject = gcpProject
+		},
+		Regions:      gcp.Regions,
+		Sizes:        gcp.Sizes,
+		DefaultSize:  "e2-small",
+		DefaultImage: core.DefaultOS, // latest image in family is used
+	})
+
+	provider.Register(provider.Provider{
+		Name: "hetzner",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			manager, err := hetzner.NewManager(appConfig.HetznerAPIKey)
+			if err != nil {
+				return manager, errors.New("could not create hetzner client")
+			}
+			return manager, nil
+		},
+		SetCredentials: func(appConfig *config.AppConfig, apiKey string) {
+			appConfig.HetznerAPIKey = apiKey
+		},
+		Regions:      hetzner.Regions,
+		Sizes:        hetzner.Sizes,
+		DefaultSize:  "cx22", // cax11 with arch: arm64
+		DefaultImage: core.DefaultOS,
+	})
+
+	provider.Register(provider.Provider{
+		Name: "linode",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			manager, err := linode.NewManager(appConfig.LinodeAPIKey)
+			if err != nil {
+				return manager, errors.New("could not create linode client")
+			}
+			return manager, nil
+		},
+		SetCredentials: func(appConfig *config.AppConfig, apiKey string) {
+			appConfig.LinodeAPIKey = apiKey
+		},
+		Regions:         linode.Regions,
+		Sizes:           linode.Sizes,
+		DefaultSize:     "g6-nanode-1",
+		DefaultImage:    core.DefaultOS,
+		DefaultNodeSize: "g6-standard-2",
+	})
+
+	provider.Register(provider.Provider{
+		Name: "ssh",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			// servers are listed in the deploy file rather than the app config
+			// note: servers already exist so there is no size or image to pick
+			return newSSHManager()
+		},
+	})
+
+	provider.Register(provider.Provider{
+		Name: "vultr",
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			manager, err := vultr.NewManager(appConfig.VultrAPIKey)
+			if err != nil {
+				return manager, errors.New("could not create vultr client")
+			}
+			return manager, nil
+		},
+		SetCredentials: func(appConfig *config.AppConfig, apiKey string) {
+			appConfig.VultrAPIKey = apiKey
+		},
+		Regions:         vultr.Regions,
+		Sizes:           vultr.Sizes,
+		DefaultSize:     "vc2-1c-1gb", // $5/month
+		DefaultImage:    core.DefaultOS,
+		DefaultNodeSize: "vc2-2c-4gb",
+	})
+}
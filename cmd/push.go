@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eezhee/eezhee/pkg/k3s"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pushDeployment string
+	pushNamespace  string
+)
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+	pushCmd.Flags().StringVarP(&pushDeployment, "deployment", "d", "", "deployment to roll to the new image")
+	pushCmd.Flags().StringVarP(&pushNamespace, "namespace", "n", "default", "namespace of the deployment")
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push [image]",
+	Short: "Copy a locally built image onto the cluster",
+	Long: `Side-load a container image onto every node of the cluster so no registry is needed.
+The image can be an OCI layout directory or a tarball from 'docker save'.
+Deployments should use 'imagePullPolicy: IfNotPresent' for the image`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := pushImage(args[0])
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// pushImage will import an image into containerd on each node of the cluster
+func pushImage(imagePath string) error {
+
+	deployState, err := loadDeployState()
+	if err != nil {
+		return err
+	}
+	nodes, err := getClusterNodes(deployState)
+	if err != nil {
+		return err
+	}
+
+	// figure out what we are pushing
+	archive, err := k3s.OpenImageArchive(imagePath)
+	if err != nil {
+		return err
+	}
+	if len(pushDeployment) > 0 && len(archive.Name) == 0 {
+		return errors.New("image does not have a name so can not be used by a deployment")
+	}
+	if len(pushDeployment) > 0 && !k3s.ValidNamespace(pushNamespace) {
+		return fmt.Errorf("invalid namespace: %s", pushNamespace)
+	}
+	if len(pushDeployment) > 0 && !k3s.ValidResourceName(pushDeployment) {
+		return fmt.Errorf("invalid deployment name: %s", pushDeployment)
+	}
+
+	// stream the image to each node
+	k3sManager := new(k3s.Manager)
+	digest := ""
+	for _, node := range nodes {
+		log.Info("pushing ", archive.Name, " to ", node)
+		digest, err = k3sManager.ImportImage(node, archive)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%s %s\n", archive.Name, digest)
+
+	// point the deployment at the image that was just loaded
+	if len(pushDeployment) > 0 {
+		err = k3sManager.RolloutImage(nodes[0], pushNamespace, pushDeployment, archive.Name)
+		if err != nil {
+			return err
+		}
+		log.Info("deployment ", pushDeployment, " restarted with ", archive.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var regionsCloud string
+var regionsPing bool
+var regionsOutput string
+
+func init() {
+	rootCmd.AddCommand(regionsCmd)
+	regionsCmd.Flags().StringVar(&regionsCloud, "cloud", "", "cloud to list regions of (default cloud in deploy file or default cloud)")
+	regionsCmd.Flags().BoolVar(&regionsPing, "ping", false, "rank regions by latency from this machine")
+	regionsCmd.Flags().StringVarP(&regionsOutput, "output", "o", "table", "output format (table or json)")
+}
+
+var regionsCmd = &cobra.Command{
+	Use:   "regions",
+	Short: "List the regions of a cloud",
+	Long: `List the regions a cloud has, where they are and if the sizes eezhee uses can be created in them.
+Regions come from the cloud's api (if it has credentials) merged with the catalog built into eezhee.
+With --ping, regions are ranked by latency (measurements are reused for a day)`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := listRegions(cmd.Context())
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// regionRow is a region as shown by 'eezhee regions'
+type regionRow struct {
+	Slug      string          `json:"slug"`
+	Name      string          `json:"name"`
+	City      string          `json:"city,omitempty"`
+	State     string          `json:"state,omitempty"`
+	Country   string          `json:"country,omitempty"`
+	Area      string          `json:"area,omitempty"` // generic region (ie us-east)
+	Available bool            `json:"available"`
+	Sizes     map[string]bool `json:"sizes,omitempty"` // if each preferred size can be created. missing if not known
+	LatencyMS int64           `json:"latency_ms,omitempty"`
+	Method    string          `json:"latency_method,omitempty"` // icmp, tcp or https
+	Error     string          `json:"latency_error,omitempty"`  // why region could not be reached
+}
+
+// listRegions prints the regions of the selected cloud
+func listRegions(ctx context.Context) error {
+
+	if regionsOutput != "table" && regionsOutput != "json" {
+		return fmt.Errorf("invalid output format %s. use table or json", regionsOutput)
+	}
+
+	// use the same cloud and size a build would
+	deployConfig := config.NewDeployConfig()
+	if deployConfig.FileExists() {
+		err := deployConfig.Load()
+		if err != nil {
+			return err
+		}
+	}
+	cloudProvider, err := selectCloud(regionsCloud, deployConfig)
+	if err != nil {
+		return err
+	}
+
+	err = resolveSize(cloudProvider, deployConfig)
+	if err != nil {
+		return err
+	}
+	sizes := preferredSizes(cloudProvider, deployConfig)
+	rows, err := getRegionRows(ctx, cloudProvider, sizes)
+	if err != nil {
+		return err
+	}
+
+	if regionsPing {
+		err = rankRegionRows(ctx, cloudProvider, rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	if regionsOutput == "json" {
+		return printJSON(rows)
+	}
+
+	printRegionRows(rows, sizes)
+	return nil
+}
+
+// preferredSizes are the sizes eezhee would create on the cloud
+func preferredSizes(cloudProvider provider.Provider, deployConfig *config.DeployConfig) []string {
+
+	var sizes []string
+	for _, size := range []string{deployConfig.Size, cloudProvider.DefaultSize, cloudProvider.DefaultNodeSize} {
+		if len(size) > 0 && !containsString(sizes, size) {
+			sizes = append(sizes, size)
+		}
+	}
+
+	return sizes
+}
+
+// getRegionRows merges the regions from the cloud's api with the catalog
+// catalog regions come first in order of preference, followed by any new regions the catalog doesn't know about
+func getRegionRows(ctx context.Context, cloudProvider provider.Provider, sizes []string) ([]regionRow, error) {
+
+	var catalogRegions []core.RegionInfo
+	if cloudProvider.Regions != nil {
+		var err error
+		catalogRegions, err = cloudProvider.Regions.GetList()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	apiRegions, err := listCloudRegions(ctx, cloudProvider)
+	if err != nil {
+		if len(catalogRegions) == 0 {
+			return nil, err
+		}
+		log.Warn("showing regions from catalog only. ", err)
+	}
+
+	// without the api, there is nothing to merge
+	if apiRegions == nil {
+		var rows []regionRow
+		for _, region := range catalogRegions {
+			rows = append(rows, newRegionRow(region, nil))
+		}
+		return rows, nil
+	}
+
+	var rows []regionRow
+	for _, region := range catalogRegions {
+		apiRegion, found := findRegion(apiRegions, region.Slug)
+		if !found {
+			log.Debug(cloudProvider.Name, " no longer has region ", region.Slug)
+			continue
+		}
+		region.Available = apiRegion.Available
+		region.Sizes = apiRegion.Sizes
+		rows = append(rows, newRegionRow(region, sizes))
+	}
+	for _, region := range apiRegions {
+		if _, found := findRegion(catalogRegions, region.Slug); !found {
+			rows = append(rows, newRegionRow(region, sizes))
+		}
+	}
+
+	return rows, nil
+}
+
+// listCloudRegions asks the cloud's api for its regions
+// returns nil (without an error) if the cloud can't list its regions
+func listCloudRegions(ctx context.Context, cloudProvider provider.Provider) ([]core.RegionInfo, error) {
+
+	vmManager, err := GetManager(cloudProvider.Name)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := core.Supports[core.RegionLister](vmManager)
+	if !ok {
+		if cloudProvider.Regions == nil {
+			return nil, fmt.Errorf("%s can not list its regions", cloudProvider.Name)
+		}
+		return nil, nil
+	}
+
+	regions, err := lister.ListRegions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get regions from %s: %w", cloudProvider.Name, err)
+	}
+
+	return regions, nil
+}
+
+// findRegion looks for a region in a list by its slug
+func findRegion(regions []core.RegionInfo, slug string) (core.RegionInfo, bool) {
+	for _, region := range regions {
+		if region.Slug == slug {
+			return region, true
+		}
+	}
+	return core.RegionInfo{}, false
+}
+
+// newRegionRow converts a region for display
+// sizes are only checked if the cloud said which sizes the region has
+func newRegionRow(region core.RegionInfo, sizes []string) regionRow {
+
+	row := regionRow{
+		Slug:      region.Slug,
+		Name:      region.Name,
+		City:      region.City,
+		State:     region.State,
+		Country:   region.Country,
+		Area:      region.Area,
+		Available: region.Available,
+	}
+	if region.Sizes != nil && len(sizes) > 0 {
+		row.Sizes = map[string]bool{}
+		for _, size := range sizes {
+			row.Sizes[size] = region.Available && containsString(region.Sizes, size)
+		}
+	}
+
+	return row
+}
+
+// rankRegionRows sorts regions by their latency, closest first
+// regions that couldn't be reached (or have no host to probe) go at the end
+func rankRegionRows(ctx context.Context, cloudProvider provider.Provider, rows []regionRow) error {
+
+	catalog, ok := cloudProvider.Regions.(*core.RegionCatalog)
+	if !ok || len(catalog.PingHosts) == 0 {
+		return fmt.Errorf("latency can not be measured for %s", cloudProvider.Name)
+	}
+
+	ranked, err := core.RankRegions(ctx, cloudProvider.Name, catalog.PingHosts)
+	if err != nil {
+		return err
+	}
+
+	rank := map[string]int{}
+	for index, latency := range ranked {
+		rank[latency.ID] = index
+		for i := range rows {
+			if rows[i].Slug != latency.ID {
+				continue
+			}
+			if latency.Reachable() {
+				rows[i].LatencyMS = latency.Latency.Milliseconds()
+				rows[i].Method = latency.Method
+			} else {
+				rows[i].Error = latency.Error
+			}
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		rankI, foundI := rank[rows[i].Slug]
+		rankJ, foundJ := rank[rows[j].Slug]
+		if foundI != foundJ {
+			return foundI
+		}
+		return rankI < rankJ
+	})
+
+	return nil
+}
+
+// containsString checks if a list of strings has the given value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// printRegionRows shows the regions as a table
+func printRegionRows(rows []regionRow, sizes []string) {
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	header := []string{"REGION", "NAME", "LOCATION", "AREA"}
+	header = append(header, sizes...)
+	if regionsPing {
+		header = append(header, "LATENCY")
+	}
+	fmt.Fprintln(writer, strings.Join(header, "\t"))
+
+	for _, row := range rows {
+		name := row.Name
+		if !row.Available {
+			name = name + " (unavailable)"
+		}
+		location := row.City
+		if len(row.Country) > 0 {
+			location = location + ", " + strings.ToUpper(row.Country)
+		}
+
+		columns := []string{row.Slug, name, location, row.Area}
+		for _, size := range sizes {
+			available, known := row.Sizes[size]
+			switch {
+			case !known:
+				columns = append(columns, "?")
+			case available:
+				columns = append(columns, "yes")
+			default:
+				columns = append(columns, "no")
+			}
+		}
+		if regionsPing {
+			latency := "-"
+			if len(row.Method) > 0 {
+				latency = (time.Duration(row.LatencyMS) * time.Millisecond).String()
+			}
+			columns = append(columns, latency)
+		}
+		fmt.Fprintln(writer, strings.Join(columns, "\t"))
+	}
+
+	writer.Flush()
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/k3s"
+	"github.com/sethvargo/go-password/password"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const registryUsername = "eezhee"
+
+var registryPasswordStdin bool
+
+func init() {
+	rootCmd.AddCommand(registryCmd)
+	registryCmd.AddCommand(registryInstallCmd)
+	registryCmd.AddCommand(registryLoginCmd)
+	registryCmd.AddCommand(registryAuthCmd)
+	registryAuthCmd.Flags().BoolVar(&registryPasswordStdin, "password-stdin", false, "read the password (or token) from stdin")
+}
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Manage container registries used by the cluster",
+	Long:  `Run a private registry in the cluster and configure which registries nodes can pull from`,
+}
+
+var registryInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Setup registries listed in the deploy file",
+	Long: `Install the built-in registry (if enabled in deploy.yaml) and write
+/etc/rancher/k3s/registries.yaml on every node`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		deployState, err := loadDeployState()
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+
+		deployConfig := config.NewDeployConfig()
+		if deployConfig.FileExists() {
+			err = deployConfig.Load()
+			if err != nil {
+				os.Exit(1)
+			}
+		}
+
+		err = setupRegistries(deployConfig, deployState)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var registryLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Print docker login command for the built-in registry",
+	Long:  `Print the command to log docker into the registry running in the cluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		deployState, err := loadDeployState()
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		if len(deployState.RegistryHost) == 0 {
+			log.Error("cluster does not have a registry. set 'registry: enabled: true' in deploy.yaml")
+			os.Exit(1)
+		}
+
+		credentials, found := AppConfig.GetRegistryCredentials(deployState.RegistryHost)
+		if !found {
+			log.Error("no credentials found for ", deployState.RegistryHost)
+			os.Exit(1)
+		}
+
+		fmt.Printf("echo '%s' | docker login %s --username %s --password-stdin\n",
+			credentials.Password, credentials.Host, credentials.Username)
+	},
+}
+
+var registryAuthCmd = &cobra.Command{
+	Use:   "auth [host] [username]",
+	Short: "Save credentials for an external registry",
+	Long: `Save the username and password (or token) nodes should use to pull from a registry like ghcr.io
+The password is asked for or, with --password-stdin, read from stdin (ie echo $TOKEN | eezhee registry auth ghcr.io me --password-stdin)`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if !k3s.ValidHost(args[0]) {
+			log.Error("invalid registry host. use just the hostname, ie ghcr.io")
+			os.Exit(1)
+		}
+
+		registryPassword, err := readRegistryPassword(args[0])
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+
+		AppConfig.SetRegistryCredentials(config.RegistryCredentials{
+			Host:     args[0],
+			Username: args[1],
+			Password: registryPassword,
+		})
+		err = AppConfig.Save()
+		if err != nil {
+			log.Error("could not save registry credentials. ", err)
+			os.Exit(1)
+		}
+
+		log.Info("credentials for ", args[0], " added to config")
+	},
+}
+
+// readRegistryPassword gets the password from stdin or asks for it without echoing it
+// note: passwords aren't taken as arguments as they'd end up in the shell history
+func readRegistryPassword(host string) (string, error) {
+
+	var registryPassword string
+	if registryPasswordStdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		registryPassword = strings.TrimRight(string(content), "\r\n")
+	} else {
+		stdin := int(os.Stdin.Fd())
+		if !term.IsTerminal(stdin) {
+			return "", errors.New("no terminal to ask for the password. use --password-stdin")
+		}
+		fmt.Fprint(os.Stderr, "password for ", host, ": ")
+		content, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		registryPassword = string(content)
+	}
+	if len(registryPassword) == 0 {
+		return "", errors.New("password can't be empty")
+	}
+
+	return registryPassword, nil
+}
+
+// setupRegistries will install the built-in registry and tell each node about all the registries
+func setupRegistries(deployConfig *config.DeployConfig, deployState *config.DeployState) error {
+
+	registryConfig := deployConfig.Registry
+	if !registryConfig.Enabled && len(registryConfig.External) == 0 {
+		// nothing to do
+		return nil
+	}
+
+	nodes, err := getClusterNodes(deployState)
+	if err != nil {
+		return err
+	}
+
+	k3sManager := new(k3s.Manager)
+	var registries []k3s.Registry
+
+	if registryConfig.Enabled {
+
+		host := registryConfig.Host
+		if len(host) == 0 {
+			host = k3s.DefaultRegistryHost(nodes[0])
+		}
+		if !k3s.ValidHost(host) {
+			return fmt.Errorf("invalid registry host: %s", host)
+		}
+
+		// generate credentials the first time registry is used
+		credentials, found := AppConfig.GetRegistryCredentials(host)
+		if !found {
+			credentials.Username = registryUsername
+			credentials.Password, err = password.Generate(32, 8, 0, false, true)
+			if err != nil {
+				return err
+			}
+			AppConfig.SetRegistryCredentials(credentials)
+			err = AppConfig.Save()
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Info("installing registry at ", host)
+		err = k3sManager.InstallRegistry(nodes[0], host, credentials.Username, credentials.Password, AppConfig.ACMEEmail)
+		if err != nil {
+			return err
+		}
+		registries = append(registries, k3s.Registry{
+			Host:     host,
+			Username: credentials.Username,
+			Password: credentials.Password,
+		})
+
+		deployState.RegistryHost = host
+		err = deployState.Save()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, external := range registryConfig.External {
+
+		if !k3s.ValidHost(external.Host) {
+			return fmt.Errorf("invalid registry host: %s", external.Host)
+		}
+
+		registry := k3s.Registry{
+			Host:               external.Host,
+			MirrorFor:          external.MirrorFor,
+			InsecureSkipVerify: external.InsecureSkipVerify,
+		}
+		if credentials, found := AppConfig.GetRegistryCredentials(external.Host); found {
+			registry.Username = credentials.Username
+			registry.Password = credentials.Password
+		}
+		if len(external.CAFile) > 0 {
+			caCert, err := os.ReadFile(external.CAFile)
+			if err != nil {
+				return errors.New("could not read CA file for " + external.Host)
+			}
+			registry.CACert = string(caCert)
+		}
+		registries = append(registries, registry)
+	}
+
+	for _, node := range nodes {
+		err = k3sManager.ConfigureRegistries(node, registries)
+		if err != nil {
+			return err
+		}
+	}
+	log.Info("registries configured on ", len(nodes), " node(s)")
+
+	return nil
+}
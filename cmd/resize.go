@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var resizeTimeout time.Duration // set with --timeout
+
+func init() {
+	rootCmd.AddCommand(resizeCmd)
+	resizeCmd.Flags().DurationVar(&resizeTimeout, "timeout", 20*time.Minute, "how long to wait for the VM to be resized")
+}
+
+var resizeCmd = &cobra.Command{
+	Use:   "resize up|down|[size]",
+	Short: "Change the size of the cluster's VM",
+	Long: `Move the cluster's VM to the next size up or down, or to the given size.
+The size can be the cloud's own name for it or a generic one (ie 2cpu4gb).
+The VM is restarted so the cluster is unavailable for a few minutes`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, resizeTimeout)
+		defer cancel()
+
+		err := resizeCluster(ctx, args[0])
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// resizeCluster moves the VM in the deploy state to a new size
+func resizeCluster(ctx context.Context, size string) error {
+
+	deployState := config.NewDeployState()
+	if !deployState.FileExists() {
+		return errors.New("no cluster to resize (no deploy-state file)")
+	}
+	err := deployState.Load()
+	if err != nil {
+		return err
+	}
+	if deployState.Type == "managed" {
+		return errors.New("managed clusters can't be resized. change the size of the node pools instead")
+	}
+
+	cloudProvider, err := provider.Get(deployState.Cloud)
+	if err != nil {
+		return err
+	}
+
+	newSize, err := getNewSize(cloudProvider, deployState.Size, size)
+	if err != nil {
+		return err
+	}
+	if newSize == deployState.Size {
+		log.Info(deployState.Name, " is already ", newSize)
+		return nil
+	}
+
+	vmManager, err := GetManager(deployState.Cloud)
+	if err != nil {
+		return err
+	}
+	resizer, ok := core.Supports[core.VMResizer](vmManager)
+	if !ok {
+		return fmt.Errorf("resizing VMs is not supported on %s", deployState.Cloud)
+	}
+
+	response := ""
+	fmt.Printf("resizing restarts the VM. resize %s from %s to %s (y/N)? ", deployState.Name, deployState.Size, newSize)
+	fmt.Scanln(&response)
+	if strings.ToLower(response) != "y" {
+		return errors.New("resize aborted")
+	}
+
+	log.Info("resizing ", deployState.Name, " to ", newSize)
+	err = resizer.ResizeVM(ctx, deployState.ID, newSize)
+	if err != nil {
+		return resizeError(ctx, err)
+	}
+
+	// some clouds return before the VM has been restarted
+	var vmInfo core.VMInfo
+	lastStatus := ""
+	for vmInfo.Status != "running" || vmInfo.SizeSlug != newSize {
+		err = sleep(ctx, statusCheckDelay)
+		if err != nil {
+			return resizeError(ctx, err)
+		}
+		vmInfo, err = vmManager.GetVMInfo(ctx, deployState.ID)
+		if err != nil {
+			return resizeError(ctx, err)
+		}
+		if vmInfo.Status != lastStatus {
+			log.Info("vm in ", vmInfo.Status, " state")
+			lastStatus = vmInfo.Status
+		}
+	}
+
+	// update state file with the new size
+	deployState.Size = newSize
+	publicIP, err := vmInfo.GetPublicIP()
+	if err == nil && publicIP != deployState.IP {
+		log.Warn("ip of ", deployState.Name, " changed to ", publicIP, ". kubeconfig and dns records need to be updated")
+		deployState.IP = publicIP
+	}
+	err = deployState.Save()
+	if err != nil {
+		return err
+	}
+	log.Info(deployState.Name, " is now ", newSize)
+
+	return nil
+}
+
+// getNewSize works out what size to move to
+// size is 'up', 'down' or a size (either the cloud's own or generic)
+func getNewSize(cloudProvider provider.Provider, currentSize string, size string) (string, error) {
+
+	if cloudProvider.Sizes == nil {
+		if size == "up" || size == "down" {
+			return "", fmt.Errorf("%s sizes are not in catalog. use 'eezhee resize [size]'", cloudProvider.Name)
+		}
+		return size, nil
+	}
+
+	var info core.SizeInfo
+	var err error
+	switch size {
+	case "up":
+		info, err = cloudProvider.Sizes.GetLargerSize(currentSize)
+	case "down":
+		info, err = cloudProvider.Sizes.GetSmallerSize(currentSize)
+	default:
+		// generic sizes stay on the same arch
+		current, _ := cloudProvider.Sizes.GetInfo(currentSize)
+		return core.ResolveSize(cloudProvider.Sizes, size, current.Arch)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return info.Slug, nil
+}
+
+// resizeError explains why a resize stopped part way
+func resizeError(ctx context.Context, err error) error {
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		return errors.New("resize interrupted. check the VM with 'eezhee list'")
+	case ctx.Err() != nil:
+		return fmt.Errorf("resize took longer than %s. check the VM with 'eezhee list'", resizeTimeout)
+	}
+
+	return err
+}
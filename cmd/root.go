@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/provider"
 	homedir "github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -28,7 +29,12 @@ var (
 
 // Execute root command
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+
+	// let any provider plugins shut down cleanly
+	provider.Close()
+
+	if err != nil {
 		// log.Fatal(err)
 		os.Exit(1)
 	}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/k3s"
+	"github.com/eezhee/eezhee/pkg/secrets"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsApplyCmd)
+}
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage kubernetes secrets for your app",
+	Long:  `Create kubernetes secrets from dotenv, sops or age encrypted files listed in deploy.yaml`,
+}
+
+var secretsApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update secrets listed in the deploy file",
+	Long: `Decrypt (in memory) the files in the 'secrets' section of deploy.yaml and create or update
+the matching kubernetes secrets. Deployments using a secret are restarted if its values change`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		deployState, err := loadDeployState()
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+
+		deployConfig := config.NewDeployConfig()
+		if !deployConfig.FileExists() {
+			log.Error("no deploy.yaml file so no secrets to apply")
+			os.Exit(1)
+		}
+		err = deployConfig.Load()
+		if err != nil {
+			os.Exit(1)
+		}
+
+		err = applySecrets(deployConfig, deployState)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// applySecrets will create or update each secret in the deploy config
+func applySecrets(deployConfig *config.DeployConfig, deployState *config.DeployState) error {
+
+	if len(deployConfig.Secrets) == 0 {
+		return nil
+	}
+	hashKey, err := getSecretKey(deployState)
+	if err != nil {
+		return err
+	}
+
+	// load everything first so a bad file doesn't leave the cluster half updated
+	var clusterSecrets []*secrets.Secret
+	for _, secretConfig := range deployConfig.Secrets {
+		secret, err := secrets.Load(secrets.Source{
+			Name:        secretConfig.Name,
+			Namespace:   secretConfig.Namespace,
+			EnvFile:     secretConfig.EnvFile,
+			SOPSFile:    secretConfig.SOPSFile,
+			AgeFile:     secretConfig.AgeFile,
+			Deployments: secretConfig.Deployments,
+			HashKey:     hashKey,
+		})
+		if err != nil {
+			return err
+		}
+		clusterSecrets = append(clusterSecrets, secret)
+	}
+
+	nodes, err := getClusterNodes(deployState)
+	if err != nil {
+		return err
+	}
+	conn, err := k3s.Connect(nodes[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, secret := range clusterSecrets {
+
+		// make sure namespace exists
+		namespace := fmt.Sprintf(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"%s"}}`, secret.Namespace)
+		err = k3s.Apply(conn, namespace)
+		if err != nil {
+			return err
+		}
+
+		manifest, err := secret.Manifest()
+		if err != nil {
+			return err
+		}
+		err = k3s.ServerSideApply(conn, manifest)
+		if err != nil {
+			return err
+		}
+		log.Info("secret ", secret.Namespace, "/", secret.Name, " updated")
+
+		// pods only get new values when they restart
+		// patch only changes the deployment (and rolls it) if the hash changed
+		for _, deployment := range secret.Deployments {
+			command := fmt.Sprintf("k3s kubectl -n %s patch deployment %s -p '%s'",
+				secret.Namespace, deployment, secret.RestartPatch())
+			output, err := k3s.RunCommand(conn, command)
+			if err != nil {
+				log.Warn("could not restart deployment ", deployment, ": ", strings.TrimSpace(output))
+			}
+		}
+	}
+
+	return nil
+}
+
+// getSecretKey returns the key secret values are hashed with
+// it is created the first time secrets are applied to the cluster
+func getSecretKey(deployState *config.DeployState) ([]byte, error) {
+
+	if len(deployState.SecretKey) > 0 {
+		key, err := hex.DecodeString(deployState.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret-key in deploy state: %w", err)
+		}
+		return key, nil
+	}
+
+	key, err := secrets.NewHashKey()
+	if err != nil {
+		return nil, err
+	}
+	deployState.SecretKey = hex.EncodeToString(key)
+	err = deployState.Save()
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -22,7 +24,7 @@ var teardownCmd = &cobra.Command{
 	Long:  `All software has versions. This is Eezhee's`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		err := teardownVM()
+		err := teardownVM(cmd.Context())
 		if err != nil {
 			log.Error(err)
 			os.Exit(1)
@@ -31,7 +33,7 @@ var teardownCmd = &cobra.Command{
 }
 
 // teardownVM will tear down the cluster & app
-func teardownVM() error {
+func teardownVM(ctx context.Context) error {
 
 	// see if there is a state file (so we know what we're supposed to teardown)
 	deployStateFile := config.NewDeployState()
@@ -45,16 +47,6 @@ func teardownVM() error {
 		return errors.New("error reading deploy state file")
 	}
 
-	// see which cloud cluster created on
-	cloud := deployStateFile.Cloud
-
-	// create a manager for desired cloud
-	vmManager, err := GetManager(cloud)
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-
 	// get details of VM
 	ID := deployStateFile.ID
 	if len(ID) == 0 {
@@ -76,12 +68,61 @@ func teardownVM() error {
 		return errors.New("deletion aborted")
 	}
 
-	// ready to delete the cluster
-	err = vmManager.DeleteVM(ID)
+	return destroyCluster(ctx, deployStateFile)
+}
+
+// destroyCluster deletes the cluster (or VM) in the deploy state along with
+// everything eezhee set up for it, then removes the deploy state file
+func destroyCluster(ctx context.Context, deployStateFile *config.DeployState) error {
+
+	// see which cloud cluster created on
+	cloud := deployStateFile.Cloud
+
+	// create a manager for desired cloud
+	vmManager, err := GetManager(cloud)
 	if err != nil {
+		log.Error(err)
 		return err
 	}
-	log.Info("k3s cluster (and VM) deleted")
+	clusterManager, isManaged := vmManager.(core.ClusterManager)
+	if deployStateFile.Type == "managed" && !isManaged {
+		return fmt.Errorf("managed clusters are not supported on %s", cloud)
+	}
+
+	// ready to delete the cluster
+	ID := deployStateFile.ID
+	if deployStateFile.Type == "managed" {
+		err = clusterManager.DeleteCluster(ctx, ID)
+		if errors.Is(err, core.ErrNotFound) {
+			log.Warn("managed cluster was already deleted")
+		} else if err != nil {
+			return err
+		} else {
+			log.Info("managed cluster deleted")
+		}
+	} else {
+		err = vmManager.DeleteVM(ctx, ID)
+		if errors.Is(err, core.ErrNotFound) {
+			log.Warn("VM was already deleted")
+		} else if err != nil {
+			return err
+		} else {
+			log.Info("k3s cluster (and VM) deleted")
+		}
+	}
+
+	// remove any dns records created by 'eezhee expose'
+	for _, service := range deployStateFile.Exposed {
+		if len(service.DNSRecord) == 0 {
+			continue
+		}
+		err = deleteDNSRecord(service, false)
+		if err != nil {
+			log.Warn("could not remove dns record for ", service.Host, ": ", err)
+			continue
+		}
+		log.Debug("removed dns record for ", service.Host)
+	}
 
 	// remove the kubeconfig file
 	kubeConfigFile, _ := filepath.Abs("kubeconfig")
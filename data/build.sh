@@ -1 +0,0 @@
-go build -o process_files
\ No newline at end of file
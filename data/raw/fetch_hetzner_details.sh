@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+
+# get hetzner details
+# note: hetzner api needs a token (HCLOUD_TOKEN) even for public details
+echo "getting info from hetzner"
+curl -s -H "Authorization: Bearer $HCLOUD_TOKEN" 'https://api.hetzner.cloud/v1/server_types' | json_pp > hetzner-server-types.json
+curl -s -H "Authorization: Bearer $HCLOUD_TOKEN" 'https://api.hetzner.cloud/v1/locations' | json_pp > hetzner-locations.json
+curl -s -H "Authorization: Bearer $HCLOUD_TOKEN" 'https://api.hetzner.cloud/v1/images?type=system' | json_pp > hetzner-images.json
+
+echo "done"
@@ -1,196 +1,493 @@
 package aws
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
-	"math"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/eezhee/eezhee/pkg/core"
 	log "github.com/sirupsen/logrus"
 )
 
+// region used for account level calls if profile doesn't set one
+const defaultRegion = "us-east-1"
+
+// Regions are the regions aws has (from the catalog built into eezhee)
+// note: SelectClosestRegion pings the ec2 endpoint of each region instead
+var Regions core.Regions = core.NewRegionCatalog("aws", nil)
+
+// Sizes are the VM sizes aws has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("aws")
+
+// name of security group (in each region) that eezhee VMs use
+const securityGroupName = "eezhee"
+
+// ports k3s clusters need open: ssh, http, https & kubernetes api
+var clusterPorts = []int64{22, 80, 443, 6443}
+
+// ubuntu & debian AMIs don't allow root logins by default
+// note: k3s installer is run as root
+const userData = `#cloud-config
+disable_root: false
+`
+
 // Manager controls access to AWS
 type Manager struct {
-	APIToken string
-	api      *session.Session
+	Profile string // profile in ~/.aws/credentials (optional)
+	api     *session.Session
 }
 
 // NewManager creates a manage object & inits it
-func NewManager(providerAPIToken string) (core.VMManager, error) {
+// credentials come from the standard aws chain: env variables, ~/.aws/credentials & profiles
+func NewManager(profile string) (core.VMManager, error) {
 
-	// if user as aws-cli installed, sdk can find ~/.aws/credential file and load keys
-	// otherwise, we can create it when user enters details
 	manager := new(Manager)
+	manager.Profile = profile
 
-	// make sure we have an api token
-	if len(providerAPIToken) == 0 {
-		// check places provider CLI tools store token
-		providerAPIToken := manager.FindAuthToken()
-		if len(providerAPIToken) == 0 {
-			// log.Error("no aws api token set")
-			return manager, errors.New("no aws api token set")
-		}
-		// ok we found a token
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return manager, err
 	}
-	manager.APIToken = providerAPIToken
-
-	manager.api = session.Must(session.NewSession(&aws.Config{
-		Region: aws.String("us-west-1"),
-	}))
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(defaultRegion)
+	}
+	manager.api = sess
 
-	// manager.api = session.Must(session.NewSessionWithOptions(session.Options{
-	// 	SharedConfigState: session.SharedConfigEnable,
-	// }))
+	// make sure we have credentials
+	if len(manager.FindAuthToken()) == 0 {
+		return manager, errors.New("no aws credentials found")
+	}
 
 	return manager, nil
 }
 
-// GetAuthToken will check common place for aws api key
+// FindAuthToken will return the access key id the credential chain found (if any)
 func (m *Manager) FindAuthToken() string {
-	return ""
+
+	credentials, err := m.api.Config.Credentials.Get()
+	if err != nil {
+		log.Debug("could not find aws credentials: ", err)
+		return ""
+	}
+
+	return credentials.AccessKeyID
 }
 
-// IsSSHKeyUploaded checks if ssh key already uploaded to DigitalOcean
-func (m *Manager) IsSSHKeyUploaded(desiredSSHKey core.SSHKey) (keyID string, err error) {
+// ValidateCredentials will make sure aws accepts the credentials
+func (m *Manager) ValidateCredentials() error {
 
-	// TODO: API calls are region specific. so if import key, only for that region of AWS
+	svc := sts.New(m.api)
+	_, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 
-	svc := ec2.New(m.api)
-	dkpOutput, err := svc.DescribeKeyPairs(nil)
-	if err != nil {
-		// errrors.New("Unable to get key pairs, %v", err)
-		return "", err
+	return convertError(err)
+}
+
+// regionClient returns an ec2 client for a given region
+func (m *Manager) regionClient(region string) *ec2.EC2 {
+
+	if len(region) == 0 {
+		return ec2.New(m.api)
 	}
-	// func (c *EC2) CreateKeyPair(input *CreateKeyPairInput) (*CreateKeyPairOutput, error)
-	foundKeyPair := false
-	for _, keyPair := range dkpOutput.KeyPairs {
-		log.Debug(keyPair)
-		keyID = *keyPair.KeyPairId
+
+	return ec2.New(m.api, aws.NewConfig().WithRegion(region))
+}
+
+// keyPairName is what we call the key in each region
+// note: key pairs are per region so key is imported into each region we use
+func keyPairName(sshKey core.SSHKey) string {
+
+	// if account shared with more than one person, key name needs to be unique
+	fingerprint := sshKey.Fingerprint()
+	return "eezhee-" + strings.ReplaceAll(fingerprint[0:8], ":", "")
+}
+
+// IsSSHKeyUploaded checks if ssh key already uploaded to the default region
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, desiredSSHKey core.SSHKey) (keyID string, err error) {
+	return m.findKeyPair(ctx, m.regionClient(""), desiredSSHKey)
+}
+
+// findKeyPair will look for our key pair in a region
+func (m *Manager) findKeyPair(ctx context.Context, svc *ec2.EC2, desiredSSHKey core.SSHKey) (keyID string, err error) {
+
+	output, err := svc.DescribeKeyPairsWithContext(ctx, &ec2.DescribeKeyPairsInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("key-name"),
+			Values: []*string{aws.String(keyPairName(desiredSSHKey))},
+		}},
+		IncludePublicKey: aws.Bool(true),
+	})
+	if err != nil {
+		return "", convertError(err)
 	}
 
-	if foundKeyPair {
-		return keyID, nil
+	// make sure it is the same key (not just the same name)
+	for _, keyPair := range output.KeyPairs {
+		publicKey := strings.TrimSpace(aws.StringValue(keyPair.PublicKey))
+		if strings.HasPrefix(publicKey, desiredSSHKey.GetPublicKey()) {
+			return aws.StringValue(keyPair.KeyPairId), nil
+		}
 	}
 
-	// is not on AWS yet
-	return "", err
+	return "", errors.New("ssh key not available on aws")
+}
+
+// UploadSSHKey will upload a given ssh key to the default region
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (keyID string, err error) {
+	return m.importKeyPair(ctx, m.regionClient(""), sshKey)
 }
 
-// UploadSSHKey will upload a given ssh key to AWS
-func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (keyID string, err error) {
+// importKeyPair will import our key into a region
+func (m *Manager) importKeyPair(ctx context.Context, svc *ec2.EC2, sshKey core.SSHKey) (keyID string, err error) {
 
-	// need to create a new keypair
-	var keyPairInfo ec2.ImportKeyPairInput
-	keyPairInfo.SetKeyName(keyName)
-	keyPairInfo.SetPublicKeyMaterial([]byte(sshKey.GetPublicKey()))
-	//keyPairInfo.SetDryRun()
-	err = keyPairInfo.Validate()
+	keyPair, err := svc.ImportKeyPairWithContext(ctx, &ec2.ImportKeyPairInput{
+		KeyName:           aws.String(keyPairName(sshKey)),
+		PublicKeyMaterial: []byte(sshKey.GetPublicKey()),
+	})
 	if err != nil {
-		return keyID, err
+		return "", fmt.Errorf("could not upload ssh key: %w", convertError(err))
 	}
+	log.Debug("imported key pair ", aws.StringValue(keyPair.KeyFingerprint))
+
+	return aws.StringValue(keyPair.KeyPairId), nil
+}
 
-	svc := ec2.New(m.api)
-	keyPair, err := svc.ImportKeyPair(&keyPairInfo)
+// SelectClosestRegion will ping all regions account can use and return the closest
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+
+	svc := m.regionClient("")
+	output, err := svc.DescribeRegionsWithContext(ctx, &ec2.DescribeRegionsInput{})
 	if err != nil {
-		return keyID, err
+		return "", convertError(err)
 	}
-	keyID = *keyPair.KeyPairId
-	log.Debug(keyPair.KeyFingerprint)
 
-	return keyID, nil
+	// ec2 endpoint in each region is used for ping test (ie ec2.eu-north-1.amazonaws.com)
+	var regionIPs []core.IPPingTime
+	for _, region := range output.Regions {
+		regionIPs = append(regionIPs, core.IPPingTime{
+			ID:      aws.StringValue(region.RegionName),
+			Address: aws.StringValue(region.Endpoint),
+		})
+	}
+
+	return core.ClosestRegion(ctx, "aws", regionIPs)
 }
 
-type regionPingTimes struct {
-	name      string // region name
-	ipAddress string // ip address in region that we can use for ping tests
-	result    int64  // ping time for given ip address
+// splitID gets the region and instance id from our VM id
+// note: instance ids are only unique per region so our id is 'region/instance-id'
+func splitID(vmID string) (region string, instanceID string, err error) {
+
+	parts := strings.SplitN(vmID, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid aws VM id: %s", vmID)
+	}
+
+	return parts[0], parts[1], nil
 }
 
-// SelectClosestRegion will check all DO regions to find the closest
-func (m *Manager) SelectClosestRegion() (closestRegion string, err error) {
+// GetVMInfo will get details of a VM
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
 
-	// get a list of regions
-	svc := ec2.New(m.api)
-	awsRegions, err := svc.DescribeRegions(&ec2.DescribeRegionsInput{})
+	region, instanceID, err := splitID(vmID)
 	if err != nil {
-		return "", err
+		return vmInfo, err
 	}
 
-	// test each region
-	var lowestPingTime = math.MaxInt32
-	// var regions []regionPingTimes
-	for _, awsRegion := range awsRegions.Regions {
+	svc := m.regionClient(region)
+	output, err := svc.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
 
-		// OptInStatus // opt-in-not-required, opted-in and not-opted-in
-		// Endpoint    // ie ec2.eu-north-1.amazonaws.com
+	for _, reservation := range output.Reservations {
+		for _, instance := range reservation.Instances {
+			return convertVMInfoToGenericFormat(region, instance)
+		}
+	}
 
-		region := regionPingTimes{name: *awsRegion.RegionName, ipAddress: *awsRegion.Endpoint, result: 0}
+	return vmInfo, fmt.Errorf("vm %s %w", vmID, core.ErrNotFound)
+}
 
-		pingTime, err := core.GetPingTime(region.ipAddress)
-		if err != nil {
-			return "", err
-		}
-		region.result = pingTime
+// findImage uses the ssm parameters canonical & debian publish to get the current AMI
+// image can be an AMI id (ami-xxx), 'ubuntu-<version>' (ie ubuntu-24.04) or 'debian-<version>'
+func (m *Manager) findImage(ctx context.Context, region string, image string, instanceType string) (string, error) {
+
+	if strings.HasPrefix(image, "ami-") {
+		return image, nil
+	}
 
-		// is this datacenter closer than others we've seen so far
-		if int(pingTime) < lowestPingTime {
-			closestRegion = region.name
-			lowestPingTime = int(pingTime)
+	// graviton instance types (t4g, m7g, etc) need arm images
+	arch := "amd64"
+	family := strings.SplitN(instanceType, ".", 2)[0]
+	if strings.Contains(strings.TrimLeft(family, "abcdefghijklmnopqrstuvwxyz"), "g") {
+		arch = "arm64"
+	}
+
+	var parameter string
+	switch {
+	case strings.HasPrefix(image, "ubuntu-"):
+		// newer releases are published on gp3 volumes
+		version := strings.TrimPrefix(image, "ubuntu-")
+		volumeType := "ebs-gp2"
+		if strings.Compare(version, "23.04") >= 0 {
+			volumeType = "ebs-gp3"
 		}
+		parameter = fmt.Sprintf("/aws/service/canonical/ubuntu/server/%s/stable/current/%s/hvm/%s/ami-id",
+			version, arch, volumeType)
+	case strings.HasPrefix(image, "debian-"):
+		parameter = fmt.Sprintf("/aws/service/debian/release/%s/latest/%s", strings.TrimPrefix(image, "debian-"), arch)
+	default:
+		return "", fmt.Errorf("unsupported aws image: %s", image)
+	}
 
-		// regions = append(regions, region)
-		// regions has unordered list of all ping times
+	svc := ssm.New(m.api, aws.NewConfig().WithRegion(region))
+	output, err := svc.GetParameterWithContext(ctx, &ssm.GetParameterInput{Name: aws.String(parameter)})
+	if err != nil {
+		return "", fmt.Errorf("could not find %s image: %w", image, convertError(err))
 	}
 
-	return closestRegion, nil
+	return aws.StringValue(output.Parameter.Value), nil
 }
 
-// GetVMInfo will get details of a VM
-func (m *Manager) GetVMInfo(vmID string) (vmInfo core.VMInfo, err error) {
+// getSecurityGroup returns the id of our security group in the default VPC (creating it if needed)
+func (m *Manager) getSecurityGroup(ctx context.Context, svc *ec2.EC2) (string, error) {
 
-	return vmInfo, nil
+	vpcs, err := svc.DescribeVpcsWithContext(ctx, &ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("is-default"), Values: []*string{aws.String("true")}}},
+	})
+	if err != nil {
+		return "", convertError(err)
+	}
+	if len(vpcs.Vpcs) == 0 {
+		return "", errors.New("region does not have a default vpc")
+	}
+	vpcID := vpcs.Vpcs[0].VpcId
+
+	groups, err := svc.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("group-name"), Values: []*string{aws.String(securityGroupName)}},
+			{Name: aws.String("vpc-id"), Values: []*string{vpcID}},
+		},
+	})
+	if err != nil {
+		return "", convertError(err)
+	}
+	if len(groups.SecurityGroups) > 0 {
+		return aws.StringValue(groups.SecurityGroups[0].GroupId), nil
+	}
+
+	// need to create it
+	group, err := svc.CreateSecurityGroupWithContext(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(securityGroupName),
+		Description: aws.String("k3s clusters created by eezhee"),
+		VpcId:       vpcID,
+	})
+	if err != nil {
+		return "", convertError(err)
+	}
+
+	var permissions []*ec2.IpPermission
+	for _, port := range clusterPorts {
+		permissions = append(permissions, &ec2.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(port),
+			ToPort:     aws.Int64(port),
+			IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			Ipv6Ranges: []*ec2.Ipv6Range{{CidrIpv6: aws.String("::/0")}},
+		})
+	}
+	_, err = svc.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       group.GroupId,
+		IpPermissions: permissions,
+	})
+	if err != nil {
+		return "", convertError(err)
+	}
+	log.Debug("created security group ", aws.StringValue(group.GroupId))
+
+	return aws.StringValue(group.GroupId), nil
 }
 
 // CreateVM will create a new VM
-func (m *Manager) CreateVM(name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
 	var vmInfo core.VMInfo
 
-	svc := ec2.New(m.api)
-
-	// us-east-1
-	// ubuntu 20.04LTS: ami-0dba2cb6798deb6d8 (amd64) ami-0ea142bd244023692 (arm)
-	// t1.micro, t2.micro
-	// VPC - create new one?
-	// security group
-	// shutdown behavior
-
-	// Specify the details of the instance that you want to create.
-	runResult, err := svc.RunInstances(&ec2.RunInstancesInput{
-		// An Amazon Linux AMI ID for t2.micro instances in the us-west-2 region
-		ImageId:      aws.String("ami-e7527ed7"),
-		InstanceType: aws.String("t2.micro"),
-		MinCount:     aws.Int64(1),
-		MaxCount:     aws.Int64(1),
-	})
-	log.Debug(runResult)
+	svc := m.regionClient(region)
+
+	// key pairs are per region so make sure ours is in this one
+	_, err := m.findKeyPair(ctx, svc, sshKey)
+	if err != nil {
+		_, err = m.importKeyPair(ctx, svc, sshKey)
+		if err != nil {
+			return vmInfo, err
+		}
+	}
+
+	imageID, err := m.findImage(ctx, region, image, size)
 	if err != nil {
-		log.Error("Could not create instance", err)
 		return vmInfo, err
 	}
 
-	return vmInfo, nil
+	securityGroupID, err := m.getSecurityGroup(ctx, svc)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	reservation, err := svc.RunInstancesWithContext(ctx, &ec2.RunInstancesInput{
+		ImageId:          aws.String(imageID),
+		InstanceType:     aws.String(size),
+		KeyName:          aws.String(keyPairName(sshKey)),
+		SecurityGroupIds: []*string{aws.String(securityGroupID)},
+		UserData:         aws.String(base64.StdEncoding.EncodeToString([]byte(userData))),
+		MinCount:         aws.Int64(1),
+		MaxCount:         aws.Int64(1),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String(ec2.ResourceTypeInstance),
+			Tags: []*ec2.Tag{
+				{Key: aws.String("Name"), Value: aws.String(name)},
+				{Key: aws.String("eezhee"), Value: aws.String("")},
+			},
+		}},
+	})
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
+	if len(reservation.Instances) == 0 {
+		return vmInfo, errors.New("aws did not create an instance")
+	}
+
+	return convertVMInfoToGenericFormat(region, reservation.Instances[0])
 }
 
-// ListVMs will return a list of all VMs created by eezhee
-func (m *Manager) ListVMs() (vmInfo []core.VMInfo, err error) {
+// ListVMs will return a list of all VMs created by eezhee (in every region)
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
+
+	regions, err := m.regionClient("").DescribeRegionsWithContext(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	for _, region := range regions.Regions {
+
+		regionName := aws.StringValue(region.RegionName)
+		svc := m.regionClient(regionName)
+
+		err = svc.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{
+			Filters: []*ec2.Filter{
+				{Name: aws.String("tag-key"), Values: []*string{aws.String("eezhee")}},
+				{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+			},
+		}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					info, _ := convertVMInfoToGenericFormat(regionName, instance)
+					vmInfo = append(vmInfo, info)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, convertError(err)
+		}
+	}
 
 	return vmInfo, nil
 }
 
 // DeleteVM will delete a given VM
-func (m *Manager) DeleteVM(ID string) error {
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
+
+	region, instanceID, err := splitID(ID)
+	if err != nil {
+		return err
+	}
+
+	svc := m.regionClient(region)
+	_, err = svc.TerminateInstancesWithContext(ctx, &ec2.TerminateInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidInstanceID.NotFound" {
+			return fmt.Errorf("vm %s %w", ID, core.ErrNotFound)
+		}
+		return convertError(err)
+	}
+
+	log.Debug("vm ", ID, " deleted")
 
 	return nil
 }
+
+// convertVMInfoToGenericFormat converts ec2 instance info into our generic format
+func convertVMInfoToGenericFormat(region string, instance *ec2.Instance) (core.VMInfo, error) {
+
+	var vmInfo core.VMInfo
+
+	vmInfo.ID = region + "/" + aws.StringValue(instance.InstanceId)
+	vmInfo.Region = core.RegionInfo{Slug: region}
+	vmInfo.Size = core.SizeInfo{Slug: aws.StringValue(instance.InstanceType)}
+	vmInfo.SizeSlug = aws.StringValue(instance.InstanceType)
+	vmInfo.Image = core.ImageInfo{Name: aws.StringValue(instance.ImageId)}
+	vmInfo.VPCUUID = aws.StringValue(instance.VpcId)
+	if instance.LaunchTime != nil {
+		vmInfo.CreatedAt = instance.LaunchTime.UTC().Format(time.RFC3339)
+	}
+	if instance.CpuOptions != nil {
+		vmInfo.VCPUs = int(aws.Int64Value(instance.CpuOptions.CoreCount) * aws.Int64Value(instance.CpuOptions.ThreadsPerCore))
+	}
+
+	// aws state names match ours ('running') so no conversion needed
+	if instance.State != nil {
+		vmInfo.Status = aws.StringValue(instance.State.Name)
+	}
+
+	// tags are key/value.  name goes in name, everything else is a tag
+	for _, tag := range instance.Tags {
+		key := aws.StringValue(tag.Key)
+		if key == "Name" {
+			vmInfo.Name = aws.StringValue(tag.Value)
+			continue
+		}
+		vmInfo.Tags = append(vmInfo.Tags, key)
+	}
+
+	vmInfo.Networks = core.NetworkInfo{
+		V4Info: []core.V4NetworkInfo{},
+		V6Info: []core.V6NetworkInfo{},
+	}
+	if instance.PublicIpAddress != nil {
+		vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+			IPAddress: aws.StringValue(instance.PublicIpAddress),
+			Type:      "public",
+		})
+	}
+	if instance.PrivateIpAddress != nil {
+		vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+			IPAddress: aws.StringValue(instance.PrivateIpAddress),
+			Type:      "private",
+		})
+	}
+	for _, networkInterface := range instance.NetworkInterfaces {
+		for _, ipv6 := range networkInterface.Ipv6Addresses {
+			vmInfo.Networks.V6Info = append(vmInfo.Networks.V6Info, core.V6NetworkInfo{
+				IPAddress: aws.StringValue(ipv6.Ipv6Address),
+				Type:      "public",
+			})
+		}
+	}
+
+	return vmInfo, nil
+}
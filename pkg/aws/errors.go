@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/eezhee/eezhee/pkg/core"
+)
+
+// error codes that mean the credentials are not valid (or not allowed to do this)
+var authErrorCodes = []string{
+	"AuthFailure", "UnauthorizedOperation", "InvalidClientTokenId", "SignatureDoesNotMatch",
+	"ExpiredToken", "AccessDenied", "AccessDeniedException", "NoCredentialProviders",
+}
+
+// error codes that are worth trying again
+var transientErrorCodes = []string{
+	"InternalError", "InternalFailure", "ServiceUnavailable", "Unavailable",
+	"InsufficientInstanceCapacity", "RequestError", "RequestTimeout",
+}
+
+// convertError maps aws sdk errors to the kinds of errors in core
+func convertError(err error) error {
+
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return core.ErrorFromResponse(nil, err)
+	}
+
+	code := awsErr.Code()
+	var kind error
+	switch {
+	case contains(authErrorCodes, code):
+		kind = core.ErrAuth
+	case strings.HasSuffix(code, ".NotFound") || code == "ParameterNotFound":
+		kind = core.ErrNotFound
+	case code == "RequestLimitExceeded" || strings.HasPrefix(code, "Throttling"):
+		kind = core.ErrRateLimited
+	case strings.HasSuffix(code, "LimitExceeded"):
+		// ie InstanceLimitExceeded, VcpuLimitExceeded
+		kind = core.ErrQuota
+	case contains(transientErrorCodes, code):
+		kind = core.ErrTransient
+	default:
+		// fall back to the http status
+		var requestFailure awserr.RequestFailure
+		if errors.As(err, &requestFailure) {
+			kind = core.KindFromStatus(requestFailure.StatusCode(), awsErr.Message())
+		}
+	}
+
+	if kind == nil {
+		return err
+	}
+
+	return core.NewProviderError(kind, err)
+}
+
+// contains checks if a list of strings has the given value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
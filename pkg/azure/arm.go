@@ -0,0 +1,329 @@
+package azure
+
+// minimal client for the azure resource manager (arm) rest api
+// like the gcp provider, the api is used directly to keep dependencies small
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// DefaultEndpoint is the azure resource manager api
+const DefaultEndpoint = "https://management.azure.com"
+
+// api versions for each resource provider
+const (
+	resourcesAPIVersion = "2021-04-01"
+	networkAPIVersion   = "2023-09-01"
+	computeAPIVersion   = "2023-09-01"
+)
+
+// APIError is returned when arm rejects a request
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("azure: %s (%s)", e.Message, e.Code)
+}
+
+// isNotFound checks if an api error is a 404
+func isNotFound(err error) bool {
+	var apiError *APIError
+	return errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound
+}
+
+// servicePrincipalTokenSource gets tokens for a service principal (app registration)
+func servicePrincipalTokenSource(tenantID string, clientID string, clientSecret string) oauth2.TokenSource {
+
+	config := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     "https://login.microsoftonline.com/" + tenantID + "/oauth2/v2.0/token",
+		Scopes:       []string{DefaultEndpoint + "/.default"},
+	}
+
+	return config.TokenSource(context.Background())
+}
+
+// cliTokenSource gets tokens from the azure cli (which uses its own token cache)
+type cliTokenSource struct{}
+
+// cliToken is the output of 'az account get-access-token'
+type cliToken struct {
+	AccessToken  string `json:"accessToken"`
+	ExpiresOn    string `json:"expiresOn"`  // local time. ie 2024-01-02 10:11:12.000000
+	ExpiresOnUTC int64  `json:"expires_on"` // unix time (newer versions of cli)
+	Subscription string `json:"subscription"`
+	Tenant       string `json:"tenant"`
+}
+
+// getCLIToken runs the azure cli to get a token
+func getCLIToken() (cliToken, error) {
+
+	var token cliToken
+
+	output, err := exec.Command("az", "account", "get-access-token", "--resource", DefaultEndpoint+"/", "--output", "json").Output()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return token, fmt.Errorf("azure cli: %s", strings.TrimSpace(string(exitError.Stderr)))
+		}
+		return token, err
+	}
+
+	err = json.Unmarshal(output, &token)
+	return token, err
+}
+
+// Token is called by oauth2 when it needs a new token
+func (c cliTokenSource) Token() (*oauth2.Token, error) {
+
+	token, err := getCLIToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Unix(token.ExpiresOnUTC, 0)
+	if token.ExpiresOnUTC == 0 {
+		expiry, err = time.ParseInLocation("2006-01-02 15:04:05.999999", token.ExpiresOn, time.Local)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &oauth2.Token{AccessToken: token.AccessToken, TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+// call makes a request to arm
+// path starts after the endpoint (ie /subscriptions/...)
+func (m *Manager) call(ctx context.Context, method string, path string, apiVersion string, body interface{}, result interface{}) error {
+
+	// paging links are full urls that already have the api version
+	address := path
+	if !strings.HasPrefix(path, "http") {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		address = strings.TrimSuffix(m.Endpoint, "/") + path + separator + "api-version=" + url.QueryEscape(apiVersion)
+	}
+
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, address, requestBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := m.client.Do(request)
+	if err != nil {
+		return core.ErrorFromResponse(nil, err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 300 {
+		var errorResponse struct {
+			Error APIError `json:"error"`
+		}
+		if json.Unmarshal(data, &errorResponse) != nil || len(errorResponse.Error.Code) == 0 {
+			errorResponse.Error = APIError{Code: strconv.Itoa(response.StatusCode), Message: response.Status}
+		}
+		errorResponse.Error.StatusCode = response.StatusCode
+		return core.ErrorFromResponse(response, &errorResponse.Error)
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// resource fields common to everything we create
+type resource struct {
+	ID       string            `json:"id,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	Location string            `json:"location"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// provisioningState is what arm uses to report progress of a PUT
+type provisioningState struct {
+	Properties struct {
+		ProvisioningState string `json:"provisioningState"`
+	} `json:"properties"`
+}
+
+// subResource is a reference to another resource
+type subResource struct {
+	ID string `json:"id"`
+}
+
+type securityRuleProperties struct {
+	Protocol                 string   `json:"protocol"`
+	SourcePortRange          string   `json:"sourcePortRange"`
+	SourceAddressPrefix      string   `json:"sourceAddressPrefix"`
+	DestinationAddressPrefix string   `json:"destinationAddressPrefix"`
+	DestinationPortRanges    []string `json:"destinationPortRanges"`
+	Access                   string   `json:"access"`
+	Direction                string   `json:"direction"`
+	Priority                 int      `json:"priority"`
+}
+
+type securityRule struct {
+	Name       string                 `json:"name"`
+	Properties securityRuleProperties `json:"properties"`
+}
+
+type networkSecurityGroup struct {
+	resource
+	Properties struct {
+		SecurityRules []securityRule `json:"securityRules"`
+	} `json:"properties"`
+}
+
+type subnet struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name"`
+	Properties struct {
+		AddressPrefix        string       `json:"addressPrefix"`
+		NetworkSecurityGroup *subResource `json:"networkSecurityGroup,omitempty"`
+	} `json:"properties"`
+}
+
+type virtualNetwork struct {
+	resource
+	Properties struct {
+		AddressSpace struct {
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"addressSpace"`
+		Subnets []subnet `json:"subnets"`
+	} `json:"properties"`
+}
+
+type publicIPAddress struct {
+	resource
+	SKU        map[string]string `json:"sku"`
+	Properties struct {
+		PublicIPAllocationMethod string `json:"publicIPAllocationMethod"`
+		PublicIPAddressVersion   string `json:"publicIPAddressVersion,omitempty"`
+		IPAddress                string `json:"ipAddress,omitempty"`
+	} `json:"properties"`
+}
+
+type ipConfiguration struct {
+	Name       string `json:"name"`
+	Properties struct {
+		PrivateIPAllocationMethod string       `json:"privateIPAllocationMethod"`
+		PrivateIPAddress          string       `json:"privateIPAddress,omitempty"`
+		Subnet                    *subResource `json:"subnet,omitempty"`
+		PublicIPAddress           *subResource `json:"publicIPAddress,omitempty"`
+	} `json:"properties"`
+}
+
+type networkInterface struct {
+	resource
+	Properties struct {
+		IPConfigurations     []ipConfiguration `json:"ipConfigurations"`
+		NetworkSecurityGroup *subResource      `json:"networkSecurityGroup,omitempty"`
+	} `json:"properties"`
+}
+
+type imageReference struct {
+	Publisher string `json:"publisher"`
+	Offer     string `json:"offer"`
+	SKU       string `json:"sku"`
+	Version   string `json:"version"`
+}
+
+type sshPublicKey struct {
+	Path    string `json:"path"`
+	KeyData string `json:"keyData"`
+}
+
+type osProfile struct {
+	ComputerName       string `json:"computerName"`
+	AdminUsername      string `json:"adminUsername"`
+	CustomData         string `json:"customData,omitempty"`
+	LinuxConfiguration struct {
+		DisablePasswordAuthentication bool `json:"disablePasswordAuthentication"`
+		SSH                           struct {
+			PublicKeys []sshPublicKey `json:"publicKeys"`
+		} `json:"ssh"`
+	} `json:"linuxConfiguration"`
+}
+
+type networkInterfaceReference struct {
+	ID         string `json:"id"`
+	Properties struct {
+		Primary      bool   `json:"primary"`
+		DeleteOption string `json:"deleteOption,omitempty"`
+	} `json:"properties"`
+}
+
+type instanceStatus struct {
+	Code string `json:"code"`
+}
+
+type virtualMachine struct {
+	resource
+	Properties struct {
+		HardwareProfile struct {
+			VMSize string `json:"vmSize"`
+		} `json:"hardwareProfile"`
+		StorageProfile struct {
+			ImageReference imageReference `json:"imageReference"`
+			OSDisk         struct {
+				CreateOption string            `json:"createOption"`
+				DeleteOption string            `json:"deleteOption,omitempty"`
+				DiskSizeGB   int               `json:"diskSizeGB,omitempty"`
+				ManagedDisk  map[string]string `json:"managedDisk,omitempty"`
+			} `json:"osDisk"`
+		} `json:"storageProfile"`
+		OSProfile      *osProfile `json:"osProfile,omitempty"`
+		NetworkProfile struct {
+			NetworkInterfaces []networkInterfaceReference `json:"networkInterfaces"`
+		} `json:"networkProfile"`
+		ProvisioningState string `json:"provisioningState,omitempty"`
+		TimeCreated       string `json:"timeCreated,omitempty"`
+		InstanceView      *struct {
+			Statuses []instanceStatus `json:"statuses"`
+		} `json:"instanceView,omitempty"`
+	} `json:"properties"`
+}
+
+type virtualMachineList struct {
+	Value    []virtualMachine `json:"value"`
+	NextLink string           `json:"nextLink"`
+}
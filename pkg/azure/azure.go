@@ -0,0 +1,574 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+// resources we create get this tag. we use it to find our VMs
+const eezheeTag = "eezhee"
+
+// ports k3s clusters need open: ssh, http, https & kubernetes api
+var clusterPorts = []string{"22", "80", "443", "6443"}
+
+// Regions are the regions azure has (from the catalog built into eezhee)
+var Regions core.Regions = core.NewRegionCatalog("azure", nil)
+
+// Sizes are the VM sizes azure has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("azure")
+
+// how long to wait for arm to finish creating a resource
+const provisionTimeout = 10 * time.Minute
+const provisionCheckDelay = 5 * time.Second
+
+// azure doesn't allow 'root' as the admin user so VM gets an eezhee user
+// cloud-init then lets root use the same key
+// note: k3s installer is run as root
+const adminUser = "eezhee"
+const userData = `#cloud-config
+disable_root: false
+`
+
+// arm sizes have a 'p' in their features. ie Standard_D2ps_v5 or Standard_B2pts_v2
+var armSizePattern = regexp.MustCompile(`^Standard_[A-Z]+[0-9]+[a-z]*p[a-z]*_v[0-9]+$`)
+
+// canonical & debian publish a different offer for each release
+// skus are for x86 and arm
+var osImages = map[string]struct {
+	Publisher string
+	Offer     string
+	SKUs      [2]string
+}{
+	"ubuntu-22.04": {"Canonical", "0001-com-ubuntu-server-jammy", [2]string{"22_04-lts-gen2", "22_04-lts-arm64"}},
+	"ubuntu-24.04": {"Canonical", "ubuntu-24_04-lts", [2]string{"server", "server-arm64"}},
+	"debian-12":    {"Debian", "debian-12", [2]string{"12-gen2", "12-arm64"}},
+}
+
+// Manager handles interactions with the Azure Resource Manager API
+type Manager struct {
+	SubscriptionID string
+	Endpoint       string // defaults to DefaultEndpoint
+	client         *http.Client
+}
+
+// NewManager creates a manage object & inits it
+// if a client id is given, the service principal is used.  otherwise the azure cli's login is used
+func NewManager(subscriptionID string, tenantID string, clientID string, clientSecret string) (core.VMManager, error) {
+
+	manager := new(Manager)
+	manager.Endpoint = DefaultEndpoint
+
+	var tokenSource oauth2.TokenSource
+	if len(clientID) > 0 {
+		if len(tenantID) == 0 || len(clientSecret) == 0 {
+			return manager, errors.New("service principal needs a tenant id, client id and client secret")
+		}
+		tokenSource = servicePrincipalTokenSource(tenantID, clientID, clientSecret)
+	} else {
+		if len(manager.FindAuthToken()) == 0 {
+			return manager, errors.New("no azure credentials found. use 'az login' or a service principal")
+		}
+		tokenSource = cliTokenSource{}
+	}
+
+	// which subscription to use
+	manager.SubscriptionID = subscriptionID
+	if len(manager.SubscriptionID) == 0 {
+		manager.SubscriptionID = findSubscription()
+	}
+	if len(manager.SubscriptionID) == 0 {
+		return manager, errors.New("no azure subscription set")
+	}
+
+	manager.client = oauth2.NewClient(context.Background(), oauth2.ReuseTokenSource(nil, tokenSource))
+
+	return manager, nil
+}
+
+// NewManagerWithClient creates a manager that talks to the given endpoint with the given client
+// used to point the manager at a stand-in for the arm api
+func NewManagerWithClient(subscriptionID string, endpoint string, client *http.Client) *Manager {
+
+	manager := new(Manager)
+	manager.SubscriptionID = subscriptionID
+	manager.Endpoint = endpoint
+	manager.client = client
+
+	return manager
+}
+
+// FindAuthToken will get a token from the azure cli (if user has logged in with it)
+func (m *Manager) FindAuthToken() string {
+
+	token, err := getCLIToken()
+	if err != nil {
+		log.Debug("could not get token from azure cli: ", err)
+		return ""
+	}
+
+	return token.AccessToken
+}
+
+// azureConfigDir is where the azure cli keeps its settings
+func azureConfigDir() string {
+
+	configDir := os.Getenv("AZURE_CONFIG_DIR")
+	if len(configDir) > 0 {
+		return configDir
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(homeDir, ".azure")
+}
+
+// findSubscription checks env variables and the azure cli profile for which subscription to use
+func findSubscription() string {
+
+	subscription := os.Getenv("AZURE_SUBSCRIPTION_ID")
+	if len(subscription) > 0 {
+		return subscription
+	}
+
+	data, err := os.ReadFile(filepath.Join(azureConfigDir(), "azureProfile.json"))
+	if err != nil {
+		return ""
+	}
+
+	// file written by azure cli starts with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var profile struct {
+		Subscriptions []struct {
+			ID        string `json:"id"`
+			IsDefault bool   `json:"isDefault"`
+		} `json:"subscriptions"`
+	}
+	if json.Unmarshal(data, &profile) != nil {
+		return ""
+	}
+	for _, subscription := range profile.Subscriptions {
+		if subscription.IsDefault {
+			return subscription.ID
+		}
+	}
+
+	return ""
+}
+
+// resourceGroupPath is the base path for resources in a cluster's resource group
+func (m *Manager) resourceGroupPath(resourceGroup string) string {
+	return "/subscriptions/" + m.SubscriptionID + "/resourceGroups/" + resourceGroup
+}
+
+// resourceGroupName is the resource group a cluster's resources go in
+func resourceGroupName(name string) string {
+	return "eezhee-" + name
+}
+
+// IsSSHKeyUploaded always succeeds as the key is added to each VM when it is created
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, desiredSSHKey core.SSHKey) (string, error) {
+	return desiredSSHKey.Fingerprint(), nil
+}
+
+// UploadSSHKey doesn't need to do anything as key is added to each VM when it is created
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (string, error) {
+	return sshKey.Fingerprint(), nil
+}
+
+// SelectClosestRegion uses the default location set in the azure cli config
+// note: azure doesn't have hosts in each region we can ping
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+
+	closestRegion = os.Getenv("AZURE_DEFAULTS_LOCATION")
+	if len(closestRegion) == 0 {
+		config := viper.New()
+		config.SetConfigType("ini")
+		config.SetConfigFile(filepath.Join(azureConfigDir(), "config"))
+		if err := config.ReadInConfig(); err == nil {
+			closestRegion = config.GetString("defaults.location")
+		}
+	}
+	if len(closestRegion) == 0 {
+		return "", errors.New("no azure region set. set region in deploy file or run 'az configure --defaults location=<region>'")
+	}
+
+	return closestRegion, nil
+}
+
+// put creates (or updates) a resource & waits for arm to finish provisioning it
+func (m *Manager) put(ctx context.Context, path string, apiVersion string, body interface{}, result interface{}) error {
+
+	var state provisioningState
+	err := m.call(ctx, http.MethodPut, path, apiVersion, body, &state)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(provisionTimeout)
+	for {
+		switch state.Properties.ProvisioningState {
+		case "Succeeded", "":
+			return m.call(ctx, http.MethodGet, path, apiVersion, nil, result)
+		case "Failed", "Canceled":
+			return fmt.Errorf("could not create %s", path[strings.LastIndex(path, "/")+1:])
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out creating %s", path)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(provisionCheckDelay):
+		}
+
+		err = m.call(ctx, http.MethodGet, path, apiVersion, nil, &state)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// imageFor returns the image of an os (ie ubuntu-24.04) to use for a given size
+func imageFor(image string, size string) (imageReference, error) {
+
+	osImage, ok := osImages[image]
+	if !ok {
+		return imageReference{}, fmt.Errorf("unsupported azure image: %s", image)
+	}
+
+	sku := osImage.SKUs[0]
+	if armSizePattern.MatchString(size) {
+		sku = osImage.SKUs[1]
+	}
+
+	return imageReference{Publisher: osImage.Publisher, Offer: osImage.Offer, SKU: sku, Version: "latest"}, nil
+}
+
+// CreateVM will create a resource group with a network and a VM in it
+// if anything fails once the resource group is created, the group is deleted so nothing is left behind
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (vmInfo core.VMInfo, err error) {
+
+	imageRef, err := imageFor(image, size)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	tags := map[string]string{eezheeTag: ""}
+	resourceGroup := resourceGroupName(name)
+	groupPath := m.resourceGroupPath(resourceGroup)
+	networkPath := groupPath + "/providers/Microsoft.Network"
+
+	// everything for the cluster goes in its own resource group so it can be deleted in one call
+	err = m.call(ctx, http.MethodPut, groupPath, resourcesAPIVersion, resource{Location: region, Tags: tags}, nil)
+	if err != nil {
+		return vmInfo, err
+	}
+	log.Debug("created resource group ", resourceGroup)
+	defer func() {
+		if err != nil {
+			m.deleteResourceGroup(context.WithoutCancel(ctx), resourceGroup)
+		}
+	}()
+
+	// network security group with the cluster ports open
+	var nsg networkSecurityGroup
+	nsg.Location = region
+	nsg.Tags = tags
+	nsg.Properties.SecurityRules = []securityRule{{
+		Name: "eezhee-cluster",
+		Properties: securityRuleProperties{
+			Protocol:                 "Tcp",
+			SourcePortRange:          "*",
+			SourceAddressPrefix:      "*",
+			DestinationAddressPrefix: "*",
+			DestinationPortRanges:    clusterPorts,
+			Access:                   "Allow",
+			Direction:                "Inbound",
+			Priority:                 100,
+		},
+	}}
+	err = m.put(ctx, networkPath+"/networkSecurityGroups/"+name+"-nsg", networkAPIVersion, nsg, &nsg)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	var vnet virtualNetwork
+	vnet.Location = region
+	vnet.Tags = tags
+	vnet.Properties.AddressSpace.AddressPrefixes = []string{"10.0.0.0/16"}
+	var defaultSubnet subnet
+	defaultSubnet.Name = "default"
+	defaultSubnet.Properties.AddressPrefix = "10.0.0.0/24"
+	defaultSubnet.Properties.NetworkSecurityGroup = &subResource{ID: nsg.ID}
+	vnet.Properties.Subnets = []subnet{defaultSubnet}
+	err = m.put(ctx, networkPath+"/virtualNetworks/"+name+"-vnet", networkAPIVersion, vnet, &vnet)
+	if err != nil {
+		return vmInfo, err
+	}
+	if len(vnet.Properties.Subnets) == 0 {
+		return vmInfo, errors.New("virtual network has no subnet")
+	}
+
+	var publicIP publicIPAddress
+	publicIP.Location = region
+	publicIP.Tags = tags
+	publicIP.SKU = map[string]string{"name": "Standard"}
+	publicIP.Properties.PublicIPAllocationMethod = "Static"
+	err = m.put(ctx, networkPath+"/publicIPAddresses/"+name+"-ip", networkAPIVersion, publicIP, &publicIP)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	var nic networkInterface
+	nic.Location = region
+	nic.Tags = tags
+	var ipConfig ipConfiguration
+	ipConfig.Name = "ipconfig1"
+	ipConfig.Properties.PrivateIPAllocationMethod = "Dynamic"
+	ipConfig.Properties.Subnet = &subResource{ID: vnet.Properties.Subnets[0].ID}
+	ipConfig.Properties.PublicIPAddress = &subResource{ID: publicIP.ID}
+	nic.Properties.IPConfigurations = []ipConfiguration{ipConfig}
+	nic.Properties.NetworkSecurityGroup = &subResource{ID: nsg.ID}
+	err = m.put(ctx, networkPath+"/networkInterfaces/"+name+"-nic", networkAPIVersion, nic, &nic)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	// the VM itself
+	var vm virtualMachine
+	vm.Location = region
+	vm.Tags = tags
+	vm.Properties.HardwareProfile.VMSize = size
+	vm.Properties.StorageProfile.ImageReference = imageRef
+	vm.Properties.StorageProfile.OSDisk.CreateOption = "FromImage"
+	vm.Properties.StorageProfile.OSDisk.DeleteOption = "Delete"
+	vm.Properties.StorageProfile.OSDisk.ManagedDisk = map[string]string{"storageAccountType": "StandardSSD_LRS"}
+	vm.Properties.OSProfile = &osProfile{
+		ComputerName:  name,
+		AdminUsername: adminUser,
+		CustomData:    base64.StdEncoding.EncodeToString([]byte(userData)),
+	}
+	vm.Properties.OSProfile.LinuxConfiguration.DisablePasswordAuthentication = true
+	vm.Properties.OSProfile.LinuxConfiguration.SSH.PublicKeys = []sshPublicKey{{
+		Path:    "/home/" + adminUser + "/.ssh/authorized_keys",
+		KeyData: sshKey.GetPublicKey(),
+	}}
+	var nicReference networkInterfaceReference
+	nicReference.ID = nic.ID
+	nicReference.Properties.Primary = true
+	nicReference.Properties.DeleteOption = "Delete"
+	vm.Properties.NetworkProfile.NetworkInterfaces = []networkInterfaceReference{nicReference}
+
+	// don't wait for VM to be provisioned.  caller will wait for it to be running
+	err = m.call(ctx, http.MethodPut, groupPath+"/providers/Microsoft.Compute/virtualMachines/"+name, computeAPIVersion, vm, nil)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	return m.GetVMInfo(ctx, resourceGroup+"/"+name)
+}
+
+// deleteResourceGroup cleans up after a VM that couldn't be created
+// note: arm deletes the group in the background so this doesn't take long
+func (m *Manager) deleteResourceGroup(ctx context.Context, resourceGroup string) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	err := m.call(ctx, http.MethodDelete, m.resourceGroupPath(resourceGroup), resourcesAPIVersion, nil, nil)
+	if err != nil && !isNotFound(err) {
+		log.Warn("could not delete resource group ", resourceGroup, ". delete it in the azure portal. ", err)
+		return
+	}
+	log.Debug("resource group ", resourceGroup, " being deleted")
+}
+
+// splitID gets the resource group and VM name from our VM id
+// note: our id is 'resource-group/vm-name'
+func splitID(vmID string) (resourceGroup string, name string, err error) {
+
+	parts := strings.SplitN(vmID, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid azure VM id: %s", vmID)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// GetVMInfo will get details of a VM
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
+
+	resourceGroup, name, err := splitID(vmID)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	var vm virtualMachine
+	path := m.resourceGroupPath(resourceGroup) + "/providers/Microsoft.Compute/virtualMachines/" + name
+	err = m.call(ctx, http.MethodGet, path+"?$expand=instanceView", computeAPIVersion, nil, &vm)
+	if err != nil {
+		if isNotFound(err) {
+			return vmInfo, fmt.Errorf("vm %s %w", vmID, core.ErrNotFound)
+		}
+		return vmInfo, err
+	}
+
+	// ip addresses are on the network interface & public ip resources
+	var nic networkInterface
+	var publicIP publicIPAddress
+	if len(vm.Properties.NetworkProfile.NetworkInterfaces) > 0 {
+		err = m.call(ctx, http.MethodGet, vm.Properties.NetworkProfile.NetworkInterfaces[0].ID, networkAPIVersion, nil, &nic)
+		if err != nil {
+			return vmInfo, err
+		}
+		for _, config := range nic.Properties.IPConfigurations {
+			if config.Properties.PublicIPAddress != nil {
+				err = m.call(ctx, http.MethodGet, config.Properties.PublicIPAddress.ID, networkAPIVersion, nil, &publicIP)
+				if err != nil {
+					return vmInfo, err
+				}
+				break
+			}
+		}
+	}
+
+	return convertVMInfoToGenericFormat(resourceGroup, vm, nic, publicIP)
+}
+
+// ListVMs will return a list of all VMs created by eezhee
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
+
+	path := "/subscriptions/" + m.SubscriptionID + "/providers/Microsoft.Compute/virtualMachines"
+	for len(path) > 0 {
+		var list virtualMachineList
+		err = m.call(ctx, http.MethodGet, path, computeAPIVersion, nil, &list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, vm := range list.Value {
+			if _, ok := vm.Tags[eezheeTag]; !ok {
+				continue
+			}
+
+			// we created this VM.  list doesn't have status or ips so get full details
+			info, err := m.GetVMInfo(ctx, resourceGroupFromID(vm.ID)+"/"+vm.Name)
+			if err != nil {
+				return nil, err
+			}
+			vmInfo = append(vmInfo, info)
+		}
+
+		path = list.NextLink
+	}
+
+	return vmInfo, nil
+}
+
+// resourceGroupFromID gets resource group from a resource id
+// ie /subscriptions/x/resourceGroups/eezhee-test/providers/...
+func resourceGroupFromID(id string) string {
+
+	parts := strings.Split(id, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if strings.EqualFold(parts[i], "resourceGroups") {
+			return parts[i+1]
+		}
+	}
+
+	return ""
+}
+
+// DeleteVM will delete the VM's resource group (and everything in it)
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
+
+	resourceGroup, _, err := splitID(ID)
+	if err != nil {
+		return err
+	}
+
+	// deleting a resource group is async.  arm will finish it in the background
+	err = m.call(ctx, http.MethodDelete, m.resourceGroupPath(resourceGroup), resourcesAPIVersion, nil, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("vm %s %w", ID, core.ErrNotFound)
+		}
+		return err
+	}
+
+	log.Debug("resource group ", resourceGroup, " being deleted")
+
+	return nil
+}
+
+// convertVMInfoToGenericFormat converts azure VM info into our generic format
+func convertVMInfoToGenericFormat(resourceGroup string, vm virtualMachine, nic networkInterface, publicIP publicIPAddress) (core.VMInfo, error) {
+
+	var vmInfo core.VMInfo
+
+	vmInfo.ID = resourceGroup + "/" + vm.Name
+	vmInfo.Name = vm.Name
+	vmInfo.Region = core.RegionInfo{Slug: vm.Location}
+	vmInfo.Size = core.SizeInfo{Slug: vm.Properties.HardwareProfile.VMSize}
+	vmInfo.SizeSlug = vm.Properties.HardwareProfile.VMSize
+	vmInfo.Image = core.ImageInfo{Name: vm.Properties.StorageProfile.ImageReference.Offer}
+
+	created, err := time.Parse(time.RFC3339, vm.Properties.TimeCreated)
+	if err == nil {
+		vmInfo.CreatedAt = created.UTC().Format(time.RFC3339)
+	}
+
+	// power state is in the instance view (ie PowerState/running)
+	// until VM is provisioned, use the provisioning state
+	vmInfo.Status = strings.ToLower(vm.Properties.ProvisioningState)
+	if vm.Properties.InstanceView != nil {
+		for _, status := range vm.Properties.InstanceView.Statuses {
+			if strings.HasPrefix(status.Code, "PowerState/") {
+				vmInfo.Status = strings.TrimPrefix(status.Code, "PowerState/")
+			}
+		}
+	}
+
+	for key := range vm.Tags {
+		vmInfo.Tags = append(vmInfo.Tags, key)
+	}
+
+	vmInfo.Networks = core.NetworkInfo{
+		V4Info: []core.V4NetworkInfo{},
+		V6Info: []core.V6NetworkInfo{},
+	}
+	if len(publicIP.Properties.IPAddress) > 0 {
+		vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+			IPAddress: publicIP.Properties.IPAddress,
+			Type:      "public",
+		})
+	}
+	for _, config := range nic.Properties.IPConfigurations {
+		if len(config.Properties.PrivateIPAddress) > 0 {
+			vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+				IPAddress: config.Properties.PrivateIPAddress,
+				Type:      "private",
+			})
+		}
+	}
+
+	return vmInfo, nil
+}
@@ -0,0 +1,106 @@
+package azure
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/core/conformance"
+	"golang.org/x/crypto/ssh"
+)
+
+const groupPath = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/eezhee-webapp"
+const networkPath = groupPath + "/providers/Microsoft.Network"
+
+func TestCreateVMRollback(t *testing.T) {
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey := core.SSHKey{PublicKey: sshPublicKey}
+
+	tests := []struct {
+		name     string
+		fixtures []conformance.Fixture
+		timeout  time.Duration
+		wantErr  error
+	}{
+		{
+			name: "public ip limit",
+			fixtures: []conformance.Fixture{
+				{Method: "PUT", Path: networkPath + "/virtualNetworks/webapp-vnet", File: "testdata/virtual-network.json"},
+				{Method: "GET", Path: networkPath + "/virtualNetworks/webapp-vnet", File: "testdata/virtual-network.json"},
+				{Method: "PUT", Path: networkPath + "/publicIPAddresses/webapp-ip", Status: http.StatusBadRequest, File: "testdata/public-ip-limit.json"},
+			},
+			wantErr: core.ErrQuota,
+		},
+		{
+			// the group is still deleted when the caller has given up
+			name: "cancelled",
+			fixtures: []conformance.Fixture{
+				{Method: "PUT", Path: networkPath + "/virtualNetworks/webapp-vnet", Status: http.StatusCreated, File: "testdata/virtual-network-updating.json"},
+			},
+			timeout: 50 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixtures := append([]conformance.Fixture{
+				{Method: "PUT", Path: groupPath, Status: http.StatusCreated, File: "testdata/resource-group.json"},
+				{Method: "DELETE", Path: groupPath, Status: http.StatusAccepted, File: "testdata/accepted.json"},
+				{Method: "PUT", Path: networkPath + "/networkSecurityGroups/webapp-nsg", File: "testdata/network-security-group.json"},
+				{Method: "GET", Path: networkPath + "/networkSecurityGroups/webapp-nsg", File: "testdata/network-security-group.json"},
+			}, test.fixtures...)
+			server := conformance.Replay(t, fixtures)
+			recorded := conformance.Record(server)
+			manager := NewManagerWithClient("00000000-0000-0000-0000-000000000000", server.URL, recorded.Client())
+
+			ctx := context.Background()
+			if test.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.timeout)
+				defer cancel()
+			}
+
+			_, err := manager.CreateVM(ctx, "webapp", "ubuntu-24.04", "Standard_B2s", "eastus", sshKey)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected %v, got %v", test.wantErr, err)
+			}
+
+			if _, ok := recorded.Find("DELETE", groupPath); !ok {
+				t.Error("expected resource group to be deleted")
+			}
+			if _, ok := recorded.Find("PUT", groupPath+"/providers/Microsoft.Compute/virtualMachines/webapp"); ok {
+				t.Error("expected no VM to be created")
+			}
+		})
+	}
+}
+
+func TestCreateVMInvalidImage(t *testing.T) {
+
+	server := conformance.Replay(t, nil)
+	recorded := conformance.Record(server)
+	manager := NewManagerWithClient("00000000-0000-0000-0000-000000000000", server.URL, recorded.Client())
+
+	// nothing is created so there is nothing to clean up
+	_, err := manager.CreateVM(context.Background(), "webapp", "windows-2022", "Standard_B2s", "eastus", core.SSHKey{})
+	if err == nil {
+		t.Fatal("expected unsupported image error")
+	}
+	if _, ok := recorded.Find("PUT", groupPath); ok {
+		t.Error("expected no resource group to be created")
+	}
+}
@@ -3,6 +3,7 @@ package cloudflare
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 
 	cf "github.com/cloudflare/cloudflare-go"
@@ -10,6 +11,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// records eezhee creates are tagged with this comment so it only changes its own records
+const ownerComment = "managed by eezhee"
+
 // DNSManager controls dns records for hosts
 type DNSManager struct {
 	APIToken string
@@ -96,6 +100,20 @@ func (m *DNSManager) Init() bool {
 	return true
 }
 
+// Verify will check the api token is valid and active
+func (m *DNSManager) Verify() error {
+
+	result, err := m.api.VerifyAPIToken(context.Background())
+	if err != nil {
+		return err
+	}
+	if result.Status != "active" {
+		return errors.New("cloudflare api token is " + result.Status)
+	}
+
+	return nil
+}
+
 // GetHostRecord will get details of dns record for a given host
 func (m *DNSManager) GetHostRecord(hostname string) (*core.HostInfo, error) {
 
@@ -122,12 +140,13 @@ func (m *DNSManager) GetHostRecord(hostname string) (*core.HostInfo, error) {
 	}
 
 	// desired record does not exist
+	// note: callers create the record on ErrNotFound so no other error can be one
 	if len(recs) == 0 {
-		return nil, errors.New("record does not exist")
+		return nil, fmt.Errorf("dns record for %s %w", hostname, core.ErrNotFound)
 	}
 
 	// found a record
-	hostInfo := core.HostInfo{Name: recs[0].Name, IP: recs[0].Content, ID: recs[0].ID}
+	hostInfo := core.HostInfo{Name: recs[0].Name, IP: recs[0].Content, ID: recs[0].ID, Owned: recs[0].Comment == ownerComment}
 
 	return &hostInfo, nil
 }
@@ -151,6 +170,7 @@ func (m *DNSManager) AddHostRecord(hostInfo core.HostInfo) error {
 		Type:    newRec.Type,
 		Name:    newRec.Name,
 		Content: newRec.Content,
+		Comment: ownerComment,
 	})
 	if err != nil {
 		log.Error("Failed to create DNS record:", err)
@@ -172,6 +192,7 @@ func (m *DNSManager) UpdateHostRecord(hostInfo core.HostInfo) error {
 
 	// update the DNS record
 	updateParams := cf.UpdateDNSRecordParams{
+		ID:      hostInfo.ID,
 		Type:    "A",
 		Name:    hostInfo.Name,
 		Content: hostInfo.IP,
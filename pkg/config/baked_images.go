@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"sort"
+
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// BakedImages are the images made with 'eezhee image bake'
+// they are kept in ~/.eezhee/baked-images.yaml so builds can find them and old ones can be pruned
+type BakedImages struct {
+	v      *viper.Viper // used to read/write file
+	Images []BakedImage
+}
+
+// BakedImage has details of an image with k3s on it
+type BakedImage struct {
+	Cloud      string   `mapstructure:"cloud"`
+	ID         string   `mapstructure:"id"` // cloud's id for the image
+	Name       string   `mapstructure:"name"`
+	Regions    []string `mapstructure:"regions"` // where VMs can be created from it. empty if any region
+	OS         string   `mapstructure:"os"`      // ie ubuntu-24.04
+	Arch       string   `mapstructure:"arch"`    // amd64 or arm64
+	K3sVersion string   `mapstructure:"k3s-version"`
+	Created    string   `mapstructure:"created"` // RFC3339 (UTC)
+}
+
+// NewBakedImages will create a new baked images object
+func NewBakedImages() *BakedImages {
+	images := new(BakedImages)
+
+	homeDir, _ := homedir.Dir()
+	path := homeDir + string(os.PathSeparator) + ".eezhee"
+	filename := path + string(os.PathSeparator) + "baked-images.yaml"
+
+	images.v = viper.New()
+	images.v.SetConfigType("yaml")
+	images.v.SetConfigFile(filename)
+
+	return images
+}
+
+// Load the list of baked images
+// note: there are no images if the file doesn't exist
+func (b *BakedImages) Load() error {
+
+	b.Images = nil
+	_, err := os.Stat(b.v.ConfigFileUsed())
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := b.v.ReadInConfig(); err != nil {
+		log.Error("error reading baked images file: ", err)
+		return err
+	}
+
+	err = b.v.UnmarshalKey("images", &b.Images)
+	if err != nil {
+		log.Error("invalid baked images file: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// Save the list of baked images
+func (b *BakedImages) Save() error {
+
+	images := []map[string]interface{}{}
+	for _, image := range b.Images {
+		images = append(images, map[string]interface{}{
+			"cloud":       image.Cloud,
+			"id":          image.ID,
+			"name":        image.Name,
+			"regions":     image.Regions,
+			"os":          image.OS,
+			"arch":        image.Arch,
+			"k3s-version": image.K3sVersion,
+			"created":     image.Created,
+		})
+	}
+	b.v.Set("images", images)
+
+	err := b.v.WriteConfig()
+	if err != nil {
+		log.Error("could not save baked images file: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// Add an image to the list
+func (b *BakedImages) Add(image BakedImage) {
+	b.Images = append(b.Images, image)
+}
+
+// Remove an image from the list
+func (b *BakedImages) Remove(cloud string, id string) {
+
+	var images []BakedImage
+	for _, image := range b.Images {
+		if image.Cloud != cloud || image.ID != id {
+			images = append(images, image)
+		}
+	}
+	b.Images = images
+}
+
+// Find returns the newest image a VM in the region can be created from
+// k3sVersion can be empty to match any version
+func (b *BakedImages) Find(cloud string, osName string, arch string, region string, k3sVersion string) (BakedImage, bool) {
+
+	var found []BakedImage
+	for _, image := range b.Images {
+		if image.Cloud != cloud || image.OS != osName || image.Arch != arch {
+			continue
+		}
+		if len(k3sVersion) > 0 && image.K3sVersion != k3sVersion {
+			continue
+		}
+		if len(image.Regions) > 0 && !contains(image.Regions, region) {
+			continue
+		}
+		found = append(found, image)
+	}
+	if len(found) == 0 {
+		return BakedImage{}, false
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Created > found[j].Created })
+
+	return found[0], true
+}
+
+// contains checks if a list has a given value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,22 +1,48 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	homedir "github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 // AppConfig has details of how to deploy the cluster
 // note: all these fields are optional
 type AppConfig struct {
-	v                  *viper.Viper // viper object
+	v                  *viper.Viper      // viper object
+	path               string            // directory config file is in
+	credentials        credentialStore   // where the api keys & secrets are. nil if there aren't any
+	locked             bool              // credentials couldn't be loaded
+	lockedSecrets      map[string]string // secrets when the credentials couldn't be loaded, so changes can be spotted
+	storedRegistries   []string          // registries with a password in the store, so ones that are removed can be deleted
 	DigitalOceanAPIKey string
 	CloudFlareAPIKey   string
+	HetznerAPIKey      string
 	LinodeAPIKey       string
 	VultrAPIKey        string
-	DefaultCloud       string // required if we have more than one api key
+	AWSProfile         string // profile in ~/.aws/credentials. 'default' uses standard credential chain
+	GCPCredentials     string // service account json file. 'default' uses application-default credentials
+	GCPProject         string // optional. defaults to project of credentials or gcloud config
+	AzureSubscription  string // azure is enabled if set
+	AzureTenantID      string // service principal details. azure cli login used if not set
+	AzureClientID      string
+	AzureClientSecret  string
+	DefaultCloud       string                // required if we have more than one api key
+	ACMEEmail          string                // contact email for Let's Encrypt certs (optional)
+	Registries         []RegistryCredentials // logins for container registries
+}
+
+// RegistryCredentials has the login details for a container registry
+// note: stored as a list as viper would split hosts like 'ghcr.io' into nested keys
+type RegistryCredentials struct {
+	Host     string `mapstructure:"host"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
 }
 
 // NewAppConfig will create a new deploy file object
@@ -29,7 +55,7 @@ func NewAppConfig() *AppConfig {
 	path := homeDir + string(os.PathSeparator) + ".eezhee"
 
 	// make sure directory exists
-	err := os.MkdirAll(path, 0755)
+	err := os.MkdirAll(path, 0700)
 	if err != nil {
 		log.Error("could not create config directory ", path)
 		log.Error(err)
@@ -40,19 +66,30 @@ func NewAppConfig() *AppConfig {
 	name := "config"
 	filename := path + string(os.PathSeparator) + name + ".yaml"
 
-	file, err := os.OpenFile(filename, os.O_CREATE, 0755)
+	file, err := os.OpenFile(filename, os.O_CREATE, 0600)
 	if err != nil {
 		log.Error("could not create config file. ", err)
 		return nil
 	}
+	info, err := file.Stat()
 	file.Close()
 
+	// only the user should be able to read it (older versions created it with 0755)
+	if err == nil && info.Mode().Perm() != 0600 {
+		err = os.Chmod(filename, 0600)
+		if err != nil {
+			log.Warn("could not change permissions of config file. ", err)
+		}
+	}
+
 	// set default filename
+	config.path = path
 	config.v = viper.New()
 	config.v.SetConfigName(name)
 	config.v.AddConfigPath(path)
 	config.v.SetConfigType("yaml")
 	config.v.SetConfigFile(filename)
+	config.v.SetConfigPermissions(0600)
 
 	return config
 }
@@ -67,23 +104,155 @@ func (a *AppConfig) Load() error {
 
 	a.DigitalOceanAPIKey = a.v.GetString("digitalocean-api-key")
 	a.CloudFlareAPIKey = a.v.GetString("cloudflare-api-key")
+	a.HetznerAPIKey = a.v.GetString("hetzner-api-key")
 	a.LinodeAPIKey = a.v.GetString("linode-api-key")
 	a.VultrAPIKey = a.v.GetString("vultr-api-key")
+	a.AWSProfile = a.v.GetString("aws-profile")
+	a.GCPCredentials = a.v.GetString("gcp-credentials")
+	a.GCPProject = a.v.GetString("gcp-project")
+	a.AzureSubscription = a.v.GetString("azure-subscription-id")
+	a.AzureTenantID = a.v.GetString("azure-tenant-id")
+	a.AzureClientID = a.v.GetString("azure-client-id")
+	a.AzureClientSecret = a.v.GetString("azure-client-secret")
 	a.DefaultCloud = a.v.GetString("default-cloud")
+	a.ACMEEmail = a.v.GetString("acme-email")
+
+	a.Registries = nil
+	err := a.v.UnmarshalKey("registries", &a.Registries)
+	if err != nil {
+		log.Error("invalid registries in config file: ", err)
+		return err
+	}
+
+	// note: older versions didn't keep track so the registries in the config file may be stored too
+	a.storedRegistries = a.v.GetStringSlice("stored-registries")
+	for _, credentials := range a.Registries {
+		if !contains(a.storedRegistries, credentials.Host) {
+			a.storedRegistries = append(a.storedRegistries, credentials.Host)
+		}
+	}
+
+	a.loadCredentials()
 
 	return nil
 }
 
+// secrets are the credentials kept in the credential store and the key each is stored as
+func (a *AppConfig) secrets() map[string]*string {
+
+	secrets := map[string]*string{
+		"digitalocean-api-key": &a.DigitalOceanAPIKey,
+		"cloudflare-api-key":   &a.CloudFlareAPIKey,
+		"hetzner-api-key":      &a.HetznerAPIKey,
+		"linode-api-key":       &a.LinodeAPIKey,
+		"vultr-api-key":        &a.VultrAPIKey,
+		"azure-client-secret":  &a.AzureClientSecret,
+	}
+	for i := range a.Registries {
+		secrets["registry-password-"+a.Registries[i].Host] = &a.Registries[i].Password
+	}
+
+	return secrets
+}
+
+// loadCredentials gets the secrets from the credential store
+// any still in the config file (ie from older versions) are moved to the store
+func (a *AppConfig) loadCredentials() {
+
+	plaintext := false
+	var keys []string
+	for key, value := range a.secrets() {
+		keys = append(keys, key)
+		if len(*value) > 0 {
+			plaintext = true
+		}
+	}
+
+	name := a.v.GetString("credential-store")
+	if len(name) > 0 {
+		store, err := newCredentialStore(name, a.path)
+		if err != nil {
+			log.Warn(err)
+			a.lock()
+			return
+		}
+		credentials, err := store.Load(keys)
+		if err != nil {
+			log.Warn("could not load credentials from ", name, ": ", err)
+			a.lock()
+			return
+		}
+		a.credentials = store
+
+		// a value in the config file is newer (ie added by hand)
+		for key, value := range a.secrets() {
+			if len(*value) == 0 {
+				*value = credentials[key]
+			}
+		}
+	}
+
+	if !plaintext {
+		return
+	}
+	err := a.Save()
+	if err != nil {
+		log.Warn("could not move credentials out of config file. ", err)
+		return
+	}
+	log.Info("moved credentials in config file to ", a.credentials.Location())
+}
+
+// lock stops secrets being saved as the ones in the store couldn't be loaded
+// settings can still be saved as long as no secrets are changed
+func (a *AppConfig) lock() {
+
+	a.locked = true
+	a.lockedSecrets = map[string]string{}
+	for key, value := range a.secrets() {
+		a.lockedSecrets[key] = *value
+	}
+}
+
 // Save details of a deploy to the deploy-state file
 func (a *AppConfig) Save() error {
 
-	a.v.Set("digitalocean-api-key", a.DigitalOceanAPIKey)
-	a.v.Set("cloudflare-api-key", a.CloudFlareAPIKey)
-	a.v.Set("linode-api-key", a.LinodeAPIKey)
-	a.v.Set("vultr-api-key", a.VultrAPIKey)
+	a.v.Set("aws-profile", a.AWSProfile)
+	a.v.Set("gcp-credentials", a.GCPCredentials)
+	a.v.Set("gcp-project", a.GCPProject)
+	a.v.Set("azure-subscription-id", a.AzureSubscription)
+	a.v.Set("azure-tenant-id", a.AzureTenantID)
+	a.v.Set("azure-client-id", a.AzureClientID)
 	a.v.Set("default-cloud", a.DefaultCloud)
+	a.v.Set("acme-email", a.ACMEEmail)
 
-	err := a.v.WriteConfig()
+	// note: caller logs the error as it has more context
+	stored, err := a.saveCredentials()
+	if err != nil {
+		return err
+	}
+
+	// passwords are with the other credentials
+	registries := []map[string]string{}
+	for _, credentials := range a.Registries {
+		registries = append(registries, map[string]string{
+			"host":     credentials.Host,
+			"username": credentials.Username,
+		})
+	}
+	a.v.Set("registries", registries)
+
+	// viper can't remove a key so the file is written without the secrets that are in the store
+	settings := a.v.AllSettings()
+	if stored {
+		for key := range a.secrets() {
+			delete(settings, key)
+		}
+	}
+	content, err := yaml.Marshal(settings)
+	if err == nil {
+		err = os.WriteFile(a.v.ConfigFileUsed(), content, 0600)
+	}
 	if err != nil {
 		log.Error("could not save config to disk: ", err)
 		return err
@@ -92,6 +261,57 @@ func (a *AppConfig) Save() error {
 	return nil
 }
 
+// saveCredentials puts the secrets in the credential store
+// the store is picked the first time there is something to save.  returns false if the
+// secrets aren't in the store (they couldn't be loaded) so must be left in the config file
+func (a *AppConfig) saveCredentials() (bool, error) {
+
+	if a.locked {
+		for key, value := range a.secrets() {
+			if *value != a.lockedSecrets[key] {
+				return false, errors.New("credentials could not be loaded so they can't be changed. set " + MasterKeyEnv + " or unlock the keyring")
+			}
+		}
+		return false, nil
+	}
+
+	store := a.credentials
+	credentials := map[string]string{}
+	for key, value := range a.secrets() {
+		credentials[key] = *value
+		if len(*value) > 0 && store == nil {
+			store = selectCredentialStore(a.path)
+		}
+	}
+
+	// passwords of registries that have been removed are deleted (empty values are removed)
+	var registries []string
+	for _, credentials := range a.Registries {
+		registries = append(registries, credentials.Host)
+	}
+	for _, host := range a.storedRegistries {
+		if !contains(registries, host) {
+			credentials["registry-password-"+host] = ""
+		}
+	}
+
+	if store == nil {
+		// no secrets at all
+		return true, nil
+	}
+
+	err := store.Save(credentials)
+	if err != nil {
+		return false, fmt.Errorf("could not save to %s: %w", store.Name(), err)
+	}
+	a.credentials = store
+	a.storedRegistries = registries
+	a.v.Set("credential-store", store.Name())
+	a.v.Set("stored-registries", registries)
+
+	return true, nil
+}
+
 // GetDefaultCloud returns which cloud has been configured
 // if there are multiple, will default to DigitalOcean
 func (a *AppConfig) GetDefaultCloud() string {
@@ -102,10 +322,18 @@ func (a *AppConfig) GetDefaultCloud() string {
 		// no default set so just return 1st that has API key
 		if len(a.DigitalOceanAPIKey) > 0 {
 			return "digitalocean"
+		} else if len(a.HetznerAPIKey) > 0 {
+			return "hetzner"
 		} else if len(a.LinodeAPIKey) > 0 {
 			return "linode"
 		} else if len(a.VultrAPIKey) > 0 {
 			return "vultr"
+		} else if len(a.AWSProfile) > 0 {
+			return "aws"
+		} else if len(a.GCPCredentials) > 0 {
+			return "gcp"
+		} else if len(a.AzureSubscription) > 0 {
+			return "azure"
 		}
 	}
 
@@ -113,3 +341,28 @@ func (a *AppConfig) GetDefaultCloud() string {
 	log.Debug("no cloud has been configured")
 	return ""
 }
+
+// GetRegistryCredentials returns the login details for a given registry host
+func (a *AppConfig) GetRegistryCredentials(host string) (RegistryCredentials, bool) {
+
+	for _, credentials := range a.Registries {
+		if credentials.Host == host {
+			return credentials, true
+		}
+	}
+
+	return RegistryCredentials{Host: host}, false
+}
+
+// SetRegistryCredentials adds (or replaces) the login details for a registry
+func (a *AppConfig) SetRegistryCredentials(credentials RegistryCredentials) {
+
+	for i := range a.Registries {
+		if a.Registries[i].Host == credentials.Host {
+			a.Registries[i] = credentials
+			return
+		}
+	}
+
+	a.Registries = append(a.Registries, credentials)
+}
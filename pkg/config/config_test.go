@@ -0,0 +1,228 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/zalando/go-keyring"
+	"gopkg.in/yaml.v3"
+)
+
+// useHome sets up an empty home directory with the given config file
+// and returns the directory the config is in
+func useHome(t *testing.T, content string) string {
+
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	path := filepath.Join(home, ".eezhee")
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(path, "config.yaml"), []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// loadAppConfig reads the config file like each command does
+func loadAppConfig(t *testing.T) *AppConfig {
+
+	appConfig := NewAppConfig()
+	err := appConfig.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return appConfig
+}
+
+// readConfigFile returns the settings in the config file
+func readConfigFile(t *testing.T, path string) map[string]interface{} {
+
+	content, err := os.ReadFile(filepath.Join(path, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := map[string]interface{}{}
+	err = yaml.Unmarshal(content, &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return settings
+}
+
+func TestMoveCredentialsToFile(t *testing.T) {
+
+	// without a keyring, credentials go in the encrypted file
+	keyring.MockInitWithError(errors.New("no keyring"))
+	t.Setenv(MasterKeyEnv, "correct horse battery staple")
+	path := useHome(t, `hetzner-api-key: hetzner-secret
+default-cloud: hetzner
+registries:
+  - host: ghcr.io
+    username: me
+    password: ghcr-secret
+`)
+
+	appConfig := loadAppConfig(t)
+	if appConfig.HetznerAPIKey != "hetzner-secret" {
+		t.Fatalf("HetznerAPIKey = %q, want hetzner-secret", appConfig.HetznerAPIKey)
+	}
+
+	// secrets are moved out of the config file. everything else stays
+	content, err := os.ReadFile(filepath.Join(path, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "secret") {
+		t.Fatal("expected secrets to be removed from config file, got ", string(content))
+	}
+	settings := readConfigFile(t, path)
+	if settings["credential-store"] != "file" || settings["default-cloud"] != "hetzner" {
+		t.Fatalf("unexpected config file %v", settings)
+	}
+
+	encrypted, err := os.ReadFile(filepath.Join(path, credentialsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encrypted), "secret") {
+		t.Fatal("expected credentials file to be encrypted")
+	}
+
+	// and loaded from the file next time
+	appConfig = loadAppConfig(t)
+	credentials, found := appConfig.GetRegistryCredentials("ghcr.io")
+	if appConfig.HetznerAPIKey != "hetzner-secret" || !found || credentials.Username != "me" || credentials.Password != "ghcr-secret" {
+		t.Fatalf("expected credentials to be loaded, got %q and %+v", appConfig.HetznerAPIKey, credentials)
+	}
+}
+
+func TestLockedCredentials(t *testing.T) {
+
+	keyring.MockInitWithError(errors.New("no keyring"))
+	t.Setenv(MasterKeyEnv, "correct horse battery staple")
+	path := useHome(t, "hetzner-api-key: hetzner-secret\n")
+	loadAppConfig(t)
+
+	// with the wrong passphrase the credentials can't be loaded
+	t.Setenv(MasterKeyEnv, "wrong")
+	appConfig := loadAppConfig(t)
+	if !appConfig.locked || len(appConfig.HetznerAPIKey) > 0 {
+		t.Fatalf("expected credentials to be locked, got %+v", appConfig)
+	}
+
+	// settings can still be changed
+	appConfig.DefaultCloud = "hetzner"
+	err := appConfig.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := readConfigFile(t, path)
+	if settings["default-cloud"] != "hetzner" || settings["credential-store"] != "file" {
+		t.Fatalf("unexpected config file %v", settings)
+	}
+
+	// but secrets can't
+	appConfig.LinodeAPIKey = "linode-secret"
+	err = appConfig.Save()
+	if err == nil {
+		t.Fatal("expected secrets not to be saved while locked")
+	}
+
+	// and the ones that are stored are left alone
+	t.Setenv(MasterKeyEnv, "correct horse battery staple")
+	appConfig = loadAppConfig(t)
+	if appConfig.HetznerAPIKey != "hetzner-secret" || len(appConfig.LinodeAPIKey) > 0 {
+		t.Fatalf("expected only the original secret, got %q and %q", appConfig.HetznerAPIKey, appConfig.LinodeAPIKey)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+
+	t.Setenv(MasterKeyEnv, "correct horse battery staple")
+	path := filepath.Join(t.TempDir(), credentialsFile)
+
+	// no file means no credentials
+	store := &fileStore{path: path}
+	credentials, err := store.Load(nil)
+	if err != nil || len(credentials) != 0 {
+		t.Fatalf("expected no credentials, got %v, %v", credentials, err)
+	}
+
+	err = store.Save(map[string]string{"vultr-api-key": "vultr-secret", "linode-api-key": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials, err = (&fileStore{path: path}).Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 1 || credentials["vultr-api-key"] != "vultr-secret" {
+		t.Fatalf("expected only the credentials with values, got %v", credentials)
+	}
+
+	t.Setenv(MasterKeyEnv, "wrong")
+	_, err = (&fileStore{path: path}).Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatal("expected wrong passphrase error, got ", err)
+	}
+}
+
+func TestRemovedRegistriesDeleted(t *testing.T) {
+
+	keyring.MockInit()
+	path := useHome(t, "")
+
+	appConfig := loadAppConfig(t)
+	appConfig.SetRegistryCredentials(RegistryCredentials{Host: "ghcr.io", Username: "me", Password: "ghcr-secret"})
+	appConfig.SetRegistryCredentials(RegistryCredentials{Host: "quay.io", Username: "me", Password: "quay-secret"})
+	err := appConfig.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"ghcr.io", "quay.io"} {
+		if _, err := keyring.Get(keyringService, "registry-password-"+host); err != nil {
+			t.Fatalf("expected %s password in keyring: %s", host, err)
+		}
+	}
+
+	// removed while running
+	appConfig.Registries = appConfig.Registries[1:]
+	err = appConfig.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.Get(keyringService, "registry-password-ghcr.io"); !errors.Is(err, keyring.ErrNotFound) {
+		t.Fatal("expected ghcr.io password to be deleted, got ", err)
+	}
+
+	// removed from the config file by hand
+	settings := readConfigFile(t, path)
+	settings["registries"] = []interface{}{}
+	content, err := yaml.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(path, "config.yaml"), content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appConfig = loadAppConfig(t)
+	err = appConfig.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.Get(keyringService, "registry-password-quay.io"); !errors.Is(err, keyring.ErrNotFound) {
+		t.Fatal("expected quay.io password to be deleted, got ", err)
+	}
+}
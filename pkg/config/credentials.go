@@ -0,0 +1,260 @@
+package config
+
+// api keys and other secrets are kept out of config.yaml.  they go in the os keyring
+// (the secret service on linux) or, if there isn't one, a file encrypted with age
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// MasterKeyEnv has the passphrase of the encrypted credentials file
+// without it, the passphrase is asked for (if there is a terminal)
+const MasterKeyEnv = "EEZHEE_MASTER_KEY"
+
+const keyringService = "eezhee"
+const credentialsFile = "credentials.age"
+
+// credentialStore keeps secrets outside of the config file
+type credentialStore interface {
+	Name() string
+	Location() string                              // where the credentials are, for messages
+	Load(keys []string) (map[string]string, error) // keyrings can't list their entries so the keys are needed
+	Save(credentials map[string]string) error      // empty values are removed
+}
+
+// newCredentialStore returns the store with the given name (as saved in the config file)
+func newCredentialStore(name string, path string) (credentialStore, error) {
+
+	switch name {
+	case "keyring":
+		return keyringStore{}, nil
+	case "file":
+		return &fileStore{path: filepath.Join(path, credentialsFile)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown credential store %s", name)
+}
+
+// selectCredentialStore picks where to put credentials that aren't stored anywhere yet
+// the keyring is used if it is running, otherwise an encrypted file
+func selectCredentialStore(path string) credentialStore {
+
+	// any lookup shows if the keyring is running
+	_, err := keyring.Get(keyringService, "probe")
+	if err == nil || errors.Is(err, keyring.ErrNotFound) {
+		return keyringStore{}
+	}
+
+	return &fileStore{path: filepath.Join(path, credentialsFile)}
+}
+
+// keyringStore keeps each credential as an entry in the os keyring
+type keyringStore struct{}
+
+// Name of the store
+func (k keyringStore) Name() string {
+	return "keyring"
+}
+
+// Location of the credentials
+func (k keyringStore) Location() string {
+	return "os keyring"
+}
+
+// Load the given credentials from the keyring. ones that aren't there are left out
+func (k keyringStore) Load(keys []string) (map[string]string, error) {
+
+	credentials := map[string]string{}
+	for _, key := range keys {
+		value, err := keyring.Get(keyringService, key)
+		if errors.Is(err, keyring.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		credentials[key] = value
+	}
+
+	return credentials, nil
+}
+
+// Save the credentials to the keyring
+func (k keyringStore) Save(credentials map[string]string) error {
+
+	for key, value := range credentials {
+		if len(value) == 0 {
+			err := keyring.Delete(keyringService, key)
+			if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+				return err
+			}
+			continue
+		}
+		err := keyring.Set(keyringService, key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileStore keeps the credentials in a yaml file encrypted with a passphrase (age scrypt)
+type fileStore struct {
+	path       string
+	once       sync.Once
+	passphrase string
+	err        error
+}
+
+// Name of the store
+func (f *fileStore) Name() string {
+	return "file"
+}
+
+// Location of the credentials
+func (f *fileStore) Location() string {
+	return f.path
+}
+
+// Load decrypts the file. there are no credentials if it doesn't exist
+func (f *fileStore) Load(keys []string) (map[string]string, error) {
+
+	credentials := map[string]string{}
+
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return credentials, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	passphrase, err := f.getPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := age.Decrypt(file, identity)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %s. wrong passphrase? %w", f.path, err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(content, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", f.path, err)
+	}
+
+	return credentials, nil
+}
+
+// Save encrypts the credentials to the file
+func (f *fileStore) Save(credentials map[string]string) error {
+
+	// first save asks for the passphrase twice
+	_, statErr := os.Stat(f.path)
+	passphrase, err := f.getPassphrase(errors.Is(statErr, os.ErrNotExist))
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	for key, value := range credentials {
+		if len(value) > 0 {
+			values[key] = value
+		}
+	}
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+	var encrypted bytes.Buffer
+	writer, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(content); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	// replace the file in one step so a failed write doesn't lose the credentials
+	tmpFile := f.path + ".tmp"
+	err = os.WriteFile(tmpFile, encrypted.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, f.path)
+}
+
+// getPassphrase from EEZHEE_MASTER_KEY or the terminal. only asked for once
+func (f *fileStore) getPassphrase(confirm bool) (string, error) {
+
+	f.once.Do(func() {
+		f.passphrase = os.Getenv(MasterKeyEnv)
+		if len(f.passphrase) > 0 {
+			return
+		}
+
+		stdin := int(os.Stdin.Fd())
+		if !term.IsTerminal(stdin) {
+			f.err = fmt.Errorf("credentials file %s needs a passphrase. set %s to it", f.path, MasterKeyEnv)
+			return
+		}
+
+		fmt.Fprint(os.Stderr, "passphrase for ", f.path, ": ")
+		passphrase, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			f.err = err
+			return
+		}
+		if len(passphrase) == 0 {
+			f.err = errors.New("passphrase can't be empty")
+			return
+		}
+		if confirm {
+			fmt.Fprint(os.Stderr, "confirm passphrase: ")
+			again, err := term.ReadPassword(stdin)
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				f.err = err
+				return
+			}
+			if !bytes.Equal(passphrase, again) {
+				f.err = errors.New("passphrases don't match")
+				return
+			}
+		}
+		f.passphrase = string(passphrase)
+	})
+
+	return f.passphrase, f.err
+}
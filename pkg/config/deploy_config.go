@@ -10,13 +10,75 @@ import (
 // DeployConfig has details of how to deploy the cluster
 // note: all these fields are optional
 type DeployConfig struct {
-	v            *viper.Viper // viper object
-	Cloud        string       // which cloud cluster was create in
-	Region       string       // where to deploy the cluster
-	Name         string       // what to call the cluster
-	K3sVersion   string       // version of k3s to use. ie: latest, stable, 1.18, 1.18.3
-	Size         string       // VM size
-	SSHPublicKey string       // which ssh key to allow to acces the VM(s)
+	v            *viper.Viper     // viper object
+	Cloud        string           // which cloud cluster was create in
+	Type         string           // 'k3s' (default) or 'managed' for the cloud's kubernetes service
+	Region       string           // where to deploy the cluster. cloud's region or generic one (ie us-east)
+	Near         string           // deploy to the region closest to this city (or 'lat,long') instead
+	Name         string           // what to call the cluster
+	K3sVersion   string           // version of k3s to use. ie: latest, stable, 1.18, 1.18.3
+	K8sVersion   string           // kubernetes version for managed clusters. defaults to latest
+	Size         string           // VM size
+	OS           string           // os of the VM. ie ubuntu-24.04 or debian-12
+	Arch         string           // amd64 or arm64. defaults to the arch of the size
+	Image        string           // 'baked' to build from an image made with 'eezhee image bake'
+	SSHPublicKey string           // which ssh key to allow to acces the VM(s)
+	Registry     RegistryConfig   // container registries cluster should use
+	Secrets      []SecretConfig   // kubernetes secrets to create from local files
+	GitOps       GitOpsConfig     // git repo the cluster should sync from
+	Servers      []ServerConfig   // existing servers to use (only for the ssh cloud)
+	NodePools    []NodePoolConfig // worker nodes (only for managed clusters)
+}
+
+// NodePoolConfig has details of a group of worker nodes in a managed cluster
+type NodePoolConfig struct {
+	Name  string `mapstructure:"name"`  // defaults to <cluster name>-pool
+	Size  string `mapstructure:"size"`  // provider specific. defaults to size of the cluster
+	Count int    `mapstructure:"count"` // defaults to 1
+}
+
+// ServerConfig has details of how to log into a server the user already has
+type ServerConfig struct {
+	Host string `mapstructure:"host"` // ip address or hostname
+	User string `mapstructure:"user"` // defaults to root. others need passwordless sudo
+	Port int    `mapstructure:"port"` // defaults to 22
+	Key  string `mapstructure:"key"`  // private key file. defaults to ~/.ssh/id_rsa
+}
+
+// GitOpsConfig has details of the controller and repo used to deploy apps with gitops
+type GitOpsConfig struct {
+	Engine    string `mapstructure:"engine"`     // 'flux' or 'argocd'
+	Repo      string `mapstructure:"repo"`       // ssh url. ie git@github.com:org/app.git
+	Branch    string `mapstructure:"branch"`     // defaults to 'main'
+	Path      string `mapstructure:"path"`       // directory with manifests
+	DeployKey string `mapstructure:"deploy-key"` // private key file. generated if it doesn't exist
+}
+
+// RegistryConfig has details of the container registries a cluster uses
+// note: credentials are kept in the app config, not in the deploy file
+type RegistryConfig struct {
+	Enabled  bool               `mapstructure:"enabled"`  // run a registry inside the cluster
+	Host     string             `mapstructure:"host"`     // hostname of the built-in registry
+	External []ExternalRegistry `mapstructure:"external"` // other registries nodes pull from
+}
+
+// SecretConfig has details of where the values for a kubernetes secret come from
+// only one of the files should be set
+type SecretConfig struct {
+	Name        string   `mapstructure:"name"`        // name of the secret
+	Namespace   string   `mapstructure:"namespace"`   // defaults to 'default'
+	EnvFile     string   `mapstructure:"env-file"`    // plaintext dotenv file
+	SOPSFile    string   `mapstructure:"sops-file"`   // sops encrypted file
+	AgeFile     string   `mapstructure:"age-file"`    // age encrypted dotenv or yaml file
+	Deployments []string `mapstructure:"deployments"` // restart these when values change
+}
+
+// ExternalRegistry has details of a registry outside the cluster (ie ghcr.io or harbor)
+type ExternalRegistry struct {
+	Host               string   `mapstructure:"host"`                 // ie ghcr.io
+	MirrorFor          []string `mapstructure:"mirror-for"`           // ie docker.io
+	CAFile             string   `mapstructure:"ca-file"`              // CA that signed registry's cert
+	InsecureSkipVerify bool     `mapstructure:"insecure-skip-verify"` // don't validate cert
 }
 
 // NewDeployConfig will create a new deploy file object
@@ -60,11 +122,47 @@ func (d *DeployConfig) Load() error {
 
 	d.Name = d.v.GetString("name")
 	d.Cloud = d.v.GetString("cloud")
+	d.Type = d.v.GetString("type")
 	d.Region = d.v.GetString("region")
+	d.Near = d.v.GetString("near")
 	d.K3sVersion = d.v.GetString("k3s-version")
+	d.K8sVersion = d.v.GetString("kubernetes-version")
 	d.Size = d.v.GetString("size")
+	d.OS = d.v.GetString("os")
+	d.Arch = d.v.GetString("arch")
+	d.Image = d.v.GetString("image")
 	d.SSHPublicKey = d.v.GetString("ssh-public-key")
 
+	err := d.v.UnmarshalKey("registry", &d.Registry)
+	if err != nil {
+		log.Error("invalid registry settings in deploy file: ", err)
+		return err
+	}
+
+	err = d.v.UnmarshalKey("secrets", &d.Secrets)
+	if err != nil {
+		log.Error("invalid secrets in deploy file: ", err)
+		return err
+	}
+
+	err = d.v.UnmarshalKey("gitops", &d.GitOps)
+	if err != nil {
+		log.Error("invalid gitops settings in deploy file: ", err)
+		return err
+	}
+
+	err = d.v.UnmarshalKey("servers", &d.Servers)
+	if err != nil {
+		log.Error("invalid servers in deploy file: ", err)
+		return err
+	}
+
+	err = d.v.UnmarshalKey("node-pools", &d.NodePools)
+	if err != nil {
+		log.Error("invalid node pools in deploy file: ", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -74,6 +172,7 @@ func (d *DeployConfig) Save() error {
 	d.v.Set("cloud", d.Cloud)
 	d.v.Set("name", d.Name)
 	d.v.Set("region", d.Region)
+	d.v.Set("near", d.Near)
 	d.v.Set("size", d.Size)
 	d.v.Set("ssh-public-key", d.SSHPublicKey)
 	d.v.Set("k3s-version", d.K3sVersion)
@@ -9,15 +9,30 @@ import (
 
 // DeployState has details of the deploy-state file for a cluster
 type DeployState struct {
-	v            *viper.Viper // used to read/write state
-	Cloud        string       // which cloud cluster was create in
-	ID           string       // ID of the VM cluster is on
-	Name         string       // name of the cluster
-	Region       string       // region cluster deployed to
-	Size         string       // VM size
-	IP           string       // public IPv4 address
-	SSHPublicKey string       // which ssh key authorited to access VM
-	K3sVersion   string       // version of k3s installed
+	v            *viper.Viper     // used to read/write state
+	Cloud        string           // which cloud cluster was create in
+	Type         string           // 'managed' if the cloud's kubernetes service is used. empty for k3s
+	ID           string           // ID of the VM cluster is on (or of the managed cluster)
+	Name         string           // name of the cluster
+	Region       string           // region cluster deployed to
+	Size         string           // VM size
+	OS           string           // os of the VM (ie ubuntu-24.04)
+	IP           string           // public IPv4 address
+	SSHPublicKey string           // which ssh key authorited to access VM
+	K3sVersion   string           // version of k3s installed
+	K8sVersion   string           // kubernetes version of a managed cluster
+	RegistryHost string           // hostname of built-in registry (if enabled)
+	SecretKey    string           // hex key secret values are hashed with (see 'eezhee secrets')
+	Exposed      []ExposedService // deployments published with 'eezhee expose'
+}
+
+// ExposedService has details of a deployment that has been published to the internet
+type ExposedService struct {
+	Deployment string `mapstructure:"deployment"`
+	Namespace  string `mapstructure:"namespace"`
+	Port       int    `mapstructure:"port"`
+	Host       string `mapstructure:"host"`
+	DNSRecord  string `mapstructure:"dns-record"` // set if eezhee created the dns record
 }
 
 // NewDeployState will create a new deploy file object
@@ -61,13 +76,25 @@ func (s *DeployState) Load() error {
 	}
 
 	s.Cloud = s.v.GetString("cloud")
+	s.Type = s.v.GetString("type")
 	s.ID = s.v.GetString("id")
 	s.Name = s.v.GetString("name")
 	s.Region = s.v.GetString("region")
 	s.Size = s.v.GetString("size")
+	s.OS = s.v.GetString("os")
 	s.IP = s.v.GetString("ip")
 	s.SSHPublicKey = s.v.GetString("ssh-public-key")
 	s.K3sVersion = s.v.GetString("k3s-version")
+	s.K8sVersion = s.v.GetString("kubernetes-version")
+	s.RegistryHost = s.v.GetString("registry-host")
+	s.SecretKey = s.v.GetString("secret-key")
+
+	s.Exposed = nil
+	err := s.v.UnmarshalKey("exposed", &s.Exposed)
+	if err != nil {
+		log.Error("invalid exposed services in state file: ", err)
+		return err
+	}
 
 	return nil
 }
@@ -77,13 +104,30 @@ func (s *DeployState) Save() error {
 
 	// move all our state variables over to viper
 	s.v.Set("cloud", s.Cloud)
+	s.v.Set("type", s.Type)
 	s.v.Set("id", s.ID)
 	s.v.Set("name", s.Name)
 	s.v.Set("region", s.Region)
 	s.v.Set("size", s.Size)
+	s.v.Set("os", s.OS)
 	s.v.Set("ip", s.IP)
 	s.v.Set("ssh-public-key", s.SSHPublicKey)
 	s.v.Set("k3s-version", s.K3sVersion)
+	s.v.Set("kubernetes-version", s.K8sVersion)
+	s.v.Set("registry-host", s.RegistryHost)
+	s.v.Set("secret-key", s.SecretKey)
+
+	exposed := []map[string]interface{}{}
+	for _, service := range s.Exposed {
+		exposed = append(exposed, map[string]interface{}{
+			"deployment": service.Deployment,
+			"namespace":  service.Namespace,
+			"port":       service.Port,
+			"host":       service.Host,
+			"dns-record": service.DNSRecord,
+		})
+	}
+	s.v.Set("exposed", exposed)
 
 	err := s.v.WriteConfig()
 	if err != nil {
@@ -0,0 +1,408 @@
+package core
+
+// the region & size catalogs compiled into eezhee are a snapshot of what the clouds had
+// when it was built.  'eezhee catalog refresh' gets the latest from each cloud's api
+// and keeps it in a cache that is used instead of the snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// CatalogVersion is the format of the catalog cache. caches in any other format are ignored
+const CatalogVersion = 1
+
+const catalogCacheFile = "catalog-cache.yaml"
+
+// CatalogCache has the latest regions, sizes & images of the clouds that have been refreshed
+type CatalogCache struct {
+	Version  int                     `yaml:"version"`
+	Snapshot string                  `yaml:"snapshot"` // built in catalog it was refreshed with
+	Clouds   map[string]CloudCatalog `yaml:"clouds"`
+}
+
+// CloudCatalog is what a cloud's api had when it was refreshed
+type CloudCatalog struct {
+	Refreshed time.Time       `yaml:"refreshed"`
+	Regions   []catalogRegion `yaml:"regions"`
+	Sizes     []catalogSize   `yaml:"sizes"`
+	Images    []catalogImage  `yaml:"images"`
+}
+
+// catalogImage is a cloud's image of one of the supported OperatingSystems
+type catalogImage struct {
+	OS   string `yaml:"os"`
+	Arch string `yaml:"arch"`
+	Slug string `yaml:"slug"`
+	Name string `yaml:"name"`
+}
+
+// PriceChange is a size whose price is different than in the built in catalog
+type PriceChange struct {
+	Size     string  `json:"size"`
+	OldPrice float32 `json:"old_price"`
+	NewPrice float32 `json:"new_price"`
+}
+
+// CatalogDiff is what changed in a cloud since the catalog built into eezhee
+type CatalogDiff struct {
+	Cloud          string        `json:"cloud"`
+	Refreshed      time.Time     `json:"refreshed"`
+	NewRegions     []RegionInfo  `json:"new_regions"` // City is empty if it isn't in the catalog
+	RetiredRegions []RegionInfo  `json:"retired_regions"`
+	NewSizes       []SizeInfo    `json:"new_sizes"`
+	RetiredSizes   []SizeInfo    `json:"retired_sizes"`
+	PriceChanges   []PriceChange `json:"price_changes"`
+}
+
+// Empty checks if nothing has changed
+func (d CatalogDiff) Empty() bool {
+	return len(d.NewRegions) == 0 && len(d.RetiredRegions) == 0 && len(d.NewSizes) == 0 &&
+		len(d.RetiredSizes) == 0 && len(d.PriceChanges) == 0
+}
+
+// catalogSnapshot identifies the catalog built into eezhee
+// a cache refreshed with another snapshot (ie an older eezhee) isn't used
+func catalogSnapshot() string {
+
+	hash := sha256.New()
+	hash.Write(regionCatalogData)
+	hash.Write(sizeCatalogData)
+
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// builtInCatalogs parses the catalogs compiled into eezhee (without the cache)
+func builtInCatalogs() (regionCatalog, sizeCatalog, error) {
+
+	var regions regionCatalog
+	var sizes sizeCatalog
+	if err := yaml.Unmarshal(regionCatalogData, &regions); err != nil {
+		return regions, sizes, fmt.Errorf("invalid region catalog: %w", err)
+	}
+	if err := yaml.Unmarshal(sizeCatalogData, &sizes); err != nil {
+		return regions, sizes, fmt.Errorf("invalid size catalog: %w", err)
+	}
+
+	return regions, sizes, nil
+}
+
+// catalogCachePath is where the cache is kept (in the same directory as the app config)
+func catalogCachePath() (string, error) {
+
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".eezhee", catalogCacheFile), nil
+}
+
+// LoadCatalogCache reads the cache. it is empty if no cloud has been refreshed
+func LoadCatalogCache() (*CatalogCache, error) {
+
+	cache := &CatalogCache{Version: CatalogVersion, Clouds: map[string]CloudCatalog{}}
+
+	path, err := catalogCachePath()
+	if err != nil {
+		return cache, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, err
+	}
+
+	var cached CatalogCache
+	if err := yaml.Unmarshal(data, &cached); err != nil {
+		return cache, fmt.Errorf("invalid catalog cache %s: %w", path, err)
+	}
+	if cached.Version != CatalogVersion {
+		return cache, fmt.Errorf("catalog cache %s is version %d (eezhee uses version %d). run 'eezhee catalog refresh'",
+			path, cached.Version, CatalogVersion)
+	}
+	if cached.Clouds == nil {
+		cached.Clouds = map[string]CloudCatalog{}
+	}
+
+	return &cached, nil
+}
+
+// Save writes the cache to disk
+func (c *CatalogCache) Save() error {
+
+	path, err := catalogCachePath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	c.Version = CatalogVersion
+	c.Snapshot = catalogSnapshot()
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// Current checks if the cache was refreshed with the catalog built into this eezhee
+func (c *CatalogCache) Current() bool {
+	return c.Snapshot == catalogSnapshot()
+}
+
+var (
+	catalogCacheOnce sync.Once
+	catalogCache     *CatalogCache
+)
+
+// cachedCatalog returns the cache the catalogs use. nil if there isn't a usable one
+func cachedCatalog() *CatalogCache {
+
+	catalogCacheOnce.Do(func() {
+		loaded, err := LoadCatalogCache()
+		if err != nil {
+			log.Debug("using built in catalog. ", err)
+			return
+		}
+		if len(loaded.Clouds) == 0 {
+			return
+		}
+		if !loaded.Current() {
+			log.Debug("using built in catalog as the catalog cache was refreshed with another version of eezhee")
+			return
+		}
+		catalogCache = loaded
+	})
+
+	return catalogCache
+}
+
+// NewCloudCatalog filters what a cloud's api returned to what eezhee supports
+// regions must be available. a region in a city that isn't in the catalog has no city
+// (so isn't used) but is kept so 'eezhee catalog diff' can show it
+// sizes must be available and in one of the cloud's families (or already in the catalog)
+func NewCloudCatalog(cloud string, regions []RegionInfo, sizes []SizeInfo, images []ImageInfo) (CloudCatalog, error) {
+
+	builtInRegions, builtInSizes, err := builtInCatalogs()
+	if err != nil {
+		return CloudCatalog{}, err
+	}
+	cloudCatalog := CloudCatalog{Refreshed: time.Now().UTC().Truncate(time.Second)}
+
+	// regions keep their city from the catalog. new ones are matched by name
+	cities := map[string]string{}
+	for _, region := range builtInRegions.Regions[cloud] {
+		cities[region.Slug] = region.City
+	}
+	for _, region := range regions {
+		if !region.Available {
+			continue
+		}
+		city, found := cities[region.Slug]
+		if !found {
+			city = matchCity(builtInRegions.Cities, region.City, region.Name)
+		}
+		cloudCatalog.Regions = append(cloudCatalog.Regions, catalogRegion{Slug: region.Slug, Name: region.Name, City: city})
+	}
+
+	var family *regexp.Regexp
+	if pattern, found := builtInSizes.Families[cloud]; found {
+		family, err = regexp.Compile(pattern)
+		if err != nil {
+			return CloudCatalog{}, fmt.Errorf("invalid size catalog: %s family: %w", cloud, err)
+		}
+	}
+	known := map[string]bool{}
+	for _, size := range builtInSizes.Sizes[cloud] {
+		known[size.Slug] = true
+	}
+	for _, size := range sizes {
+		// generic sizes are whole cpus & GB
+		if !size.Available || size.VCPUs == 0 || size.Memory < 1024 || size.Memory%1024 != 0 {
+			continue
+		}
+		if !known[size.Slug] && (family == nil || !family.MatchString(size.Slug)) {
+			continue
+		}
+		arch := size.Arch
+		if arch == "amd64" {
+			arch = ""
+		}
+		cloudCatalog.Sizes = append(cloudCatalog.Sizes, catalogSize{
+			Slug:     size.Slug,
+			CPUs:     size.VCPUs,
+			Memory:   size.Memory / 1024,
+			Disk:     size.Disk,
+			Transfer: size.Transfer,
+			Price:    float32(math.Round(float64(size.PriceMonthly)*100) / 100),
+			Arch:     arch,
+		})
+	}
+	// smallest to largest, same as the catalog
+	sort.SliceStable(cloudCatalog.Sizes, func(i, j int) bool {
+		a, b := cloudCatalog.Sizes[i], cloudCatalog.Sizes[j]
+		if a.Arch != b.Arch {
+			return a.Arch < b.Arch
+		}
+		if a.Price != b.Price {
+			return a.Price < b.Price
+		}
+		if a.CPUs != b.CPUs {
+			return a.CPUs < b.CPUs
+		}
+		return a.Memory < b.Memory
+	})
+
+	for _, image := range images {
+		if len(image.OS) == 0 {
+			continue
+		}
+		cloudCatalog.Images = append(cloudCatalog.Images, catalogImage{OS: image.OS, Arch: image.Arch, Slug: image.Slug, Name: image.Name})
+	}
+	sort.SliceStable(cloudCatalog.Images, func(i, j int) bool {
+		a, b := cloudCatalog.Images[i], cloudCatalog.Images[j]
+		if a.OS != b.OS {
+			return a.OS < b.OS
+		}
+		return a.Arch < b.Arch
+	})
+
+	return cloudCatalog, nil
+}
+
+// matchCity finds the catalog city a region is in from its city or name (ie 'New York 3')
+// empty if none match
+func matchCity(cities map[string]City, names ...string) string {
+
+	// longest first so a city isn't matched by part of its name
+	var keys []string
+	for key := range cities {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, name := range names {
+		if len(name) == 0 {
+			continue
+		}
+		name = cityKey(name)
+		if _, found := cities[name]; found {
+			return name
+		}
+		for _, key := range keys {
+			if strings.Contains(name, key) {
+				return key
+			}
+		}
+	}
+
+	return ""
+}
+
+// mergeRegions updates a cloud's regions in the catalog with the ones it was refreshed with
+// regions the cloud no longer has are dropped and new ones in a known city are added after
+// the existing ones so the order of preference doesn't change
+func mergeRegions(builtIn []catalogRegion, refreshed []catalogRegion, cities map[string]City) []catalogRegion {
+
+	current := map[string]bool{}
+	for _, region := range refreshed {
+		current[region.Slug] = true
+	}
+
+	var merged []catalogRegion
+	existing := map[string]bool{}
+	for _, region := range builtIn {
+		existing[region.Slug] = true
+		if current[region.Slug] {
+			merged = append(merged, region)
+		}
+	}
+	for _, region := range refreshed {
+		if _, found := cities[region.City]; found && !existing[region.Slug] {
+			merged = append(merged, region)
+		}
+	}
+
+	return merged
+}
+
+// DiffCatalog compares what a cloud had when it was refreshed with the catalog built into eezhee
+func DiffCatalog(cloud string, refreshed CloudCatalog) (CatalogDiff, error) {
+
+	builtInRegions, builtInSizes, err := builtInCatalogs()
+	if err != nil {
+		return CatalogDiff{}, err
+	}
+	diff := CatalogDiff{Cloud: cloud, Refreshed: refreshed.Refreshed}
+
+	regionInfo := func(region catalogRegion) RegionInfo {
+		city := builtInRegions.Cities[region.City]
+		return RegionInfo{Name: region.Name, Slug: region.Slug, City: city.Name, Country: city.Country, Area: city.Area}
+	}
+	builtIn := map[string]bool{}
+	for _, region := range builtInRegions.Regions[cloud] {
+		builtIn[region.Slug] = true
+	}
+	current := map[string]bool{}
+	for _, region := range refreshed.Regions {
+		current[region.Slug] = true
+		if !builtIn[region.Slug] {
+			diff.NewRegions = append(diff.NewRegions, regionInfo(region))
+		}
+	}
+	for _, region := range builtInRegions.Regions[cloud] {
+		if !current[region.Slug] {
+			diff.RetiredRegions = append(diff.RetiredRegions, regionInfo(region))
+		}
+	}
+
+	builtInPrices := map[string]float32{}
+	for _, size := range builtInSizes.Sizes[cloud] {
+		builtInPrices[size.Slug] = size.Price
+	}
+	currentSizes := map[string]bool{}
+	for _, size := range refreshed.Sizes {
+		currentSizes[size.Slug] = true
+		price, found := builtInPrices[size.Slug]
+		if !found {
+			diff.NewSizes = append(diff.NewSizes, size.info())
+			continue
+		}
+		if math.Abs(float64(price-size.Price)) >= 0.01 {
+			diff.PriceChanges = append(diff.PriceChanges, PriceChange{Size: size.Slug, OldPrice: price, NewPrice: size.Price})
+		}
+	}
+	for _, size := range builtInSizes.Sizes[cloud] {
+		if !currentSizes[size.Slug] {
+			diff.RetiredSizes = append(diff.RetiredSizes, size.info())
+		}
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,36 @@
+package core
+
+import "context"
+
+// ClusterManager is the interface clouds with managed kubernetes need to follow
+// it is implemented by the same manager object as VMManager so callers can
+// check if a cloud supports it with a type assertion
+type ClusterManager interface {
+	ListClusters(ctx context.Context) ([]ClusterInfo, error)
+	CreateCluster(ctx context.Context, name string, version string, region string, nodePools []NodePool) (ClusterInfo, error)
+	GetClusterInfo(ctx context.Context, clusterID string) (ClusterInfo, error)
+	GetKubeConfig(ctx context.Context, clusterID string) ([]byte, error)
+	DeleteCluster(ctx context.Context, clusterID string) error
+}
+
+// NodePool is a group of worker nodes that are all the same size
+type NodePool struct {
+	Name  string `json:"name"`
+	Size  string `json:"size"`  // provider specific. ie s-2vcpu-4gb
+	Count int    `json:"count"` // number of nodes
+}
+
+// ClusterInfo has details about a managed kubernetes cluster
+// like VMInfo, providers need to set Status to 'running' once the cluster is ready
+// and to 'failed' if the cloud gave up on it, so callers stop waiting
+type ClusterInfo struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	Region    string     `json:"region"`
+	Version   string     `json:"version"`  // kubernetes version
+	Endpoint  string     `json:"endpoint"` // kubernetes api
+	CreatedAt string     `json:"created_at"`
+	NodePools []NodePool `json:"node_pools"`
+	Tags      []string   `json:"tags"`
+}
@@ -0,0 +1,151 @@
+// Package conformance has checks every core.VMManager needs to pass
+// providers convert their api objects in their own way, this makes sure the
+// result looks the same to the rest of eezhee
+package conformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+)
+
+// Expect describes the VMs in a provider's fixtures
+type Expect struct {
+	RunningID string // vm that is up
+	PendingID string // vm that is still being created (and has no ip yet)
+	MissingID string // vm the api returns a 404 for
+	Name      string // name of the running vm
+	PublicIP  string // public ipv4 of the running vm
+	CreatedAt string // creation time of the running vm in RFC3339 (UTC)
+	NumListed int    // number of vms tagged 'eezhee' in the list fixture
+}
+
+// Run checks a manager (pointed at a replay of its api) behaves like every other provider
+// unauthorized is the same manager pointed at an api that rejects its credentials
+func Run(t *testing.T, manager core.VMManager, unauthorized core.VMManager, expect Expect) {
+
+	ctx := context.Background()
+
+	t.Run("running vm", func(t *testing.T) {
+		vmInfo, err := manager.GetVMInfo(ctx, expect.RunningID)
+		if err != nil {
+			t.Fatalf("GetVMInfo: %s", err)
+		}
+		if vmInfo.ID != expect.RunningID {
+			t.Errorf("ID = %q, want %q", vmInfo.ID, expect.RunningID)
+		}
+		if vmInfo.Name != expect.Name {
+			t.Errorf("Name = %q, want %q", vmInfo.Name, expect.Name)
+		}
+		if vmInfo.Status != "running" {
+			t.Errorf("Status = %q, want running", vmInfo.Status)
+		}
+		if vmInfo.CreatedAt != expect.CreatedAt {
+			t.Errorf("CreatedAt = %q, want %q", vmInfo.CreatedAt, expect.CreatedAt)
+		}
+		checkTimestamp(t, vmInfo)
+		checkTagged(t, vmInfo)
+
+		ip, err := vmInfo.GetPublicIP()
+		if err != nil {
+			t.Errorf("GetPublicIP: %s", err)
+		}
+		if ip != expect.PublicIP {
+			t.Errorf("GetPublicIP = %q, want %q", ip, expect.PublicIP)
+		}
+		checkNetworks(t, vmInfo)
+	})
+
+	t.Run("pending vm", func(t *testing.T) {
+		vmInfo, err := manager.GetVMInfo(ctx, expect.PendingID)
+		if err != nil {
+			t.Fatalf("GetVMInfo: %s", err)
+		}
+		if len(vmInfo.Status) == 0 || vmInfo.Status == "running" {
+			t.Errorf("Status = %q, want a provisioning state", vmInfo.Status)
+		}
+		if ip, err := vmInfo.GetPublicIP(); err == nil {
+			t.Errorf("GetPublicIP = %q, want an error as no ip assigned yet", ip)
+		}
+		checkTimestamp(t, vmInfo)
+		checkNetworks(t, vmInfo)
+	})
+
+	t.Run("list only tagged vms", func(t *testing.T) {
+		vms, err := manager.ListVMs(ctx)
+		if err != nil {
+			t.Fatalf("ListVMs: %s", err)
+		}
+		if len(vms) != expect.NumListed {
+			t.Errorf("ListVMs returned %d vms, want %d", len(vms), expect.NumListed)
+		}
+		for _, vmInfo := range vms {
+			checkTagged(t, vmInfo)
+			checkTimestamp(t, vmInfo)
+			checkNetworks(t, vmInfo)
+		}
+	})
+
+	t.Run("missing vm", func(t *testing.T) {
+		if _, err := manager.GetVMInfo(ctx, expect.MissingID); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("GetVMInfo of missing vm returned %v, want core.ErrNotFound", err)
+		}
+		if err := manager.DeleteVM(ctx, expect.MissingID); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("DeleteVM of missing vm returned %v, want core.ErrNotFound", err)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		if _, err := unauthorized.ListVMs(ctx); !errors.Is(err, core.ErrAuth) {
+			t.Errorf("ListVMs with bad credentials returned %v, want core.ErrAuth", err)
+		}
+		if _, err := unauthorized.GetVMInfo(ctx, expect.RunningID); !errors.Is(err, core.ErrAuth) {
+			t.Errorf("GetVMInfo with bad credentials returned %v, want core.ErrAuth", err)
+		}
+	})
+}
+
+// checkTimestamp makes sure CreatedAt is RFC3339 in UTC
+func checkTimestamp(t *testing.T, vmInfo core.VMInfo) {
+	t.Helper()
+
+	created, err := time.Parse(time.RFC3339, vmInfo.CreatedAt)
+	if err != nil {
+		t.Errorf("vm %s: CreatedAt %q is not RFC3339", vmInfo.ID, vmInfo.CreatedAt)
+		return
+	}
+	if created.Location() != time.UTC {
+		t.Errorf("vm %s: CreatedAt %q is not in UTC", vmInfo.ID, vmInfo.CreatedAt)
+	}
+}
+
+// checkTagged makes sure a vm has the 'eezhee' tag
+func checkTagged(t *testing.T, vmInfo core.VMInfo) {
+	t.Helper()
+
+	for _, tag := range vmInfo.Tags {
+		if tag == "eezhee" {
+			return
+		}
+	}
+	t.Errorf("vm %s: Tags %v missing 'eezhee'", vmInfo.ID, vmInfo.Tags)
+}
+
+// checkNetworks makes sure every address has a type and is set
+func checkNetworks(t *testing.T, vmInfo core.VMInfo) {
+	t.Helper()
+
+	for _, network := range vmInfo.Networks.V4Info {
+		if len(network.IPAddress) == 0 || (network.Type != "public" && network.Type != "private") {
+			t.Errorf("vm %s: invalid ipv4 network %+v", vmInfo.ID, network)
+		}
+	}
+	for _, network := range vmInfo.Networks.V6Info {
+		if len(network.IPAddress) == 0 || (network.Type != "public" && network.Type != "private") {
+			t.Errorf("vm %s: invalid ipv6 network %+v", vmInfo.ID, network)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package conformance
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Fixture is a recorded response from a provider's api
+type Fixture struct {
+	Method string // ie GET
+	Path   string // query string is ignored
+	Status int    // defaults to 200
+	File   string // body of the response (relative to the test's directory)
+}
+
+// Replay starts a server that answers with the recorded responses
+// requests that don't match a fixture fail the test
+func Replay(t *testing.T, fixtures []Fixture) *httptest.Server {
+	t.Helper()
+
+	bodies := make([][]byte, len(fixtures))
+	for i, fixture := range fixtures {
+		body, err := os.ReadFile(fixture.File)
+		if err != nil {
+			t.Fatalf("could not load fixture: %s", err)
+		}
+		bodies[i] = body
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i, fixture := range fixtures {
+			if fixture.Method != r.Method || fixture.Path != r.URL.Path {
+				continue
+			}
+			status := fixture.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write(bodies[i])
+			return
+		}
+
+		t.Errorf("no fixture for %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Unauthorized starts a server that rejects every request with a 401
+// body is the provider's recorded error
+func Unauthorized(t *testing.T, file string) *httptest.Server {
+	t.Helper()
+
+	body, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Request is a call a manager made to a replay server
+type Request struct {
+	Method string
+	Path   string
+	Body   []byte
+}
+
+// Recorder is a client for a replay server that keeps track of the requests it sends
+// so tests can check what was created (or deleted)
+type Recorder struct {
+	transport http.RoundTripper
+	mutex     sync.Mutex
+	requests  []Request
+}
+
+// Record returns a recorder for requests sent to server
+func Record(server *httptest.Server) *Recorder {
+	return &Recorder{transport: server.Client().Transport}
+}
+
+// Client returns an http client that sends its requests through the recorder
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip sends a request on to the server and records it
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+
+	var body []byte
+	if request.Body != nil {
+		body, _ = io.ReadAll(request.Body)
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// requests that never got to the server (ie the context was done) aren't recorded
+	response, err := r.transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	r.requests = append(r.requests, Request{Method: request.Method, Path: request.URL.Path, Body: body})
+	r.mutex.Unlock()
+
+	return response, nil
+}
+
+// Find returns the first request with the given method & path
+func (r *Recorder) Find(method string, path string) (Request, bool) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, request := range r.requests {
+		if request.Method == method && request.Path == path {
+			return request, true
+		}
+	}
+	return Request{}, false
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	_ "embed"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// prices for things other than VMs are compiled into eezhee as well
+//
+//go:embed catalog/prices.yaml
+var priceCatalogData []byte
+
+// CloudPrices are what a cloud charges for things other than VMs (in USD unless Currency is set)
+type CloudPrices struct {
+	Volume       float32 `yaml:"volume" json:"volume"`               // per GB per month
+	LoadBalancer float32 `yaml:"load-balancer" json:"load_balancer"` // per month
+	Transfer     float32 `yaml:"transfer" json:"transfer"`           // per GB over what the VMs include
+	RootDisk     int     `yaml:"root-disk" json:"root_disk"`         // GB each VM gets that is billed as a volume
+	ControlPlane float32 `yaml:"control-plane" json:"control_plane"` // per month for a managed cluster
+	Currency     string  `yaml:"currency" json:"currency,omitempty"` // the cloud's VM prices are in this currency too
+}
+
+var (
+	pricesOnce    sync.Once
+	prices        map[string]CloudPrices
+	exchangeRates map[string]float32
+	pricesError   error
+)
+
+// GetPrices returns what a cloud charges for volumes, load balancers & transfer
+func GetPrices(cloud string) (CloudPrices, error) {
+
+	pricesOnce.Do(func() {
+		var catalog struct {
+			ExchangeRates map[string]float32     `yaml:"exchange-rates"`
+			Prices        map[string]CloudPrices `yaml:"prices"`
+		}
+		pricesError = yaml.Unmarshal(priceCatalogData, &catalog)
+		if pricesError != nil {
+			pricesError = fmt.Errorf("invalid price catalog: %w", pricesError)
+		}
+		prices = catalog.Prices
+		exchangeRates = catalog.ExchangeRates
+	})
+	if pricesError != nil {
+		return CloudPrices{}, pricesError
+	}
+
+	cloudPrices, found := prices[cloud]
+	if !found {
+		return CloudPrices{}, fmt.Errorf("no prices for %s in catalog", cloud)
+	}
+
+	return cloudPrices, nil
+}
+
+// exchangeRate is the USD for one unit of a cloud's currency
+func exchangeRate(cloudPrices CloudPrices) (float32, error) {
+
+	if len(cloudPrices.Currency) == 0 || cloudPrices.Currency == "USD" {
+		return 1, nil
+	}
+
+	rate, found := exchangeRates[cloudPrices.Currency]
+	if !found {
+		return 0, fmt.Errorf("no exchange rate for %s in price catalog", cloudPrices.Currency)
+	}
+
+	return rate, nil
+}
+
+// ClusterShape is what a cluster is made of, for estimating its cost
+type ClusterShape struct {
+	Managed       bool       // uses the cloud's kubernetes service
+	Nodes         []NodePool // VMs (or worker nodes) in the cluster
+	VolumeGB      int        // block storage
+	LoadBalancers int
+	TransferGB    int // outbound transfer per month
+}
+
+// CostItem is one line of a cost estimate
+type CostItem struct {
+	Name      string  `json:"name"`
+	Quantity  float32 `json:"quantity"`
+	Unit      string  `json:"unit,omitempty"` // ie GB. empty if quantity is a count
+	UnitPrice float32 `json:"unit_price"`
+	Monthly   float32 `json:"monthly"`
+}
+
+// CostEstimate is how much a cluster costs per month (in USD)
+// prices of clouds that bill in another currency are converted with the catalog's exchange rate
+type CostEstimate struct {
+	Cloud         string     `json:"cloud"`
+	Items         []CostItem `json:"items"`
+	Monthly       float32    `json:"monthly"`
+	ConvertedFrom string     `json:"converted_from,omitempty"` // currency the cloud bills in
+	ExchangeRate  float32    `json:"exchange_rate,omitempty"`  // USD for one unit of that currency
+}
+
+// add puts a line on the estimate and updates the total
+// unitPrice is in the cloud's currency
+func (c *CostEstimate) add(name string, quantity float32, unit string, unitPrice float32) {
+
+	if c.ExchangeRate > 0 {
+		unitPrice = unitPrice * c.ExchangeRate
+	}
+	item := CostItem{Name: name, Quantity: quantity, Unit: unit, UnitPrice: unitPrice, Monthly: quantity * unitPrice}
+	c.Items = append(c.Items, item)
+	c.Monthly += item.Monthly
+}
+
+// EstimateCost works out the monthly cost of a cluster on a cloud using the catalog prices
+// node sizes must be ones the cloud has (see ResolveSize)
+func EstimateCost(cloud string, sizes VMSizes, shape ClusterShape) (CostEstimate, error) {
+
+	estimate := CostEstimate{Cloud: cloud}
+
+	cloudPrices, err := GetPrices(cloud)
+	if err != nil {
+		return estimate, err
+	}
+	if sizes == nil {
+		return estimate, fmt.Errorf("no sizes for %s in catalog", cloud)
+	}
+	rate, err := exchangeRate(cloudPrices)
+	if err != nil {
+		return estimate, err
+	}
+	if rate != 1 {
+		estimate.ConvertedFrom = cloudPrices.Currency
+		estimate.ExchangeRate = rate
+	}
+
+	numVMs := 0
+	includedTransfer := 0
+	for _, pool := range shape.Nodes {
+		info, err := sizes.GetInfo(pool.Size)
+		if err != nil {
+			return estimate, err
+		}
+		estimate.add("vm "+info.Slug+" ("+info.Name+")", float32(pool.Count), "", info.PriceMonthly)
+		numVMs += pool.Count
+		includedTransfer += info.Transfer * pool.Count
+	}
+
+	if cloudPrices.RootDisk > 0 {
+		estimate.add("root disks", float32(numVMs*cloudPrices.RootDisk), "GB", cloudPrices.Volume)
+	}
+	if shape.Managed {
+		estimate.add("control plane", 1, "", cloudPrices.ControlPlane)
+	}
+	if shape.VolumeGB > 0 {
+		estimate.add("volumes", float32(shape.VolumeGB), "GB", cloudPrices.Volume)
+	}
+	if shape.LoadBalancers > 0 {
+		estimate.add("load balancers", float32(shape.LoadBalancers), "", cloudPrices.LoadBalancer)
+	}
+	if shape.TransferGB > 0 {
+		overage := shape.TransferGB - includedTransfer
+		if overage < 0 {
+			overage = 0
+		}
+		estimate.add(fmt.Sprintf("transfer over %dGB included", includedTransfer), float32(overage), "GB", cloudPrices.Transfer)
+	}
+
+	return estimate, nil
+}
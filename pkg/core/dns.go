@@ -12,14 +12,18 @@ type HostInfo struct {
 	Name string // hostname
 	ID   string // assigned by dns provider
 	IP   string // current IP address assigned to this host
+	// Owned is set if eezhee created the record (providers tag the records they create)
+	Owned bool
 }
 
 // DNSProvider is the interface all DNS providers need to follow
 type DNSProvider interface {
 	Init() bool
-	GetHostRecord(host string) *HostInfo
-	UpdateHostRecord(*HostInfo) error
-	DeleteHostRecord(*HostInfo) error
+	// GetHostRecord returns ErrNotFound if host has no record
+	GetHostRecord(host string) (*HostInfo, error)
+	AddHostRecord(HostInfo) error
+	UpdateHostRecord(HostInfo) error
+	DeleteHostRecord(HostInfo) error
 }
 
 // PingTime contains results of ping test to ip address
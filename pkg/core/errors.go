@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// kinds of errors providers map their sdk errors to
+// callers check for them with errors.Is (ie errors.Is(err, core.ErrNotFound))
+var (
+	ErrAuth        = errors.New("invalid or missing credentials")
+	ErrNotFound    = errors.New("not found")
+	ErrQuota       = errors.New("account limit reached")
+	ErrRateLimited = errors.New("rate limited by provider")
+	ErrTransient   = errors.New("temporary provider error")
+
+	// ErrNotSupported is returned by a wrapped manager when the cloud doesn't have an optional feature
+	ErrNotSupported = errors.New("not supported by cloud")
+)
+
+// ProviderError is an error from a provider along with which kind of error it is
+type ProviderError struct {
+	Kind       error         // one of the Err* kinds above
+	RetryAfter time.Duration // how long the provider asked us to wait (if it did)
+	Err        error         // error from the provider's sdk
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap lets errors.Is match both the kind and the original error
+func (e *ProviderError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// NewProviderError marks err as the given kind of error
+func NewProviderError(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ProviderError{Kind: kind, Err: err}
+}
+
+// ErrorFromResponse classifies an error based on the http response it came with
+// response can be nil if the request never got a response (ie network error).
+// err is returned unchanged if it doesn't fit any of the kinds
+func ErrorFromResponse(response *http.Response, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if response == nil {
+		if isNetworkError(err) {
+			return NewProviderError(ErrTransient, err)
+		}
+		return err
+	}
+
+	kind := KindFromStatus(response.StatusCode, err.Error())
+	if kind == nil {
+		return err
+	}
+
+	return &ProviderError{
+		Kind:       kind,
+		RetryAfter: ParseRetryAfter(response.Header.Get("Retry-After")),
+		Err:        err,
+	}
+}
+
+// KindFromStatus returns the kind of error for an http status code
+// the message is used to tell account limits apart from other client errors.
+// nil is returned if the status doesn't map to a kind
+func KindFromStatus(status int, message string) error {
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusPaymentRequired:
+		return ErrQuota
+	case isQuotaMessage(message) &&
+		(status == http.StatusBadRequest || status == http.StatusForbidden || status == http.StatusUnprocessableEntity):
+		return ErrQuota
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusRequestTimeout || status >= http.StatusInternalServerError:
+		// note: 501 (not implemented) will never work no matter how often it is tried
+		if status != http.StatusNotImplemented {
+			return ErrTransient
+		}
+	}
+
+	return nil
+}
+
+// ParseRetryAfter converts a Retry-After header (seconds or a date) to a duration
+// zero is returned if the header is missing or invalid
+func ParseRetryAfter(value string) time.Duration {
+
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err == nil {
+		wait := time.Until(date)
+		if wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+// isQuotaMessage checks if an error message is about an account limit
+func isQuotaMessage(message string) bool {
+	message = strings.ToLower(message)
+	if strings.Contains(message, "rate limit") {
+		return false
+	}
+	return strings.Contains(message, "quota") || strings.Contains(message, "limit")
+}
+
+// isNetworkError checks if the request failed before getting a response
+func isNetworkError(err error) bool {
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestKindFromStatus(t *testing.T) {
+
+	tests := []struct {
+		status  int
+		message string
+		want    error
+	}{
+		{http.StatusTooManyRequests, "slow down", ErrRateLimited},
+		{http.StatusPaymentRequired, "add a payment method", ErrQuota},
+		{http.StatusForbidden, "droplet limit exceeded", ErrQuota},
+		{http.StatusForbidden, "forbidden", ErrAuth},
+		{http.StatusForbidden, "rate limit exceeded", ErrAuth},
+		{http.StatusBadRequest, "Quota 'CPUS' exceeded", ErrQuota},
+		{http.StatusBadRequest, "invalid size", nil},
+		{http.StatusUnprocessableEntity, "server limit reached", ErrQuota},
+		{http.StatusUnprocessableEntity, "invalid image", nil},
+		{http.StatusUnauthorized, "invalid token", ErrAuth},
+		{http.StatusNotFound, "not found", ErrNotFound},
+		{http.StatusConflict, "already exists", nil},
+		{http.StatusRequestTimeout, "timeout", ErrTransient},
+		{http.StatusInternalServerError, "oops", ErrTransient},
+		{http.StatusBadGateway, "bad gateway", ErrTransient},
+		{http.StatusServiceUnavailable, "maintenance", ErrTransient},
+		{http.StatusNotImplemented, "not implemented", nil},
+		{http.StatusOK, "", nil},
+	}
+
+	for _, test := range tests {
+		got := KindFromStatus(test.status, test.message)
+		if got != test.want {
+			t.Errorf("KindFromStatus(%d, %q) = %v, want %v", test.status, test.message, got, test.want)
+		}
+	}
+}
+
+func TestIsQuotaMessage(t *testing.T) {
+
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{"Quota exceeded for CPUS", true},
+		{"droplet LIMIT reached", true},
+		{"rate limit exceeded", false},
+		{"Rate Limit reached, try again later", false},
+		{"not found", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		got := isQuotaMessage(test.message)
+		if got != test.want {
+			t.Errorf("isQuotaMessage(%q) = %v, want %v", test.message, got, test.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"  ", 0},
+		{"30", 30 * time.Second},
+		{" 5 ", 5 * time.Second},
+		{"0", 0},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0},
+	}
+
+	for _, test := range tests {
+		got := ParseRetryAfter(test.value)
+		if got != test.want {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+
+	// dates only have whole seconds
+	date := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	got := ParseRetryAfter(date)
+	if got <= time.Minute || got > 2*time.Minute {
+		t.Errorf("ParseRetryAfter(%q) = %v, want about 2m", date, got)
+	}
+}
+
+func TestErrorFromResponse(t *testing.T) {
+
+	sdkErr := errors.New("droplet limit exceeded")
+	response := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"10"}}}
+
+	err := ErrorFromResponse(response, sdkErr)
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.RetryAfter != 10*time.Second {
+		t.Fatalf("expected provider error with retry after, got %#v", err)
+	}
+	if !errors.Is(err, ErrRateLimited) || !errors.Is(err, sdkErr) {
+		t.Errorf("expected %v to be both rate limited and the sdk error", err)
+	}
+
+	// errors that don't map to a kind are left alone
+	response = &http.Response{StatusCode: http.StatusConflict}
+	if err := ErrorFromResponse(response, sdkErr); err != sdkErr {
+		t.Errorf("expected sdk error, got %v", err)
+	}
+	if err := ErrorFromResponse(nil, sdkErr); err != sdkErr {
+		t.Errorf("expected sdk error, got %v", err)
+	}
+	if err := ErrorFromResponse(response, nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OperatingSystem is an os that VMs can be created with
+type OperatingSystem struct {
+	Name         string `json:"name"`         // ie ubuntu-24.04
+	Distribution string `json:"distribution"` // ie Ubuntu
+	Version      string `json:"version"`      // ie 24.04
+}
+
+// OperatingSystems are the ones k3s is installed on. newest first
+var OperatingSystems = []OperatingSystem{
+	{Name: "ubuntu-24.04", Distribution: "Ubuntu", Version: "24.04"},
+	{Name: "ubuntu-22.04", Distribution: "Ubuntu", Version: "22.04"},
+	{Name: "debian-12", Distribution: "Debian", Version: "12"},
+}
+
+// DefaultOS is used when the deploy file doesn't set one
+const DefaultOS = "ubuntu-24.04"
+
+// GetOperatingSystem returns the details of an os given its name (ie debian-12)
+func GetOperatingSystem(name string) (OperatingSystem, error) {
+
+	var names []string
+	for _, os := range OperatingSystems {
+		if os.Name == name {
+			return os, nil
+		}
+		names = append(names, os.Name)
+	}
+
+	return OperatingSystem{}, fmt.Errorf("unsupported os %s. use %s", name, strings.Join(names, ", "))
+}
+
+// MatchOperatingSystem finds the os for a cloud's image given its distribution & version
+// ie 'Ubuntu' & '24.04'.  false if it isn't one eezhee supports
+func MatchOperatingSystem(distribution string, version string) (OperatingSystem, bool) {
+
+	for _, os := range OperatingSystems {
+		if strings.EqualFold(os.Distribution, distribution) && os.Version == version {
+			return os, true
+		}
+	}
+
+	return OperatingSystem{}, false
+}
+
+// FindImage picks the image for an os & arch from the images a cloud has (see ImageLister)
+func FindImage(images []ImageInfo, os string, arch string) (ImageInfo, error) {
+
+	if len(arch) == 0 {
+		arch = "amd64"
+	}
+
+	for _, image := range images {
+		if image.OS == os && image.Arch == arch {
+			return image, nil
+		}
+	}
+
+	return ImageInfo{}, fmt.Errorf("no %s image for %s", os, arch)
+}
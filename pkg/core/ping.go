@@ -1,114 +1,359 @@
 package core
 
-// tool to find the ping time to an array of ip addresses
+// tool to find how long it takes to reach a host in each region of a cloud
 
-// normally used to find the closest data center for a cloud provider.  caller
-// passes in an array of ips with some details about the ip and is returned the same
-// array with ping times for each ip address
+// normally used to find the closest data center for a cloud provider.  ICMP
+// ping is tried first but it needs raw sockets (or the ping_group_range sysctl
+// on linux), so if it fails the time to open a tcp connection is used instead
+// and then the time to the first byte of an https response (which also works
+// through a proxy)
 
 import (
-	"math"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	log "github.com/sirupsen/logrus"
-
 	"github.com/go-ping/ping"
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
 )
 
-const maxPingTime = 3 * time.Second // assumes there will be atleast one region closer than this
-const numPings = 3                  // how many pings test should do to an IP
+const probeTimeout = 3 * time.Second // assumes there will be atleast one region closer than this
+const numPings = 3                   // how many pings test should do to an IP
+
+// latency to each region is saved so it doesn't need to be measured on every build
+const latencyCacheFile = "latency-cache.json"
+const latencyCacheAge = 24 * time.Hour
 
+// IPPingTime is a host in a region that can be used to measure latency
 type IPPingTime struct {
 	ID      string // id to identify what ip is associated with (normally region id)
 	Address string // ip address or hostname that we can use for ping test
-	Time    int    // ping time for given ip address (in msec)
 }
 
-// getPingTime will do a ping test to the given host / ip address
-func getPingTime(pingDetails *IPPingTime, ch chan IPPingTime) {
+// RegionLatency is how long it took to reach a region
+type RegionLatency struct {
+	ID      string        `json:"id"`
+	Address string        `json:"address"`
+	Latency time.Duration `json:"latency"`          // zero if region could not be reached
+	Method  string        `json:"method,omitempty"` // icmp, tcp or https
+	Error   string        `json:"error,omitempty"`  // why region could not be reached
+}
+
+// Reachable checks if any of the probes got an answer from the region
+func (r RegionLatency) Reachable() bool {
+	return r.Latency > 0
+}
+
+// ways to measure latency, in the order they are tried
+var probeMethods = []struct {
+	name  string
+	probe func(ctx context.Context, address string) (time.Duration, error)
+}{
+	{"icmp", pingLatency},
+	{"tcp", tcpLatency},
+	{"https", httpsLatency},
+}
+
+// ClosestRegion returns the id of the region with the lowest latency
+// cloud is used to cache the results (see RankRegions)
+func ClosestRegion(ctx context.Context, cloud string, hosts []IPPingTime) (string, error) {
+
+	ranked, err := RankRegions(ctx, cloud, hosts)
+	if err != nil {
+		return "", err
+	}
+
+	log.Debug("closest ", cloud, " region is ", ranked[0].ID, " (", ranked[0].Latency.Round(time.Millisecond), ")")
+	return ranked[0].ID, nil
+}
+
+// RankRegions is ProbeRegions but reuses results from the last day if the
+// same hosts were probed for the cloud
+func RankRegions(ctx context.Context, cloud string, hosts []IPPingTime) ([]RegionLatency, error) {
+
+	cache := loadLatencyCache()
+	cached, found := cache[cloud]
+	if found && time.Since(cached.Time) < latencyCacheAge && sameHosts(cached.Regions, hosts) {
+		log.Debug("using latency to ", cloud, " regions measured at ", cached.Time.Format(time.RFC3339))
+		return cached.Regions, nil
+	}
+
+	ranked, err := ProbeRegions(ctx, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	cache[cloud] = cachedLatency{Time: time.Now(), Regions: ranked}
+	err = saveLatencyCache(cache)
+	if err != nil {
+		log.Debug("could not save latency cache: ", err)
+	}
+
+	return ranked, nil
+}
+
+// ProbeRegions measures the latency to every host at the same time
+// all regions are returned, fastest first, with the ones that could not be
+// reached at the end along with why.  it is an error if no region answered
+func ProbeRegions(ctx context.Context, hosts []IPPingTime) ([]RegionLatency, error) {
+
+	if len(hosts) == 0 {
+		return nil, errors.New("no regions to probe")
+	}
 
-	pinger, err := ping.NewPinger(pingDetails.Address)
-	if err == nil {
+	results := make([]RegionLatency, len(hosts))
+	var wg sync.WaitGroup
+	for index := range hosts {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			results[index] = probe(ctx, hosts[index])
+		}(index)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 
-		// set ping parameters
-		pinger.Count = numPings
-		pinger.Timeout = time.Millisecond * maxPingTime // milliseconds
-		if runtime.GOOS == "windows" {
-			// https://github.com/go-ping/ping#windows
-			pinger.SetPrivileged(true)
+	// regions that couldn't be reached keep their order at the end
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Reachable() != results[j].Reachable() {
+			return results[i].Reachable()
 		}
+		return results[i].Latency < results[j].Latency
+	})
+
+	if !results[0].Reachable() {
+		return nil, fmt.Errorf("could not reach any of the %d regions (%s: %s)",
+			len(results), results[0].ID, results[0].Error)
+	}
+
+	return results, nil
+}
+
+// probe finds the latency to a host, trying each method until one works
+func probe(ctx context.Context, host IPPingTime) RegionLatency {
+
+	result := RegionLatency{ID: host.ID, Address: host.Address}
 
-		// do the ping test
-		err = pinger.Run() // blocks until finished
+	var reasons []string
+	for _, method := range probeMethods {
+		latency, err := method.probe(ctx, host.Address)
 		if err == nil {
-			// get results
-			stats := pinger.Statistics() // get send/receive/rtt stats
+			log.Debug(method.name, " probe to ", host.ID, " took ", latency.Round(time.Millisecond))
+			result.Latency = latency
+			result.Method = method.name
+			return result
+		}
+		log.Debug(method.name, " probe to ", host.ID, " failed: ", err)
+		reasons = append(reasons, method.name+": "+err.Error())
+
+		// other methods won't do any better if the host can't be found
+		var dnsErr *net.DNSError
+		if ctx.Err() != nil || errors.As(err, &dnsErr) {
+			break
+		}
+	}
+	result.Error = strings.Join(reasons, "; ")
+
+	return result
+}
+
+// pingLatency does an icmp ping test to the given host / ip address
+func pingLatency(ctx context.Context, address string) (time.Duration, error) {
+
+	pinger, err := ping.NewPinger(address)
+	if err != nil {
+		return 0, err
+	}
+
+	// set ping parameters
+	pinger.Count = numPings
+	pinger.Timeout = probeTimeout
+	if runtime.GOOS == "windows" {
+		// https://github.com/go-ping/ping#windows
+		pinger.SetPrivileged(true)
+	}
 
-			// save results
-			pingTime := stats.AvgRtt.Milliseconds()
-			pingDetails.Time = int(pingTime)
-			log.Debug("ping to ", pingDetails.ID, " took ", pingDetails.Time, " mSec")
+	// do the ping test
+	stop := context.AfterFunc(ctx, pinger.Stop)
+	defer stop()
+	err = pinger.Run() // blocks until finished
+	if err != nil {
+		return 0, err
+	}
+
+	stats := pinger.Statistics()
+	if stats.PacketsRecv == 0 {
+		return 0, errors.New("no reply")
+	}
+
+	return stats.AvgRtt, nil
+}
+
+// tcpLatency times how long it takes to open a connection to the host
+// a refused connection still took a round trip so it counts as well
+func tcpLatency(ctx context.Context, address string) (time.Duration, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	// look up the host first so dns isn't part of the time
+	ips, err := net.DefaultResolver.LookupHost(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+
+	var dialer net.Dialer
+	for _, port := range []string{"443", "80"} {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ips[0], port))
+		latency := time.Since(start)
+		if err == nil {
+			conn.Close()
+			return latency, nil
 		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return latency, nil
+		}
+		if ctx.Err() != nil {
+			return 0, err
+		}
+	}
+
+	return 0, errors.New("could not connect on port 443 or 80")
+}
+
+// httpsLatency times how long the host takes to start answering an https request
+// note: time is from when the request is sent so connecting isn't included
+func httpsLatency(ctx context.Context, address string) (time.Duration, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var sent, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { sent = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	request, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace),
+		http.MethodHead, "https://"+address+"/", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// don't reuse connections (or follow redirects) so every probe is the same
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+
+	if sent.IsZero() || firstByte.IsZero() {
+		return 0, errors.New("no response")
 	}
 
+	return firstByte.Sub(sent), nil
+}
+
+// cachedLatency is the latency to a cloud's regions and when it was measured
+type cachedLatency struct {
+	Time    time.Time       `json:"time"`
+	Regions []RegionLatency `json:"regions"`
+}
+
+// latencyCachePath is where the cache is kept (in the same directory as the app config)
+func latencyCachePath() (string, error) {
+
+	homeDir, err := homedir.Dir()
 	if err != nil {
-		// log the error
-		log.Warn(err)
+		return "", err
 	}
 
-	// pass results back to caller
-	// note: need to pass something back whether worked or not
-	// callers waits until gets results from all ping tests
-	ch <- *pingDetails
+	return filepath.Join(homeDir, ".eezhee", latencyCacheFile), nil
 }
 
-// GetPingTimesForArray will ping all ips/hosts and return the ID of the closest
-func GetPingTimes(ipAddressList []IPPingTime) (closestRegion string, err error) {
+// loadLatencyCache reads the cache. it is empty if there isn't one (or it can't be read)
+func loadLatencyCache() map[string]cachedLatency {
 
-	numIPs := len(ipAddressList)
+	cache := map[string]cachedLatency{}
 
-	// create a channel for ping tests to return results to us
-	// don't want any blocking to make size of number of tests
-	ch := make(chan IPPingTime, numIPs)
+	path, err := latencyCachePath()
+	if err != nil {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if json.Unmarshal(data, &cache) != nil {
+		log.Debug("ignoring invalid latency cache ", path)
+		return map[string]cachedLatency{}
+	}
+
+	return cache
+}
 
-	// set a timeout as we don't want to hang if
-	// don't get all ping results
-	f := func() {
-		close(ch)
+// saveLatencyCache writes the cache to disk
+func saveLatencyCache(cache map[string]cachedLatency) error {
+
+	path, err := latencyCachePath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
 	}
 
-	// issue the pings
-	for index := range ipAddressList {
-		go getPingTime(&ipAddressList[index], ch)
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	// start the timeout timer
-	// timeout should be longer than timeout on pings
-	timeout := time.AfterFunc(maxPingTime+time.Second, f)
-	defer timeout.Stop()
+	return os.WriteFile(path, data, 0600)
+}
 
-	// reading result until we have them all
-	numResults := 0
-	lowestPingTime := math.MaxInt32
-	for result := range ch {
+// sameHosts checks if cached results are for the given hosts
+// if a region was added or removed, the results are out of date
+func sameHosts(results []RegionLatency, hosts []IPPingTime) bool {
 
-		numResults++
+	if len(results) != len(hosts) {
+		return false
+	}
 
-		// keep track of fastest ping time
-		// ignore time of 0 (means ping failed)
-		if (result.Time > 0) && (result.Time < lowestPingTime) {
-			closestRegion = result.ID
-			lowestPingTime = result.Time
+	for _, host := range hosts {
+		found := false
+		for _, result := range results {
+			if result.ID == host.ID && result.Address == host.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
 		}
-
-		// do we have all the results?
-		// NOTE: this method was unreliable and would sometimes hang
-		//       seems like some of the ping tests would not report back
-		// if numResults == numRegions {
-		// 	close(ch) // will break the loop
-		// }
 	}
 
-	return closestRegion, nil
+	return true
 }
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// the catalog is compiled into eezhee so regions can be looked up offline
+//
+//go:embed catalog/regions.yaml
+var regionCatalogData []byte
+
+// City is a place one or more clouds have a datacenter
+type City struct {
+	Name      string  `yaml:"name"`
+	Country   string  `yaml:"country"` // iso 3166 code (ie ca)
+	State     string  `yaml:"state"`
+	Area      string  `yaml:"area"` // generic region (ie us-east)
+	Latitude  float32 `yaml:"lat"`
+	Longitude float32 `yaml:"long"`
+}
+
+// catalogRegion is one of a cloud's regions in the catalog
+type catalogRegion struct {
+	Slug string `yaml:"slug"`
+	Name string `yaml:"name"`
+	City string `yaml:"city,omitempty"` // empty if the city isn't in the catalog
+}
+
+// regionCatalog has all the cities and the regions each cloud has in them
+type regionCatalog struct {
+	Cities  map[string]City            `yaml:"cities"`
+	Regions map[string][]catalogRegion `yaml:"regions"`
+}
+
+var (
+	catalogOnce  sync.Once
+	catalog      regionCatalog
+	catalogError error
+)
+
+// loadRegionCatalog parses the catalog the first time it is needed
+func loadRegionCatalog() (*regionCatalog, error) {
+
+	catalogOnce.Do(func() {
+		catalogError = yaml.Unmarshal(regionCatalogData, &catalog)
+		if catalogError != nil {
+			catalogError = fmt.Errorf("invalid region catalog: %w", catalogError)
+			return
+		}
+
+		// catch typos in the catalog
+		for cloud, regions := range catalog.Regions {
+			for _, region := range regions {
+				if _, found := catalog.Cities[region.City]; !found {
+					catalogError = fmt.Errorf("invalid region catalog: %s region %s is in unknown city %s",
+						cloud, region.Slug, region.City)
+					return
+				}
+			}
+		}
+
+		// use the latest regions of any cloud that has been refreshed
+		cache := cachedCatalog()
+		if cache == nil {
+			return
+		}
+		for cloud, cloudCatalog := range cache.Clouds {
+			if len(cloudCatalog.Regions) > 0 {
+				catalog.Regions[cloud] = mergeRegions(catalog.Regions[cloud], cloudCatalog.Regions, catalog.Cities)
+			}
+		}
+	})
+
+	return &catalog, catalogError
+}
+
+// cityKey converts a city name to how it is stored in the catalog (ie New York -> newyork)
+func cityKey(name string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "", ".", "").Replace(strings.ToLower(name))
+}
+
+// FindCity looks up a city in the catalog by name (ie toronto or 'new york')
+func FindCity(name string) (City, error) {
+
+	catalog, err := loadRegionCatalog()
+	if err != nil {
+		return City{}, err
+	}
+
+	city, found := catalog.Cities[cityKey(name)]
+	if !found {
+		return City{}, fmt.Errorf("unknown city: %s", name)
+	}
+
+	return city, nil
+}
+
+// Areas returns all the generic regions (ie us-east, eu-central), sorted by name
+func Areas() []string {
+
+	catalog, err := loadRegionCatalog()
+	if err != nil {
+		return nil
+	}
+
+	var areas []string
+	for _, city := range catalog.Cities {
+		if !containsString(areas, city.Area) {
+			areas = append(areas, city.Area)
+		}
+	}
+	sort.Strings(areas)
+
+	return areas
+}
+
+// IsArea checks if a region is one of the generic regions
+func IsArea(region string) bool {
+	return containsString(Areas(), region)
+}
+
+// RegionCatalog implements Regions for a cloud using the catalog built into eezhee
+type RegionCatalog struct {
+	Cloud     string       // name of cloud in the catalog
+	PingHosts []IPPingTime // host in each region that can be pinged (if cloud has them)
+}
+
+// NewRegionCatalog creates the list of regions for a cloud
+// pingHosts can be nil if the cloud doesn't have hosts to ping
+func NewRegionCatalog(cloud string, pingHosts []IPPingTime) *RegionCatalog {
+	return &RegionCatalog{Cloud: cloud, PingHosts: pingHosts}
+}
+
+// GetList returns all of the cloud's regions in order of preference
+func (r *RegionCatalog) GetList() ([]RegionInfo, error) {
+
+	catalog, err := loadRegionCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	regions, found := catalog.Regions[r.Cloud]
+	if !found {
+		return nil, fmt.Errorf("no regions for %s in catalog", r.Cloud)
+	}
+
+	var regionInfo []RegionInfo
+	for _, region := range regions {
+		city := catalog.Cities[region.City]
+		regionInfo = append(regionInfo, RegionInfo{
+			Name:      region.Name,
+			Slug:      region.Slug,
+			Available: true,
+			City:      city.Name,
+			State:     city.State,
+			Country:   city.Country,
+			Area:      city.Area,
+			Latitude:  city.Latitude,
+			Longitude: city.Longitude,
+		})
+	}
+
+	return regionInfo, nil
+}
+
+// GetClosestByPing returns the regions that answered a latency probe, closest first
+func (r *RegionCatalog) GetClosestByPing(ctx context.Context) ([]RegionInfo, error) {
+
+	if len(r.PingHosts) == 0 {
+		return nil, fmt.Errorf("no hosts to probe for %s", r.Cloud)
+	}
+
+	regions, err := r.GetList()
+	if err != nil {
+		return nil, err
+	}
+
+	ranked, err := RankRegions(ctx, r.Cloud, r.PingHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var closest []RegionInfo
+	for _, latency := range ranked {
+		if !latency.Reachable() {
+			continue
+		}
+		for _, region := range regions {
+			if region.Slug == latency.ID {
+				closest = append(closest, region)
+			}
+		}
+	}
+
+	return closest, nil
+}
+
+// GetClosestByLatLong returns all of the cloud's regions, closest to the given location first
+func (r *RegionCatalog) GetClosestByLatLong(lat float32, long float32) ([]RegionInfo, error) {
+
+	regions, err := r.GetList()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool {
+		return distance(lat, long, regions[i].Latitude, regions[i].Longitude) <
+			distance(lat, long, regions[j].Latitude, regions[j].Longitude)
+	})
+
+	return regions, nil
+}
+
+// GetClosestByCountry returns the cloud's regions in a country (ie ca), in order of preference
+func (r *RegionCatalog) GetClosestByCountry(country string) ([]RegionInfo, error) {
+
+	regions, err := r.GetList()
+	if err != nil {
+		return nil, err
+	}
+
+	var inCountry []RegionInfo
+	for _, region := range regions {
+		if strings.EqualFold(region.Country, country) {
+			inCountry = append(inCountry, region)
+		}
+	}
+	if len(inCountry) == 0 {
+		return nil, fmt.Errorf("%s has no regions in %s", r.Cloud, country)
+	}
+
+	return inCountry, nil
+}
+
+// ResolveRegion translates the region in a deploy file to the name a cloud uses for it
+// region can be one of the cloud's own regions or a generic region (ie us-east).
+// near is a city (or 'lat,long') and picks the closest region to it.
+// regions that aren't in the catalog are returned unchanged as the catalog
+// may be out of date and the cloud will reject regions that don't exist
+func ResolveRegion(regions Regions, region string, near string) (string, error) {
+
+	if len(near) > 0 {
+		if len(region) > 0 {
+			return "", errors.New("set either region or near in deploy file, not both")
+		}
+
+		lat, long, err := parseLocation(near)
+		if err != nil {
+			return "", err
+		}
+		closest, err := regions.GetClosestByLatLong(lat, long)
+		if err != nil {
+			return "", err
+		}
+		if len(closest) == 0 {
+			return "", fmt.Errorf("no region near %s", near)
+		}
+		return closest[0].Slug, nil
+	}
+
+	list, err := regions.GetList()
+	if err != nil {
+		return "", err
+	}
+
+	// cloud's own name for a region wins (ie linode has a region called us-east)
+	for _, info := range list {
+		if info.Slug == region {
+			return region, nil
+		}
+	}
+
+	if IsArea(region) {
+		for _, info := range list {
+			if info.Area == region {
+				return info.Slug, nil
+			}
+		}
+		return "", fmt.Errorf("no region in %s", region)
+	}
+
+	log.Debug("region ", region, " is not in catalog")
+	return region, nil
+}
+
+// parseLocation gets the coordinates of a city name or 'lat,long'
+func parseLocation(location string) (lat float32, long float32, err error) {
+
+	parts := strings.Split(location, ",")
+	if len(parts) == 2 {
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 32)
+		longitude, longErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 32)
+		if latErr == nil && longErr == nil {
+			return float32(latitude), float32(longitude), nil
+		}
+	}
+
+	city, err := FindCity(location)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return city.Latitude, city.Longitude, nil
+}
+
+// distance is the great circle distance (in km) between two locations
+func distance(lat1 float32, long1 float32, lat2 float32, long2 float32) float64 {
+
+	const earthRadius = 6371 // km
+
+	toRadians := func(degrees float32) float64 { return float64(degrees) * math.Pi / 180 }
+	deltaLat := toRadians(lat2 - lat1)
+	deltaLong := toRadians(long2 - long1)
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(deltaLong/2)*math.Sin(deltaLong/2)
+
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// containsString checks if a list of strings has the given value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
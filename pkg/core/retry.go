@@ -0,0 +1,324 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy says how often and how long to wait before retrying a provider call
+type RetryPolicy struct {
+	MaxAttempts int           // includes the first try
+	BaseDelay   time.Duration // delay before first retry. doubles each time after that
+	MaxDelay    time.Duration // longest we will back off for (Retry-After can be longer)
+}
+
+// DefaultRetryPolicy is used for all provider calls
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// IsRetryable checks if an error is worth trying again
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTransient)
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't retryable,
+// runs out of attempts or the context is done
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	return p.do(ctx, fn, IsRetryable)
+}
+
+// do is Do with a choice of which errors get retried
+func (p RetryPolicy) do(ctx context.Context, fn func() error, retryable func(error) bool) error {
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || !retryable(err) || attempt+1 >= p.MaxAttempts {
+			return err
+		}
+
+		delay := p.Delay(attempt, err)
+		log.Debug("provider call failed (", err, "). retrying in ", delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Delay is how long to wait before the given retry
+// it is jittered exponential backoff unless the provider asked for longer with Retry-After
+func (p RetryPolicy) Delay(attempt int, err error) time.Duration {
+
+	backoff := p.BaseDelay
+	for i := 0; i < attempt && backoff < p.MaxDelay; i++ {
+		backoff = backoff * 2
+	}
+	if backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+
+	// wait somewhere between half and all of the backoff so clients don't retry in lockstep
+	delay := backoff / 2
+	if backoff > 1 {
+		delay = delay + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.RetryAfter > delay {
+		delay = providerErr.RetryAfter
+	}
+
+	return delay
+}
+
+// WithRetry wraps a manager so every call is retried as per the policy
+// if manager supports managed clusters, so does the manager returned.
+// the optional interfaces (ie VMResizer) are forwarded too.  use Supports to check
+// for them as the manager returned has their methods whether manager does or not
+func WithRetry(manager VMManager, policy RetryPolicy) VMManager {
+
+	retrying := &retryManager{manager: manager, policy: policy}
+	if clusterManager, ok := manager.(ClusterManager); ok {
+		return &retryClusterManager{retryManager: retrying, clusterManager: clusterManager}
+	}
+
+	return retrying
+}
+
+// Supports checks if a manager has an optional interface (ie core.Supports[core.VMResizer](manager))
+// wrapped managers (see WithRetry) are checked by what the manager they wrap supports
+func Supports[T any](manager VMManager) (T, bool) {
+
+	var none T
+	inner := manager
+	for {
+		wrapper, ok := inner.(interface{ Unwrap() VMManager })
+		if !ok {
+			break
+		}
+		inner = wrapper.Unwrap()
+	}
+	if _, ok := inner.(T); !ok {
+		return none, false
+	}
+
+	// use the wrapper so calls are still retried
+	if supported, ok := manager.(T); ok {
+		return supported, true
+	}
+	return inner.(T), true
+}
+
+// retryManager retries calls to a VMManager
+type retryManager struct {
+	manager VMManager
+	policy  RetryPolicy
+}
+
+// onlyRateLimited is used for calls that create something.  the provider
+// may have acted on a request that failed with a server error, so only
+// requests it turned away are safe to send again
+func onlyRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// Unwrap returns the manager calls are retried on
+func (r *retryManager) Unwrap() VMManager {
+	return r.manager
+}
+
+func (r *retryManager) FindAuthToken() string {
+	return r.manager.FindAuthToken()
+}
+
+func (r *retryManager) ListVMs(ctx context.Context) (vms []VMInfo, err error) {
+	err = r.policy.Do(ctx, func() error {
+		vms, err = r.manager.ListVMs(ctx)
+		return err
+	})
+	return vms, err
+}
+
+func (r *retryManager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey SSHKey) (vmInfo VMInfo, err error) {
+	err = r.policy.do(ctx, func() error {
+		vmInfo, err = r.manager.CreateVM(ctx, name, image, size, region, sshKey)
+		return err
+	}, onlyRateLimited)
+	return vmInfo, err
+}
+
+func (r *retryManager) GetVMInfo(ctx context.Context, vmID string) (vmInfo VMInfo, err error) {
+	err = r.policy.Do(ctx, func() error {
+		vmInfo, err = r.manager.GetVMInfo(ctx, vmID)
+		return err
+	})
+	return vmInfo, err
+}
+
+func (r *retryManager) DeleteVM(ctx context.Context, ID string) error {
+	return r.policy.Do(ctx, func() error {
+		return r.manager.DeleteVM(ctx, ID)
+	})
+}
+
+func (r *retryManager) IsSSHKeyUploaded(ctx context.Context, sshKey SSHKey) (keyID string, err error) {
+	err = r.policy.Do(ctx, func() error {
+		keyID, err = r.manager.IsSSHKeyUploaded(ctx, sshKey)
+		return err
+	})
+	return keyID, err
+}
+
+func (r *retryManager) UploadSSHKey(ctx context.Context, keyName string, sshKey SSHKey) (keyID string, err error) {
+	err = r.policy.do(ctx, func() error {
+		keyID, err = r.manager.UploadSSHKey(ctx, keyName, sshKey)
+		return err
+	}, onlyRateLimited)
+	return keyID, err
+}
+
+func (r *retryManager) SelectClosestRegion(ctx context.Context) (region string, err error) {
+	err = r.policy.Do(ctx, func() error {
+		region, err = r.manager.SelectClosestRegion(ctx)
+		return err
+	})
+	return region, err
+}
+
+func (r *retryManager) ListRegions(ctx context.Context) (regions []RegionInfo, err error) {
+	lister, ok := r.manager.(RegionLister)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	err = r.policy.Do(ctx, func() error {
+		regions, err = lister.ListRegions(ctx)
+		return err
+	})
+	return regions, err
+}
+
+func (r *retryManager) ListSizes(ctx context.Context) (sizes []SizeInfo, err error) {
+	lister, ok := r.manager.(SizeLister)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	err = r.policy.Do(ctx, func() error {
+		sizes, err = lister.ListSizes(ctx)
+		return err
+	})
+	return sizes, err
+}
+
+func (r *retryManager) ListImages(ctx context.Context) (images []ImageInfo, err error) {
+	lister, ok := r.manager.(ImageLister)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	err = r.policy.Do(ctx, func() error {
+		images, err = lister.ListImages(ctx)
+		return err
+	})
+	return images, err
+}
+
+// ResizeVM is only retried if the cloud turned the request away as the resize may have been started
+func (r *retryManager) ResizeVM(ctx context.Context, vmID string, size string) error {
+	resizer, ok := r.manager.(VMResizer)
+	if !ok {
+		return ErrNotSupported
+	}
+	return r.policy.do(ctx, func() error {
+		return resizer.ResizeVM(ctx, vmID, size)
+	}, onlyRateLimited)
+}
+
+// SnapshotVM is only retried if the cloud turned the request away as a snapshot may have been started
+func (r *retryManager) SnapshotVM(ctx context.Context, vmID string, name string) (image ImageInfo, err error) {
+	snapshotter, ok := r.manager.(VMSnapshotter)
+	if !ok {
+		return image, ErrNotSupported
+	}
+	err = r.policy.do(ctx, func() error {
+		image, err = snapshotter.SnapshotVM(ctx, vmID, name)
+		return err
+	}, onlyRateLimited)
+	return image, err
+}
+
+func (r *retryManager) WaitForImage(ctx context.Context, imageID string) (image ImageInfo, err error) {
+	snapshotter, ok := r.manager.(VMSnapshotter)
+	if !ok {
+		return image, ErrNotSupported
+	}
+	err = r.policy.Do(ctx, func() error {
+		image, err = snapshotter.WaitForImage(ctx, imageID)
+		return err
+	})
+	return image, err
+}
+
+func (r *retryManager) DeleteImage(ctx context.Context, imageID string) error {
+	snapshotter, ok := r.manager.(VMSnapshotter)
+	if !ok {
+		return ErrNotSupported
+	}
+	return r.policy.Do(ctx, func() error {
+		return snapshotter.DeleteImage(ctx, imageID)
+	})
+}
+
+// retryClusterManager retries calls for managers that also support managed clusters
+type retryClusterManager struct {
+	*retryManager
+	clusterManager ClusterManager
+}
+
+func (r *retryClusterManager) ListClusters(ctx context.Context) (clusters []ClusterInfo, err error) {
+	err = r.policy.Do(ctx, func() error {
+		clusters, err = r.clusterManager.ListClusters(ctx)
+		return err
+	})
+	return clusters, err
+}
+
+func (r *retryClusterManager) CreateCluster(ctx context.Context, name string, version string, region string, nodePools []NodePool) (clusterInfo ClusterInfo, err error) {
+	err = r.policy.do(ctx, func() error {
+		clusterInfo, err = r.clusterManager.CreateCluster(ctx, name, version, region, nodePools)
+		return err
+	}, onlyRateLimited)
+	return clusterInfo, err
+}
+
+func (r *retryClusterManager) GetClusterInfo(ctx context.Context, clusterID string) (clusterInfo ClusterInfo, err error) {
+	err = r.policy.Do(ctx, func() error {
+		clusterInfo, err = r.clusterManager.GetClusterInfo(ctx, clusterID)
+		return err
+	})
+	return clusterInfo, err
+}
+
+func (r *retryClusterManager) GetKubeConfig(ctx context.Context, clusterID string) (kubeConfig []byte, err error) {
+	err = r.policy.Do(ctx, func() error {
+		kubeConfig, err = r.clusterManager.GetKubeConfig(ctx, clusterID)
+		return err
+	})
+	return kubeConfig, err
+}
+
+func (r *retryClusterManager) DeleteCluster(ctx context.Context, clusterID string) error {
+	return r.policy.Do(ctx, func() error {
+		return r.clusterManager.DeleteCluster(ctx, clusterID)
+	})
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingManager fails each call with the next error in errs (and works once they run out)
+type failingManager struct {
+	errs  []error
+	calls int
+}
+
+// fail returns the error for the next call
+func (m *failingManager) fail() error {
+
+	m.calls++
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+func (m *failingManager) FindAuthToken() string {
+	return "token"
+}
+
+func (m *failingManager) ListVMs(ctx context.Context) ([]VMInfo, error) {
+	return nil, m.fail()
+}
+
+func (m *failingManager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey SSHKey) (VMInfo, error) {
+	return VMInfo{}, m.fail()
+}
+
+func (m *failingManager) GetVMInfo(ctx context.Context, vmID string) (VMInfo, error) {
+	return VMInfo{}, m.fail()
+}
+
+func (m *failingManager) DeleteVM(ctx context.Context, ID string) error {
+	return m.fail()
+}
+
+func (m *failingManager) IsSSHKeyUploaded(ctx context.Context, sshKey SSHKey) (string, error) {
+	return "", m.fail()
+}
+
+func (m *failingManager) UploadSSHKey(ctx context.Context, keyName string, sshKey SSHKey) (string, error) {
+	return "", m.fail()
+}
+
+func (m *failingManager) SelectClosestRegion(ctx context.Context) (string, error) {
+	return "", m.fail()
+}
+
+// resizingManager is a failingManager that can resize VMs
+type resizingManager struct {
+	failingManager
+}
+
+func (m *resizingManager) ResizeVM(ctx context.Context, vmID string, size string) error {
+	return m.fail()
+}
+
+// testPolicy retries right away
+var testPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+// repeat returns err n times
+func repeat(err error, n int) []error {
+
+	errs := []error{}
+	for i := 0; i < n; i++ {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func TestRetry(t *testing.T) {
+
+	rateLimited := NewProviderError(ErrRateLimited, errors.New("429"))
+	transient := NewProviderError(ErrTransient, errors.New("503"))
+	auth := NewProviderError(ErrAuth, errors.New("401"))
+
+	createVM := func(m VMManager) error {
+		_, err := m.CreateVM(context.Background(), "webapp", "", "", "", SSHKey{})
+		return err
+	}
+	listVMs := func(m VMManager) error {
+		_, err := m.ListVMs(context.Background())
+		return err
+	}
+	uploadSSHKey := func(m VMManager) error {
+		_, err := m.UploadSSHKey(context.Background(), "eezhee", SSHKey{})
+		return err
+	}
+	resizeVM := func(m VMManager) error {
+		resizer, _ := Supports[VMResizer](m)
+		return resizer.ResizeVM(context.Background(), "1", "large")
+	}
+
+	tests := []struct {
+		name    string
+		call    func(VMManager) error
+		errs    []error
+		wantErr error
+		calls   int
+	}{
+		{"list recovers", listVMs, []error{transient}, nil, 2},
+		{"list transient", listVMs, repeat(transient, 5), ErrTransient, 3},
+		{"list rate limited", listVMs, repeat(rateLimited, 5), ErrRateLimited, 3},
+		{"list auth", listVMs, []error{auth}, ErrAuth, 1},
+		{"create rate limited", createVM, []error{rateLimited}, nil, 2},
+		{"create transient", createVM, []error{transient}, ErrTransient, 1},
+		{"upload transient", uploadSSHKey, []error{transient}, ErrTransient, 1},
+		{"resize rate limited", resizeVM, []error{rateLimited}, nil, 2},
+		{"resize transient", resizeVM, []error{transient}, ErrTransient, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := &resizingManager{failingManager{errs: test.errs}}
+			err := test.call(WithRetry(manager, testPolicy))
+			if test.wantErr == nil && err != nil {
+				t.Fatal("expected no error, got ", err)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected %v, got %v", test.wantErr, err)
+			}
+			if manager.calls != test.calls {
+				t.Errorf("called %d times, want %d", manager.calls, test.calls)
+			}
+		})
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+
+	manager := &failingManager{errs: repeat(NewProviderError(ErrTransient, errors.New("503")), 5)}
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := WithRetry(manager, policy).ListVMs(ctx)
+	if !errors.Is(err, ErrTransient) {
+		t.Fatal("expected the last error, got ", err)
+	}
+	if manager.calls != 1 {
+		t.Errorf("called %d times, want 1", manager.calls)
+	}
+}
+
+func TestDelay(t *testing.T) {
+
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 8 * time.Second}
+	plain := errors.New("503")
+
+	tests := []struct {
+		attempt int
+		err     error
+		min     time.Duration
+		max     time.Duration
+	}{
+		{0, plain, 500 * time.Millisecond, time.Second},
+		{1, plain, time.Second, 2 * time.Second},
+		{2, plain, 2 * time.Second, 4 * time.Second},
+		{3, plain, 4 * time.Second, 8 * time.Second},
+		{10, plain, 4 * time.Second, 8 * time.Second},
+		{0, &ProviderError{Kind: ErrRateLimited, RetryAfter: 20 * time.Second, Err: plain}, 20 * time.Second, 20 * time.Second},
+		{3, &ProviderError{Kind: ErrRateLimited, RetryAfter: time.Second, Err: plain}, 4 * time.Second, 8 * time.Second},
+	}
+
+	for _, test := range tests {
+		// the delay is jittered so try it a few times
+		for i := 0; i < 20; i++ {
+			delay := policy.Delay(test.attempt, test.err)
+			if delay < test.min || delay > test.max {
+				t.Fatalf("Delay(%d, %v) = %v, want between %v and %v", test.attempt, test.err, delay, test.min, test.max)
+			}
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+
+	// the wrapper has ResizeVM but the manager it wraps doesn't
+	plain := WithRetry(&failingManager{}, testPolicy)
+	if _, ok := plain.(VMResizer); !ok {
+		t.Fatal("expected wrapper to have ResizeVM")
+	}
+	if _, ok := Supports[VMResizer](plain); ok {
+		t.Error("expected manager without ResizeVM not to support VMResizer")
+	}
+	if _, ok := Supports[ClusterManager](plain); ok {
+		t.Error("expected manager without clusters not to support ClusterManager")
+	}
+
+	manager := &resizingManager{failingManager{errs: []error{NewProviderError(ErrRateLimited, errors.New("429"))}}}
+	if resizer, ok := Supports[VMResizer](manager); !ok || resizer != VMResizer(manager) {
+		t.Error("expected unwrapped manager to be returned as is")
+	}
+
+	// wrappers of wrappers are checked too and the outer one is returned so calls are retried
+	wrapped := WithRetry(WithRetry(manager, testPolicy), testPolicy)
+	resizer, ok := Supports[VMResizer](wrapped)
+	if !ok {
+		t.Fatal("expected wrapped manager to support VMResizer")
+	}
+	err := resizer.ResizeVM(context.Background(), "1", "large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.calls != 2 {
+		t.Errorf("called %d times, want 2", manager.calls)
+	}
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// like the regions, the sizes are compiled into eezhee
+//
+//go:embed catalog/sizes.yaml
+var sizeCatalogData []byte
+
+// hours in a month (as clouds use to bill)
+const hoursPerMonth = 730
+
+// genericSize matches generic size names (ie 2cpu4gb)
+var genericSize = regexp.MustCompile(`^(\d+)cpu(\d+)gb$`)
+
+// catalogSize is one of a cloud's sizes in the catalog
+type catalogSize struct {
+	Slug     string  `yaml:"slug"`
+	CPUs     int     `yaml:"cpus"`
+	Memory   int     `yaml:"memory"`             // GB
+	Disk     int     `yaml:"disk,omitempty"`     // GB
+	Transfer int     `yaml:"transfer,omitempty"` // GB
+	Price    float32 `yaml:"price"`              // per month in the cloud's currency (see prices.yaml)
+	Arch     string  `yaml:"arch,omitempty"`     // defaults to amd64
+}
+
+// sizeCatalog has the sizes of each cloud, smallest first
+type sizeCatalog struct {
+	Families map[string]string        `yaml:"families"` // sizes kept when refreshing (regexp)
+	Sizes    map[string][]catalogSize `yaml:"sizes"`
+}
+
+var (
+	sizesOnce  sync.Once
+	sizes      sizeCatalog
+	sizesError error
+)
+
+// loadSizeCatalog parses the catalog the first time it is needed
+func loadSizeCatalog() (*sizeCatalog, error) {
+
+	sizesOnce.Do(func() {
+		sizesError = yaml.Unmarshal(sizeCatalogData, &sizes)
+		if sizesError != nil {
+			sizesError = fmt.Errorf("invalid size catalog: %w", sizesError)
+			return
+		}
+
+		// use the latest sizes of any cloud that has been refreshed
+		cache := cachedCatalog()
+		if cache == nil {
+			return
+		}
+		for cloud, cloudCatalog := range cache.Clouds {
+			if len(cloudCatalog.Sizes) > 0 {
+				sizes.Sizes[cloud] = cloudCatalog.Sizes
+			}
+		}
+	})
+
+	return &sizes, sizesError
+}
+
+// GenericSizeName is what eezhee calls a size with the given cpus and memory (in GB)
+func GenericSizeName(cpus int, memory int) string {
+	return fmt.Sprintf("%dcpu%dgb", cpus, memory)
+}
+
+// SizeCatalog implements VMSizes for a cloud using the catalog built into eezhee
+type SizeCatalog struct {
+	Cloud string // name of cloud in the catalog
+}
+
+// NewSizeCatalog creates the list of sizes for a cloud
+func NewSizeCatalog(cloud string) *SizeCatalog {
+	return &SizeCatalog{Cloud: cloud}
+}
+
+// GetList returns all of the cloud's sizes, smallest first
+func (s *SizeCatalog) GetList() ([]SizeInfo, error) {
+
+	catalog, err := loadSizeCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	list, found := catalog.Sizes[s.Cloud]
+	if !found {
+		return nil, fmt.Errorf("no sizes for %s in catalog", s.Cloud)
+	}
+
+	var sizeInfo []SizeInfo
+	for _, size := range list {
+		sizeInfo = append(sizeInfo, size.info())
+	}
+
+	return sizeInfo, nil
+}
+
+// info converts a size in the catalog to a SizeInfo
+func (size catalogSize) info() SizeInfo {
+
+	arch := size.Arch
+	if len(arch) == 0 {
+		arch = "amd64"
+	}
+
+	return SizeInfo{
+		Slug:         size.Slug,
+		Name:         GenericSizeName(size.CPUs, size.Memory),
+		Arch:         arch,
+		Memory:       size.Memory * 1024,
+		VCPUs:        size.CPUs,
+		Disk:         size.Disk,
+		PriceMonthly: size.Price,
+		PriceHourly:  size.Price / hoursPerMonth,
+		Available:    true,
+		Transfer:     size.Transfer,
+	}
+}
+
+// GetInfo returns the details of a size, given the cloud's name for it or a generic one (ie 2cpu4gb)
+// generic sizes only match amd64 sizes
+func (s *SizeCatalog) GetInfo(size string) (SizeInfo, error) {
+
+	list, err := s.GetList()
+	if err != nil {
+		return SizeInfo{}, err
+	}
+
+	for _, info := range list {
+		if info.Slug == size {
+			return info, nil
+		}
+	}
+	for _, info := range list {
+		if info.Name == size && info.Arch == "amd64" {
+			return info, nil
+		}
+	}
+
+	return SizeInfo{}, fmt.Errorf("%s size %s is not in catalog", s.Cloud, size)
+}
+
+// GetLargerSize returns the next size up with the same arch
+func (s *SizeCatalog) GetLargerSize(size string) (SizeInfo, error) {
+	return s.nextSize(size, 1, "largest")
+}
+
+// GetSmallerSize returns the next size down with the same arch
+func (s *SizeCatalog) GetSmallerSize(size string) (SizeInfo, error) {
+	return s.nextSize(size, -1, "smallest")
+}
+
+// nextSize steps through the list of sizes from the given size, skipping sizes with a different arch
+func (s *SizeCatalog) nextSize(size string, step int, end string) (SizeInfo, error) {
+
+	current, err := s.GetInfo(size)
+	if err != nil {
+		return SizeInfo{}, err
+	}
+	list, err := s.GetList()
+	if err != nil {
+		return SizeInfo{}, err
+	}
+
+	index := 0
+	for i, info := range list {
+		if info.Slug == current.Slug {
+			index = i
+		}
+	}
+	for i := index + step; i >= 0 && i < len(list); i += step {
+		if list[i].Arch == current.Arch {
+			return list[i], nil
+		}
+	}
+
+	return SizeInfo{}, fmt.Errorf("%s is already the %s %s size", current.Slug, end, s.Cloud)
+}
+
+// ResolveSize translates the size in a deploy file to the name a cloud uses for it
+// size can be one of the cloud's own sizes or a generic one (ie 2cpu4gb).  if the
+// cloud doesn't have the generic size, the cheapest size that is at least as big is used.
+// generic sizes are matched against sizes with the given arch (amd64 if empty).
+// sizes that aren't in the catalog are returned unchanged (see ResolveRegion)
+func ResolveSize(sizes VMSizes, size string, arch string) (string, error) {
+
+	if len(arch) == 0 {
+		arch = "amd64"
+	}
+
+	info, err := sizes.GetInfo(size)
+	if err == nil && (info.Slug == size || info.Arch == arch) {
+		return info.Slug, nil
+	}
+
+	match := genericSize.FindStringSubmatch(size)
+	if match == nil {
+		log.Debug("size ", size, " is not in catalog")
+		return size, nil
+	}
+	cpus, _ := strconv.Atoi(match[1])
+	memory, _ := strconv.Atoi(match[2])
+
+	list, err := sizes.GetList()
+	if err != nil {
+		return "", err
+	}
+
+	var closest *SizeInfo
+	for i, info := range list {
+		if info.Arch != arch || info.VCPUs < cpus || info.Memory < memory*1024 {
+			continue
+		}
+		if closest == nil || info.PriceMonthly < closest.PriceMonthly {
+			closest = &list[i]
+		}
+	}
+	if closest == nil {
+		return "", fmt.Errorf("no %s size with at least %d cpus and %dGB of memory", arch, cpus, memory)
+	}
+	if closest.Name != size {
+		log.Info("using ", closest.Slug, " (", closest.Name, ") as there is no ", size, " size")
+	}
+
+	return closest.Slug, nil
+}
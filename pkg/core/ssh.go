@@ -8,6 +8,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"golang.org/x/crypto/ssh"
@@ -80,6 +81,12 @@ func (s *SSHKey) GenerateNewKey(publicKeyPath string) error {
 		return err
 	}
 
+	// new users might not have a .ssh directory yet
+	err = os.MkdirAll(filepath.Dir(privateKeyPath), 0700)
+	if err != nil {
+		return err
+	}
+
 	// generate a private key
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
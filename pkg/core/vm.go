@@ -1,38 +1,50 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"strings"
 )
 
 // VMManager is the interface all cloud provider need to follow
+// every call that talks to the cloud takes a context so it can be cancelled
 type VMManager interface {
 	FindAuthToken() string
-	ListVMs() (vmInfo []VMInfo, err error)
-	CreateVM(name string, image string, size string, region string, sshKey SSHKey) (VMInfo, error)
-	GetVMInfo(vmID string) (vmInfo VMInfo, err error)
-	DeleteVM(ID string) error
+	ListVMs(ctx context.Context) (vmInfo []VMInfo, err error)
+	CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey SSHKey) (VMInfo, error)
+	GetVMInfo(ctx context.Context, vmID string) (vmInfo VMInfo, err error)
+	DeleteVM(ctx context.Context, ID string) error
 	// UploadSSHKey()
-	IsSSHKeyUploaded(sshKey SSHKey) (string, error)
-	UploadSSHKey(keyName string, sshKey SSHKey) (string, error)
-	SelectClosestRegion() (closestRegion string, err error)
+	IsSSHKeyUploaded(ctx context.Context, sshKey SSHKey) (string, error)
+	UploadSSHKey(ctx context.Context, keyName string, sshKey SSHKey) (string, error)
+	SelectClosestRegion(ctx context.Context) (closestRegion string, err error)
 }
 
 // Regions has details about all the regions a provider supports
 type Regions interface {
 	GetList() ([]RegionInfo, error)
-	GetClosestByPing() ([]RegionInfo, error)
+	GetClosestByPing(ctx context.Context) ([]RegionInfo, error)
 	GetClosestByLatLong(lat float32, long float32) ([]RegionInfo, error)
 	GetClosestByCountry(country string) ([]RegionInfo, error)
 }
 
+// RegionLister is implemented by clouds whose api can list their regions
+// Sizes of each region are the sizes that can be created there (nil if the cloud doesn't say)
+type RegionLister interface {
+	ListRegions(ctx context.Context) ([]RegionInfo, error)
+}
+
 // RegionInfo has details about a given datacenter/region
 type RegionInfo struct {
 	Name      string   `json:"name"`
 	Slug      string   `json:"slug"`
 	Available bool     `json:"available"`
+	City      string   `json:"city"`
 	Country   string   `json:"country"`
 	State     string   `json:"State"`
+	Area      string   `json:"area"` // generic region (ie us-east)
+	Latitude  float32  `json:"latitude"`
+	Longitude float32  `json:"longitude"`
 	Sizes     []string `json:"sizes"`
 	Features  []string `json:"features"`
 }
@@ -41,14 +53,43 @@ type RegionInfo struct {
 type VMSizes interface {
 	GetList() ([]SizeInfo, error)
 	GetInfo(size string) (SizeInfo, error)
-	GetLargerSize()
-	GetSmallerSize()
+	GetLargerSize(size string) (SizeInfo, error)
+	GetSmallerSize(size string) (SizeInfo, error)
+}
+
+// VMResizer is implemented by clouds that can change the size of an existing VM
+// the VM is normally restarted and may still be booting when ResizeVM returns
+type VMResizer interface {
+	ResizeVM(ctx context.Context, vmID string, size string) error
+}
+
+// VMSnapshotter is implemented by clouds that can save a VM as an image (ie a snapshot)
+// the VM is powered off first. SnapshotVM returns as soon as the cloud has an id for the image
+// (its Slug, which is what CreateVM takes) and WaitForImage returns once VMs can be created from it
+type VMSnapshotter interface {
+	SnapshotVM(ctx context.Context, vmID string, name string) (ImageInfo, error)
+	WaitForImage(ctx context.Context, imageID string) (ImageInfo, error)
+	DeleteImage(ctx context.Context, imageID string) error
+}
+
+// ImageLister is implemented by clouds whose api can list the images VMs are created from
+// only images of the supported OperatingSystems are returned, with OS & Arch set
+type ImageLister interface {
+	ListImages(ctx context.Context) ([]ImageInfo, error)
+}
+
+// SizeLister is implemented by clouds whose api can list their VM sizes and current prices
+// Memory is in MB, Disk & Transfer in GB and PriceMonthly in the cloud's currency
+type SizeLister interface {
+	ListSizes(ctx context.Context) ([]SizeInfo, error)
 }
 
 // SizeInfo has details about a specific VM size
 type SizeInfo struct {
 	Slug         string   `json:"slug"`
-	Memory       int      `json:"memory"`
+	Name         string   `json:"name"`   // generic size (ie 2cpu4gb)
+	Arch         string   `json:"arch"`   // amd64 or arm64
+	Memory       int      `json:"memory"` // MB
 	VCPUs        int      `json:"vcpus"`
 	Disk         int      `json:"disk"`
 	PriceMonthly float32  `json:"price_monthly"`
@@ -64,7 +105,9 @@ type ImageInfo struct {
 	Name          string   `json:"name"`
 	Type          string   `json:"type"`
 	Distrubution  string   `json:"distribution"`
-	Slug          string   `json:"slug"`    // N/A if status is 'retired'
+	Slug          string   `json:"slug"`    // what CreateVM takes. N/A if status is 'retired'
+	OS            string   `json:"os"`      // generic os (ie ubuntu-24.04)
+	Arch          string   `json:"arch"`    // amd64 or arm64
 	Public        bool     `json:"public"`  // N/A if status is 'retired'
 	Regions       []string `json:"regions"` // N/A if status is 'retired'
 	MinDiskSize   int      `json:"min_disk_size"`
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/digitalocean/godo"
 	"github.com/eezhee/eezhee/pkg/core"
@@ -15,6 +18,9 @@ import (
 	"github.com/spf13/viper"
 )
 
+const actionCheckDelay = 5 * time.Second // time between checks on a droplet action (ie resize)
+const powerOnTimeout = 5 * time.Minute   // how long to wait for a droplet to power back on after a resize
+
 // ip addresses to use to find closest region
 var regionIPs = []core.IPPingTime{
 	{ID: "ams2", Address: "206.189.240.1"},
@@ -27,6 +33,12 @@ var regionIPs = []core.IPPingTime{
 	{ID: "tor1", Address: "68.183.194.1"},
 }
 
+// Regions are the regions digitalocean has (from the catalog built into eezhee)
+var Regions core.Regions = core.NewRegionCatalog("digitalocean", regionIPs)
+
+// Sizes are the VM sizes digitalocean has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("digitalocean")
+
 // datacenters: ams2","ams3","blr1","fra1","lon1","nyc1","nyc2","nyc3","sfo1","sfo2","sfo3","sgp1","tor1"
 // sizes:
 //        "512mb","1gb","2gb","4gb","8gb","16gb","32gb","48gb","64gb",
@@ -37,7 +49,7 @@ var regionIPs = []core.IPPingTime{
 //				"m3-2vcpu-16gb","m3-4vcpu-32gb","m3-8vcpu-64gb","m3-16vcpu-128gb","m3-24vcpu-192gb","m3-32vcpu-256gb",
 //				"m6-2vcpu-16gb","m6-4vcpu-32gb","m6-8vcpu-64gb","m6-16vcpu-128gb","m6-24vcpu-192gb","m6-32vcpu-256gb"
 //        "c-2","c2-2vcpu-4gb","c-4","c2-4vpcu-8gb","c-8","c2-8vpcu-16gb","c-16","c2-16vcpu-32gb","c-32","c2-32vpcu-64gb",
-// images:  no need as we always want to be on the same plain Ubuntu box
+// images:  current image for the os in the deploy file is looked up (see ListImages)
 
 // TODO: the way to manage sizes is on a 3 (or more dimensional plane).  User decides what they want to increase and we figure out the right VM upgrade
 
@@ -68,6 +80,22 @@ func NewManager(providerAPIToken string) (core.VMManager, error) {
 	return manager, nil
 }
 
+// NewManagerWithClient creates a manager that talks to the given endpoint with the given client
+// used to point the manager at a stand-in for the digitalocean api
+func NewManagerWithClient(endpoint string, client *http.Client) (*Manager, error) {
+
+	baseURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := new(Manager)
+	manager.api = godo.NewClient(client)
+	manager.api.BaseURL = baseURL
+
+	return manager, nil
+}
+
 // GetAuthToken will check common place for digitalocean api key
 func (m *Manager) FindAuthToken() string {
 
@@ -103,14 +131,12 @@ func (m *Manager) FindAuthToken() string {
 }
 
 // IsSSHKeyUploaded checks if ssh key already uploaded to DigitalOcean
-func (m *Manager) IsSSHKeyUploaded(desiredSSHKey core.SSHKey) (string, error) {
-
-	ctx := context.TODO()
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, desiredSSHKey core.SSHKey) (string, error) {
 
 	// get list of sshkeys DO knows about
 	sshKeys, _, err := m.api.Keys.List(ctx, nil)
 	if err != nil {
-		return "", err
+		return "", convertError(err)
 	}
 
 	// go through each key and see if it matches what is on this machine
@@ -125,7 +151,7 @@ func (m *Manager) IsSSHKeyUploaded(desiredSSHKey core.SSHKey) (string, error) {
 }
 
 // UploadSSHKey will upload given key to the provider
-func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (keyID string, err error) {
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (keyID string, err error) {
 
 	// if provider account shared with  more than one person, key name needs to be unique
 	// let's add first few characters  fingerprint
@@ -137,11 +163,9 @@ func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (keyID string
 		PublicKey: sshKey.GetPublicKey(),
 	}
 
-	ctx := context.Background()
 	key, _, err := m.api.Keys.Create(ctx, createRequest)
 	if err != nil {
-		msg := fmt.Sprintf("could not upload ssh key: %s", err)
-		return "", errors.New(msg)
+		return "", fmt.Errorf("could not upload ssh key: %w", convertError(err))
 	}
 
 	id := strconv.Itoa(key.ID)
@@ -149,22 +173,108 @@ func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (keyID string
 }
 
 // SelectClosestRegion will check all DO regions to find the closest
-func (m *Manager) SelectClosestRegion() (closestRegion string, err error) {
-	closestRegion, err = core.GetPingTimes(regionIPs)
-	// note regionsIPs is now filled with ping times
-	return closestRegion, err
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+	return core.ClosestRegion(ctx, "digitalocean", regionIPs)
+}
+
+// ListRegions gets all of digitalocean's regions and the sizes available in each
+func (m *Manager) ListRegions(ctx context.Context) ([]core.RegionInfo, error) {
+
+	regions, _, err := m.api.Regions.List(ctx, &godo.ListOptions{PerPage: 200})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var regionInfo []core.RegionInfo
+	for _, region := range regions {
+		regionInfo = append(regionInfo, core.RegionInfo{
+			Name:      region.Name,
+			Slug:      region.Slug,
+			Available: region.Available,
+			Sizes:     region.Sizes,
+			Features:  region.Features,
+		})
+	}
+
+	return regionInfo, nil
+}
+
+// ListImages gets the current digitalocean image for each supported os
+// note: digitalocean only has x86 droplets
+func (m *Manager) ListImages(ctx context.Context) ([]core.ImageInfo, error) {
+
+	images, _, err := m.api.Images.ListDistribution(ctx, &godo.ListOptions{PerPage: 200})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var imageInfo []core.ImageInfo
+	for _, image := range images {
+		// name is the version. ie '24.04 (LTS) x64' or '12 x64'
+		fields := strings.Fields(image.Name)
+		if len(fields) == 0 || !image.Public || len(image.Slug) == 0 {
+			continue
+		}
+		os, ok := core.MatchOperatingSystem(image.Distribution, fields[0])
+		if !ok {
+			continue
+		}
+		imageInfo = append(imageInfo, core.ImageInfo{
+			ID:           image.ID,
+			Name:         image.Name,
+			Type:         image.Type,
+			Distrubution: image.Distribution,
+			Slug:         image.Slug,
+			OS:           os.Name,
+			Arch:         "amd64",
+			Public:       image.Public,
+			Regions:      image.Regions,
+			MinDiskSize:  image.MinDiskSize,
+			CreatedAt:    image.Created,
+			Description:  image.Description,
+			Status:       image.Status,
+		})
+	}
+
+	return imageInfo, nil
+}
+
+// ListSizes gets all of digitalocean's droplet sizes and their prices
+func (m *Manager) ListSizes(ctx context.Context) ([]core.SizeInfo, error) {
+
+	sizes, _, err := m.api.Sizes.List(ctx, &godo.ListOptions{PerPage: 200})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var sizeInfo []core.SizeInfo
+	for _, size := range sizes {
+		sizeInfo = append(sizeInfo, core.SizeInfo{
+			Slug:         size.Slug,
+			Arch:         "amd64",
+			Memory:       size.Memory,
+			VCPUs:        size.Vcpus,
+			Disk:         size.Disk,
+			PriceMonthly: float32(size.PriceMonthly),
+			PriceHourly:  float32(size.PriceHourly),
+			Regions:      size.Regions,
+			Available:    size.Available,
+			Transfer:     int(size.Transfer * 1000), // api has it in TB
+		})
+	}
+
+	return sizeInfo, nil
 }
 
 // GetVMInfo will get details of a VM
-func (m *Manager) GetVMInfo(vmID string) (vmInfo core.VMInfo, err error) {
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
 
 	// get the latest VM info.  see if status active now
-	ctx := context.TODO()
 	instanceID, _ := strconv.Atoi(vmID)
 	droplet, _, err := m.api.Droplets.Get(ctx, instanceID)
 	if err != nil {
 		log.Error(err)
-		return vmInfo, err
+		return vmInfo, convertError(err)
 	}
 
 	// need to convert info from digitalocean format to our format
@@ -174,17 +284,21 @@ func (m *Manager) GetVMInfo(vmID string) (vmInfo core.VMInfo, err error) {
 }
 
 // CreateVM will create a new VM
-func (m *Manager) CreateVM(name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
 
 	var vmInfo core.VMInfo
 
+	// snapshots are referred to by id rather than slug
+	createImage := godo.DropletCreateImage{Slug: image}
+	if imageID, err := strconv.Atoi(image); err == nil {
+		createImage = godo.DropletCreateImage{ID: imageID}
+	}
+
 	createRequest := &godo.DropletCreateRequest{
-		Name:   name,
-		Region: region,
-		Size:   size,
-		Image: godo.DropletCreateImage{
-			Slug: image,
-		},
+		Name:    name,
+		Region:  region,
+		Size:    size,
+		Image:   createImage,
 		SSHKeys: []godo.DropletCreateSSHKey{{Fingerprint: sshKey.Fingerprint()}},
 		// Volumes: []godo.DropletCreateVolume{
 		// 	{Name: "hello-im-a-volume"},
@@ -194,11 +308,10 @@ func (m *Manager) CreateVM(name string, image string, size string, region string
 		// VPCUUID: "880b7f98-f062-404d-b33c-458d545696f6",
 		Tags: []string{"eezhee"},
 	}
-	ctx := context.TODO()
 
 	newDroplet, _, err := m.api.Droplets.Create(ctx, createRequest)
 	if err != nil {
-		return vmInfo, err
+		return vmInfo, convertError(err)
 	}
 
 	vmInfo, _ = convertVMInfoToGenericFormat(*newDroplet)
@@ -207,15 +320,13 @@ func (m *Manager) CreateVM(name string, image string, size string, region string
 }
 
 // ListVMs will return a list of all VMs created by eezhee
-func (m *Manager) ListVMs() (vmInfo []core.VMInfo, err error) {
-
-	ctx := context.TODO()
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
 
 	// get a list of VMs running on DO
 	options := godo.ListOptions{}
 	droplets, _, err := m.api.Droplets.List(ctx, &options)
 	if err != nil {
-		return nil, err
+		return nil, convertError(err)
 	}
 
 	log.Debug("account has ", len(droplets), " VMs")
@@ -237,14 +348,12 @@ func (m *Manager) ListVMs() (vmInfo []core.VMInfo, err error) {
 }
 
 // DeleteVM will delete a given VM
-func (m *Manager) DeleteVM(ID string) error {
-
-	ctx := context.TODO()
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
 
 	instanceID, _ := strconv.Atoi(ID)
 	_, err := m.api.Droplets.Delete(ctx, instanceID)
 	if err != nil {
-		return err
+		return convertError(err)
 	}
 
 	log.Debug("vm ", ID, " deleted")
@@ -252,6 +361,180 @@ func (m *Manager) DeleteVM(ID string) error {
 	return nil
 }
 
+// ResizeVM changes the size of a droplet
+// droplet has to be off while it is resized. the disk is left alone so it can be resized back down
+func (m *Manager) ResizeVM(ctx context.Context, vmID string, size string) error {
+
+	dropletID, err := strconv.Atoi(vmID)
+	if err != nil {
+		return fmt.Errorf("invalid digitalocean droplet id: %s", vmID)
+	}
+
+	log.Debug("power off droplet ", vmID)
+	action, _, err := m.api.DropletActions.PowerOff(ctx, dropletID)
+	if err != nil {
+		return fmt.Errorf("could not power off droplet: %w", convertError(err))
+	}
+	err = m.waitForAction(ctx, dropletID, action)
+	if err == nil {
+		log.Debug("resize droplet ", vmID)
+		action, _, err = m.api.DropletActions.Resize(ctx, dropletID, size, false)
+		if err == nil {
+			err = m.waitForAction(ctx, dropletID, action)
+		} else {
+			err = convertError(err)
+		}
+	}
+
+	// the droplet is powered on even if the resize failed (ie size was refused or ctx timed out)
+	// so the cluster isn't left down
+	powerOnErr := m.powerOn(ctx, dropletID)
+	if err != nil {
+		if powerOnErr != nil {
+			log.Warn(powerOnErr)
+		}
+		return fmt.Errorf("could not resize droplet: %w", err)
+	}
+
+	return powerOnErr
+}
+
+// powerOn turns a droplet back on and waits until it is on
+// note: not cancelled with ctx so a stopped resize doesn't leave the droplet off
+func (m *Manager) powerOn(ctx context.Context, dropletID int) error {
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), powerOnTimeout)
+	defer cancel()
+
+	log.Debug("power on droplet ", dropletID)
+	action, _, err := m.api.DropletActions.PowerOn(ctx, dropletID)
+	if err != nil {
+		return fmt.Errorf("could not power on droplet: %w", convertError(err))
+	}
+	err = m.waitForAction(ctx, dropletID, action)
+	if err != nil {
+		return fmt.Errorf("could not power on droplet: %w", err)
+	}
+
+	return nil
+}
+
+// waitForAction polls a droplet action until it is finished
+func (m *Manager) waitForAction(ctx context.Context, dropletID int, action *godo.Action) error {
+
+	for action.Status == godo.ActionInProgress {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(actionCheckDelay):
+		}
+
+		var err error
+		action, _, err = m.api.DropletActions.Get(ctx, dropletID, action.ID)
+		if err != nil {
+			return convertError(err)
+		}
+	}
+	if action.Status != godo.ActionCompleted {
+		return fmt.Errorf("action %s %s", action.Type, action.Status)
+	}
+
+	return nil
+}
+
+// SnapshotVM powers off a droplet and saves its disk as a snapshot
+// note: snapshots are only in the droplet's region until they are transferred.
+// the snapshot only gets an id once the action is done so this waits for it
+func (m *Manager) SnapshotVM(ctx context.Context, vmID string, name string) (core.ImageInfo, error) {
+
+	dropletID, err := strconv.Atoi(vmID)
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("invalid digitalocean droplet id: %s", vmID)
+	}
+
+	steps := []struct {
+		name   string
+		action func() (*godo.Action, *godo.Response, error)
+	}{
+		{"power off", func() (*godo.Action, *godo.Response, error) { return m.api.DropletActions.PowerOff(ctx, dropletID) }},
+		{"snapshot", func() (*godo.Action, *godo.Response, error) {
+			return m.api.DropletActions.Snapshot(ctx, dropletID, name)
+		}},
+	}
+	for _, step := range steps {
+		log.Debug(step.name, " droplet ", vmID)
+		action, _, err := step.action()
+		if err != nil {
+			return core.ImageInfo{}, fmt.Errorf("could not %s droplet: %w", step.name, convertError(err))
+		}
+		err = m.waitForAction(ctx, dropletID, action)
+		if err != nil {
+			return core.ImageInfo{}, fmt.Errorf("could not %s droplet: %w", step.name, err)
+		}
+	}
+
+	snapshots, _, err := m.api.Droplets.Snapshots(ctx, dropletID, &godo.ListOptions{PerPage: 200})
+	if err != nil {
+		return core.ImageInfo{}, convertError(err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name {
+			return convertSnapshot(snapshot), nil
+		}
+	}
+
+	return core.ImageInfo{}, fmt.Errorf("snapshot %s %w", name, core.ErrNotFound)
+}
+
+// WaitForImage gets details of a snapshot
+// note: SnapshotVM has already waited for it
+func (m *Manager) WaitForImage(ctx context.Context, imageID string) (core.ImageInfo, error) {
+
+	id, err := strconv.Atoi(imageID)
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("invalid digitalocean image id: %s", imageID)
+	}
+
+	snapshot, _, err := m.api.Images.GetByID(ctx, id)
+	if err != nil {
+		return core.ImageInfo{}, convertError(err)
+	}
+
+	return convertSnapshot(*snapshot), nil
+}
+
+// convertSnapshot converts a digitalocean snapshot into our generic format
+func convertSnapshot(snapshot godo.Image) core.ImageInfo {
+	return core.ImageInfo{
+		ID:            snapshot.ID,
+		Name:          snapshot.Name,
+		Type:          snapshot.Type,
+		Distrubution:  snapshot.Distribution,
+		Slug:          strconv.Itoa(snapshot.ID),
+		Regions:       snapshot.Regions,
+		MinDiskSize:   snapshot.MinDiskSize,
+		SizeGigabytes: snapshot.SizeGigaBytes,
+		CreatedAt:     snapshot.Created,
+		Status:        snapshot.Status,
+	}
+}
+
+// DeleteImage deletes a snapshot
+func (m *Manager) DeleteImage(ctx context.Context, imageID string) error {
+
+	id, err := strconv.Atoi(imageID)
+	if err != nil {
+		return fmt.Errorf("invalid digitalocean image id: %s", imageID)
+	}
+
+	_, err = m.api.Images.Delete(ctx, id)
+	if err != nil {
+		return convertError(err)
+	}
+
+	return nil
+}
+
 // convert digitalocean droplet info into our generic format
 func convertVMInfoToGenericFormat(dropletInfo godo.Droplet) (core.VMInfo, error) {
 
@@ -0,0 +1,106 @@
+package digitalocean
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/eezhee/eezhee/pkg/core/conformance"
+)
+
+func TestConformance(t *testing.T) {
+
+	server := conformance.Replay(t, []conformance.Fixture{
+		{Method: "GET", Path: "/v2/droplets", File: "testdata/droplets.json"},
+		{Method: "GET", Path: "/v2/droplets/3164444", File: "testdata/droplet.json"},
+		{Method: "GET", Path: "/v2/droplets/3164450", File: "testdata/droplet-new.json"},
+		{Method: "GET", Path: "/v2/droplets/999", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+		{Method: "DELETE", Path: "/v2/droplets/999", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+	})
+	manager, err := NewManagerWithClient(server.URL+"/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejecting := conformance.Unauthorized(t, "testdata/unauthorized.json")
+	unauthorized, err := NewManagerWithClient(rejecting.URL+"/", rejecting.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conformance.Run(t, manager, unauthorized, conformance.Expect{
+		RunningID: "3164444",
+		PendingID: "3164450",
+		MissingID: "999",
+		Name:      "webapp-main",
+		PublicIP:  "159.203.31.12",
+		CreatedAt: "2024-03-01T12:00:00Z",
+		NumListed: 2,
+	})
+}
+
+func TestResizeRefusedPowersOn(t *testing.T) {
+
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Type string `json:"type"`
+		}
+		if r.Method != "POST" || r.URL.Path != "/v2/droplets/3164444/actions" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		actions = append(actions, request.Type)
+
+		w.Header().Set("Content-Type", "application/json")
+		if request.Type == "resize" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"id":"unprocessable_entity","message":"This size is not available because it has a smaller disk."}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"action":{"id":%d,"status":"completed","type":"%s","resource_id":3164444,"resource_type":"droplet"}}`,
+			len(actions), request.Type)
+	}))
+	defer server.Close()
+
+	manager, err := NewManagerWithClient(server.URL+"/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = manager.ResizeVM(context.Background(), "3164444", "s-1vcpu-512mb-10gb")
+	if err == nil {
+		t.Fatal("expected resize to fail")
+	}
+	if strings.Join(actions, ",") != "power_off,resize,power_on" {
+		t.Fatalf("actions = %v, want droplet powered back on after the refused resize", actions)
+	}
+}
+
+func TestClusterStatus(t *testing.T) {
+
+	tests := []struct {
+		state godo.KubernetesClusterStatusState
+		want  string
+	}{
+		{godo.KubernetesClusterStatusProvisioning, "provisioning"},
+		{godo.KubernetesClusterStatusRunning, "running"},
+		{godo.KubernetesClusterStatusDegraded, "failed"},
+		{godo.KubernetesClusterStatusError, "failed"},
+	}
+
+	for _, test := range tests {
+		cluster := &godo.KubernetesCluster{Status: &godo.KubernetesClusterStatus{State: test.state}}
+		clusterInfo := convertClusterInfoToGenericFormat(cluster)
+		if clusterInfo.Status != test.want {
+			t.Errorf("status of %s cluster = %q, want %q", test.state, clusterInfo.Status, test.want)
+		}
+	}
+}
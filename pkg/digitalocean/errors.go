@@ -0,0 +1,19 @@
+package digitalocean
+
+import (
+	"errors"
+
+	"github.com/digitalocean/godo"
+	"github.com/eezhee/eezhee/pkg/core"
+)
+
+// convertError maps godo errors to the kinds of errors in core
+func convertError(err error) error {
+
+	var errorResponse *godo.ErrorResponse
+	if errors.As(err, &errorResponse) {
+		return core.ErrorFromResponse(errorResponse.Response, err)
+	}
+
+	return core.ErrorFromResponse(nil, err)
+}
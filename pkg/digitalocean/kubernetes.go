@@ -0,0 +1,143 @@
+package digitalocean
+
+import (
+	"context"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/eezhee/eezhee/pkg/core"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateCluster will create a DigitalOcean Kubernetes (DOKS) cluster
+// version can be 'latest' or a DOKS version slug (ie 1.31.1-do.0)
+func (m *Manager) CreateCluster(ctx context.Context, name string, version string, region string, nodePools []core.NodePool) (core.ClusterInfo, error) {
+
+	var clusterInfo core.ClusterInfo
+
+	if len(version) == 0 {
+		version = "latest"
+	}
+
+	createRequest := &godo.KubernetesClusterCreateRequest{
+		Name:        name,
+		RegionSlug:  region,
+		VersionSlug: version,
+		Tags:        []string{"eezhee"},
+	}
+	// note: node pools are not tagged as the tags are applied to the droplets
+	// and they would then show up as k3s VMs
+	for _, pool := range nodePools {
+		createRequest.NodePools = append(createRequest.NodePools, &godo.KubernetesNodePoolCreateRequest{
+			Name:  pool.Name,
+			Size:  pool.Size,
+			Count: pool.Count,
+		})
+	}
+
+	cluster, _, err := m.api.Kubernetes.Create(ctx, createRequest)
+	if err != nil {
+		return clusterInfo, convertError(err)
+	}
+
+	return convertClusterInfoToGenericFormat(cluster), nil
+}
+
+// GetClusterInfo will get details of a DOKS cluster
+func (m *Manager) GetClusterInfo(ctx context.Context, clusterID string) (core.ClusterInfo, error) {
+
+	var clusterInfo core.ClusterInfo
+
+	cluster, _, err := m.api.Kubernetes.Get(ctx, clusterID)
+	if err != nil {
+		return clusterInfo, convertError(err)
+	}
+
+	return convertClusterInfoToGenericFormat(cluster), nil
+}
+
+// ListClusters will return all DOKS clusters created by eezhee
+func (m *Manager) ListClusters(ctx context.Context) (clusterInfo []core.ClusterInfo, err error) {
+
+	clusters, _, err := m.api.Kubernetes.List(ctx, &godo.ListOptions{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	for _, cluster := range clusters {
+		if contains(cluster.Tags, "eezhee") {
+			clusterInfo = append(clusterInfo, convertClusterInfoToGenericFormat(cluster))
+		}
+	}
+
+	return clusterInfo, nil
+}
+
+// GetKubeConfig will get the kubeconfig for a DOKS cluster
+func (m *Manager) GetKubeConfig(ctx context.Context, clusterID string) ([]byte, error) {
+
+	config, _, err := m.api.Kubernetes.GetKubeConfig(ctx, clusterID)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return config.KubeconfigYAML, nil
+}
+
+// DeleteCluster will delete a DOKS cluster and its node pools
+// note: load balancers and volumes created by the cluster are deleted too
+func (m *Manager) DeleteCluster(ctx context.Context, clusterID string) error {
+
+	_, err := m.api.Kubernetes.DeleteDangerous(ctx, clusterID)
+	if err != nil {
+		return convertError(err)
+	}
+
+	log.Debug("cluster ", clusterID, " deleted")
+
+	return nil
+}
+
+// contains checks if a list of tags has a given tag
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// convert digitalocean cluster info into our generic format
+func convertClusterInfoToGenericFormat(cluster *godo.KubernetesCluster) core.ClusterInfo {
+
+	var clusterInfo core.ClusterInfo
+
+	clusterInfo.ID = cluster.ID
+	clusterInfo.Name = cluster.Name
+	clusterInfo.Region = cluster.RegionSlug
+	clusterInfo.Version = cluster.VersionSlug
+	clusterInfo.Endpoint = cluster.Endpoint
+	clusterInfo.CreatedAt = cluster.CreatedAt.UTC().Format(time.RFC3339)
+	clusterInfo.Tags = cluster.Tags
+
+	// digitalocean uses 'running' as well. a cluster in error (or degraded) needs someone to look at it
+	if cluster.Status != nil {
+		switch cluster.Status.State {
+		case godo.KubernetesClusterStatusError, godo.KubernetesClusterStatusDegraded:
+			clusterInfo.Status = "failed"
+		default:
+			clusterInfo.Status = string(cluster.Status.State)
+		}
+	}
+
+	for _, pool := range cluster.NodePools {
+		clusterInfo.NodePools = append(clusterInfo.NodePools, core.NodePool{
+			Name:  pool.Name,
+			Size:  pool.Size,
+			Count: pool.Count,
+		})
+	}
+
+	return clusterInfo
+}
@@ -0,0 +1,448 @@
+package fake
+
+// an in-memory cloud so the cli can be run end to end without spending money
+// VMs go through the same states as a real cloud (with optional latency) and
+// any call can be made to fail. pair it with the embedded ssh server (see sshd.go)
+// so k3s can be 'installed' on the VMs. state can be saved to a file (see state.go)
+// so a cluster built by one command can be listed and torn down by the next
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/k3s"
+)
+
+// Region is the only region the fake cloud has
+const Region = "fake-1"
+
+// Regions has the fake cloud's region (from the catalog built into eezhee)
+var Regions core.Regions = core.NewRegionCatalog("fake", nil)
+
+// Sizes are the VM sizes fake has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("fake")
+
+// ErrNotFound is returned when a VM doesn't exist
+var ErrNotFound = fmt.Errorf("vm %w", core.ErrNotFound)
+
+// Options control how the fake cloud behaves
+type Options struct {
+	Latency   time.Duration    // added to every call
+	BootPolls int              // calls to GetVMInfo before a new VM is running. defaults to 2
+	IPAddress string           // given to every VM. defaults to 127.0.0.1
+	SSHPort   int              // port of the embedded ssh server. VMs are logged into on this port
+	StateFile string           // VMs, keys & images are saved here. only kept in memory if empty
+	Failures  map[string]error // methods that fail from the start (see FailOn & ParseFailures)
+}
+
+// vm is a VM in the fake cloud
+type vm struct {
+	info  core.VMInfo
+	polls int // number of times GetVMInfo has been called
+}
+
+// Cloud is an in-memory VMManager
+type Cloud struct {
+	options  Options
+	mutex    sync.Mutex
+	vms      map[string]*vm
+	keys     map[string]string // fingerprint -> key name
+	images   map[string]core.ImageInfo
+	nextID   int
+	failures map[string]error // method name -> error to return
+}
+
+// NewCloud creates an empty fake cloud
+func NewCloud(options Options) *Cloud {
+
+	if options.BootPolls == 0 {
+		options.BootPolls = 2
+	}
+	if len(options.IPAddress) == 0 {
+		options.IPAddress = "127.0.0.1"
+	}
+
+	cloud := &Cloud{
+		options:  options,
+		vms:      map[string]*vm{},
+		keys:     map[string]string{},
+		images:   map[string]core.ImageInfo{},
+		nextID:   1000,
+		failures: map[string]error{},
+	}
+	for method, err := range options.Failures {
+		cloud.failures[method] = err
+	}
+
+	return cloud
+}
+
+// FailOn makes a method (ie "CreateVM") return the given error
+// pass a nil error to make the method work again
+func (c *Cloud) FailOn(method string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err == nil {
+		delete(c.failures, method)
+		return
+	}
+	c.failures[method] = err
+}
+
+// call adds latency and returns the error (if any) a method should fail with
+// note: the caller must not hold the mutex
+func (c *Cloud) call(ctx context.Context, method string) error {
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.options.Latency):
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.failures[method]
+}
+
+// FindAuthToken returns a dummy token as the fake cloud doesn't need one
+func (c *Cloud) FindAuthToken() string {
+	return "fake"
+}
+
+// IsSSHKeyUploaded checks if a key has been uploaded
+func (c *Cloud) IsSSHKeyUploaded(ctx context.Context, sshKey core.SSHKey) (string, error) {
+
+	if err := c.call(ctx, "IsSSHKeyUploaded"); err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return "", err
+	}
+
+	fingerprint := sshKey.Fingerprint()
+	if _, ok := c.keys[fingerprint]; !ok {
+		return "", errors.New("ssh key not uploaded")
+	}
+
+	return fingerprint, nil
+}
+
+// UploadSSHKey remembers a key
+func (c *Cloud) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (string, error) {
+
+	if err := c.call(ctx, "UploadSSHKey"); err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return "", err
+	}
+
+	fingerprint := sshKey.Fingerprint()
+	c.keys[fingerprint] = keyName
+
+	return fingerprint, c.save()
+}
+
+// SelectClosestRegion returns the only region there is
+func (c *Cloud) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+
+	if err := c.call(ctx, "SelectClosestRegion"); err != nil {
+		return "", err
+	}
+
+	return Region, nil
+}
+
+// ListRegions returns the only region there is
+func (c *Cloud) ListRegions(ctx context.Context) ([]core.RegionInfo, error) {
+
+	if err := c.call(ctx, "ListRegions"); err != nil {
+		return nil, err
+	}
+
+	return []core.RegionInfo{{Name: "Fake 1", Slug: Region, Available: true, Sizes: []string{"fake-small"}}}, nil
+}
+
+// ListImages returns an image for each supported os
+func (c *Cloud) ListImages(ctx context.Context) ([]core.ImageInfo, error) {
+
+	if err := c.call(ctx, "ListImages"); err != nil {
+		return nil, err
+	}
+
+	var images []core.ImageInfo
+	for _, os := range core.OperatingSystems {
+		images = append(images, core.ImageInfo{Name: os.Name, Slug: os.Name, OS: os.Name, Arch: "amd64", Public: true})
+	}
+
+	return images, nil
+}
+
+// ListSizes returns the sizes in the catalog
+func (c *Cloud) ListSizes(ctx context.Context) ([]core.SizeInfo, error) {
+
+	if err := c.call(ctx, "ListSizes"); err != nil {
+		return nil, err
+	}
+
+	return Sizes.GetList()
+}
+
+// CreateVM adds a VM in the 'new' state
+// it moves to 'booting' and then 'running' as GetVMInfo is called
+func (c *Cloud) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+
+	if err := c.call(ctx, "CreateVM"); err != nil {
+		return core.VMInfo{}, err
+	}
+
+	if region != Region {
+		return core.VMInfo{}, fmt.Errorf("invalid region: %s", region)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return core.VMInfo{}, err
+	}
+
+	c.nextID++
+	newVM := &vm{info: core.VMInfo{
+		ID:        strconv.Itoa(c.nextID),
+		Name:      name,
+		Status:    "new",
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Region:    core.RegionInfo{Slug: region},
+		Image:     core.ImageInfo{Name: image},
+		Size:      core.SizeInfo{Slug: size},
+		SizeSlug:  size,
+		Networks: core.NetworkInfo{
+			V4Info: []core.V4NetworkInfo{},
+			V6Info: []core.V6NetworkInfo{},
+		},
+		Tags: []string{"eezhee"},
+	}}
+	c.vms[newVM.info.ID] = newVM
+
+	return newVM.info, c.save()
+}
+
+// GetVMInfo returns details of a VM, moving it to its next state
+func (c *Cloud) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
+
+	if err := c.call(ctx, "GetVMInfo"); err != nil {
+		return vmInfo, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err = c.load()
+	if err != nil {
+		return vmInfo, err
+	}
+
+	existing, ok := c.vms[vmID]
+	if !ok {
+		return vmInfo, ErrNotFound
+	}
+
+	existing.polls++
+	if existing.info.Status != "running" {
+		if existing.polls >= c.options.BootPolls {
+			c.boot(existing)
+		} else {
+			existing.info.Status = "booting"
+		}
+	}
+
+	return existing.info, c.save()
+}
+
+// boot gives a VM its ip and marks it as running
+// note: caller must hold the mutex
+func (c *Cloud) boot(v *vm) {
+
+	v.info.Status = "running"
+	v.info.Networks.V4Info = []core.V4NetworkInfo{
+		{IPAddress: "10.0.0." + strconv.Itoa(len(c.vms)), Type: "private"},
+		{IPAddress: c.options.IPAddress, Type: "public"},
+	}
+
+	c.setLogin()
+}
+
+// setLogin lets the k3s package know how to log into the VMs
+// note: all VMs are really the embedded ssh server
+func (c *Cloud) setLogin() {
+
+	if c.options.SSHPort != 0 {
+		k3s.SetLogin(c.options.IPAddress, k3s.Login{Port: c.options.SSHPort})
+	}
+}
+
+// ListVMs returns all VMs in the cloud
+func (c *Cloud) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
+
+	if err := c.call(ctx, "ListVMs"); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err = c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range c.vms {
+		vmInfo = append(vmInfo, v.info)
+	}
+	sort.Slice(vmInfo, func(i, j int) bool { return vmInfo[i].ID < vmInfo[j].ID })
+
+	return vmInfo, nil
+}
+
+// DeleteVM removes a VM
+func (c *Cloud) DeleteVM(ctx context.Context, ID string) error {
+
+	if err := c.call(ctx, "DeleteVM"); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := c.vms[ID]; !ok {
+		return ErrNotFound
+	}
+	delete(c.vms, ID)
+
+	return c.save()
+}
+
+// ResizeVM changes the size of a VM. like a real cloud, it has to boot again
+func (c *Cloud) ResizeVM(ctx context.Context, vmID string, size string) error {
+
+	if err := c.call(ctx, "ResizeVM"); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return err
+	}
+
+	v, ok := c.vms[vmID]
+	if !ok {
+		return ErrNotFound
+	}
+	v.info.Size = core.SizeInfo{Slug: size}
+	v.info.SizeSlug = size
+	v.info.Status = "booting"
+	v.polls = 0
+
+	return c.save()
+}
+
+// SnapshotVM saves a VM as an image. the VM is left powered off
+func (c *Cloud) SnapshotVM(ctx context.Context, vmID string, name string) (core.ImageInfo, error) {
+
+	if err := c.call(ctx, "SnapshotVM"); err != nil {
+		return core.ImageInfo{}, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return core.ImageInfo{}, err
+	}
+
+	v, ok := c.vms[vmID]
+	if !ok {
+		return core.ImageInfo{}, ErrNotFound
+	}
+	v.info.Status = "off"
+
+	// note: named after the image so ids are unique across runs
+	image := core.ImageInfo{Name: name, Slug: "snapshot-" + name, Status: "available"}
+	c.images[image.Slug] = image
+
+	return image, c.save()
+}
+
+// WaitForImage returns an image made by SnapshotVM. images are ready right away
+func (c *Cloud) WaitForImage(ctx context.Context, imageID string) (core.ImageInfo, error) {
+
+	if err := c.call(ctx, "WaitForImage"); err != nil {
+		return core.ImageInfo{}, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return core.ImageInfo{}, err
+	}
+
+	image, ok := c.images[imageID]
+	if !ok {
+		return core.ImageInfo{}, fmt.Errorf("image %w", core.ErrNotFound)
+	}
+
+	return image, nil
+}
+
+// DeleteImage deletes an image made by SnapshotVM
+func (c *Cloud) DeleteImage(ctx context.Context, imageID string) error {
+
+	if err := c.call(ctx, "DeleteImage"); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.load()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := c.images[imageID]; !ok {
+		return fmt.Errorf("image %w", core.ErrNotFound)
+	}
+	delete(c.images, imageID)
+
+	return c.save()
+}
@@ -0,0 +1,19 @@
+package fake
+
+import "github.com/eezhee/eezhee/pkg/k3s"
+
+// Releases returns a fixed list of k3s releases so the release lookup works offline
+func Releases() k3s.ReleaseInfo {
+	return k3s.ReleaseInfo{
+		Channels: []k3s.Channel{
+			{Name: "stable", Latest: "v1.30.5+k3s1"},
+			{Name: "latest", Latest: "v1.31.1+k3s1"},
+			{Name: "v1.30", Latest: "v1.30.5+k3s1"},
+			{Name: "v1.31", Latest: "v1.31.1+k3s1"},
+		},
+		Releases: map[string][]string{
+			"1.30": {"v1.30.5+k3s1", "v1.30.4+k3s1"},
+			"1.31": {"v1.31.1+k3s1", "v1.31.0+k3s1"},
+		},
+	}
+}
@@ -0,0 +1,215 @@
+package fake
+
+// an ssh server that pretends to be a freshly created VM
+// it understands the commands eezhee uses to install k3s and fetch the kubeconfig.
+// everything else succeeds without doing anything
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// KubeConfig is returned when /etc/rancher/k3s/k3s.yaml is read
+// it is what k3s writes (with dummy certs)
+const KubeConfig = `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: ZmFrZQ==
+    server: https://127.0.0.1:6443
+  name: default
+contexts:
+- context:
+    cluster: default
+    user: default
+  name: default
+current-context: default
+kind: Config
+preferences: {}
+users:
+- name: default
+  user:
+    client-certificate-data: ZmFrZQ==
+    client-key-data: ZmFrZQ==
+`
+
+// SSHServer is an embedded ssh server that emulates a VM
+type SSHServer struct {
+	listener  net.Listener
+	config    *ssh.ServerConfig
+	mutex     sync.Mutex
+	commands  []string
+	installed bool // has k3s been installed
+}
+
+// StartSSHServer starts a server on a random port of localhost
+// any user and key is allowed to log in
+func StartSSHServer() (*SSHServer, error) {
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	server := new(SSHServer)
+	server.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	server.config.AddHostKey(hostKey)
+
+	server.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go server.serve()
+
+	return server, nil
+}
+
+// Port the server is listening on
+func (s *SSHServer) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Commands returns all the commands that have been run
+func (s *SSHServer) Commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string{}, s.commands...)
+}
+
+// Installed checks if k3s is currently installed
+func (s *SSHServer) Installed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.installed
+}
+
+// Close stops the server
+func (s *SSHServer) Close() error {
+	return s.listener.Close()
+}
+
+// serve accepts connections until the server is closed
+func (s *SSHServer) serve() {
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Debug("fake sshd: ", err)
+			}
+			return
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection does the ssh handshake and then handles each session
+func (s *SSHServer) handleConnection(netConn net.Conn) {
+
+	_, channels, requests, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		log.Debug("fake sshd: ", err)
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(channel, channelRequests)
+	}
+}
+
+// handleSession runs the command of an 'exec' request
+func (s *SSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type != "exec" {
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+			continue
+		}
+
+		// payload is a length prefixed string
+		var payload struct{ Command string }
+		err := ssh.Unmarshal(request.Payload, &payload)
+		if err != nil {
+			request.Reply(false, nil)
+			return
+		}
+		request.Reply(true, nil)
+
+		// input (ie manifests) is not needed but has to be read
+		// note: the client always sends EOF, even when there is no input
+		io.Copy(io.Discard, channel)
+
+		output, exitStatus := s.run(payload.Command)
+		channel.Write([]byte(output))
+
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, exitStatus)
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+// run emulates a command and returns its output and exit status
+func (s *SSHServer) run(command string) (string, uint32) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.commands = append(s.commands, command)
+
+	switch {
+	case strings.Contains(command, "k3s-airgap-images"):
+		// baking only downloads k3s
+		return "", 0
+	case strings.Contains(command, "get.k3s.io"), strings.Contains(command, "INSTALL_K3S_SKIP_DOWNLOAD"):
+		s.installed = true
+		return "[INFO]  systemd: Starting k3s\n", 0
+	case strings.Contains(command, "/etc/rancher/k3s/k3s.yaml"):
+		if !s.installed {
+			return "cat: /etc/rancher/k3s/k3s.yaml: No such file or directory\n", 1
+		}
+		return KubeConfig, 0
+	case strings.Contains(command, "k3s-uninstall.sh"), strings.Contains(command, "k3s-agent-uninstall.sh"):
+		s.installed = false
+		return "", 0
+	case strings.Contains(command, "test ! -e /usr/local/bin/k3s"):
+		if s.installed {
+			return "", 1
+		}
+		return "", 0
+	}
+
+	return "", 0
+}
@@ -0,0 +1,136 @@
+package fake
+
+// the fake cloud's VMs, keys & images can be saved to a file so they outlive
+// the process (ie 'eezhee build' followed by 'eezhee list' and 'eezhee teardown')
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eezhee/eezhee/pkg/core"
+)
+
+// state is what is saved in the state file
+type state struct {
+	VMs    []savedVM                 `json:"vms"`
+	Keys   map[string]string         `json:"keys"`
+	Images map[string]core.ImageInfo `json:"images"`
+	NextID int                       `json:"next_id"`
+}
+
+// savedVM is a VM in the state file
+type savedVM struct {
+	Info  core.VMInfo `json:"info"`
+	Polls int         `json:"polls"`
+}
+
+// load replaces what is in memory with what is in the state file
+// nothing is loaded if there is no state file yet
+// note: caller must hold the mutex
+func (c *Cloud) load() error {
+
+	if len(c.options.StateFile) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.options.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved state
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return fmt.Errorf("invalid fake cloud state in %s: %w", c.options.StateFile, err)
+	}
+
+	c.vms = map[string]*vm{}
+	for _, v := range saved.VMs {
+		c.vms[v.Info.ID] = &vm{info: v.Info, polls: v.Polls}
+
+		// VMs that were booted by another process are on this process' ssh server now
+		if v.Info.Status == "running" {
+			c.setLogin()
+		}
+	}
+	c.keys = saved.Keys
+	if c.keys == nil {
+		c.keys = map[string]string{}
+	}
+	c.images = saved.Images
+	if c.images == nil {
+		c.images = map[string]core.ImageInfo{}
+	}
+	c.nextID = saved.NextID
+
+	return nil
+}
+
+// save writes what is in memory to the state file
+// note: caller must hold the mutex
+func (c *Cloud) save() error {
+
+	if len(c.options.StateFile) == 0 {
+		return nil
+	}
+
+	saved := state{Keys: c.keys, Images: c.images, NextID: c.nextID}
+	for _, v := range c.vms {
+		saved.VMs = append(saved.VMs, savedVM{Info: v.info, Polls: v.polls})
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(c.options.StateFile), 0700)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.options.StateFile, data, 0600)
+}
+
+// kinds of errors that can be injected with ParseFailures
+var failureKinds = map[string]error{
+	"auth":         core.ErrAuth,
+	"not-found":    core.ErrNotFound,
+	"quota":        core.ErrQuota,
+	"rate-limited": core.ErrRateLimited,
+	"transient":    core.ErrTransient,
+}
+
+// ParseFailures turns a list of methods into the errors they should fail with
+// the list is comma separated and each method can have a kind of error
+// (ie "CreateVM=quota,DeleteVM"). methods without a kind fail with a plain error
+func ParseFailures(list string) (map[string]error, error) {
+
+	failures := map[string]error{}
+	for _, entry := range strings.Split(list, ",") {
+
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		method, kindName, hasKind := strings.Cut(entry, "=")
+		if !hasKind {
+			failures[method] = fmt.Errorf("fake cloud: %s failed", method)
+			continue
+		}
+		kind, ok := failureKinds[kindName]
+		if !ok {
+			return nil, fmt.Errorf("invalid kind of failure %s. use auth, not-found, quota, rate-limited or transient", kindName)
+		}
+		failures[method] = core.NewProviderError(kind, fmt.Errorf("fake cloud: %s failed (%s)", method, kindName))
+	}
+
+	return failures, nil
+}
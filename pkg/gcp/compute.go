@@ -0,0 +1,223 @@
+package gcp
+
+// minimal client for the parts of the compute engine rest api eezhee needs
+// using the api directly (rather than the generated client) keeps the dependency
+// small and lets the manager be pointed at a local stand-in of the api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/eezhee/eezhee/pkg/core"
+)
+
+// DefaultEndpoint is the compute engine api
+const DefaultEndpoint = "https://compute.googleapis.com/compute/v1/"
+
+// APIError is returned when the compute api rejects a request
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gcp: %s (%d)", e.Message, e.Code)
+}
+
+// isNotFound checks if an api error is a 404
+func isNotFound(err error) bool {
+	var apiError *APIError
+	return errors.As(err, &apiError) && apiError.Code == http.StatusNotFound
+}
+
+// metadataItem is a key/value pair in project or instance metadata
+type metadataItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type metadata struct {
+	Fingerprint string         `json:"fingerprint,omitempty"`
+	Items       []metadataItem `json:"items,omitempty"`
+}
+
+type project struct {
+	Name                   string   `json:"name"`
+	CommonInstanceMetadata metadata `json:"commonInstanceMetadata"`
+}
+
+type region struct {
+	Name  string   `json:"name"`
+	Zones []string `json:"zones"` // urls of zones in region
+}
+
+type machineType struct {
+	Name      string `json:"name"`
+	GuestCPUs int    `json:"guestCpus"`
+	MemoryMB  int    `json:"memoryMb"`
+}
+
+type firewallAllowed struct {
+	IPProtocol string   `json:"IPProtocol"`
+	Ports      []string `json:"ports,omitempty"`
+}
+
+type firewall struct {
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Network      string            `json:"network"`
+	Direction    string            `json:"direction"`
+	Allowed      []firewallAllowed `json:"allowed"`
+	SourceRanges []string          `json:"sourceRanges"`
+	TargetTags   []string          `json:"targetTags"`
+}
+
+type accessConfig struct {
+	Type         string `json:"type,omitempty"`
+	Name         string `json:"name,omitempty"`
+	NatIP        string `json:"natIP,omitempty"`
+	ExternalIPv6 string `json:"externalIpv6,omitempty"`
+}
+
+type networkInterface struct {
+	Network           string         `json:"network,omitempty"`
+	NetworkIP         string         `json:"networkIP,omitempty"`
+	AccessConfigs     []accessConfig `json:"accessConfigs,omitempty"`
+	IPv6AccessConfigs []accessConfig `json:"ipv6AccessConfigs,omitempty"`
+}
+
+type initializeParams struct {
+	SourceImage string `json:"sourceImage"`
+	DiskSizeGB  string `json:"diskSizeGb,omitempty"`
+}
+
+type attachedDisk struct {
+	Boot             bool              `json:"boot"`
+	AutoDelete       bool              `json:"autoDelete"`
+	InitializeParams *initializeParams `json:"initializeParams,omitempty"`
+	DiskSizeGB       string            `json:"diskSizeGb,omitempty"`
+}
+
+type tags struct {
+	Items []string `json:"items,omitempty"`
+}
+
+type instance struct {
+	ID                string             `json:"id,omitempty"`
+	Name              string             `json:"name"`
+	MachineType       string             `json:"machineType"`
+	Zone              string             `json:"zone,omitempty"`
+	Status            string             `json:"status,omitempty"`
+	CreationTimestamp string             `json:"creationTimestamp,omitempty"`
+	Tags              tags               `json:"tags"`
+	Labels            map[string]string  `json:"labels,omitempty"`
+	Disks             []attachedDisk     `json:"disks"`
+	NetworkInterfaces []networkInterface `json:"networkInterfaces"`
+	Metadata          metadata           `json:"metadata"`
+}
+
+type instanceList struct {
+	Items         map[string]struct{ Instances []instance } `json:"items"`
+	NextPageToken string                                    `json:"nextPageToken"`
+}
+
+type operation struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  *struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// err converts any errors in a finished operation into a go error
+func (o *operation) err() error {
+	if o.Error == nil || len(o.Error.Errors) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, e := range o.Error.Errors {
+		messages = append(messages, e.Message)
+	}
+	err := errors.New("gcp: " + strings.Join(messages, ", "))
+
+	// ie QUOTA_EXCEEDED or ZONE_RESOURCE_POOL_EXHAUSTED
+	for _, e := range o.Error.Errors {
+		if strings.HasSuffix(e.Code, "QUOTA_EXCEEDED") {
+			return core.NewProviderError(core.ErrQuota, err)
+		}
+		if strings.HasSuffix(e.Code, "RESOURCE_POOL_EXHAUSTED") {
+			return core.NewProviderError(core.ErrTransient, err)
+		}
+	}
+
+	return err
+}
+
+// call makes a request to the compute api
+// path is relative to the endpoint (ie projects/my-project/zones)
+func (m *Manager) call(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+
+	address := strings.TrimSuffix(m.Endpoint, "/") + "/" + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, address, requestBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := m.client.Do(request)
+	if err != nil {
+		return core.ErrorFromResponse(nil, err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 300 {
+		var errorResponse struct {
+			Error APIError `json:"error"`
+		}
+		if json.Unmarshal(data, &errorResponse) != nil || errorResponse.Error.Code == 0 {
+			errorResponse.Error = APIError{Code: response.StatusCode, Message: response.Status}
+		}
+		return core.ErrorFromResponse(response, &errorResponse.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// lastPart returns the name at the end of a resource url
+// ie https://.../zones/us-central1-a returns us-central1-a
+func lastPart(resourceURL string) string {
+	return resourceURL[strings.LastIndex(resourceURL, "/")+1:]
+}
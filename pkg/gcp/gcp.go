@@ -0,0 +1,580 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const computeScope = "https://www.googleapis.com/auth/compute"
+
+// instances get this network tag. firewall rule applies to it & we use it to find our VMs
+const networkTag = "eezhee"
+
+// firewall rule that opens ssh, http, https & kubernetes api on our VMs
+const firewallName = "eezhee-cluster"
+
+var clusterPorts = []string{"22", "80", "443", "6443"}
+
+// Regions are the regions gcp has (from the catalog built into eezhee)
+var Regions core.Regions = core.NewRegionCatalog("gcp", nil)
+
+// Sizes are the VM sizes gcp has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("gcp")
+
+// how long to wait for compute operations (ie creating a VM) to finish
+const operationTimeout = 3 * time.Minute
+
+// zones are a region plus a letter. ie us-central1-a
+var zonePattern = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+-[a-z]$`)
+
+// images are published as families in the ubuntu-os-cloud & debian-cloud projects
+// note: arm machine types need the arm64 family
+var imageFamilies = map[string]struct {
+	Project  string
+	Families [2]string
+}{
+	"ubuntu-22.04": {"ubuntu-os-cloud", [2]string{"ubuntu-2204-lts", "ubuntu-2204-lts-arm64"}},
+	"ubuntu-24.04": {"ubuntu-os-cloud", [2]string{"ubuntu-2404-lts-amd64", "ubuntu-2404-lts-arm64"}},
+	"debian-12":    {"debian-cloud", [2]string{"debian-12", "debian-12-arm64"}},
+}
+
+// ubuntu & debian images don't allow root logins by default
+// note: k3s installer is run as root
+const userDataTemplate = `#cloud-config
+disable_root: false
+ssh_authorized_keys:
+  - %s
+`
+
+// Manager handles interactions with the Compute Engine API
+type Manager struct {
+	Credentials string // service account json file or 'default' for application-default credentials
+	Project     string
+	Endpoint    string // defaults to DefaultEndpoint
+	client      *http.Client
+}
+
+// NewManager creates a manage object & inits it
+// credentials is a service account json file. if empty (or 'default'), application-default credentials are used
+func NewManager(credentials string, projectID string) (core.VMManager, error) {
+
+	manager := new(Manager)
+	manager.Credentials = credentials
+	manager.Endpoint = DefaultEndpoint
+	ctx := context.Background()
+
+	var creds *google.Credentials
+	var err error
+	if len(credentials) == 0 || credentials == "default" {
+		creds, err = google.FindDefaultCredentials(ctx, computeScope)
+	} else {
+		var data []byte
+		data, err = os.ReadFile(credentials)
+		if err != nil {
+			return manager, err
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, computeScope)
+	}
+	if err != nil {
+		return manager, fmt.Errorf("no gcp credentials found: %w", err)
+	}
+
+	// which project to use
+	manager.Project = projectID
+	if len(manager.Project) == 0 {
+		manager.Project = creds.ProjectID
+	}
+	if len(manager.Project) == 0 {
+		manager.Project = findProject()
+	}
+	if len(manager.Project) == 0 {
+		return manager, errors.New("no gcp project set")
+	}
+
+	manager.client = oauth2.NewClient(ctx, creds.TokenSource)
+
+	return manager, nil
+}
+
+// NewManagerWithClient creates a manager that talks to the given endpoint with the given client
+// used to point the manager at a stand-in for the compute api
+func NewManagerWithClient(projectID string, endpoint string, client *http.Client) *Manager {
+
+	manager := new(Manager)
+	manager.Project = projectID
+	manager.Endpoint = endpoint
+	manager.client = client
+
+	return manager
+}
+
+// FindAuthToken will check common places for gcp credentials
+// returns the path of the credentials file
+func (m *Manager) FindAuthToken() string {
+
+	filename := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if len(filename) > 0 {
+		return filename
+	}
+
+	// 'gcloud auth application-default login' puts them here
+	configDir, err := gcloudConfigDir()
+	if err != nil {
+		return ""
+	}
+	filename = filepath.Join(configDir, "application_default_credentials.json")
+	if _, err := os.Stat(filename); err == nil {
+		return filename
+	}
+
+	return ""
+}
+
+// gcloudConfigDir is where the gcloud cli keeps its settings
+func gcloudConfigDir() (string, error) {
+
+	configDir := os.Getenv("CLOUDSDK_CONFIG")
+	if len(configDir) > 0 {
+		return configDir, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".config", "gcloud"), nil
+}
+
+// gcloudSetting reads a setting (ie core.project) from the active gcloud configuration
+func gcloudSetting(key string) string {
+
+	configDir, err := gcloudConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	activeConfig := os.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME")
+	if len(activeConfig) == 0 {
+		data, err := os.ReadFile(filepath.Join(configDir, "active_config"))
+		if err != nil {
+			activeConfig = "default"
+		} else {
+			activeConfig = strings.TrimSpace(string(data))
+		}
+	}
+
+	config := viper.New()
+	config.SetConfigType("ini")
+	config.SetConfigFile(filepath.Join(configDir, "configurations", "config_"+activeConfig))
+	if err := config.ReadInConfig(); err != nil {
+		log.Debug("could not read gcloud config file: ", config.ConfigFileUsed(), " - ", err)
+		return ""
+	}
+
+	return config.GetString(key)
+}
+
+// findProject checks env variables and the gcloud config for which project to use
+func findProject() string {
+
+	for _, name := range []string{"GOOGLE_CLOUD_PROJECT", "CLOUDSDK_CORE_PROJECT"} {
+		if project := os.Getenv(name); len(project) > 0 {
+			return project
+		}
+	}
+
+	return gcloudSetting("core.project")
+}
+
+// projectPath is the base path for all project resources
+func (m *Manager) projectPath() string {
+	return "projects/" + m.Project
+}
+
+// findProjectSSHKey looks for the key in the project-wide ssh keys
+func (m *Manager) findProjectSSHKey(ctx context.Context, sshKey core.SSHKey) (bool, error) {
+
+	var info project
+	err := m.call(ctx, http.MethodGet, m.projectPath(), nil, nil, &info)
+	if err != nil {
+		return false, err
+	}
+
+	// ssh-keys has one key per line in the format user:key
+	for _, item := range info.CommonInstanceMetadata.Items {
+		if item.Key != "ssh-keys" {
+			continue
+		}
+		for _, line := range strings.Split(item.Value, "\n") {
+			if strings.HasPrefix(line, "root:"+sshKey.GetPublicKey()) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// IsSSHKeyUploaded checks if ssh key is in the project-wide ssh keys
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, desiredSSHKey core.SSHKey) (string, error) {
+
+	found, err := m.findProjectSSHKey(ctx, desiredSSHKey)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", errors.New("ssh key not in gcp project metadata")
+	}
+
+	return desiredSSHKey.Fingerprint(), nil
+}
+
+// UploadSSHKey doesn't change project metadata as that would give the key access to every VM
+// in the project.  instead the key is added to the metadata of each VM we create
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (string, error) {
+	return sshKey.Fingerprint(), nil
+}
+
+// SelectClosestRegion uses the region set in the gcloud cli config
+// note: gcp doesn't have hosts in each region we can ping
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+
+	closestRegion = os.Getenv("CLOUDSDK_COMPUTE_REGION")
+	if len(closestRegion) == 0 {
+		closestRegion = gcloudSetting("compute.region")
+	}
+	if len(closestRegion) == 0 {
+		return "", errors.New("no gcp region set. set region in deploy file or run 'gcloud config set compute/region'")
+	}
+
+	return closestRegion, nil
+}
+
+// isARM checks if a machine type uses arm processors (ie t2a-standard-1)
+func isARM(size string) bool {
+	return strings.HasPrefix(size, "t2a-") || strings.HasPrefix(size, "c4a-")
+}
+
+// sourceImage returns the image a VM boots from
+// image can be an os (ie ubuntu-24.04 or debian-12) or a full image path (projects/x/global/images/y)
+func sourceImage(image string, size string) (string, error) {
+
+	if strings.HasPrefix(image, "projects/") {
+		return image, nil
+	}
+
+	images, ok := imageFamilies[image]
+	if !ok {
+		return "", fmt.Errorf("unsupported gcp image: %s", image)
+	}
+	family := images.Families[0]
+	if isARM(size) {
+		family = images.Families[1]
+	}
+
+	return "projects/" + images.Project + "/global/images/family/" + family, nil
+}
+
+// selectZone picks a zone in the region that has the machine type
+// region can also be a zone (ie us-central1-a)
+func (m *Manager) selectZone(ctx context.Context, regionName string, size string) (string, error) {
+
+	if zonePattern.MatchString(regionName) {
+		return regionName, nil
+	}
+
+	var info region
+	err := m.call(ctx, http.MethodGet, m.projectPath()+"/regions/"+regionName, nil, nil, &info)
+	if err != nil {
+		return "", err
+	}
+
+	var zones []string
+	for _, zoneURL := range info.Zones {
+		zones = append(zones, lastPart(zoneURL))
+	}
+	sort.Strings(zones)
+
+	// not all machine types are in every zone (ie arm)
+	for _, zone := range zones {
+		err = m.call(ctx, http.MethodGet, m.projectPath()+"/zones/"+zone+"/machineTypes/"+size, nil, nil, &machineType{})
+		if err == nil {
+			return zone, nil
+		}
+		if !isNotFound(err) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("%s not available in %s", size, regionName)
+}
+
+// ensureFirewall will create the firewall rule for cluster ports if it doesn't exist yet
+func (m *Manager) ensureFirewall(ctx context.Context) error {
+
+	path := m.projectPath() + "/global/firewalls"
+	err := m.call(ctx, http.MethodGet, path+"/"+firewallName, nil, nil, &firewall{})
+	if err == nil {
+		return nil
+	}
+	if !isNotFound(err) {
+		return err
+	}
+
+	rule := firewall{
+		Name:         firewallName,
+		Description:  "k3s clusters created by eezhee",
+		Network:      "global/networks/default",
+		Direction:    "INGRESS",
+		Allowed:      []firewallAllowed{{IPProtocol: "tcp", Ports: clusterPorts}},
+		SourceRanges: []string{"0.0.0.0/0"},
+		TargetTags:   []string{networkTag},
+	}
+	var op operation
+	err = m.call(ctx, http.MethodPost, path, nil, rule, &op)
+	if err != nil {
+		return err
+	}
+	log.Debug("created firewall rule ", firewallName)
+
+	return m.waitForOperation(ctx, "global", op)
+}
+
+// waitForOperation waits until an operation is done
+// scope is 'global' or 'zones/<zone>'
+func (m *Manager) waitForOperation(ctx context.Context, scope string, op operation) error {
+
+	deadline := time.Now().Add(operationTimeout)
+	for op.Status != "DONE" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for gcp operation %s", op.Name)
+		}
+		// wait returns when the operation is done or after about 2 minutes
+		err := m.call(ctx, http.MethodPost, m.projectPath()+"/"+scope+"/operations/"+op.Name+"/wait", nil, nil, &op)
+		if err != nil {
+			return err
+		}
+	}
+
+	return op.err()
+}
+
+// splitID gets the zone and instance name from our VM id
+// note: instance names are only unique per zone so our id is 'zone/name'
+func splitID(vmID string) (zone string, name string, err error) {
+
+	parts := strings.SplitN(vmID, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid gcp VM id: %s", vmID)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// GetVMInfo will get details of a VM
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
+
+	zone, name, err := splitID(vmID)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	var info instance
+	err = m.call(ctx, http.MethodGet, m.projectPath()+"/zones/"+zone+"/instances/"+name, nil, nil, &info)
+	if err != nil {
+		if isNotFound(err) {
+			return vmInfo, fmt.Errorf("vm %s %w", vmID, core.ErrNotFound)
+		}
+		return vmInfo, err
+	}
+
+	return convertVMInfoToGenericFormat(info)
+}
+
+// CreateVM will create a new VM
+// region can be a region (a zone is picked) or a zone
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+	var vmInfo core.VMInfo
+
+	zone, err := m.selectZone(ctx, region, size)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	imagePath, err := sourceImage(image, size)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	err = m.ensureFirewall(ctx)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	// key goes in instance metadata unless the project already has it
+	items := []metadataItem{
+		{Key: "user-data", Value: fmt.Sprintf(userDataTemplate, sshKey.GetPublicKey())},
+	}
+	inProject, err := m.findProjectSSHKey(ctx, sshKey)
+	if err != nil {
+		return vmInfo, err
+	}
+	if !inProject {
+		items = append(items, metadataItem{Key: "ssh-keys", Value: "root:" + sshKey.GetPublicKey()})
+	}
+
+	newInstance := instance{
+		Name:        name,
+		MachineType: "zones/" + zone + "/machineTypes/" + size,
+		Tags:        tags{Items: []string{networkTag}},
+		Disks: []attachedDisk{{
+			Boot:             true,
+			AutoDelete:       true,
+			InitializeParams: &initializeParams{SourceImage: imagePath, DiskSizeGB: "20"},
+		}},
+		NetworkInterfaces: []networkInterface{{
+			Network:       "global/networks/default",
+			AccessConfigs: []accessConfig{{Type: "ONE_TO_ONE_NAT", Name: "External NAT"}},
+		}},
+		Metadata: metadata{Items: items},
+	}
+
+	var op operation
+	err = m.call(ctx, http.MethodPost, m.projectPath()+"/zones/"+zone+"/instances", nil, newInstance, &op)
+	if err != nil {
+		return vmInfo, err
+	}
+	err = m.waitForOperation(ctx, "zones/"+zone, op)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	return m.GetVMInfo(ctx, zone+"/"+name)
+}
+
+// ListVMs will return a list of all VMs created by eezhee (in every zone)
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
+
+	query := url.Values{}
+	for {
+		var list instanceList
+		err = m.call(ctx, http.MethodGet, m.projectPath()+"/aggregated/instances", query, nil, &list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, scope := range list.Items {
+			for _, info := range scope.Instances {
+				for _, tag := range info.Tags.Items {
+					if tag == networkTag {
+						// we created this VM
+						vm, _ := convertVMInfoToGenericFormat(info)
+						vmInfo = append(vmInfo, vm)
+						break
+					}
+				}
+			}
+		}
+
+		if len(list.NextPageToken) == 0 {
+			break
+		}
+		query.Set("pageToken", list.NextPageToken)
+	}
+
+	return vmInfo, nil
+}
+
+// DeleteVM will delete a given VM
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
+
+	zone, name, err := splitID(ID)
+	if err != nil {
+		return err
+	}
+
+	var op operation
+	err = m.call(ctx, http.MethodDelete, m.projectPath()+"/zones/"+zone+"/instances/"+name, nil, nil, &op)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("vm %s %w", ID, core.ErrNotFound)
+		}
+		return err
+	}
+
+	log.Debug("vm ", ID, " being deleted")
+
+	return nil
+}
+
+// convertVMInfoToGenericFormat converts gcp instance info into our generic format
+func convertVMInfoToGenericFormat(info instance) (core.VMInfo, error) {
+
+	var vmInfo core.VMInfo
+
+	zone := lastPart(info.Zone)
+	size := lastPart(info.MachineType)
+
+	vmInfo.ID = zone + "/" + info.Name
+	vmInfo.Name = info.Name
+	vmInfo.Region = core.RegionInfo{Slug: zone}
+	vmInfo.Size = core.SizeInfo{Slug: size}
+	vmInfo.SizeSlug = size
+	vmInfo.Tags = info.Tags.Items
+
+	// gcp uses upper case (ie RUNNING)
+	vmInfo.Status = strings.ToLower(info.Status)
+
+	// gcp includes the local offset (ie 2024-01-02T10:11:12.123-07:00)
+	created, err := time.Parse(time.RFC3339, info.CreationTimestamp)
+	if err == nil {
+		vmInfo.CreatedAt = created.UTC().Format(time.RFC3339)
+	}
+
+	vmInfo.Networks = core.NetworkInfo{
+		V4Info: []core.V4NetworkInfo{},
+		V6Info: []core.V6NetworkInfo{},
+	}
+	for _, nic := range info.NetworkInterfaces {
+		for _, config := range nic.AccessConfigs {
+			if len(config.NatIP) > 0 {
+				vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+					IPAddress: config.NatIP,
+					Type:      "public",
+				})
+			}
+		}
+		if len(nic.NetworkIP) > 0 {
+			vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+				IPAddress: nic.NetworkIP,
+				Type:      "private",
+			})
+		}
+		for _, config := range nic.IPv6AccessConfigs {
+			if len(config.ExternalIPv6) > 0 {
+				vmInfo.Networks.V6Info = append(vmInfo.Networks.V6Info, core.V6NetworkInfo{
+					IPAddress: config.ExternalIPv6,
+					Type:      "public",
+				})
+			}
+		}
+	}
+
+	return vmInfo, nil
+}
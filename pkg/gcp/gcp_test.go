@@ -0,0 +1,137 @@
+package gcp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/core/conformance"
+	"golang.org/x/crypto/ssh"
+)
+
+const basePath = "/compute/v1/projects/eezhee-test"
+
+func TestConformance(t *testing.T) {
+
+	server := conformance.Replay(t, []conformance.Fixture{
+		{Method: "GET", Path: basePath + "/aggregated/instances", File: "testdata/instances.json"},
+		{Method: "GET", Path: basePath + "/zones/us-central1-a/instances/webapp-main", File: "testdata/instance.json"},
+		{Method: "GET", Path: basePath + "/zones/us-central1-a/instances/webapp-staging", File: "testdata/instance-provisioning.json"},
+		{Method: "GET", Path: basePath + "/zones/us-central1-a/instances/missing", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+		{Method: "DELETE", Path: basePath + "/zones/us-central1-a/instances/missing", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+	})
+	manager := NewManagerWithClient("eezhee-test", server.URL+"/compute/v1/", server.Client())
+
+	rejecting := conformance.Unauthorized(t, "testdata/unauthorized.json")
+	unauthorized := NewManagerWithClient("eezhee-test", rejecting.URL+"/compute/v1/", rejecting.Client())
+
+	conformance.Run(t, manager, unauthorized, conformance.Expect{
+		RunningID: "us-central1-a/webapp-main",
+		PendingID: "us-central1-a/webapp-staging",
+		MissingID: "us-central1-a/missing",
+		Name:      "webapp-main",
+		PublicIP:  "34.68.12.45",
+		CreatedAt: "2024-03-01T12:00:00Z",
+		NumListed: 2,
+	})
+}
+
+func TestCreateAndDeleteVM(t *testing.T) {
+
+	server := conformance.Replay(t, []conformance.Fixture{
+		{Method: "GET", Path: basePath + "/regions/us-central1", File: "testdata/region.json"},
+		{Method: "GET", Path: basePath + "/zones/us-central1-a/machineTypes/e2-small", Status: http.StatusNotFound, File: "testdata/machine-type-not-found.json"},
+		{Method: "GET", Path: basePath + "/zones/us-central1-b/machineTypes/e2-small", File: "testdata/machine-type.json"},
+		{Method: "GET", Path: basePath + "/global/firewalls/eezhee-cluster", Status: http.StatusNotFound, File: "testdata/firewall-not-found.json"},
+		{Method: "POST", Path: basePath + "/global/firewalls", File: "testdata/firewall-operation.json"},
+		{Method: "GET", Path: basePath, File: "testdata/project.json"},
+		{Method: "POST", Path: basePath + "/zones/us-central1-b/instances", File: "testdata/insert-operation.json"},
+		{Method: "POST", Path: basePath + "/zones/us-central1-b/operations/operation-1709294400000-insert/wait", File: "testdata/insert-operation-done.json"},
+		{Method: "GET", Path: basePath + "/zones/us-central1-b/instances/webapp-new", File: "testdata/instance-new.json"},
+		{Method: "DELETE", Path: basePath + "/zones/us-central1-b/instances/webapp-new", File: "testdata/delete-operation.json"},
+	})
+	recorded := conformance.Record(server)
+	manager := NewManagerWithClient("eezhee-test", server.URL+"/compute/v1/", recorded.Client())
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey := core.SSHKey{PublicKey: sshPublicKey}
+
+	ctx := context.Background()
+	vmInfo, err := manager.CreateVM(ctx, "webapp-new", "ubuntu-24.04", "e2-small", "us-central1", sshKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vmInfo.ID != "us-central1-b/webapp-new" || vmInfo.Status != "running" {
+		t.Fatalf("unexpected vm %+v", vmInfo)
+	}
+	ip, err := vmInfo.GetPublicIP()
+	if err != nil || ip != "34.68.12.99" {
+		t.Fatalf("GetPublicIP = %q, %v, want 34.68.12.99", ip, err)
+	}
+
+	// e2-small isn't in us-central1-a so the next zone is used
+	if _, ok := recorded.Find("GET", basePath+"/zones/us-central1-a/machineTypes/e2-small"); !ok {
+		t.Error("expected us-central1-a to be checked first")
+	}
+
+	// firewall rule didn't exist so was created
+	rule, ok := recorded.Find("POST", basePath+"/global/firewalls")
+	if !ok {
+		t.Fatal("expected firewall rule to be created")
+	}
+	var newRule firewall
+	err = json.Unmarshal(rule.Body, &newRule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRule.Name != firewallName || len(newRule.TargetTags) != 1 || newRule.TargetTags[0] != networkTag ||
+		strings.Join(newRule.Allowed[0].Ports, ",") != "22,80,443,6443" {
+		t.Errorf("unexpected firewall rule %+v", newRule)
+	}
+
+	// the key isn't in the project so it is added to the instance
+	insert, ok := recorded.Find("POST", basePath+"/zones/us-central1-b/instances")
+	if !ok {
+		t.Fatal("expected instance to be inserted")
+	}
+	var newInstance instance
+	err = json.Unmarshal(insert.Body, &newInstance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newInstance.MachineType != "zones/us-central1-b/machineTypes/e2-small" {
+		t.Errorf("MachineType = %q, want zones/us-central1-b/machineTypes/e2-small", newInstance.MachineType)
+	}
+	if newInstance.Disks[0].InitializeParams.SourceImage != "projects/ubuntu-os-cloud/global/images/family/ubuntu-2404-lts-amd64" {
+		t.Errorf("SourceImage = %q", newInstance.Disks[0].InitializeParams.SourceImage)
+	}
+	hasKey := false
+	for _, item := range newInstance.Metadata.Items {
+		if item.Key == "ssh-keys" && item.Value == "root:"+sshKey.GetPublicKey() {
+			hasKey = true
+		}
+	}
+	if !hasKey {
+		t.Errorf("ssh key missing from instance metadata %+v", newInstance.Metadata.Items)
+	}
+
+	err = manager.DeleteVM(ctx, vmInfo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := recorded.Find("DELETE", basePath+"/zones/us-central1-b/instances/webapp-new"); !ok {
+		t.Error("expected instance to be deleted")
+	}
+}
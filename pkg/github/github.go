@@ -5,6 +5,7 @@ package github
 //   the REST API allows some the tags endpoint to be queried without an auth token
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -88,13 +89,13 @@ type Release struct {
 }
 
 // GetRepoReleases will return a list of all the releases for a given repo
-func GetRepoReleases(owner string, repo string) (repoReleases []Release, err error) {
+func GetRepoReleases(ctx context.Context, owner string, repo string) (repoReleases []Release, err error) {
 
 	// get all releases, 100 at a time
 	// paginate through results if more than 100
 	apiURL := "https://api.github.com/repos/" + owner + "/" + repo + "/releases?page=1&per_page=100"
 	for len(apiURL) > 0 {
-		data, headers, err := makeRepoReleasesRequest(apiURL)
+		data, headers, err := makeRepoReleasesRequest(ctx, apiURL)
 		if err != nil {
 			return nil, err
 		}
@@ -145,7 +146,7 @@ func GetVersionUsingREST() []string {
 	apiURL := "https://api.github.com/repos/rancher/k3s/releases?page=1&per_page=100"
 
 	for len(apiURL) > 0 {
-		data, headers, err := makeRepoReleasesRequest(apiURL)
+		data, headers, err := makeRepoReleasesRequest(context.Background(), apiURL)
 		if err != nil {
 			return nil
 		}
@@ -270,10 +271,10 @@ func GetVersionUsingREST() []string {
 // }
 
 // makeRepoReleasesRequest will get release info for the repo
-func makeRepoReleasesRequest(apiURL string) (data []byte, headers http.Header, err error) {
+func makeRepoReleasesRequest(ctx context.Context, apiURL string) (data []byte, headers http.Header, err error) {
 
 	// setup api request
-	request, err := http.NewRequest("GET", apiURL, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,42 @@
+package hetzner
+
+import (
+	"errors"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// convertError maps hcloud errors to the kinds of errors in core
+func convertError(err error) error {
+
+	var apiErr hcloud.Error
+	if !errors.As(err, &apiErr) {
+		return core.ErrorFromResponse(nil, err)
+	}
+
+	var kind error
+	switch apiErr.Code {
+	case hcloud.ErrorCodeUnauthorized, hcloud.ErrorCodeForbidden:
+		kind = core.ErrAuth
+	case hcloud.ErrorCodeNotFound:
+		kind = core.ErrNotFound
+	case hcloud.ErrorCodeResourceLimitExceeded:
+		kind = core.ErrQuota
+	case hcloud.ErrorCodeRateLimitExceeded:
+		kind = core.ErrRateLimited
+	case hcloud.ErrorCodeServiceError, hcloud.ErrorCodeUnknownError, hcloud.ErrorCodeLocked,
+		hcloud.ErrorCodeConflict, hcloud.ErrorCodeMaintenance, hcloud.ErrorCodeResourceUnavailable,
+		hcloud.ErrorCodeRobotUnavailable, "timeout":
+		kind = core.ErrTransient
+	default:
+		return err
+	}
+
+	providerErr := &core.ProviderError{Kind: kind, Err: err}
+	if response := apiErr.Response(); response != nil && response.Response != nil {
+		providerErr.RetryAfter = core.ParseRetryAfter(response.Header.Get("Retry-After"))
+	}
+
+	return providerErr
+}
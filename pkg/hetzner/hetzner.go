@@ -0,0 +1,478 @@
+package hetzner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// hetzner runs a speed test server in each location
+var regionIPs = []core.IPPingTime{
+	{ID: "fsn1", Address: "fsn1-speed.hetzner.com"},
+	{ID: "nbg1", Address: "nbg1-speed.hetzner.com"},
+	{ID: "hel1", Address: "hel1-speed.hetzner.com"},
+	{ID: "ash", Address: "ash-speed.hetzner.com"},
+	{ID: "hil", Address: "hil-speed.hetzner.com"},
+	{ID: "sin", Address: "sin-speed.hetzner.com"},
+}
+
+// Regions are the regions hetzner has (from the catalog built into eezhee)
+var Regions core.Regions = core.NewRegionCatalog("hetzner", regionIPs)
+
+// Sizes are the VM sizes hetzner has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("hetzner")
+
+// Manager handles interactions with the Hetzner Cloud API
+type Manager struct {
+	APIToken string
+	api      *hcloud.Client
+}
+
+// NewManager creates a manage object & inits it
+func NewManager(providerAPIToken string) (core.VMManager, error) {
+
+	manager := new(Manager)
+
+	// make sure we have an api token
+	if len(providerAPIToken) == 0 {
+		// check places provider CLI tools store token
+		providerAPIToken = manager.FindAuthToken()
+		if len(providerAPIToken) == 0 {
+			return manager, errors.New("no hetzner api token set")
+		}
+		// ok we found a token
+	}
+
+	manager.APIToken = providerAPIToken
+	manager.api = hcloud.NewClient(
+		hcloud.WithToken(manager.APIToken),
+		hcloud.WithApplication("eezhee", ""),
+	)
+
+	return manager, nil
+}
+
+// hcloudContext is a context in the hcloud cli config file
+type hcloudContext struct {
+	Name  string `mapstructure:"name"`
+	Token string `mapstructure:"token"`
+}
+
+// FindAuthToken will check common places for hetzner api token
+func (m *Manager) FindAuthToken() string {
+
+	// hcloud cli lets env variable override config file
+	token := os.Getenv("HCLOUD_TOKEN")
+	if len(token) > 0 {
+		return token
+	}
+
+	// hcloud cli keeps its config in ~/.config/hcloud/cli.toml (unless HCLOUD_CONFIG set)
+	// the file has a list of contexts (one per project) and which one is active
+	// active_context = "my-project"
+	// [[contexts]]
+	//   name = "my-project"
+	//   token = "..."
+	configPath := os.Getenv("HCLOUD_CONFIG")
+	if len(configPath) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configPath = filepath.Join(homeDir, ".config", "hcloud", "cli.toml")
+	}
+
+	config := viper.New()
+	config.SetConfigType("toml")
+	config.SetConfigFile(configPath)
+	if err := config.ReadInConfig(); err != nil {
+		log.Debug("could not read hcloud config file: ", config.ConfigFileUsed(), " - ", err)
+		return ""
+	}
+
+	activeContext := os.Getenv("HCLOUD_CONTEXT")
+	if len(activeContext) == 0 {
+		activeContext = config.GetString("active_context")
+	}
+
+	var contexts []hcloudContext
+	err := config.UnmarshalKey("contexts", &contexts)
+	if err != nil {
+		log.Debug("invalid contexts in hcloud config file: ", err)
+		return ""
+	}
+	for _, context := range contexts {
+		if context.Name == activeContext {
+			return context.Token
+		}
+	}
+
+	return ""
+}
+
+// IsSSHKeyUploaded checks if ssh key already uploaded to hetzner
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, desiredSSHKey core.SSHKey) (string, error) {
+
+	sshKey, _, err := m.api.SSHKey.GetByFingerprint(ctx, desiredSSHKey.Fingerprint())
+	if err != nil {
+		return "", convertError(err)
+	}
+	if sshKey == nil {
+		return "", errors.New("ssh key not available on hetzner")
+	}
+
+	return strconv.FormatInt(sshKey.ID, 10), nil
+}
+
+// UploadSSHKey will upload given key to the provider
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (string, error) {
+
+	// if provider account shared with  more than one person, key name needs to be unique
+	// let's add first few characters  fingerprint
+	fingerprint := sshKey.Fingerprint()
+	keyName = keyName + "-" + fingerprint[0:8]
+
+	newKey, _, err := m.api.SSHKey.Create(ctx, hcloud.SSHKeyCreateOpts{
+		Name:      keyName,
+		PublicKey: sshKey.GetPublicKey(),
+		Labels:    map[string]string{"eezhee": ""},
+	})
+	if err != nil {
+		return "", convertError(err)
+	}
+
+	return strconv.FormatInt(newKey.ID, 10), nil
+}
+
+// SelectClosestRegion will check all hetzner locations to find the closest
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+	return core.ClosestRegion(ctx, "hetzner", regionIPs)
+}
+
+// ListRegions gets all of hetzner's locations and the server types available in each
+func (m *Manager) ListRegions(ctx context.Context) ([]core.RegionInfo, error) {
+
+	locations, err := m.api.Location.All(ctx)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	// a server type has a price for every location it can be created in
+	serverTypes, err := m.api.ServerType.All(ctx)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var regionInfo []core.RegionInfo
+	for _, location := range locations {
+		var sizes []string
+		for _, serverType := range serverTypes {
+			if serverType.IsDeprecated() {
+				continue
+			}
+			for _, pricing := range serverType.Pricings {
+				if pricing.Location != nil && pricing.Location.Name == location.Name {
+					sizes = append(sizes, serverType.Name)
+					break
+				}
+			}
+		}
+		regionInfo = append(regionInfo, core.RegionInfo{
+			Name:      location.Description,
+			Slug:      location.Name,
+			Available: true,
+			City:      location.City,
+			Country:   location.Country,
+			Latitude:  float32(location.Latitude),
+			Longitude: float32(location.Longitude),
+			Sizes:     sizes,
+		})
+	}
+
+	return regionInfo, nil
+}
+
+// ListImages gets the current hetzner image for each supported os
+// note: x86 and arm builds of an image have the same name (ie ubuntu-24.04)
+func (m *Manager) ListImages(ctx context.Context) ([]core.ImageInfo, error) {
+
+	images, err := m.api.Image.AllWithOpts(ctx, hcloud.ImageListOpts{
+		ListOpts: hcloud.ListOpts{PerPage: 50},
+		Type:     []hcloud.ImageType{hcloud.ImageTypeSystem},
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var imageInfo []core.ImageInfo
+	for _, image := range images {
+		if image.IsDeprecated() {
+			continue
+		}
+		os, ok := core.MatchOperatingSystem(image.OSFlavor, image.OSVersion)
+		if !ok {
+			continue
+		}
+		arch := "amd64"
+		if image.Architecture == hcloud.ArchitectureARM {
+			arch = "arm64"
+		}
+		imageInfo = append(imageInfo, core.ImageInfo{
+			ID:           int(image.ID),
+			Name:         image.Name,
+			Type:         string(image.Type),
+			Distrubution: image.OSFlavor,
+			Slug:         image.Name,
+			OS:           os.Name,
+			Arch:         arch,
+			Public:       true,
+			Description:  image.Description,
+			Status:       string(image.Status),
+			CreatedAt:    image.Created.Format(time.RFC3339),
+		})
+	}
+
+	return imageInfo, nil
+}
+
+// ListSizes gets all of hetzner's server types and their prices
+// prices are in EUR (including vat) and vary by location so the cheapest location is used
+func (m *Manager) ListSizes(ctx context.Context) ([]core.SizeInfo, error) {
+
+	serverTypes, err := m.api.ServerType.All(ctx)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var sizeInfo []core.SizeInfo
+	for _, serverType := range serverTypes {
+		arch := "amd64"
+		if serverType.Architecture == hcloud.ArchitectureARM {
+			arch = "arm64"
+		}
+		size := core.SizeInfo{
+			Slug:      serverType.Name,
+			Arch:      arch,
+			Memory:    int(serverType.Memory * 1024),
+			VCPUs:     serverType.Cores,
+			Disk:      serverType.Disk,
+			Available: !serverType.IsDeprecated(),
+		}
+		for _, pricing := range serverType.Pricings {
+			if pricing.Location != nil {
+				size.Regions = append(size.Regions, pricing.Location.Name)
+			}
+			monthly, err := strconv.ParseFloat(pricing.Monthly.Gross, 32)
+			if err != nil || (size.PriceMonthly > 0 && float32(monthly) >= size.PriceMonthly) {
+				continue
+			}
+			hourly, _ := strconv.ParseFloat(pricing.Hourly.Gross, 32)
+			size.PriceMonthly = float32(monthly)
+			size.PriceHourly = float32(hourly)
+			size.Transfer = int(pricing.IncludedTraffic >> 30) // bytes -> GB
+		}
+		sizeInfo = append(sizeInfo, size)
+	}
+
+	return sizeInfo, nil
+}
+
+// GetVMInfo will get details of a VM
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
+
+	serverID, err := strconv.ParseInt(vmID, 10, 64)
+	if err != nil {
+		return vmInfo, fmt.Errorf("invalid hetzner server id: %s", vmID)
+	}
+
+	server, _, err := m.api.Server.GetByID(ctx, serverID)
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
+	if server == nil {
+		return vmInfo, fmt.Errorf("vm %s %w", vmID, core.ErrNotFound)
+	}
+
+	return convertVMInfoToGenericFormat(server)
+}
+
+// CreateVM will create a new VM
+// size can be an x86 (ie cx22, cpx11) or arm (ie cax11) server type
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+	var vmInfo core.VMInfo
+
+	serverType, _, err := m.api.ServerType.GetByName(ctx, size)
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
+	if serverType == nil {
+		return vmInfo, fmt.Errorf("invalid hetzner server type: %s", size)
+	}
+
+	// hetzner has separate x86 and arm builds of each image (with the same name)
+	serverImage, _, err := m.api.Image.GetForArchitecture(ctx, image, serverType.Architecture)
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
+	if serverImage == nil {
+		return vmInfo, fmt.Errorf("image %s not available for %s", image, serverType.Architecture)
+	}
+
+	keyID, err := m.IsSSHKeyUploaded(ctx, sshKey)
+	if err != nil {
+		return vmInfo, err
+	}
+	id, _ := strconv.ParseInt(keyID, 10, 64)
+
+	result, _, err := m.api.Server.Create(ctx, hcloud.ServerCreateOpts{
+		Name:       name,
+		ServerType: serverType,
+		Image:      serverImage,
+		Location:   &hcloud.Location{Name: region},
+		SSHKeys:    []*hcloud.SSHKey{{ID: id}},
+		Labels:     map[string]string{"eezhee": ""},
+	})
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
+
+	return convertVMInfoToGenericFormat(result.Server)
+}
+
+// ListVMs will return a list of all VMs created by eezhee
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
+
+	servers, err := m.api.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: "eezhee"},
+	})
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
+
+	for _, server := range servers {
+		info, _ := convertVMInfoToGenericFormat(server)
+		vmInfo = append(vmInfo, info)
+	}
+
+	return vmInfo, nil
+}
+
+// DeleteVM will delete a given VM
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
+
+	serverID, err := strconv.ParseInt(ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid hetzner server id: %s", ID)
+	}
+
+	_, _, err = m.api.Server.DeleteWithResult(ctx, &hcloud.Server{ID: serverID})
+	if err != nil {
+		return convertError(err)
+	}
+
+	return nil
+}
+
+// ResizeVM changes the type of a server
+// server has to be off while it is changed. the disk is left alone so it can be resized back down
+func (m *Manager) ResizeVM(ctx context.Context, vmID string, size string) error {
+
+	serverID, err := strconv.ParseInt(vmID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid hetzner server id: %s", vmID)
+	}
+	server := &hcloud.Server{ID: serverID}
+
+	action, _, err := m.api.Server.Poweroff(ctx, server)
+	if err == nil {
+		err = m.api.Action.WaitFor(ctx, action)
+	}
+	if err != nil {
+		return fmt.Errorf("could not power off server: %w", convertError(err))
+	}
+
+	action, _, err = m.api.Server.ChangeType(ctx, server, hcloud.ServerChangeTypeOpts{
+		ServerType:  &hcloud.ServerType{Name: size},
+		UpgradeDisk: false,
+	})
+	if err == nil {
+		err = m.api.Action.WaitFor(ctx, action)
+	}
+	if err != nil {
+		// don't leave the server off (even if ctx was cancelled)
+		resizeErr := convertError(err)
+		powerOnCtx := context.WithoutCancel(ctx)
+		if action, _, err := m.api.Server.Poweron(powerOnCtx, server); err == nil {
+			m.api.Action.WaitFor(powerOnCtx, action)
+		}
+		return fmt.Errorf("could not change server type: %w", resizeErr)
+	}
+
+	action, _, err = m.api.Server.Poweron(ctx, server)
+	if err == nil {
+		err = m.api.Action.WaitFor(ctx, action)
+	}
+	if err != nil {
+		return fmt.Errorf("could not power on server: %w", convertError(err))
+	}
+
+	return nil
+}
+
+// convert hetzner server info into our generic format
+func convertVMInfoToGenericFormat(server *hcloud.Server) (core.VMInfo, error) {
+
+	var vmInfo core.VMInfo
+
+	vmInfo.ID = strconv.FormatInt(server.ID, 10)
+	vmInfo.Name = server.Name
+	vmInfo.Status = string(server.Status) // hetzner uses 'running' as well
+	vmInfo.CreatedAt = server.Created.UTC().Format(time.RFC3339)
+
+	if server.ServerType != nil {
+		vmInfo.Memory = int(server.ServerType.Memory)
+		vmInfo.VCPUs = server.ServerType.Cores
+		vmInfo.Disk = server.ServerType.Disk
+		vmInfo.Size = core.SizeInfo{Slug: server.ServerType.Name}
+		vmInfo.SizeSlug = server.ServerType.Name
+	}
+	if server.Datacenter != nil && server.Datacenter.Location != nil {
+		vmInfo.Region = core.RegionInfo{Slug: server.Datacenter.Location.Name}
+	}
+	if server.Image != nil {
+		vmInfo.Image = core.ImageInfo{Name: server.Image.Name}
+	}
+
+	vmInfo.Networks = core.NetworkInfo{
+		V4Info: []core.V4NetworkInfo{},
+		V6Info: []core.V6NetworkInfo{},
+	}
+	if !server.PublicNet.IPv4.IsUnspecified() {
+		vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+			IPAddress: server.PublicNet.IPv4.IP.String(),
+			Type:      "public",
+		})
+	}
+	if !server.PublicNet.IPv6.IsUnspecified() {
+		vmInfo.Networks.V6Info = append(vmInfo.Networks.V6Info, core.V6NetworkInfo{
+			IPAddress: server.PublicNet.IPv6.IP.String(),
+			Type:      "public",
+		})
+	}
+
+	// labels are key/value.  keys are our tags
+	for key := range server.Labels {
+		vmInfo.Tags = append(vmInfo.Tags, key)
+	}
+
+	return vmInfo, nil
+}
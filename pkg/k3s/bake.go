@@ -0,0 +1,88 @@
+package k3s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// k3s binaries and airgap images are downloaded from the github release
+const k3sReleaseURL = "https://github.com/k3s-io/k3s/releases/download/"
+
+// where a baked image keeps the k3s installer. k3s itself is in /usr/local/bin
+const bakedInstallScript = "/usr/local/bin/k3s-install.sh"
+
+// k3s imports any image archives in this directory when it starts
+const airgapImagesDir = "/var/lib/rancher/k3s/agent/images"
+
+// cleanCommand removes state that is specific to the VM an image is baked on
+// cloud-init runs again on VMs created from the image and creates new host keys & machine id
+// note: authorized keys are kept so VMs created from the image can always be logged into
+const cleanCommand = `set -e
+rm -f /etc/ssh/ssh_host_*
+truncate -s 0 /etc/machine-id
+rm -f /var/lib/dbus/machine-id
+cloud-init clean --logs
+(apt-get clean || true)
+rm -f /root/.bash_history
+sync
+`
+
+// Bake gets a VM ready to be saved as an image that clusters can be built from quickly
+// the k3s binary, its airgap images and the installer are downloaded but k3s isn't started
+// arch is the arch of the VM (amd64 or arm64)
+func (m *Manager) Bake(ctx context.Context, ipAddress string, k3sVersion string, arch string) error {
+
+	binary := "k3s"
+	if arch == "arm64" {
+		binary = "k3s-arm64"
+	}
+	airgapImages := fmt.Sprintf("k3s-airgap-images-%s.tar.gz", arch)
+	releaseURL := k3sReleaseURL + strings.ReplaceAll(k3sVersion, "+", "%2B") + "/"
+
+	// files are checked against the release's checksums before anything is installed
+	downloadCommand := fmt.Sprintf(`set -e
+curl -sfL https://get.k3s.io -o %[1]s
+download=$(mktemp -d)
+cd $download
+curl -sfL %[2]ssha256sum-%[3]s.txt -o sha256sum.txt
+curl -sfL %[2]s%[4]s -o %[4]s
+curl -sfL %[2]s%[5]s -o %[5]s
+awk '$2 == "%[4]s" || $2 == "%[5]s"' sha256sum.txt > checksums.txt
+test $(wc -l < checksums.txt) -eq 2
+sha256sum -c checksums.txt
+install -m 755 %[4]s /usr/local/bin/k3s
+mkdir -p %[6]s
+mv %[5]s %[6]s/%[5]s
+cd /
+rm -rf $download
+`, bakedInstallScript, releaseURL, arch, binary, airgapImages, airgapImagesDir)
+
+	conn, err := ConnectContext(ctx, ipAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// commands can't be cancelled so drop the connection instead
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	log.Info("downloading k3s ", k3sVersion, " and its images")
+	output, err := runCommand(conn, downloadCommand)
+	if err != nil {
+		log.Debug(output)
+		return installError(ctx, err)
+	}
+
+	log.Info("cleaning up VM")
+	output, err = runCommand(conn, cleanCommand)
+	if err != nil {
+		log.Debug(output)
+		return installError(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package k3s
+
+// code to publish a deployment to the internet through the traefik ingress k3s ships with
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// controller name traefik registers its IngressClass with
+const traefikController = "traefik.io/ingress-controller"
+
+// ingress that sends traffic for a host to a service & gets a cert for the host
+var ingressTemplate = template.Must(template.New("ingress").Parse(`apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+  labels:
+    app.kubernetes.io/managed-by: eezhee
+  annotations:
+    traefik.ingress.kubernetes.io/router.entrypoints: websecure
+    traefik.ingress.kubernetes.io/router.tls: "true"
+    traefik.ingress.kubernetes.io/router.tls.certresolver: {{ .CertResolver }}
+spec:
+  ingressClassName: {{ .IngressClass }}
+  tls:
+    - hosts:
+        - {{ .Host }}
+  rules:
+    - host: {{ .Host }}
+      http:
+        paths:
+          - path: /
+            pathType: Prefix
+            backend:
+              service:
+                name: {{ .Name }}
+                port:
+                  number: 80
+`))
+
+// FindIngressClass returns the name of the IngressClass traefik is using
+func FindIngressClass(conn *ssh.Client) (string, error) {
+
+	command := `k3s kubectl get ingressclass -o jsonpath='{range .items[*]}{.metadata.name}={.spec.controller}{"\n"}{end}'`
+	output, err := runCommand(conn, command)
+	if err != nil {
+		return "", fmt.Errorf("could not get ingress classes: %s", strings.TrimSpace(output))
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && parts[1] == traefikController {
+			return parts[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("traefik is not installed in the cluster")
+}
+
+// Expose will create a service and an ingress (with a Let's Encrypt cert) for a deployment
+// the service (and ingress) are named after the deployment
+func Expose(conn *ssh.Client, namespace string, deployment string, port int, host string, email string) error {
+
+	ingressClass, err := FindIngressClass(conn)
+	if err != nil {
+		return err
+	}
+
+	err = EnableCertResolver(conn, email)
+	if err != nil {
+		return err
+	}
+
+	// let kubectl build the service so it uses the deployment's selector
+	command := fmt.Sprintf("k3s kubectl -n %s expose deployment %s --name %s --port 80 --target-port %d "+
+		"--labels app.kubernetes.io/managed-by=eezhee --dry-run=client -o yaml | k3s kubectl apply -f -",
+		namespace, deployment, deployment, port)
+	output, err := runCommand(conn, command)
+	if err != nil {
+		return fmt.Errorf("could not create service for %s: %s", deployment, strings.TrimSpace(output))
+	}
+
+	var manifest bytes.Buffer
+	err = ingressTemplate.Execute(&manifest, map[string]string{
+		"Name":         deployment,
+		"Namespace":    namespace,
+		"Host":         host,
+		"CertResolver": CertResolver,
+		"IngressClass": ingressClass,
+	})
+	if err != nil {
+		return err
+	}
+
+	return Apply(conn, manifest.String())
+}
+
+// Unexpose removes the ingress and service created by Expose
+func Unexpose(conn *ssh.Client, namespace string, deployment string) error {
+
+	// only delete objects we created
+	command := fmt.Sprintf("k3s kubectl -n %s delete ingress,service -l app.kubernetes.io/managed-by=eezhee --field-selector metadata.name=%s --ignore-not-found",
+		namespace, deployment)
+	output, err := runCommand(conn, command)
+	if err != nil {
+		return fmt.Errorf("could not remove ingress for %s: %s", deployment, strings.TrimSpace(output))
+	}
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package k3s
+
+// code to bootstrap a gitops controller (flux or argo cd) so the cluster pulls
+// its manifests from a git repo rather than having them pushed to it
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const crdTimeout = 5 * time.Minute    // how long to wait for controller to install its CRDs
+const crdCheckDelay = 5 * time.Second // time between checks for CRDs
+
+// GitOps has details of the repo the cluster should sync from
+type GitOps struct {
+	Engine     string // 'flux' or 'argocd'
+	Repo       string // ssh url of the repo. ie git@github.com:org/app.git
+	Branch     string // defaults to 'main'
+	Path       string // directory in repo with manifests. defaults to '.'
+	PrivateKey string // PEM of deploy key
+}
+
+// gitopsEngine has details of how to install a given gitops controller
+type gitopsEngine struct {
+	Namespace string   // where controller runs
+	ChartRepo string   // helm repo with controller's chart
+	Chart     string   // name of chart
+	CRDs      []string // need to exist before we can create source objects
+}
+
+var gitopsEngines = map[string]gitopsEngine{
+	"flux": {
+		Namespace: "flux-system",
+		ChartRepo: "https://fluxcd-community.github.io/helm-charts",
+		Chart:     "flux2",
+		CRDs:      []string{"gitrepositories.source.toolkit.fluxcd.io", "kustomizations.kustomize.toolkit.fluxcd.io"},
+	},
+	"argocd": {
+		Namespace: "argocd",
+		ChartRepo: "https://argoproj.github.io/argo-helm",
+		Chart:     "argo-cd",
+		CRDs:      []string{"applications.argoproj.io"},
+	},
+}
+
+// k3s' helm controller installs any HelmChart put in the auto-deploy directory
+var helmChartTemplate = template.Must(template.New("helmchart").Parse(`apiVersion: helm.cattle.io/v1
+kind: HelmChart
+metadata:
+  name: {{ .Chart }}
+  namespace: kube-system
+spec:
+  repo: {{ .ChartRepo }}
+  chart: {{ .Chart }}
+  targetNamespace: {{ .Namespace }}
+  createNamespace: true
+`))
+
+// ValidGitOpsEngine checks if we know how to install the given engine
+func ValidGitOpsEngine(engine string) bool {
+	_, ok := gitopsEngines[engine]
+	return ok
+}
+
+// InstallGitOps will install the controller and point it at the repo
+func InstallGitOps(conn *ssh.Client, settings GitOps) error {
+
+	engine, ok := gitopsEngines[settings.Engine]
+	if !ok {
+		return fmt.Errorf("unsupported gitops engine: %s. use 'flux' or 'argocd'", settings.Engine)
+	}
+	if len(settings.Branch) == 0 {
+		settings.Branch = "main"
+	}
+	if len(settings.Path) == 0 {
+		settings.Path = "."
+	}
+
+	repoURL, repoHost, err := parseRepoURL(settings.Repo)
+	if err != nil {
+		return err
+	}
+
+	// install the controller
+	var chart bytes.Buffer
+	err = helmChartTemplate.Execute(&chart, engine)
+	if err != nil {
+		return err
+	}
+	err = WriteFile(conn, autoDeployDir+"/eezhee-gitops.yaml", chart.String(), "0600")
+	if err != nil {
+		return err
+	}
+	log.Info("installing ", settings.Engine)
+
+	// can't create source objects until the controller's CRDs exist
+	err = waitForCRDs(conn, engine.CRDs)
+	if err != nil {
+		return err
+	}
+
+	var objects []map[string]interface{}
+	switch settings.Engine {
+	case "flux":
+		// flux needs to know the git host's keys
+		keyscanCommand := "ssh-keyscan -t rsa,ecdsa,ed25519 "
+		if host, port, err := net.SplitHostPort(repoHost); err == nil {
+			keyscanCommand += "-p " + port + " " + host
+		} else {
+			keyscanCommand += repoHost
+		}
+		knownHosts, err := runCommand(conn, keyscanCommand+" 2>/dev/null")
+		if err != nil || len(knownHosts) == 0 {
+			return fmt.Errorf("could not get ssh host keys for %s", repoHost)
+		}
+		objects = fluxObjects(engine.Namespace, repoURL, knownHosts, settings)
+	case "argocd":
+		objects = argoObjects(engine.Namespace, repoURL, settings)
+	}
+
+	for _, object := range objects {
+		manifest, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		// objects include the private key so don't keep a copy in annotations
+		err = ServerSideApply(conn, string(manifest))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForCRDs will wait until the given CRDs exist and are ready to use
+func waitForCRDs(conn *ssh.Client, crds []string) error {
+
+	deadline := time.Now().Add(crdTimeout)
+	for _, crd := range crds {
+		for {
+			output, err := runCommand(conn, "k3s kubectl wait --for condition=established --timeout=30s crd/"+crd)
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for %s: %s", crd, strings.TrimSpace(output))
+			}
+			time.Sleep(crdCheckDelay)
+		}
+	}
+
+	return nil
+}
+
+// parseRepoURL converts scp style urls (git@host:org/repo) into ssh://git@host/org/repo
+// and returns the git host (and port if not 22)
+func parseRepoURL(repo string) (repoURL string, host string, err error) {
+
+	if !strings.Contains(repo, "://") {
+		// scp style url
+		parts := strings.SplitN(repo, ":", 2)
+		if len(parts) != 2 || !strings.Contains(parts[0], "@") {
+			return "", "", errors.New("gitops repo needs to be an ssh url. ie git@github.com:org/app.git")
+		}
+		repo = "ssh://" + parts[0] + "/" + strings.TrimPrefix(parts[1], "/")
+	}
+
+	parsed, err := url.Parse(repo)
+	if err != nil {
+		return "", "", err
+	}
+	if parsed.Scheme != "ssh" || len(parsed.Hostname()) == 0 {
+		return "", "", errors.New("gitops repo needs to be an ssh url. ie git@github.com:org/app.git")
+	}
+
+	return parsed.String(), parsed.Host, nil
+}
+
+// fluxObjects are the secret, GitRepository and Kustomization flux needs
+func fluxObjects(namespace string, repoURL string, knownHosts string, settings GitOps) []map[string]interface{} {
+
+	name := "eezhee"
+	metadata := map[string]interface{}{
+		"name":      name,
+		"namespace": namespace,
+		"labels":    map[string]string{"app.kubernetes.io/managed-by": "eezhee"},
+	}
+
+	return []map[string]interface{}{
+		{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"type":       "Opaque",
+			"metadata":   metadata,
+			"data": map[string]string{
+				"identity":    base64.StdEncoding.EncodeToString([]byte(settings.PrivateKey)),
+				"known_hosts": base64.StdEncoding.EncodeToString([]byte(knownHosts)),
+			},
+		},
+		{
+			"apiVersion": "source.toolkit.fluxcd.io/v1",
+			"kind":       "GitRepository",
+			"metadata":   metadata,
+			"spec": map[string]interface{}{
+				"interval":  "1m",
+				"url":       repoURL,
+				"ref":       map[string]string{"branch": settings.Branch},
+				"secretRef": map[string]string{"name": name},
+			},
+		},
+		{
+			"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+			"kind":       "Kustomization",
+			"metadata":   metadata,
+			"spec": map[string]interface{}{
+				"interval":  "5m",
+				"path":      settings.Path,
+				"prune":     true,
+				"sourceRef": map[string]string{"kind": "GitRepository", "name": name},
+			},
+		},
+	}
+}
+
+// argoObjects are the repository secret and Application argo cd needs
+func argoObjects(namespace string, repoURL string, settings GitOps) []map[string]interface{} {
+
+	return []map[string]interface{}{
+		{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"type":       "Opaque",
+			"metadata": map[string]interface{}{
+				"name":      "eezhee-repo",
+				"namespace": namespace,
+				"labels": map[string]string{
+					"app.kubernetes.io/managed-by":   "eezhee",
+					"argocd.argoproj.io/secret-type": "repository",
+				},
+			},
+			"data": map[string]string{
+				"type":          base64.StdEncoding.EncodeToString([]byte("git")),
+				"url":           base64.StdEncoding.EncodeToString([]byte(repoURL)),
+				"sshPrivateKey": base64.StdEncoding.EncodeToString([]byte(settings.PrivateKey)),
+			},
+		},
+		{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Application",
+			"metadata": map[string]interface{}{
+				"name":      "eezhee",
+				"namespace": namespace,
+				"labels":    map[string]string{"app.kubernetes.io/managed-by": "eezhee"},
+			},
+			"spec": map[string]interface{}{
+				"project": "default",
+				"source": map[string]string{
+					"repoURL":        repoURL,
+					"targetRevision": settings.Branch,
+					"path":           settings.Path,
+				},
+				"destination": map[string]string{
+					"server":    "https://kubernetes.default.svc",
+					"namespace": "default",
+				},
+				"syncPolicy": map[string]interface{}{
+					"automated": map[string]bool{"prune": true, "selfHeal": true},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,363 @@
+package k3s
+
+// code to side-load container images onto a cluster without needing a registry
+// images are exported locally (as an OCI layout or docker-archive tarball) and
+// streamed over ssh straight into containerd on each node
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const importImageCommand = "k3s ctr images import --all-platforms -"
+
+// ImageArchive has details of a locally built container image
+type ImageArchive struct {
+	Path   string // OCI layout directory or tarball
+	Format string // 'oci-layout' or 'archive'
+	Name   string // image reference (if archive has one)
+	Digest string // manifest (or config) digest of the image
+}
+
+// ociIndex is the index.json of an OCI layout
+type ociIndex struct {
+	Manifests []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"manifests"`
+}
+
+// dockerManifest is an entry in the manifest.json of a docker-archive
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// digest that containerd reports when it unpacks an image
+var unpackedDigest = regexp.MustCompile(`(sha256:[0-9a-f]{64})`)
+
+// OpenImageArchive will inspect a local image and figure out its format
+func OpenImageArchive(path string) (*ImageArchive, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &ImageArchive{Path: path}
+
+	if info.IsDir() {
+		// needs to be an OCI image layout
+		if _, err := os.Stat(filepath.Join(path, "oci-layout")); err != nil {
+			return nil, errors.New("directory is not an OCI image layout (no oci-layout file)")
+		}
+		archive.Format = "oci-layout"
+
+		data, err := os.ReadFile(filepath.Join(path, "index.json"))
+		if err != nil {
+			return nil, err
+		}
+		err = archive.parseOCIIndex(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return archive, nil
+	}
+
+	// otherwise it is a tarball (docker save or an oci-archive)
+	archive.Format = "archive"
+	err = archive.readTarballMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// parseOCIIndex gets the image name and digest from an OCI index
+func (a *ImageArchive) parseOCIIndex(data []byte) error {
+
+	var index ociIndex
+	err := json.Unmarshal(data, &index)
+	if err != nil {
+		return err
+	}
+	if len(index.Manifests) == 0 {
+		return errors.New("OCI index does not have any images")
+	}
+
+	manifest := index.Manifests[0]
+	a.Digest = manifest.Digest
+	a.Name = manifest.Annotations["org.opencontainers.image.ref.name"]
+	if len(a.Name) == 0 {
+		a.Name = manifest.Annotations["io.containerd.image.name"]
+	}
+
+	return nil
+}
+
+// readTarballMetadata looks for index.json (oci) or manifest.json (docker) in a tarball
+func (a *ImageArchive) readTarballMetadata() error {
+
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tarReader := tar.NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read image tarball: %w", err)
+		}
+
+		switch strings.TrimPrefix(header.Name, "./") {
+		case "index.json":
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				return err
+			}
+			// oci index is the better source so stop looking
+			return a.parseOCIIndex(data)
+
+		case "manifest.json":
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				return err
+			}
+			var manifests []dockerManifest
+			err = json.Unmarshal(data, &manifests)
+			if err != nil {
+				return err
+			}
+			if len(manifests) == 0 {
+				return errors.New("docker archive does not have any images")
+			}
+			if len(manifests[0].RepoTags) > 0 {
+				a.Name = manifests[0].RepoTags[0]
+			}
+			// config is named after its digest. ie blobs/sha256/abc or abc.json
+			config := strings.TrimSuffix(manifests[0].Config, ".json")
+			a.Digest = "sha256:" + filepath.Base(config)
+		}
+	}
+
+	if len(a.Digest) == 0 {
+		return errors.New("file is not a docker-archive or oci-archive tarball")
+	}
+
+	return nil
+}
+
+// Open returns a stream of the image in a format containerd can import
+// note: an OCI layout is tarred on the fly so nothing extra is written to disk
+func (a *ImageArchive) Open() (io.ReadCloser, error) {
+
+	if a.Format == "archive" {
+		return os.Open(a.Path)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTarball(a.Path, writer))
+	}()
+
+	return reader, nil
+}
+
+// writeTarball will tar up the given directory
+func writeTarball(dir string, output io.Writer) error {
+
+	tarWriter := tar.NewWriter(output)
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+// ImportImage will stream an image into containerd on the given node
+// returns the digest containerd reports for the image
+func (m *Manager) ImportImage(ipAddress string, archive *ImageArchive) (digest string, err error) {
+
+	conn, err := Connect(ipAddress)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	stream, err := archive.Open()
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	output, err := StreamCommand(conn, importImageCommand, stream)
+	if err != nil {
+		return "", fmt.Errorf("could not import image on %s: %w", ipAddress, err)
+	}
+	log.Debug(output)
+
+	// prefer what containerd says over what we found locally
+	digest = archive.Digest
+	if match := unpackedDigest.FindString(output); len(match) > 0 {
+		digest = match
+	}
+
+	return digest, nil
+}
+
+// RolloutImage will point a deployment at an image that has been side-loaded
+// pull policy is set so k3s uses the local copy rather than going to a registry
+func (m *Manager) RolloutImage(ipAddress string, namespace string, deployment string, image string) error {
+
+	// names end up in shell commands so only what kubernetes allows is let through
+	if !ValidNamespace(namespace) {
+		return fmt.Errorf("invalid namespace: %s", namespace)
+	}
+	if !ValidResourceName(deployment) {
+		return fmt.Errorf("invalid deployment name: %s", deployment)
+	}
+
+	conn, err := Connect(ipAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// get the containers (and their current images) in the deployment
+	getContainersCommand := fmt.Sprintf(
+		"k3s kubectl -n %s get deployment %s -o jsonpath='{range .spec.template.spec.containers[*]}{.name}={.image}{\"\\n\"}{end}'",
+		namespace, deployment)
+	output, err := runCommand(conn, getContainersCommand)
+	if err != nil {
+		return fmt.Errorf("could not find deployment %s: %s", deployment, strings.TrimSpace(output))
+	}
+
+	// only update containers that use the same image repo
+	var containers []string
+	var allContainers []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		allContainers = append(allContainers, parts[0])
+		if imageRepo(parts[1]) == imageRepo(image) {
+			containers = append(containers, parts[0])
+		}
+	}
+	if len(containers) == 0 {
+		if len(allContainers) != 1 {
+			return fmt.Errorf("deployment %s has no container using %s", deployment, imageRepo(image))
+		}
+		containers = allContainers
+	}
+
+	// set image and stop kubelet from trying to pull it
+	var patches []string
+	for _, container := range containers {
+		patches = append(patches, fmt.Sprintf(`{"name":"%s","image":"%s","imagePullPolicy":"IfNotPresent"}`, container, image))
+	}
+	patch := `{"spec":{"template":{"spec":{"containers":[` + strings.Join(patches, ",") + `]}}}}`
+
+	commands := []string{
+		fmt.Sprintf("k3s kubectl -n %s patch deployment %s --type strategic -p %s", namespace, deployment, shellQuote(patch)),
+		fmt.Sprintf("k3s kubectl -n %s rollout restart deployment/%s", namespace, deployment),
+	}
+	for _, command := range commands {
+		output, err := runCommand(conn, command)
+		if err != nil {
+			return fmt.Errorf("could not roll deployment %s: %s", deployment, strings.TrimSpace(output))
+		}
+	}
+
+	return nil
+}
+
+// names of namespaces are DNS-1123 labels and most other resources (ie deployments) DNS-1123 subdomains
+var (
+	labelPattern     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	subdomainPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// ValidNamespace checks a namespace name is one kubernetes allows
+func ValidNamespace(name string) bool {
+	return len(name) <= 63 && labelPattern.MatchString(name)
+}
+
+// ValidResourceName checks the name of a resource like a deployment is one kubernetes allows
+func ValidResourceName(name string) bool {
+	return len(name) <= 253 && subdomainPattern.MatchString(name)
+}
+
+// imageRepo strips the tag or digest from an image reference
+func imageRepo(image string) string {
+
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// a ':' after the last '/' is a tag (before it could be a registry port)
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	// docker.io/library/nginx is how containerd names nginx
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "library/")
+
+	return image
+}
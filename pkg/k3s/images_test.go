@@ -0,0 +1,60 @@
+package k3s
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidNames(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		namespace bool
+		resource  bool
+	}{
+		{"default", true, true},
+		{"web-app2", true, true},
+		{"web.app", false, true},
+		{"", false, false},
+		{"-web", false, false},
+		{"web-", false, false},
+		{"Web", false, false},
+		{"web_app", false, false},
+		{"web;reboot", false, false},
+		{"web'app", false, false},
+		{"$(reboot)", false, false},
+		{"web app", false, false},
+		{strings.Repeat("a", 64), false, true},
+		{strings.Repeat("a", 254), false, false},
+	}
+
+	for _, test := range tests {
+		if got := ValidNamespace(test.name); got != test.namespace {
+			t.Errorf("ValidNamespace(%q) = %v, want %v", test.name, got, test.namespace)
+		}
+		if got := ValidResourceName(test.name); got != test.resource {
+			t.Errorf("ValidResourceName(%q) = %v, want %v", test.name, got, test.resource)
+		}
+	}
+}
+
+func TestImageRepo(t *testing.T) {
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"nginx", "nginx"},
+		{"nginx:1.27", "nginx"},
+		{"docker.io/library/nginx:1.27", "nginx"},
+		{"ghcr.io/me/webapp@sha256:abc", "ghcr.io/me/webapp"},
+		{"localhost:5000/webapp", "localhost:5000/webapp"},
+		{"localhost:5000/webapp:v2", "localhost:5000/webapp"},
+	}
+
+	for _, test := range tests {
+		if got := imageRepo(test.image); got != test.want {
+			t.Errorf("imageRepo(%q) = %q, want %q", test.image, got, test.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package k3s
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -9,9 +10,7 @@ import (
 	"strings"
 	"time"
 
-	homedir "github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -20,9 +19,6 @@ const (
 	apiTimeout          = 10 * time.Second
 )
 
-const maxRetries = 6               // number of times to try ssh'ing into the VM
-const retryDelay = 5 * time.Second // time between retries
-
 // use cases:
 //  	build latest version of k3s
 //		build specific version of k3s
@@ -34,14 +30,14 @@ type Manager struct {
 }
 
 // NewManager will create a new k3s manager
-func NewManager() *Manager {
+func NewManager(ctx context.Context) *Manager {
 	m := new(Manager)
 
-	err := m.Releases.LoadChannels()
+	err := m.Releases.LoadChannels(ctx)
 	if err != nil {
 		log.Error("error: could not load list of k3s channels")
 	}
-	err = m.Releases.LoadReleases()
+	err = m.Releases.LoadReleases(ctx)
 	if err != nil {
 		log.Error("could not load list of k3s releases")
 	}
@@ -60,66 +56,44 @@ func (m *Manager) CheckRequirements() (bool, error) {
 }
 
 // Install k3s on given VM
-func (m *Manager) Install(ipAddress string, k3sVersion string, appName string) bool {
-
-	user := "root"
-	sshPort := 22
+func (m *Manager) Install(ctx context.Context, ipAddress string, k3sVersion string, appName string) error {
 
 	// build install command
 	installK3scommand := fmt.Sprintf("curl -sLS https://get.k3s.io | INSTALL_K3S_VERSION=%s sh -\n", k3sVersion)
 	// log.Debug(installK3scommand)
 
-	// get the private sshkey
-	// TODO: should support ssh agent & passphrases
-	keyFile := "~/.ssh/id_rsa"
-	sshPrivateKeyFile, _ := homedir.Expand(keyFile)
-	passphrase := ""
+	return m.install(ctx, ipAddress, installK3scommand, appName)
+}
 
-	signer, err := getSSHKey(sshPrivateKeyFile, passphrase)
-	if err != nil {
-		log.Error(err)
-		return false
-	}
+// InstallBaked configures k3s on a VM created from a baked image (see Bake)
+// k3s and its images are already on the VM so nothing is downloaded
+func (m *Manager) InstallBaked(ctx context.Context, ipAddress string, k3sVersion string, appName string) error {
 
-	// setup ssh details
-	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-	address := fmt.Sprintf("%s:%d", ipAddress, sshPort)
+	installK3scommand := fmt.Sprintf("INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_VERSION=%s sh %s\n",
+		k3sVersion, bakedInstallScript)
 
-	// ssh into the server (& retry if can't)
-	numRetries := 0
-	conn := &ssh.Client{}
-	for numRetries < maxRetries {
-
-		// try and ssh into vm
-		conn, err = ssh.Dial("tcp", address, config)
-		if err == nil {
-			// able to ssh into vm
-			break
-		}
-
-		log.Debug(err)
-
-		// wait a few seconds
-		time.Sleep(retryDelay)
-		numRetries += 1
-	}
+	return m.install(ctx, ipAddress, installK3scommand, appName)
+}
+
+// install runs the k3s installer on a VM and saves its kubeconfig
+func (m *Manager) install(ctx context.Context, ipAddress string, installK3scommand string, appName string) error {
 
+	// ssh into the server (& retry if can't)
+	conn, err := ConnectContext(ctx, ipAddress)
 	if err != nil {
-		return false
+		return err
 	}
+	defer conn.Close()
+
+	// commands can't be cancelled so drop the connection instead
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	// install k3s on the VM
 	output, err := runCommand(conn, installK3scommand)
 	if err != nil {
-		log.Error(err)
 		log.Debug(output)
-		return false
+		return installError(ctx, err)
 	}
 	log.Info("k3s installed on VM")
 
@@ -127,21 +101,20 @@ func (m *Manager) Install(ipAddress string, k3sVersion string, appName string) b
 	getK3sConfigCommand := "cat /etc/rancher/k3s/k3s.yaml\n"
 	output, err = runCommand(conn, getK3sConfigCommand)
 	if err != nil {
-		log.Error(err)
 		log.Debug(string(output))
-		return false
+		return installError(ctx, err)
 	}
 	// log.Debug(string(output))
 
 	// need to update kubeconfig so works outside the VM
 	// IP address needs to be set to external IP
 	// also rename context to something other than 'default'
-	context := appName
+	contextName := appName
 
 	configUpdater := strings.NewReplacer(
 		"127.0.0.1", ipAddress,
 		"localhost", ipAddress,
-		"default", context,
+		"default", contextName,
 	)
 	kubectlConfig := configUpdater.Replace(output)
 
@@ -150,52 +123,20 @@ func (m *Manager) Install(ipAddress string, k3sVersion string, appName string) b
 	absPath, _ := filepath.Abs("kubeconfig")
 	err = os.WriteFile(absPath, []byte(kubectlConfig), 0600)
 	if err != nil {
-		log.Error(err)
-		return false
+		return err
 	}
 
 	log.Info("kubernetes is initializing")
 	log.Info("you can access using `kubectl --kubeconfig ./kubeconfig get pods`")
 
-	return true
-}
-
-func runCommand(conn *ssh.Client, command string) (outputStr string, err error) {
-
-	sess, err := conn.NewSession()
-	if err != nil {
-		log.Error(err)
-		return "", err
-	}
-	defer sess.Close()
-
-	output, err := sess.CombinedOutput(command)
-	outputStr = string(output)
-	if err != nil {
-		log.Error(err)
-		log.Debug(outputStr)
-		return outputStr, err
-	}
-	// log.Debug(outputStr)
-
-	return outputStr, nil
+	return nil
 }
 
-// getSshKey
-func getSSHKey(keyFilename string, passphrase string) (signer ssh.Signer, err error) {
-
-	// load the private key
-	privateKey, err := os.ReadFile(keyFilename)
-	if err != nil {
-		return nil, err
-	}
-
-	// decode the key
-	if passphrase != "" {
-		signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(passphrase))
-	} else {
-		signer, err = ssh.ParsePrivateKey(privateKey)
+// installError reports the context error if the install was cancelled
+// (the command fails when its connection is closed)
+func installError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-
-	return signer, err
+	return err
 }
@@ -0,0 +1,72 @@
+package k3s
+
+// helpers to manage a cluster over ssh using the kubectl that is built into k3s
+// manifests are piped over the ssh connection so nothing is written to local disk
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Apply will create or update the objects in the given manifest
+func Apply(conn *ssh.Client, manifest string) error {
+
+	output, err := StreamCommand(conn, "k3s kubectl apply -f -", strings.NewReader(manifest))
+	if err != nil {
+		return fmt.Errorf("could not apply manifest: %s", strings.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// ServerSideApply will create or update objects without kubectl keeping a copy of them
+// in the last-applied annotation. used for secrets so values only live in the secret
+func ServerSideApply(conn *ssh.Client, manifest string) error {
+
+	command := "k3s kubectl apply --server-side --force-conflicts --field-manager eezhee -f -"
+	output, err := StreamCommand(conn, command, strings.NewReader(manifest))
+	if err != nil {
+		return fmt.Errorf("could not apply manifest: %s", strings.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// Delete will remove the objects in the given manifest (if they exist)
+func Delete(conn *ssh.Client, manifest string) error {
+
+	output, err := StreamCommand(conn, "k3s kubectl delete --ignore-not-found -f -", strings.NewReader(manifest))
+	if err != nil {
+		return fmt.Errorf("could not delete objects: %s", strings.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// WriteFile will create (or overwrite) a file on the VM
+func WriteFile(conn *ssh.Client, filename string, content string, mode string) error {
+
+	command := fmt.Sprintf("mkdir -p %s && install -m %s /dev/stdin %s", path.Dir(filename), mode, filename)
+	output, err := StreamCommand(conn, command, strings.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("could not write %s: %s", filename, strings.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// Restart k3s so it picks up changes to its config files
+func Restart(conn *ssh.Client) error {
+
+	// servers run 'k3s' and agents run 'k3s-agent'
+	command := "systemctl restart k3s 2>/dev/null || systemctl restart k3s-agent"
+	output, err := runCommand(conn, command)
+	if err != nil {
+		return fmt.Errorf("could not restart k3s: %s", strings.TrimSpace(output))
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package k3s
+
+// code to run a private registry inside the cluster and to tell containerd
+// (via /etc/rancher/k3s/registries.yaml) how to reach it and any external registries
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+const registriesFile = "/etc/rancher/k3s/registries.yaml"
+const registryCertsDir = "/etc/rancher/k3s/certs"
+const registryNamespace = "eezhee-registry"
+
+// Registry has details of a container registry nodes should be able to pull from
+type Registry struct {
+	Host               string   // ie ghcr.io or registry.example.com
+	Username           string   // optional
+	Password           string   // optional
+	CACert             string   // PEM of CA that signed registry's cert (optional)
+	InsecureSkipVerify bool     // don't validate registry's cert
+	MirrorFor          []string // registries this one mirrors. ie docker.io
+}
+
+// registriesConfig is the format of k3s' registries.yaml
+type registriesConfig struct {
+	Mirrors map[string]registryMirror `yaml:"mirrors,omitempty"`
+	Configs map[string]registryConfig `yaml:"configs,omitempty"`
+}
+
+type registryMirror struct {
+	Endpoints []string `yaml:"endpoint"`
+}
+
+type registryConfig struct {
+	Auth *registryAuth `yaml:"auth,omitempty"`
+	TLS  *registryTLS  `yaml:"tls,omitempty"`
+}
+
+type registryAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type registryTLS struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// BuildRegistriesFile will generate the contents of registries.yaml
+func BuildRegistriesFile(registries []Registry) (string, error) {
+
+	config := registriesConfig{
+		Mirrors: make(map[string]registryMirror),
+		Configs: make(map[string]registryConfig),
+	}
+
+	for _, registry := range registries {
+
+		endpoint := "https://" + registry.Host
+
+		// registry is its own mirror plus any others it stands in for
+		mirrorFor := append([]string{registry.Host}, registry.MirrorFor...)
+		for _, name := range mirrorFor {
+			mirror := config.Mirrors[name]
+			mirror.Endpoints = append(mirror.Endpoints, endpoint)
+			config.Mirrors[name] = mirror
+		}
+
+		var settings registryConfig
+		if len(registry.Username) > 0 {
+			settings.Auth = &registryAuth{Username: registry.Username, Password: registry.Password}
+		}
+		if len(registry.CACert) > 0 || registry.InsecureSkipVerify {
+			settings.TLS = &registryTLS{InsecureSkipVerify: registry.InsecureSkipVerify}
+			if len(registry.CACert) > 0 {
+				settings.TLS.CAFile = registryCAFile(registry.Host)
+			}
+		}
+		if settings.Auth != nil || settings.TLS != nil {
+			config.Configs[registry.Host] = settings
+		}
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// where the CA cert for a given registry is stored on each node
+func registryCAFile(host string) string {
+	host = strings.ReplaceAll(host, ":", "_")
+	return fmt.Sprintf("%s/%s/ca.crt", registryCertsDir, host)
+}
+
+// ConfigureRegistries will write registries.yaml (and any CA certs) to a node & restart k3s
+func (m *Manager) ConfigureRegistries(ipAddress string, registries []Registry) error {
+
+	registriesYAML, err := BuildRegistriesFile(registries)
+	if err != nil {
+		return err
+	}
+
+	conn, err := Connect(ipAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, registry := range registries {
+		if len(registry.CACert) == 0 {
+			continue
+		}
+		err = WriteFile(conn, registryCAFile(registry.Host), registry.CACert, "0644")
+		if err != nil {
+			return err
+		}
+	}
+
+	// file has credentials so only root can read it
+	err = WriteFile(conn, registriesFile, registriesYAML, "0600")
+	if err != nil {
+		return err
+	}
+	log.Debug("updated ", registriesFile, " on ", ipAddress)
+
+	// containerd only reads the config at startup
+	return Restart(conn)
+}
+
+// manifest for a registry running in the cluster
+// storage uses the local-path provisioner that comes with k3s
+var registryTemplate = template.Must(template.New("registry").Parse(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: registry-auth
+  namespace: {{ .Namespace }}
+type: Opaque
+stringData:
+  htpasswd: |
+    {{ .Htpasswd }}
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: registry-data
+  namespace: {{ .Namespace }}
+spec:
+  accessModes:
+    - ReadWriteOnce
+  storageClassName: local-path
+  resources:
+    requests:
+      storage: 10Gi
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: registry
+  namespace: {{ .Namespace }}
+  labels:
+    app: registry
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels:
+      app: registry
+  template:
+    metadata:
+      labels:
+        app: registry
+    spec:
+      containers:
+        - name: registry
+          image: registry:2
+          ports:
+            - containerPort: 5000
+          env:
+            - name: REGISTRY_AUTH
+              value: htpasswd
+            - name: REGISTRY_AUTH_HTPASSWD_REALM
+              value: eezhee
+            - name: REGISTRY_AUTH_HTPASSWD_PATH
+              value: /auth/htpasswd
+          volumeMounts:
+            - name: data
+              mountPath: /var/lib/registry
+            - name: auth
+              mountPath: /auth
+              readOnly: true
+      volumes:
+        - name: data
+          persistentVolumeClaim:
+            claimName: registry-data
+        - name: auth
+          secret:
+            secretName: registry-auth
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: registry
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    app: registry
+  ports:
+    - port: 5000
+      targetPort: 5000
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: registry
+  namespace: {{ .Namespace }}
+  annotations:
+    traefik.ingress.kubernetes.io/router.entrypoints: websecure
+    traefik.ingress.kubernetes.io/router.tls: "true"
+    traefik.ingress.kubernetes.io/router.tls.certresolver: {{ .CertResolver }}
+spec:
+  ingressClassName: {{ .IngressClass }}
+  tls:
+    - hosts:
+        - {{ .Host }}
+  rules:
+    - host: {{ .Host }}
+      http:
+        paths:
+          - path: /
+            pathType: Prefix
+            backend:
+              service:
+                name: registry
+                port:
+                  number: 5000
+`))
+
+// InstallRegistry will run a registry in the cluster, fronted by traefik with a Let's Encrypt cert
+func (m *Manager) InstallRegistry(ipAddress string, host string, username string, password string, email string) error {
+
+	// registry only supports bcrypt hashed passwords
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	conn, err := Connect(ipAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ingressClass, err := FindIngressClass(conn)
+	if err != nil {
+		return err
+	}
+
+	var manifest bytes.Buffer
+	err = registryTemplate.Execute(&manifest, map[string]string{
+		"Namespace":    registryNamespace,
+		"Htpasswd":     username + ":" + string(hash),
+		"Host":         host,
+		"CertResolver": CertResolver,
+		"IngressClass": ingressClass,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = EnableCertResolver(conn, email)
+	if err != nil {
+		return err
+	}
+
+	return Apply(conn, manifest.String())
+}
+
+// DefaultRegistryHost gives a hostname that resolves to the node without needing any DNS setup
+func DefaultRegistryHost(ipAddress string) string {
+	return "registry." + ipAddress + ".sslip.io"
+}
+
+// ValidHost makes sure a host is just a hostname (and optional port)
+func ValidHost(host string) bool {
+	parsed, err := url.Parse("https://" + host)
+	return err == nil && parsed.Host == host && len(parsed.Hostname()) > 0
+}
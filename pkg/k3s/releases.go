@@ -6,6 +6,7 @@ package k3s
 // latest release is
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -95,11 +96,11 @@ func (r *Release) Parse(releaseStr string) (err error) {
 }
 
 // LoadChannels will get the channel details from updates.k3s.io
-func (ri *ReleaseInfo) LoadChannels() error {
+func (ri *ReleaseInfo) LoadChannels(ctx context.Context) error {
 
 	// setup api request
 	apiURL := k3sUpdateAPI + k3sChannelsEndpoint
-	request, err := http.NewRequest("GET", apiURL, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return err
 	}
@@ -129,7 +130,7 @@ func (ri *ReleaseInfo) LoadChannels() error {
 }
 
 // LoadReleases will get a list of all
-func (ri *ReleaseInfo) LoadReleases() error {
+func (ri *ReleaseInfo) LoadReleases(ctx context.Context) error {
 
 	// see if we already have the versions list
 	if ri.Releases != nil {
@@ -138,7 +139,7 @@ func (ri *ReleaseInfo) LoadReleases() error {
 
 	ri.Releases = make(map[string][]string)
 
-	githubReleases, err := github.GetRepoReleases("rancher", "k3s")
+	githubReleases, err := github.GetRepoReleases(ctx, "rancher", "k3s")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,220 @@
+package k3s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const maxRetries = 6               // number of times to try ssh'ing into the VM
+const retryDelay = 5 * time.Second // time between retries
+
+// Login has details of how to ssh into a given server
+// note: only needed for servers we did not create (ie the ssh cloud)
+type Login struct {
+	User    string // defaults to root
+	Port    int    // defaults to 22
+	KeyFile string // private key. defaults to ~/.ssh/id_rsa
+}
+
+var (
+	loginsMutex sync.Mutex
+	logins      = map[string]Login{}
+)
+
+// SetLogin sets how Connect should log into a given host
+func SetLogin(host string, login Login) {
+	loginsMutex.Lock()
+	defer loginsMutex.Unlock()
+	logins[host] = login
+}
+
+// getLogin returns the login for a host, filling in any missing defaults
+func getLogin(host string) Login {
+	loginsMutex.Lock()
+	login := logins[host]
+	loginsMutex.Unlock()
+
+	if len(login.User) == 0 {
+		login.User = "root"
+	}
+	if login.Port == 0 {
+		login.Port = 22
+	}
+	if len(login.KeyFile) == 0 {
+		login.KeyFile = "~/.ssh/id_rsa"
+	}
+	return login
+}
+
+// Connect will ssh into the given VM (& retry if can't)
+// VMs we create are logged into as root unless SetLogin was called for the host
+func Connect(ipAddress string) (*ssh.Client, error) {
+	return ConnectContext(context.Background(), ipAddress)
+}
+
+// ConnectContext is Connect but gives up once the context is done
+func ConnectContext(ctx context.Context, ipAddress string) (*ssh.Client, error) {
+
+	login := getLogin(ipAddress)
+	user := login.User
+	sshPort := login.Port
+
+	// get the private sshkey
+	// TODO: should support ssh agent & passphrases
+	sshPrivateKeyFile, _ := homedir.Expand(login.KeyFile)
+	passphrase := ""
+
+	signer, err := getSSHKey(sshPrivateKeyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// setup ssh details
+	config := &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	address := fmt.Sprintf("%s:%d", ipAddress, sshPort)
+
+	numRetries := 0
+	var conn *ssh.Client
+	for numRetries < maxRetries {
+
+		// try and ssh into vm
+		conn, err = dial(ctx, address, config)
+		if err == nil {
+			// able to ssh into vm
+			return conn, nil
+		}
+
+		log.Debug(err)
+
+		// wait a few seconds
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryDelay):
+		}
+		numRetries += 1
+	}
+
+	return nil, err
+}
+
+// dial is ssh.Dial but the tcp connection and ssh handshake can be cancelled
+func dial(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// closing the connection is the only way to interrupt the handshake
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+	defer stop()
+
+	sshConn, channels, requests, err := ssh.NewClientConn(netConn, address, config)
+	if err != nil {
+		netConn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	return ssh.NewClient(sshConn, channels, requests), nil
+}
+
+// RunCommand will run a command on the VM and return its combined output
+func RunCommand(conn *ssh.Client, command string) (outputStr string, err error) {
+	return runCommand(conn, command)
+}
+
+// StreamCommand will run a command on the VM with input piped to its stdin
+// note: input is streamed so large payloads never need to fit in memory
+func StreamCommand(conn *ssh.Client, command string, input io.Reader) (outputStr string, err error) {
+
+	sess, err := conn.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer sess.Close()
+
+	sess.Stdin = input
+	output, err := sess.CombinedOutput(asRoot(conn, command))
+	outputStr = string(output)
+	if err != nil {
+		log.Debug(outputStr)
+		return outputStr, err
+	}
+
+	return outputStr, nil
+}
+
+func runCommand(conn *ssh.Client, command string) (outputStr string, err error) {
+
+	sess, err := conn.NewSession()
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	defer sess.Close()
+
+	output, err := sess.CombinedOutput(asRoot(conn, command))
+	outputStr = string(output)
+	if err != nil {
+		log.Error(err)
+		log.Debug(outputStr)
+		return outputStr, err
+	}
+	// log.Debug(outputStr)
+
+	return outputStr, nil
+}
+
+// asRoot wraps a command in sudo when not logged in as root
+// note: user needs passwordless sudo as there is no way to enter a password
+func asRoot(conn *ssh.Client, command string) string {
+	if conn.User() == "root" {
+		return command
+	}
+	return "sudo -n sh -c " + shellQuote(command)
+}
+
+// shellQuote puts a value in single quotes so the shell passes it on as is
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// getSshKey
+func getSSHKey(keyFilename string, passphrase string) (signer ssh.Signer, err error) {
+
+	// load the private key
+	privateKey, err := os.ReadFile(keyFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode the key
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(privateKey)
+	}
+
+	return signer, err
+}
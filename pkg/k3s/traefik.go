@@ -0,0 +1,50 @@
+package k3s
+
+import (
+	"bytes"
+	"text/template"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CertResolver is the name of the traefik resolver that gets certs from Let's Encrypt
+const CertResolver = "letsencrypt"
+
+// k3s watches this directory and applies any manifests put in it
+const autoDeployDir = "/var/lib/rancher/k3s/server/manifests"
+
+// HelmChartConfig lets us change the values k3s uses to install traefik
+var traefikConfigTemplate = template.Must(template.New("traefik").Parse(`apiVersion: helm.cattle.io/v1
+kind: HelmChartConfig
+metadata:
+  name: traefik
+  namespace: kube-system
+spec:
+  valuesContent: |-
+    persistence:
+      enabled: true
+    certResolvers:
+      {{ .Resolver }}:
+        {{- if .Email }}
+        email: {{ .Email }}
+        {{- end }}
+        httpChallenge:
+          entryPoint: web
+        storage: /data/acme.json
+`))
+
+// EnableCertResolver will setup traefik so ingresses can request a Let's Encrypt cert
+// note: traefik is redeployed by k3s once the config is written
+func EnableCertResolver(conn *ssh.Client, email string) error {
+
+	var manifest bytes.Buffer
+	err := traefikConfigTemplate.Execute(&manifest, struct {
+		Resolver string
+		Email    string
+	}{CertResolver, email})
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(conn, autoDeployDir+"/traefik-config.yaml", manifest.String(), "0600")
+}
@@ -0,0 +1,35 @@
+package linode
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/linode/linodego"
+)
+
+// convertError maps linodego errors to the kinds of errors in core
+func convertError(err error) error {
+
+	var apiErr *linodego.Error
+	if !errors.As(err, &apiErr) {
+		return core.ErrorFromResponse(nil, err)
+	}
+
+	// code is the http status for errors returned by the api
+	kind := core.KindFromStatus(apiErr.Code, apiErr.Message)
+	if kind == nil {
+		return err
+	}
+
+	var header http.Header
+	if apiErr.Response != nil {
+		header = apiErr.Response.Header
+	}
+
+	return &core.ProviderError{
+		Kind:       kind,
+		RetryAfter: core.ParseRetryAfter(header.Get("Retry-After")),
+		Err:        err,
+	}
+}
@@ -0,0 +1,220 @@
+package linode
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/linode/linodego"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateCluster will create a Linode Kubernetes Engine (LKE) cluster
+// version can be 'latest' or a kubernetes minor version (ie 1.31)
+func (m *Manager) CreateCluster(ctx context.Context, name string, version string, region string, nodePools []core.NodePool) (core.ClusterInfo, error) {
+
+	var clusterInfo core.ClusterInfo
+
+	// lke needs an exact version
+	if len(version) == 0 || version == "latest" {
+		latest, err := m.latestLKEVersion(ctx)
+		if err != nil {
+			return clusterInfo, err
+		}
+		version = latest
+	}
+
+	createOptions := linodego.LKEClusterCreateOptions{
+		Label:      name,
+		Region:     region,
+		K8sVersion: version,
+		Tags:       []string{"eezhee"},
+	}
+	for _, pool := range nodePools {
+		// lke pools don't have names so the name is added as a tag
+		// note: pool tags end up on the linodes so 'eezhee' is not used (or they would
+		// show up as k3s VMs)
+		var tags []string
+		if len(pool.Name) > 0 {
+			tags = append(tags, pool.Name)
+		}
+		createOptions.NodePools = append(createOptions.NodePools, linodego.LKENodePoolCreateOptions{
+			Count: pool.Count,
+			Type:  pool.Size,
+			Tags:  tags,
+		})
+	}
+
+	cluster, err := m.api.CreateLKECluster(ctx, createOptions)
+	if err != nil {
+		return clusterInfo, convertError(err)
+	}
+
+	return convertClusterInfoToGenericFormat(*cluster), nil
+}
+
+// GetClusterInfo will get details of a LKE cluster
+func (m *Manager) GetClusterInfo(ctx context.Context, clusterID string) (core.ClusterInfo, error) {
+
+	var clusterInfo core.ClusterInfo
+
+	id, err := strconv.Atoi(clusterID)
+	if err != nil {
+		return clusterInfo, errors.New("invalid lke cluster id: " + clusterID)
+	}
+
+	cluster, err := m.api.GetLKECluster(ctx, id)
+	if err != nil {
+		return clusterInfo, convertError(err)
+	}
+	clusterInfo = convertClusterInfoToGenericFormat(*cluster)
+
+	pools, err := m.api.ListLKENodePools(ctx, id, nil)
+	if err == nil {
+		clusterInfo.NodePools = convertNodePools(pools)
+	}
+
+	// endpoints are only available once the control plane is up
+	endpoints, err := m.api.ListLKEClusterAPIEndpoints(ctx, id, nil)
+	if err == nil && len(endpoints) > 0 {
+		clusterInfo.Endpoint = endpoints[0].Endpoint
+	}
+
+	return clusterInfo, nil
+}
+
+// ListClusters will return all LKE clusters created by eezhee
+func (m *Manager) ListClusters(ctx context.Context) (clusterInfo []core.ClusterInfo, err error) {
+
+	clusters, err := m.api.ListLKEClusters(ctx, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	for _, cluster := range clusters {
+		for _, tag := range cluster.Tags {
+			if tag == "eezhee" {
+				clusterInfo = append(clusterInfo, convertClusterInfoToGenericFormat(cluster))
+				break
+			}
+		}
+	}
+
+	return clusterInfo, nil
+}
+
+// GetKubeConfig will get the kubeconfig for a LKE cluster
+// note: it is not available until the cluster has finished provisioning
+func (m *Manager) GetKubeConfig(ctx context.Context, clusterID string) ([]byte, error) {
+
+	id, err := strconv.Atoi(clusterID)
+	if err != nil {
+		return nil, errors.New("invalid lke cluster id: " + clusterID)
+	}
+
+	config, err := m.api.GetLKEClusterKubeconfig(ctx, id)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	// linode returns the kubeconfig base64 encoded
+	return base64.StdEncoding.DecodeString(config.KubeConfig)
+}
+
+// DeleteCluster will delete a LKE cluster and its node pools
+func (m *Manager) DeleteCluster(ctx context.Context, clusterID string) error {
+
+	id, err := strconv.Atoi(clusterID)
+	if err != nil {
+		return errors.New("invalid lke cluster id: " + clusterID)
+	}
+
+	err = m.api.DeleteLKECluster(ctx, id)
+	if err != nil {
+		return convertError(err)
+	}
+
+	log.Debug("cluster ", clusterID, " deleted")
+
+	return nil
+}
+
+// latestLKEVersion finds the newest kubernetes version lke supports
+func (m *Manager) latestLKEVersion(ctx context.Context) (string, error) {
+
+	versions, err := m.api.ListLKEVersions(ctx, nil)
+	if err != nil {
+		return "", convertError(err)
+	}
+
+	latest := ""
+	for _, version := range versions {
+		if len(latest) == 0 || isNewerVersion(version.ID, latest) {
+			latest = version.ID
+		}
+	}
+	if len(latest) == 0 {
+		return "", errors.New("linode did not return any lke versions")
+	}
+
+	return latest, nil
+}
+
+// isNewerVersion compares two dotted version numbers (ie 1.31 vs 1.30)
+func isNewerVersion(version string, than string) bool {
+
+	a := strings.Split(version, ".")
+	b := strings.Split(than, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, _ := strconv.Atoi(a[i])
+		y, _ := strconv.Atoi(b[i])
+		if x != y {
+			return x > y
+		}
+	}
+
+	return len(a) > len(b)
+}
+
+// convertNodePools converts lke node pools to our generic format
+func convertNodePools(pools []linodego.LKENodePool) []core.NodePool {
+
+	var nodePools []core.NodePool
+	for _, pool := range pools {
+		nodePools = append(nodePools, core.NodePool{
+			Name:  strconv.Itoa(pool.ID),
+			Size:  pool.Type,
+			Count: pool.Count,
+		})
+	}
+
+	return nodePools
+}
+
+// convert lke cluster info into our generic format
+func convertClusterInfoToGenericFormat(cluster linodego.LKECluster) core.ClusterInfo {
+
+	var clusterInfo core.ClusterInfo
+
+	clusterInfo.ID = strconv.Itoa(cluster.ID)
+	clusterInfo.Name = cluster.Label
+	clusterInfo.Region = cluster.Region
+	clusterInfo.Version = cluster.K8sVersion
+	clusterInfo.Tags = cluster.Tags
+	if cluster.Created != nil {
+		clusterInfo.CreatedAt = cluster.Created.UTC().Format(time.RFC3339)
+	}
+
+	// need to convert final status to standard format
+	if cluster.Status == linodego.LKEClusterReady {
+		clusterInfo.Status = "running"
+	} else {
+		clusterInfo.Status = string(cluster.Status)
+	}
+
+	return clusterInfo
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eezhee/eezhee/pkg/core"
 	"github.com/linode/linodego"
@@ -30,6 +31,15 @@ var regionIPs = []core.IPPingTime{
 	{ID: "ap-northeast", Address: "speedtest.tokyo2.linode.com"},
 }
 
+// Regions are the regions linode has (from the catalog built into eezhee)
+var Regions core.Regions = core.NewRegionCatalog("linode", regionIPs)
+
+// Sizes are the VM sizes linode has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("linode")
+
+// how long to wait for a linode to shut down or an image to be created (in seconds)
+const imageTimeout = 30 * 60
+
 // Manager handles interactions with DigitalOcean API
 type Manager struct {
 	APIToken string
@@ -66,6 +76,17 @@ func NewManager(providerAPIToken string) (core.VMManager, error) {
 	return manager, nil
 }
 
+// NewManagerWithClient creates a manager that talks to the given endpoint with the given client
+// used to point the manager at a stand-in for the linode api
+func NewManagerWithClient(endpoint string, client *http.Client) (*Manager, error) {
+
+	manager := new(Manager)
+	manager.api = linodego.NewClient(client)
+	manager.api.SetBaseURL(endpoint)
+
+	return manager, nil
+}
+
 // GetAuthToken will check common place for digitalocean api key
 func (m *Manager) FindAuthToken() string {
 
@@ -120,7 +141,7 @@ func (m *Manager) FindAuthToken() string {
 }
 
 // IsSSHKeyUploaded checks if ssh key already uploaded
-func (m *Manager) IsSSHKeyUploaded(desiredSSHKey core.SSHKey) (string, error) {
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, desiredSSHKey core.SSHKey) (string, error) {
 
 	// don't need to do anything as ssh key is added during instance creation
 
@@ -128,7 +149,7 @@ func (m *Manager) IsSSHKeyUploaded(desiredSSHKey core.SSHKey) (string, error) {
 }
 
 // UploadSSHKey uploads a given ssh key to the provider
-func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (string, error) {
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (string, error) {
 
 	// don't need to do anything as ssh key is added during instance creation
 
@@ -136,19 +157,131 @@ func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (string, erro
 }
 
 // SelectClosestRegion will check all DO regions to find the closest
-func (m *Manager) SelectClosestRegion() (closestRegion string, err error) {
-	closestRegion, err = core.GetPingTimes(regionIPs)
-	// note regionsIPs is now filled with ping times
-	return closestRegion, err
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+	return core.ClosestRegion(ctx, "linode", regionIPs)
+}
+
+// ListRegions gets all of linode's regions and the types available in each
+func (m *Manager) ListRegions(ctx context.Context) ([]core.RegionInfo, error) {
+
+	regions, err := m.api.ListRegions(ctx, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	types, err := m.api.ListTypes(ctx, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	// linode only lists the types that have limited availability
+	availability, err := m.api.ListRegionsAvailability(ctx, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	soldOut := map[string]bool{}
+	for _, plan := range availability {
+		if !plan.Available {
+			soldOut[plan.Region+"/"+plan.Plan] = true
+		}
+	}
+
+	var regionInfo []core.RegionInfo
+	for _, region := range regions {
+		var sizes []string
+		for _, linodeType := range types {
+			if !soldOut[region.ID+"/"+linodeType.ID] {
+				sizes = append(sizes, linodeType.ID)
+			}
+		}
+		regionInfo = append(regionInfo, core.RegionInfo{
+			Name:      region.Label,
+			Slug:      region.ID,
+			Available: region.Status == "ok",
+			Country:   region.Country,
+			Sizes:     sizes,
+			Features:  region.Capabilities,
+		})
+	}
+
+	return regionInfo, nil
+}
+
+// ListImages gets the current linode image for each supported os
+// ids are the distribution and version. ie linode/ubuntu24.04 or linode/debian12
+func (m *Manager) ListImages(ctx context.Context) ([]core.ImageInfo, error) {
+
+	images, err := m.api.ListImages(ctx, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var imageInfo []core.ImageInfo
+	for _, image := range images {
+		if !image.IsPublic || image.Deprecated {
+			continue
+		}
+		name := strings.TrimPrefix(image.ID, "linode/")
+		version := strings.TrimPrefix(name, strings.ToLower(image.Vendor))
+		if version == name {
+			continue
+		}
+		os, ok := core.MatchOperatingSystem(image.Vendor, version)
+		if !ok {
+			continue
+		}
+		imageInfo = append(imageInfo, core.ImageInfo{
+			Name:         image.Label,
+			Type:         image.Type,
+			Distrubution: image.Vendor,
+			Slug:         image.ID,
+			OS:           os.Name,
+			Arch:         "amd64",
+			Public:       image.IsPublic,
+			Description:  image.Description,
+			Status:       string(image.Status),
+		})
+	}
+
+	return imageInfo, nil
+}
+
+// ListSizes gets all of linode's types and their prices
+// note: some regions cost more. the price here is the base price
+func (m *Manager) ListSizes(ctx context.Context) ([]core.SizeInfo, error) {
+
+	types, err := m.api.ListTypes(ctx, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var sizeInfo []core.SizeInfo
+	for _, linodeType := range types {
+		size := core.SizeInfo{
+			Slug:      linodeType.ID,
+			Arch:      "amd64",
+			Memory:    linodeType.Memory,
+			VCPUs:     linodeType.VCPUs,
+			Disk:      linodeType.Disk / 1024, // api has it in MB
+			Available: true,
+			Transfer:  linodeType.Transfer,
+		}
+		if linodeType.Price != nil {
+			size.PriceMonthly = linodeType.Price.Monthly
+			size.PriceHourly = linodeType.Price.Hourly
+		}
+		sizeInfo = append(sizeInfo, size)
+	}
+
+	return sizeInfo, nil
 }
 
 // GetVMInfo will get details of a VM
-func (m *Manager) GetVMInfo(vmID string) (vmInfo core.VMInfo, err error) {
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
 
 	instanceID, _ := strconv.Atoi(vmID)
-	instanceInfo, err := m.api.GetInstance(context.Background(), instanceID)
+	instanceInfo, err := m.api.GetInstance(ctx, instanceID)
 	if err != nil {
-		return vmInfo, err
+		return vmInfo, convertError(err)
 	}
 
 	vmInfo, _ = convertVMInfoToGenericFormat(*instanceInfo)
@@ -157,7 +290,7 @@ func (m *Manager) GetVMInfo(vmID string) (vmInfo core.VMInfo, err error) {
 }
 
 // CreateVM will create a new VM
-func (m *Manager) CreateVM(name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
 	var vmInfo core.VMInfo
 
 	// generate a strong root password.  we will through this away
@@ -180,9 +313,9 @@ func (m *Manager) CreateVM(name string, image string, size string, region string
 
 	createOptions.AuthorizedKeys = append(createOptions.AuthorizedKeys, sshKey.GetPublicKey())
 	createOptions.Tags = append(createOptions.Tags, "eezhee")
-	newInstance, err := m.api.CreateInstance(context.Background(), createOptions)
+	newInstance, err := m.api.CreateInstance(ctx, createOptions)
 	if err != nil {
-		return vmInfo, err
+		return vmInfo, convertError(err)
 	}
 
 	// see if vm ready
@@ -206,11 +339,11 @@ func (m *Manager) CreateVM(name string, image string, size string, region string
 }
 
 // ListVMs will return a list of all VMs created by eezhee
-func (m *Manager) ListVMs() (vmInfo []core.VMInfo, err error) {
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
 
-	instances, err := m.api.ListInstances(context.Background(), nil)
+	instances, err := m.api.ListInstances(ctx, nil)
 	if err != nil {
-		return vmInfo, err
+		return vmInfo, convertError(err)
 	}
 
 	for _, instance := range instances {
@@ -243,7 +376,9 @@ func convertVMInfoToGenericFormat(instance linodego.Instance) (core.VMInfo, erro
 	vmInfo.Region = core.RegionInfo{Slug: instance.Region}
 	vmInfo.Status = string(instance.Status)
 
-	vmInfo.CreatedAt = instance.Created.String()
+	if instance.Created != nil {
+		vmInfo.CreatedAt = instance.Created.UTC().Format(time.RFC3339)
+	}
 
 	vmInfo.Image = core.ImageInfo{
 		// ID: instance.Image,   	// int vs string
@@ -259,16 +394,28 @@ func convertVMInfoToGenericFormat(instance linodego.Instance) (core.VMInfo, erro
 		V6Info: []core.V6NetworkInfo{},
 	}
 
-	v4NetworkInfo := core.V4NetworkInfo{
-		IPAddress: instance.IPv4[0].String(),
-		Type:      "public",
+	// linode lists all ipv4 addresses together (and none until the ips are assigned)
+	for _, ip := range instance.IPv4 {
+		if ip == nil {
+			continue
+		}
+		networkType := "public"
+		if ip.IsPrivate() {
+			networkType = "private"
+		}
+		vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+			IPAddress: ip.String(),
+			Type:      networkType,
+		})
 	}
-	vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, v4NetworkInfo)
 
-	v6NetworkInfo := core.V6NetworkInfo{
-		IPAddress: instance.IPv6,
+	// ipv6 is in cidr format (ie 2600:3c03::f03c:92ff:fe2a:1/128)
+	if len(instance.IPv6) > 0 {
+		vmInfo.Networks.V6Info = append(vmInfo.Networks.V6Info, core.V6NetworkInfo{
+			IPAddress: strings.Split(instance.IPv6, "/")[0],
+			Type:      "public",
+		})
 	}
-	vmInfo.Networks.V6Info = append(vmInfo.Networks.V6Info, v6NetworkInfo)
 
 	vmInfo.Tags = instance.Tags
 
@@ -276,12 +423,110 @@ func convertVMInfoToGenericFormat(instance linodego.Instance) (core.VMInfo, erro
 }
 
 // DeleteVM will delete a given VM
-func (m *Manager) DeleteVM(ID string) error {
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
 
 	instanceID, _ := strconv.Atoi(ID)
-	err := m.api.DeleteInstance(context.Background(), instanceID)
+	err := m.api.DeleteInstance(ctx, instanceID)
+	if err != nil {
+		return convertError(err)
+	}
+
+	return nil
+}
+
+// ResizeVM changes the type of a linode
+// linode shuts it down, migrates it and boots it back up.  the disk is left
+// alone so it can be resized back down
+func (m *Manager) ResizeVM(ctx context.Context, vmID string, size string) error {
+
+	instanceID, err := strconv.Atoi(vmID)
+	if err != nil {
+		return fmt.Errorf("invalid linode id: %s", vmID)
+	}
+
+	resizeDisk := false
+	err = m.api.ResizeInstance(ctx, instanceID, linodego.InstanceResizeOptions{
+		Type:                size,
+		AllowAutoDiskResize: &resizeDisk,
+	})
+	if err != nil {
+		return convertError(err)
+	}
+
+	return nil
+}
+
+// SnapshotVM shuts down a linode and starts saving its main disk as a private image
+// note: private images can be used in any region
+func (m *Manager) SnapshotVM(ctx context.Context, vmID string, name string) (core.ImageInfo, error) {
+
+	instanceID, err := strconv.Atoi(vmID)
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("invalid linode id: %s", vmID)
+	}
+
+	err = m.api.ShutdownInstance(ctx, instanceID)
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("could not shut down linode: %w", convertError(err))
+	}
+	_, err = m.api.WaitForInstanceStatus(ctx, instanceID, linodego.InstanceOffline, imageTimeout)
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("could not shut down linode: %w", convertError(err))
+	}
+
+	// linodes have a swap disk as well as the main one
+	disks, err := m.api.ListInstanceDisks(ctx, instanceID, nil)
+	if err != nil {
+		return core.ImageInfo{}, convertError(err)
+	}
+	diskID := 0
+	for _, disk := range disks {
+		if disk.Filesystem != linodego.FilesystemSwap {
+			diskID = disk.ID
+			break
+		}
+	}
+	if diskID == 0 {
+		return core.ImageInfo{}, fmt.Errorf("linode %s has no disk to image", vmID)
+	}
+
+	image, err := m.api.CreateImage(ctx, linodego.ImageCreateOptions{DiskID: diskID, Label: name})
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("could not create image: %w", convertError(err))
+	}
+
+	return convertImage(image), nil
+}
+
+// WaitForImage waits until a private image is available
+func (m *Manager) WaitForImage(ctx context.Context, imageID string) (core.ImageInfo, error) {
+
+	image, err := m.api.WaitForImageStatus(ctx, imageID, linodego.ImageStatusAvailable, imageTimeout)
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("could not create image: %w", convertError(err))
+	}
+
+	return convertImage(image), nil
+}
+
+// convertImage converts a linode image into our generic format
+func convertImage(image *linodego.Image) core.ImageInfo {
+	return core.ImageInfo{
+		Name:        image.Label,
+		Type:        image.Type,
+		Slug:        image.ID,
+		Description: image.Description,
+		Status:      string(image.Status),
+		MinDiskSize: image.Size,
+	}
+}
+
+// DeleteImage deletes a private image
+func (m *Manager) DeleteImage(ctx context.Context, imageID string) error {
+
+	err := m.api.DeleteImage(ctx, imageID)
 	if err != nil {
-		return err
+		return convertError(err)
 	}
 
 	return nil
@@ -0,0 +1,39 @@
+package linode
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/eezhee/eezhee/pkg/core/conformance"
+)
+
+func TestConformance(t *testing.T) {
+
+	server := conformance.Replay(t, []conformance.Fixture{
+		{Method: "GET", Path: "/v4/linode/instances", File: "testdata/instances.json"},
+		{Method: "GET", Path: "/v4/linode/instances/123456", File: "testdata/instance.json"},
+		{Method: "GET", Path: "/v4/linode/instances/123470", File: "testdata/instance-provisioning.json"},
+		{Method: "GET", Path: "/v4/linode/instances/999", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+		{Method: "DELETE", Path: "/v4/linode/instances/999", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+	})
+	manager, err := NewManagerWithClient(server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejecting := conformance.Unauthorized(t, "testdata/unauthorized.json")
+	unauthorized, err := NewManagerWithClient(rejecting.URL, rejecting.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conformance.Run(t, manager, unauthorized, conformance.Expect{
+		RunningID: "123456",
+		PendingID: "123470",
+		MissingID: "999",
+		Name:      "webapp-main",
+		PublicIP:  "45.79.112.34",
+		CreatedAt: "2024-03-01T12:00:00Z",
+		NumListed: 2,
+	})
+}
@@ -0,0 +1,465 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// the plugin protocol is JSON-RPC 2.0 over the plugin's stdin and stdout
+// with one message per line. stderr is passed through so plugins can log.
+//
+// methods match core.VMManager:
+//
+//	FindAuthToken        -> string
+//	ListVMs              -> []VMInfo
+//	CreateVM             {name, image, size, region, ssh_key} -> VMInfo
+//	GetVMInfo            {id} -> VMInfo
+//	DeleteVM             {id} -> null
+//	IsSSHKeyUploaded     {ssh_key} -> string (id of key)
+//	UploadSSHKey         {name, ssh_key} -> string (id of key)
+//	SelectClosestRegion  -> string
+//
+// ssh_key is {name, public_key} with the key in authorized_keys format.
+// image and size are empty if the deploy file doesn't set them, in which
+// case the plugin should use its own defaults
+//
+// errors use the codes below so eezhee knows if a call is worth retrying
+// (ie -32004 for a rate limit). any other code is treated as a plain error
+
+// error codes from the JSON-RPC spec. codes from -32000 down are left
+// for servers to define, so eezhee uses them for the kinds of errors in core
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeProviderError  = -32000 // error returned by the provider itself
+	codeAuth           = -32001
+	codeNotFound       = -32002
+	codeQuota          = -32003
+	codeRateLimited    = -32004
+	codeTransient      = -32005
+)
+
+// errorCodes maps each kind of error in core to its code
+var errorCodes = []struct {
+	kind error
+	code int
+}{
+	{core.ErrAuth, codeAuth},
+	{core.ErrNotFound, codeNotFound},
+	{core.ErrQuota, codeQuota},
+	{core.ErrRateLimited, codeRateLimited},
+	{core.ErrTransient, codeTransient},
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// SSHKeyParams is how an ssh key is sent to a plugin
+type SSHKeyParams struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"` // authorized_keys format
+}
+
+// CreateVMParams are the arguments of CreateVM
+type CreateVMParams struct {
+	Name   string       `json:"name"`
+	Image  string       `json:"image"`
+	Size   string       `json:"size"`
+	Region string       `json:"region"`
+	SSHKey SSHKeyParams `json:"ssh_key"`
+}
+
+// VMParams are the arguments of methods that work on a single VM
+type VMParams struct {
+	ID string `json:"id"`
+}
+
+// SSHKeyUploadParams are the arguments of IsSSHKeyUploaded and UploadSSHKey
+type SSHKeyUploadParams struct {
+	Name   string       `json:"name,omitempty"`
+	SSHKey SSHKeyParams `json:"ssh_key"`
+}
+
+// Plugin is a VMManager backed by an external eezhee-provider-<name> executable
+type Plugin struct {
+	name   string
+	path   string
+	mutex  sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+	nextID int
+}
+
+// NewPlugin creates a manager for the plugin at path
+// the plugin is started the first time it is used
+func NewPlugin(name string, path string) *Plugin {
+	return &Plugin{name: name, path: path}
+}
+
+// FindAuthToken asks the plugin where its credentials are
+func (p *Plugin) FindAuthToken() string {
+	var token string
+	err := p.call(context.Background(), "FindAuthToken", nil, &token)
+	if err != nil {
+		log.Debug(err)
+	}
+	return token
+}
+
+// ListVMs returns the VMs eezhee created with the plugin's cloud
+func (p *Plugin) ListVMs(ctx context.Context) ([]core.VMInfo, error) {
+	var vms []core.VMInfo
+	err := p.call(ctx, "ListVMs", nil, &vms)
+	return vms, err
+}
+
+// CreateVM asks the plugin to create a new VM
+func (p *Plugin) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+	params := CreateVMParams{
+		Name:   name,
+		Image:  image,
+		Size:   size,
+		Region: region,
+		SSHKey: toSSHKeyParams(sshKey),
+	}
+	var vmInfo core.VMInfo
+	err := p.call(ctx, "CreateVM", params, &vmInfo)
+	return vmInfo, err
+}
+
+// GetVMInfo returns details about a VM
+func (p *Plugin) GetVMInfo(ctx context.Context, vmID string) (core.VMInfo, error) {
+	var vmInfo core.VMInfo
+	err := p.call(ctx, "GetVMInfo", VMParams{ID: vmID}, &vmInfo)
+	return vmInfo, err
+}
+
+// DeleteVM asks the plugin to delete a VM
+func (p *Plugin) DeleteVM(ctx context.Context, vmID string) error {
+	return p.call(ctx, "DeleteVM", VMParams{ID: vmID}, nil)
+}
+
+// IsSSHKeyUploaded checks if the plugin's cloud already has the ssh key
+func (p *Plugin) IsSSHKeyUploaded(ctx context.Context, sshKey core.SSHKey) (string, error) {
+	var keyID string
+	err := p.call(ctx, "IsSSHKeyUploaded", SSHKeyUploadParams{SSHKey: toSSHKeyParams(sshKey)}, &keyID)
+	return keyID, err
+}
+
+// UploadSSHKey adds the ssh key to the plugin's cloud
+func (p *Plugin) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (string, error) {
+	var keyID string
+	err := p.call(ctx, "UploadSSHKey", SSHKeyUploadParams{Name: keyName, SSHKey: toSSHKeyParams(sshKey)}, &keyID)
+	return keyID, err
+}
+
+// SelectClosestRegion asks the plugin which region is closest
+func (p *Plugin) SelectClosestRegion(ctx context.Context) (string, error) {
+	var region string
+	err := p.call(ctx, "SelectClosestRegion", nil, &region)
+	return region, err
+}
+
+// Close stops the plugin process (if running)
+func (p *Plugin) Close() error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cmd == nil {
+		return nil
+	}
+
+	// plugins are expected to exit once stdin is closed
+	p.stdin.Close()
+	err := p.cmd.Wait()
+	p.cmd = nil
+
+	return err
+}
+
+// start will run the plugin executable
+func (p *Plugin) start() error {
+
+	cmd := exec.Command(p.path)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("could not start %s provider: %w", p.name, err)
+	}
+	log.Debug("started provider plugin ", p.path)
+
+	p.cmd = cmd
+	p.stdin = stdin
+	p.stdout = bufio.NewScanner(stdout)
+	p.stdout.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	return nil
+}
+
+// reset cleans up after a plugin that died (or was killed) so the next call starts it again
+// note: caller must hold the mutex
+func (p *Plugin) reset() {
+
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	err := p.cmd.Wait()
+	if err != nil {
+		log.Debug(p.name, " provider stopped: ", err)
+	}
+	p.cmd = nil
+}
+
+// call will send a request to the plugin and wait for its response
+func (p *Plugin) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cmd == nil {
+		err := p.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	p.nextID = p.nextID + 1
+	request := rpcRequest{JSONRPC: "2.0", ID: p.nextID, Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		request.Params = encoded
+	}
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	// plugins can't be told to stop part way through a call so if the
+	// context is done the process is killed. it is restarted on the next call
+	cmd := p.cmd
+	stop := context.AfterFunc(ctx, func() { cmd.Process.Kill() })
+	defer func() {
+		// the process may have been killed just as the response came in
+		if !stop() && ctx.Err() != nil && p.cmd == cmd {
+			p.reset()
+		}
+	}()
+
+	_, err = p.stdin.Write(append(line, '\n'))
+	if err != nil {
+		p.reset()
+		return fmt.Errorf("%s provider is not running: %w", p.name, err)
+	}
+
+	// skip anything that isn't the response to this request
+	for {
+		if !p.stdout.Scan() {
+			p.reset()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if p.stdout.Err() != nil {
+				return fmt.Errorf("could not read from %s provider: %w", p.name, p.stdout.Err())
+			}
+			return fmt.Errorf("%s provider exited unexpectedly", p.name)
+		}
+
+		var response rpcResponse
+		err = json.Unmarshal(p.stdout.Bytes(), &response)
+		if err != nil {
+			log.Debug("ignoring output from ", p.name, " provider: ", p.stdout.Text())
+			continue
+		}
+		if response.ID != request.ID {
+			continue
+		}
+
+		if response.Error != nil {
+			return response.Error.toError()
+		}
+		if result != nil && len(response.Result) > 0 {
+			err = json.Unmarshal(response.Result, result)
+			if err != nil {
+				return fmt.Errorf("invalid response from %s provider: %w", p.name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// toSSHKeyParams converts a key to how it is sent to plugins
+func toSSHKeyParams(sshKey core.SSHKey) SSHKeyParams {
+	return SSHKeyParams{Name: sshKey.Name, PublicKey: sshKey.GetPublicKey()}
+}
+
+// toSSHKey converts the key received from eezhee back to a core.SSHKey
+func toSSHKey(params SSHKeyParams) (core.SSHKey, error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(params.PublicKey))
+	if err != nil {
+		return core.SSHKey{}, err
+	}
+	return core.SSHKey{Name: params.Name, PublicKey: publicKey}, nil
+}
+
+// Serve runs the plugin side of the protocol, passing each request on to manager
+// plugins written in go can call this from main with os.Stdin and os.Stdout
+func Serve(manager core.VMManager, in io.Reader, out io.Writer) error {
+
+	ctx := context.Background()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	encoder := json.NewEncoder(out)
+
+	for scanner.Scan() {
+		var request rpcRequest
+		err := json.Unmarshal(scanner.Bytes(), &request)
+		if err != nil {
+			err = encoder.Encode(rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: codeParseError, Message: err.Error()}})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		response := rpcResponse{JSONRPC: "2.0", ID: request.ID}
+		result, rpcErr := dispatch(ctx, manager, request)
+		if rpcErr != nil {
+			response.Error = rpcErr
+		} else {
+			response.Result, err = json.Marshal(result)
+			if err != nil {
+				response.Error = &rpcError{Code: codeProviderError, Message: err.Error()}
+			}
+		}
+
+		err = encoder.Encode(response)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// dispatch calls the manager method named in the request
+func dispatch(ctx context.Context, manager core.VMManager, request rpcRequest) (interface{}, *rpcError) {
+
+	var result interface{}
+	var err error
+
+	switch request.Method {
+	case "FindAuthToken":
+		result = manager.FindAuthToken()
+	case "ListVMs":
+		result, err = manager.ListVMs(ctx)
+	case "CreateVM":
+		var params CreateVMParams
+		if json.Unmarshal(request.Params, &params) != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid params"}
+		}
+		sshKey, keyErr := toSSHKey(params.SSHKey)
+		if keyErr != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: keyErr.Error()}
+		}
+		result, err = manager.CreateVM(ctx, params.Name, params.Image, params.Size, params.Region, sshKey)
+	case "GetVMInfo", "DeleteVM":
+		var params VMParams
+		if json.Unmarshal(request.Params, &params) != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid params"}
+		}
+		if request.Method == "GetVMInfo" {
+			result, err = manager.GetVMInfo(ctx, params.ID)
+		} else {
+			err = manager.DeleteVM(ctx, params.ID)
+		}
+	case "IsSSHKeyUploaded", "UploadSSHKey":
+		var params SSHKeyUploadParams
+		if json.Unmarshal(request.Params, &params) != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid params"}
+		}
+		sshKey, keyErr := toSSHKey(params.SSHKey)
+		if keyErr != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: keyErr.Error()}
+		}
+		if request.Method == "IsSSHKeyUploaded" {
+			result, err = manager.IsSSHKeyUploaded(ctx, sshKey)
+		} else {
+			result, err = manager.UploadSSHKey(ctx, params.Name, sshKey)
+		}
+	case "SelectClosestRegion":
+		result, err = manager.SelectClosestRegion(ctx)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + request.Method}
+	}
+
+	if err != nil {
+		return nil, newRPCError(err)
+	}
+
+	return result, nil
+}
+
+// newRPCError converts an error from the manager into what is sent to eezhee
+func newRPCError(err error) *rpcError {
+	for _, mapping := range errorCodes {
+		if errors.Is(err, mapping.kind) {
+			return &rpcError{Code: mapping.code, Message: err.Error()}
+		}
+	}
+	return &rpcError{Code: codeProviderError, Message: err.Error()}
+}
+
+// toError converts an error sent by the plugin back into a go error
+func (e *rpcError) toError() error {
+	err := errors.New(e.Message)
+	for _, mapping := range errorCodes {
+		if e.Code == mapping.code {
+			return core.NewProviderError(mapping.kind, err)
+		}
+	}
+	return err
+}
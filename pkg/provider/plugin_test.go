@@ -0,0 +1,327 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/fake"
+	"golang.org/x/crypto/ssh"
+)
+
+// pluginEnv makes the test binary act as a plugin for the fake cloud. it is set
+// to the file the fake cloud saves its state in so it outlives a restart
+const pluginEnv = "EEZHEE_TEST_PLUGIN_STATE"
+
+// TestMain runs the plugin side when the test binary is started by a Plugin
+func TestMain(m *testing.M) {
+
+	stateFile := os.Getenv(pluginEnv)
+	if len(stateFile) == 0 {
+		os.Exit(m.Run())
+	}
+
+	failures, err := fake.ParseFailures(os.Getenv("EEZHEE_FAKE_FAIL"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cloud := fake.NewCloud(fake.Options{StateFile: stateFile, Failures: failures})
+
+	err = Serve(&testManager{VMManager: cloud}, os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// testManager is the fake cloud with a few VM ids that misbehave
+type testManager struct {
+	core.VMManager
+}
+
+// GetVMInfo hangs on 'hang' and exits part way through the call on 'crash'
+func (m *testManager) GetVMInfo(ctx context.Context, vmID string) (core.VMInfo, error) {
+
+	switch vmID {
+	case "hang":
+		select {}
+	case "crash":
+		os.Exit(3)
+	}
+	return m.VMManager.GetVMInfo(ctx, vmID)
+}
+
+// SelectClosestRegion writes some noise before its response
+func (m *testManager) SelectClosestRegion(ctx context.Context) (string, error) {
+
+	fmt.Println("looking up closest region")
+	fmt.Println(`{"jsonrpc":"2.0","id":0,"result":"stale-region"}`)
+	return m.VMManager.SelectClosestRegion(ctx)
+}
+
+// startPlugin returns a Plugin that runs the test binary as the plugin
+func startPlugin(t *testing.T) *Plugin {
+
+	t.Setenv(pluginEnv, filepath.Join(t.TempDir(), "fake-cloud.json"))
+
+	plugin := NewPlugin("test", os.Args[0])
+	t.Cleanup(func() { plugin.Close() })
+	return plugin
+}
+
+// newSSHKey creates a key to send to the plugin
+func newSSHKey(t *testing.T) core.SSHKey {
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return core.SSHKey{Name: "eezhee", PublicKey: sshPublicKey}
+}
+
+func TestPluginMethods(t *testing.T) {
+
+	plugin := startPlugin(t)
+	ctx := context.Background()
+	sshKey := newSSHKey(t)
+
+	if token := plugin.FindAuthToken(); token != "fake" {
+		t.Errorf("FindAuthToken = %q, want fake", token)
+	}
+
+	// responses with other ids (and anything that isn't json) are skipped
+	region, err := plugin.SelectClosestRegion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if region != fake.Region {
+		t.Errorf("SelectClosestRegion = %q, want %s", region, fake.Region)
+	}
+
+	keyID, err := plugin.UploadSSHKey(ctx, "eezhee", sshKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadedID, err := plugin.IsSSHKeyUploaded(ctx, sshKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != sshKey.Fingerprint() || uploadedID != keyID {
+		t.Errorf("got key ids %q and %q, want %q", keyID, uploadedID, sshKey.Fingerprint())
+	}
+
+	vmInfo, err := plugin.CreateVM(ctx, "webapp", "ubuntu-24.04", "fake-small", fake.Region, sshKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vmInfo.ID) == 0 || vmInfo.Name != "webapp" || vmInfo.SizeSlug != "fake-small" || vmInfo.Status != "new" {
+		t.Fatalf("unexpected vm %+v", vmInfo)
+	}
+
+	for i := 0; i < 2; i++ {
+		vmInfo, err = plugin.GetVMInfo(ctx, vmInfo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ip, err := vmInfo.GetPublicIP()
+	if vmInfo.Status != "running" || err != nil || ip != "127.0.0.1" {
+		t.Fatalf("expected running vm with an ip, got %+v", vmInfo)
+	}
+
+	vms, err := plugin.ListVMs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 1 || vms[0].ID != vmInfo.ID {
+		t.Fatalf("expected %s to be listed, got %+v", vmInfo.ID, vms)
+	}
+
+	err = plugin.DeleteVM(ctx, vmInfo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = plugin.GetVMInfo(ctx, vmInfo.ID)
+	if !errors.Is(err, core.ErrNotFound) {
+		t.Fatal("expected not found error, got ", err)
+	}
+
+	// plugins exit once stdin is closed
+	err = plugin.Close()
+	if err != nil {
+		t.Fatal("expected plugin to exit cleanly, got ", err)
+	}
+}
+
+func TestPluginErrors(t *testing.T) {
+
+	t.Setenv("EEZHEE_FAKE_FAIL", "CreateVM=quota,DeleteVM=not-found,ListVMs=auth,SelectClosestRegion=rate-limited,UploadSSHKey=transient,IsSSHKeyUploaded")
+	plugin := startPlugin(t)
+	ctx := context.Background()
+	sshKey := newSSHKey(t)
+
+	tests := []struct {
+		method string
+		call   func() error
+		kind   error
+	}{
+		{"CreateVM", func() error {
+			_, err := plugin.CreateVM(ctx, "webapp", "", "", fake.Region, sshKey)
+			return err
+		}, core.ErrQuota},
+		{"DeleteVM", func() error { return plugin.DeleteVM(ctx, "1001") }, core.ErrNotFound},
+		{"ListVMs", func() error {
+			_, err := plugin.ListVMs(ctx)
+			return err
+		}, core.ErrAuth},
+		{"SelectClosestRegion", func() error {
+			_, err := plugin.SelectClosestRegion(ctx)
+			return err
+		}, core.ErrRateLimited},
+		{"UploadSSHKey", func() error {
+			_, err := plugin.UploadSSHKey(ctx, "eezhee", sshKey)
+			return err
+		}, core.ErrTransient},
+		{"IsSSHKeyUploaded", func() error {
+			_, err := plugin.IsSSHKeyUploaded(ctx, sshKey)
+			return err
+		}, nil},
+	}
+
+	kinds := []error{core.ErrAuth, core.ErrNotFound, core.ErrQuota, core.ErrRateLimited, core.ErrTransient}
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			err := test.call()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), "fake cloud: "+test.method+" failed") {
+				t.Errorf("expected the plugin's message, got %q", err)
+			}
+			for _, kind := range kinds {
+				if errors.Is(err, kind) != (kind == test.kind) {
+					t.Errorf("errors.Is(%q, %v) = %v", err, kind, errors.Is(err, kind))
+				}
+			}
+		})
+	}
+}
+
+func TestPluginContextDone(t *testing.T) {
+
+	plugin := startPlugin(t)
+
+	_, err := plugin.ListVMs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstPID := plugin.cmd.Process.Pid
+
+	// the plugin can't be told to stop so it is killed
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = plugin.GetVMInfo(ctx, "hang")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded, got ", err)
+	}
+	if plugin.cmd != nil {
+		t.Fatal("expected killed plugin to be cleaned up")
+	}
+
+	// and started again on the next call
+	region, err := plugin.SelectClosestRegion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if region != fake.Region {
+		t.Errorf("SelectClosestRegion = %q, want %s", region, fake.Region)
+	}
+	if plugin.cmd == nil || plugin.cmd.Process.Pid == firstPID {
+		t.Fatal("expected a new plugin process")
+	}
+}
+
+func TestPluginRestartsAfterExit(t *testing.T) {
+
+	plugin := startPlugin(t)
+	ctx := context.Background()
+
+	vmInfo, err := plugin.CreateVM(ctx, "webapp", "", "", fake.Region, newSSHKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the plugin exits before it responds
+	_, err = plugin.GetVMInfo(ctx, "crash")
+	if err == nil || !strings.Contains(err.Error(), "exited unexpectedly") {
+		t.Fatal("expected exited unexpectedly error, got ", err)
+	}
+	if plugin.cmd != nil {
+		t.Fatal("expected dead plugin to be cleaned up")
+	}
+
+	// the next call starts it again
+	vms, err := plugin.ListVMs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 1 || vms[0].ID != vmInfo.ID {
+		t.Fatalf("expected %s to be listed, got %+v", vmInfo.ID, vms)
+	}
+}
+
+func TestServeInvalidRequests(t *testing.T) {
+
+	sshKey := newSSHKey(t)
+	validKey, err := json.Marshal(CreateVMParams{Name: "webapp", Region: fake.Region, SSHKey: toSSHKeyParams(sshKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		code    int
+	}{
+		{"not json", `not json`, codeParseError},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"ResizeVM"}`, codeMethodNotFound},
+		{"invalid params", `{"jsonrpc":"2.0","id":1,"method":"GetVMInfo","params":"1001"}`, codeInvalidParams},
+		{"invalid ssh key", `{"jsonrpc":"2.0","id":1,"method":"UploadSSHKey","params":{"ssh_key":{"public_key":"not a key"}}}`, codeInvalidParams},
+		{"provider error", `{"jsonrpc":"2.0","id":1,"method":"CreateVM","params":` + strings.Replace(string(validKey), fake.Region, "nowhere", 1) + `}`, codeProviderError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Serve(fake.NewCloud(fake.Options{}), strings.NewReader(test.request+"\n"), &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var response rpcResponse
+			err = json.Unmarshal(out.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Error == nil || response.Error.Code != test.code {
+				t.Fatalf("expected error code %d, got %s", test.code, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/eezhee/eezhee/pkg/config"
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/k3s"
+)
+
+// PluginPrefix is the start of the name of external provider executables
+// ie the openstack provider would be eezhee-provider-openstack
+const PluginPrefix = "eezhee-provider-"
+
+// Provider has everything eezhee needs to know to deploy to a cloud
+type Provider struct {
+	Name string
+
+	// New creates a manager using the credentials in the app config
+	New func(appConfig *config.AppConfig) (core.VMManager, error)
+
+	// SetCredentials stores the api key (or profile, credentials file...) in the app config
+	// nil if credentials are not set with 'eezhee clouds' (ie ssh or plugins)
+	SetCredentials func(appConfig *config.AppConfig, credentials string)
+
+	// Regions has the cloud's regions so generic regions (ie us-east) can be translated
+	// nil if the cloud's regions are not in the catalog (ie ssh or plugins)
+	Regions core.Regions
+
+	// Sizes has the cloud's VM sizes so generic sizes (ie 2cpu4gb) can be translated
+	// nil if the cloud's sizes are not in the catalog
+	Sizes core.VMSizes
+
+	// Releases has a fixed list of k3s releases for clouds that are used offline (ie the fake cloud)
+	// nil if releases are looked up on github
+	Releases func() k3s.ReleaseInfo
+
+	DefaultSize     string // size of VM if deploy file doesn't specify one
+	DefaultImage    string // os VMs are created with if deploy file doesn't specify one (ie ubuntu-24.04)
+	DefaultNodeSize string // size of worker nodes in a managed cluster (if supported)
+	Hidden          bool   // not included when listing clouds (ie the fake cloud)
+	Plugin          bool   // external executable rather than built into eezhee
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]Provider{}
+	plugins       = map[string]*Plugin{}
+)
+
+// Register adds a provider to the registry
+// it panics if a provider with the same name has already been registered
+func Register(provider Provider) {
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if len(provider.Name) == 0 || provider.New == nil {
+		panic("provider: name and constructor are required")
+	}
+	if _, found := registry[provider.Name]; found {
+		panic("provider: " + provider.Name + " registered twice")
+	}
+	registry[provider.Name] = provider
+}
+
+// Get returns the provider for the given cloud
+// built in providers are used first, then an eezhee-provider-<name> executable on the PATH
+func Get(name string) (Provider, error) {
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	provider, found := registry[name]
+	if found {
+		return provider, nil
+	}
+
+	// name ends up in a file path so don't let it escape the PATH
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) {
+		return Provider{}, errors.New("invalid cloud type")
+	}
+
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return Provider{}, fmt.Errorf("invalid cloud type. no provider named %s", name)
+	}
+
+	// all callers share one plugin process
+	plugin, found := plugins[name]
+	if !found {
+		plugin = NewPlugin(name, path)
+		plugins[name] = plugin
+	}
+
+	provider = Provider{
+		Name: name,
+		New: func(appConfig *config.AppConfig) (core.VMManager, error) {
+			return plugin, nil
+		},
+		Plugin: true,
+	}
+
+	return provider, nil
+}
+
+// List returns the name of all visible providers, built in and plugins, sorted by name
+func List() []string {
+
+	registryMutex.Lock()
+	var names []string
+	for name, provider := range registry {
+		if !provider.Hidden {
+			names = append(names, name)
+		}
+	}
+	registryMutex.Unlock()
+
+	for _, name := range findPlugins() {
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// findPlugins will look for provider executables in every directory of the PATH
+func findPlugins() []string {
+
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, PluginPrefix+"*"))
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+				continue
+			}
+			name := strings.TrimPrefix(filepath.Base(match), PluginPrefix)
+			if len(name) > 0 && !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// Close will stop any plugin processes that have been started
+func Close() {
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, plugin := range plugins {
+		plugin.Close()
+	}
+}
+
+// contains checks if a list of strings has the given value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
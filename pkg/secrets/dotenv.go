@@ -0,0 +1,125 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readEnvFile will load a dotenv file
+func readEnvFile(filename string) (map[string]string, error) {
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEnv(content)
+}
+
+// parseEnv handles the common dotenv format
+//
+//	# comment
+//	export KEY=value
+//	KEY="value with \n escapes"
+//	KEY='literal value'
+func parseEnv(content []byte) (map[string]string, error) {
+
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d is not in KEY=value format", lineNumber)
+		}
+		key := strings.TrimSpace(parts[0])
+		if !validKey(key) {
+			return nil, fmt.Errorf("line %d has an invalid key", lineNumber)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// parseEnvValue will remove quotes and (for double quotes) expand escapes
+func parseEnvValue(value string) (string, error) {
+
+	if len(value) == 0 {
+		return "", nil
+	}
+
+	switch value[0] {
+	case '\'':
+		// single quoted values are taken as is, up to the first closing quote
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("missing closing quote")
+		}
+		end++
+		if err := checkAfterQuote(value[end+1:]); err != nil {
+			return "", err
+		}
+		return value[1:end], nil
+
+	case '"':
+		// find the closing quote, skipping escaped ones
+		end := -1
+		for i := 1; i < len(value); i++ {
+			if value[i] == '\\' {
+				i++
+				continue
+			}
+			if value[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf("missing closing quote")
+		}
+		if err := checkAfterQuote(value[end+1:]); err != nil {
+			return "", err
+		}
+		replacer := strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+		return replacer.Replace(value[1:end]), nil
+	}
+
+	// unquoted values can have a trailing comment
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+
+	return value, nil
+}
+
+// checkAfterQuote makes sure there is only a comment (if anything) after a quoted value
+func checkAfterQuote(rest string) error {
+
+	rest = strings.TrimSpace(rest)
+	if len(rest) > 0 && rest[0] != '#' {
+		return fmt.Errorf("unexpected text after closing quote: %s", rest)
+	}
+
+	return nil
+}
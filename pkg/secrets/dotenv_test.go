@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{"plain", "KEY=value", map[string]string{"KEY": "value"}},
+		{"empty value", "KEY=", map[string]string{"KEY": ""}},
+		{"spaces around", "  KEY = value  ", map[string]string{"KEY": "value"}},
+		{"value with equals", "URL=postgres://db?sslmode=disable", map[string]string{"URL": "postgres://db?sslmode=disable"}},
+		{"export", "export KEY=value", map[string]string{"KEY": "value"}},
+		{"comment lines", "# comment\n\nKEY=value\n  # indented comment", map[string]string{"KEY": "value"}},
+		{"trailing comment", "KEY=value # comment", map[string]string{"KEY": "value"}},
+		{"hash in value", "KEY=abc#def", map[string]string{"KEY": "abc#def"}},
+		{"single quotes", `KEY='a \n b # c'`, map[string]string{"KEY": `a \n b # c`}},
+		{"single quotes then comment", `KEY='value' # comment`, map[string]string{"KEY": "value"}},
+		{"double quotes", `KEY="value # not a comment"`, map[string]string{"KEY": "value # not a comment"}},
+		{"escapes", `KEY="line1\nline2\ttab\\slash"`, map[string]string{"KEY": "line1\nline2\ttab\\slash"}},
+		{"escaped quote", `KEY="say \"hi\""`, map[string]string{"KEY": `say "hi"`}},
+		{"stops at first closing quote", `A="one" # "two"`, map[string]string{"A": "one"}},
+		{"several", "A=1\nexport B='2'\nC=\"3\"", map[string]string{"A": "1", "B": "2", "C": "3"}},
+		{"windows line endings", "A=1\r\nB=2\r\n", map[string]string{"A": "1", "B": "2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := parseEnv([]byte(test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(values) != len(test.want) {
+				t.Fatalf("got %q, want %q", values, test.want)
+			}
+			for key, value := range test.want {
+				if values[key] != value {
+					t.Errorf("%s = %q, want %q", key, values[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEnvErrors(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no equals", "KEY"},
+		{"invalid key", "MY KEY=value"},
+		{"empty key", "=value"},
+		{"unclosed single quote", "KEY='value"},
+		{"unclosed double quote", `KEY="value`},
+		{"escaped closing quote", `KEY="value\"`},
+		{"text after quote", `KEY="value" extra`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseEnv([]byte(test.content))
+			if err == nil {
+				t.Errorf("expected an error for %q", test.content)
+			}
+		})
+	}
+}
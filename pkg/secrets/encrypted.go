@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// decryptSOPSFile uses the sops cli so every key type sops supports (age, pgp, kms) works
+// note: decrypted output is read from stdout so it never touches the disk
+func decryptSOPSFile(filename string) (map[string]string, error) {
+
+	if _, err := exec.LookPath("sops"); err != nil {
+		return nil, errors.New("sops is not installed. see https://github.com/getsops/sops")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sops", "--decrypt", "--output-type", "json", filename)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("sops could not decrypt file: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var values map[string]interface{}
+	err = json.Unmarshal(stdout.Bytes(), &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return flatten(values)
+}
+
+// decryptAgeFile will decrypt a dotenv or yaml file that was encrypted with age
+// looks for identities in the same places sops does
+func decryptAgeFile(filename string) (map[string]string, error) {
+
+	identities, err := loadAgeIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := age.Decrypt(file, identities...)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// file type is the extension before '.age'. ie secrets.yaml.age
+	switch filepath.Ext(strings.TrimSuffix(filename, ".age")) {
+	case ".yaml", ".yml", ".json":
+		var values map[string]interface{}
+		err = yaml.Unmarshal(content, &values)
+		if err != nil {
+			return nil, err
+		}
+		return flatten(values)
+	}
+
+	return parseEnv(content)
+}
+
+// loadAgeIdentities from SOPS_AGE_KEY, SOPS_AGE_KEY_FILE or the sops default key file
+func loadAgeIdentities() ([]age.Identity, error) {
+
+	if key := os.Getenv("SOPS_AGE_KEY"); len(key) > 0 {
+		return age.ParseIdentities(strings.NewReader(key))
+	}
+
+	keyFile := os.Getenv("SOPS_AGE_KEY_FILE")
+	if len(keyFile) == 0 {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		keyFile = filepath.Join(configDir, "sops", "age", "keys.txt")
+	}
+
+	file, err := os.Open(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("no age key found. set SOPS_AGE_KEY_FILE: %w", err)
+	}
+	defer file.Close()
+
+	return age.ParseIdentities(file)
+}
+
+// flatten turns decrypted values into secret keys
+// nested values are stored as json so apps can still parse them
+func flatten(values map[string]interface{}) (map[string]string, error) {
+
+	data := make(map[string]string)
+	for key, value := range values {
+
+		if !validKey(key) {
+			return nil, fmt.Errorf("%s is not a valid secret key", key)
+		}
+
+		switch v := value.(type) {
+		case string:
+			data[key] = v
+		case bool:
+			data[key] = strconv.FormatBool(v)
+		case int:
+			data[key] = strconv.Itoa(v)
+		case float64:
+			data[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+			data[key] = ""
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode %s: %w", key, err)
+			}
+			data[key] = string(encoded)
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,158 @@
+package secrets
+
+// code to turn app config (dotenv files, SOPS or age encrypted files) into kubernetes secrets
+// note: decrypted values are only ever held in memory. they are never written to disk
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HashAnnotation is set on a secret (and on pods using it) so changes trigger a restart
+const HashAnnotation = "eezhee.io/secret-hash"
+
+// Source has details of where the values for a secret come from
+type Source struct {
+	Name        string   // name of kubernetes secret
+	Namespace   string   // defaults to 'default'
+	EnvFile     string   // plaintext dotenv file
+	SOPSFile    string   // file encrypted with sops
+	AgeFile     string   // dotenv or yaml file encrypted with age
+	Deployments []string // deployments to restart when secret changes
+	HashKey     []byte   // key the hash of the values is made with (see NewHashKey)
+}
+
+// Secret has the (decrypted) contents of a secret
+type Secret struct {
+	Name        string
+	Namespace   string
+	Data        map[string]string
+	Deployments []string // deployments to restart when secret changes
+	HashKey     []byte
+}
+
+// NewHashKey creates a random key for hashing secret values
+// one is kept per cluster so the hash stays the same between applies
+func NewHashKey() ([]byte, error) {
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Load will read and decrypt the values for a secret
+func Load(source Source) (*Secret, error) {
+
+	if len(source.Name) == 0 {
+		return nil, errors.New("secret does not have a name")
+	}
+	if len(source.HashKey) == 0 {
+		return nil, fmt.Errorf("secret %s does not have a hash key", source.Name)
+	}
+
+	secret := &Secret{Name: source.Name, Namespace: source.Namespace, Deployments: source.Deployments, HashKey: source.HashKey}
+	if len(secret.Namespace) == 0 {
+		secret.Namespace = "default"
+	}
+
+	var err error
+	switch {
+	case len(source.EnvFile) > 0:
+		secret.Data, err = readEnvFile(source.EnvFile)
+	case len(source.SOPSFile) > 0:
+		secret.Data, err = decryptSOPSFile(source.SOPSFile)
+	case len(source.AgeFile) > 0:
+		secret.Data, err = decryptAgeFile(source.AgeFile)
+	default:
+		return nil, fmt.Errorf("secret %s needs an env-file, sops-file or age-file", source.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load secret %s: %w", source.Name, err)
+	}
+
+	return secret, nil
+}
+
+// Hash of the secret values. changes whenever a key or value changes
+// note: it ends up on the deployment's pods where more people can see it than can see the
+// secret so it is an hmac. without the key, it can't be used to guess the values
+func (s *Secret) Hash() string {
+
+	keys := make([]string, 0, len(s.Data))
+	for key := range s.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := hmac.New(sha256.New, s.HashKey)
+	for _, key := range keys {
+		// length prefix so 'a=bc' and 'ab=c' hash differently
+		fmt.Fprintf(hash, "%d:%s%d:%s", len(key), key, len(s.Data[key]), s.Data[key])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[0:16]
+}
+
+// Manifest will generate the kubernetes objects for the secret (as json)
+func (s *Secret) Manifest() (string, error) {
+
+	data := make(map[string]string)
+	for key, value := range s.Data {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata": map[string]interface{}{
+			"name":        s.Name,
+			"namespace":   s.Namespace,
+			"labels":      map[string]string{"app.kubernetes.io/managed-by": "eezhee"},
+			"annotations": map[string]string{HashAnnotation: s.Hash()},
+		},
+		"data": data,
+	}
+
+	var manifest bytes.Buffer
+	encoder := json.NewEncoder(&manifest)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return manifest.String(), nil
+}
+
+// RestartPatch is the patch that sets the secret's hash on a deployment's pods
+// as it changes the pod template, kubernetes will roll the deployment if the hash changed
+func (s *Secret) RestartPatch() string {
+
+	annotation := HashAnnotation + "-" + s.Name
+	return fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"%s":"%s"}}}}}`, annotation, s.Hash())
+}
+
+// valid key for a kubernetes secret
+func validKey(key string) bool {
+
+	if len(key) == 0 {
+		return false
+	}
+	return strings.IndexFunc(key, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) < 0
+}
@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	secret := &Secret{Name: "app", Data: map[string]string{"PASSWORD": "hunter2"}, HashKey: key}
+	hash := secret.Hash()
+
+	same := &Secret{Name: "app", Data: map[string]string{"PASSWORD": "hunter2"}, HashKey: key}
+	if same.Hash() != hash {
+		t.Error("expected the same values to have the same hash")
+	}
+
+	changed := &Secret{Name: "app", Data: map[string]string{"PASSWORD": "hunter3"}, HashKey: key}
+	if changed.Hash() == hash {
+		t.Error("expected a changed value to change the hash")
+	}
+
+	// without the key the hash can't be recreated
+	otherKey := &Secret{Name: "app", Data: map[string]string{"PASSWORD": "hunter2"}, HashKey: []byte("another key")}
+	if otherKey.Hash() == hash {
+		t.Error("expected the hash to depend on the key")
+	}
+
+	// keys and values can't be shifted into each other
+	shifted := &Secret{Data: map[string]string{"a": "bc"}, HashKey: key}
+	if shifted.Hash() == (&Secret{Data: map[string]string{"ab": "c"}, HashKey: key}).Hash() {
+		t.Error("expected a=bc and ab=c to hash differently")
+	}
+}
+
+func TestLoadNeedsHashKey(t *testing.T) {
+
+	envFile := filepath.Join(t.TempDir(), "app.env")
+	err := os.WriteFile(envFile, []byte("PASSWORD=hunter2\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Load(Source{Name: "app", EnvFile: envFile})
+	if err == nil {
+		t.Fatal("expected secret without a hash key to be rejected")
+	}
+
+	secret, err := Load(Source{Name: "app", EnvFile: envFile, HashKey: []byte("key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Namespace != "default" || secret.Data["PASSWORD"] != "hunter2" {
+		t.Fatalf("unexpected secret %+v", secret)
+	}
+}
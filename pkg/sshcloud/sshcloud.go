@@ -0,0 +1,265 @@
+package sshcloud
+
+// the ssh cloud lets eezhee build clusters on servers the user already has
+// (ie a home lab or bare metal boxes). there is no api, the servers are listed
+// in deploy.yaml and everything is done over ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/k3s"
+	log "github.com/sirupsen/logrus"
+)
+
+// Region is reported for all servers as there is no way to tell where they are
+const Region = "on-prem"
+
+const dialTimeout = 3 * time.Second // how long to wait when checking if server is up
+
+// k3s installs these when it sets up a server or agent
+const (
+	serverUninstallScript = "/usr/local/bin/k3s-uninstall.sh"
+	agentUninstallScript  = "/usr/local/bin/k3s-agent-uninstall.sh"
+)
+
+// Server is a machine in the inventory
+type Server struct {
+	Host    string // ip address (or hostname) to ssh to
+	User    string // defaults to root. other users need passwordless sudo
+	Port    int    // defaults to 22
+	KeyFile string // private key. defaults to ~/.ssh/id_rsa
+}
+
+// Manager handles the servers in the inventory
+type Manager struct {
+	Servers []Server
+}
+
+// NewManager creates a manager for the given servers
+func NewManager(servers []Server) (core.VMManager, error) {
+
+	manager := new(Manager)
+
+	if len(servers) == 0 {
+		return manager, errors.New("no servers listed in deploy file")
+	}
+
+	for i := range servers {
+		if len(servers[i].Host) == 0 {
+			return manager, fmt.Errorf("server %d in deploy file has no host", i+1)
+		}
+		if servers[i].Port == 0 {
+			servers[i].Port = 22
+		}
+	}
+	SetLogins(servers)
+	manager.Servers = servers
+
+	return manager, nil
+}
+
+// SetLogins lets the k3s package know how to log into each server
+// needed before connecting to a server, even if there is no manager (ie for a cluster that is already built)
+func SetLogins(servers []Server) {
+
+	for _, server := range servers {
+		k3s.SetLogin(server.Host, k3s.Login{
+			User:    server.User,
+			Port:    server.Port,
+			KeyFile: server.KeyFile,
+		})
+	}
+}
+
+// FindAuthToken is not needed as there is no api
+func (m *Manager) FindAuthToken() string {
+	return ""
+}
+
+// IsSSHKeyUploaded always succeeds as the key in the inventory is used to log in
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, sshKey core.SSHKey) (string, error) {
+	return sshKey.Fingerprint(), nil
+}
+
+// UploadSSHKey does nothing as keys need to be on the servers already
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (string, error) {
+	return sshKey.Fingerprint(), nil
+}
+
+// SelectClosestRegion returns the only region there is
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+	return Region, nil
+}
+
+// GetVMInfo will get details of a server in the inventory
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
+
+	server, err := m.findServer(vmID)
+	if err != nil {
+		return vmInfo, err
+	}
+
+	return convertVMInfoToGenericFormat(server, isReachable(ctx, server)), nil
+}
+
+// CreateVM picks the first server that does not have k3s on it yet
+// nothing is created, the server just needs to be reachable (and root or sudo to work)
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+	var vmInfo core.VMInfo
+
+	for _, server := range m.Servers {
+
+		if ctx.Err() != nil {
+			return vmInfo, ctx.Err()
+		}
+		if !isReachable(ctx, server) {
+			log.Warn("server ", server.Host, " is not reachable")
+			continue
+		}
+
+		available, err := isAvailable(ctx, server)
+		if err != nil {
+			if ctx.Err() != nil {
+				return vmInfo, ctx.Err()
+			}
+			log.Warn(err)
+			continue
+		}
+		if !available {
+			log.Debug("k3s already installed on ", server.Host)
+			continue
+		}
+
+		vmInfo = convertVMInfoToGenericFormat(server, true)
+		vmInfo.Name = name
+		return vmInfo, nil
+	}
+
+	return vmInfo, errors.New("no server in deploy file is available for a new cluster")
+}
+
+// ListVMs will return all servers in the inventory
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
+
+	for _, server := range m.Servers {
+		vmInfo = append(vmInfo, convertVMInfoToGenericFormat(server, isReachable(ctx, server)))
+	}
+
+	return vmInfo, nil
+}
+
+// DeleteVM will uninstall k3s from a server (the server itself is left running)
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
+
+	server, err := m.findServer(ID)
+	if err != nil {
+		return err
+	}
+
+	conn, err := k3s.ConnectContext(ctx, server.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	uninstallCommand := fmt.Sprintf("if [ -x %[1]s ]; then %[1]s; elif [ -x %[2]s ]; then %[2]s; fi",
+		serverUninstallScript, agentUninstallScript)
+	output, err := k3s.RunCommand(conn, uninstallCommand)
+	if err != nil {
+		log.Debug(output)
+		return fmt.Errorf("could not uninstall k3s from %s: %w", server.Host, err)
+	}
+
+	return nil
+}
+
+// findServer looks up a server by its host
+func (m *Manager) findServer(host string) (Server, error) {
+	for _, server := range m.Servers {
+		if server.Host == host {
+			return server, nil
+		}
+	}
+	return Server{}, fmt.Errorf("server %s is not in deploy file: %w", host, core.ErrNotFound)
+}
+
+// isReachable checks if the ssh port of a server is open
+func isReachable(ctx context.Context, server Server) bool {
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	address := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// isAvailable checks if a server can be used for a new cluster
+// commands need to run as root (ie sudo doesn't need a password) and k3s can't already be installed
+func isAvailable(ctx context.Context, server Server) (bool, error) {
+
+	conn, err := k3s.ConnectContext(ctx, server.Host)
+	if err != nil {
+		return false, fmt.Errorf("could not ssh into %s: %w", server.Host, err)
+	}
+	defer conn.Close()
+
+	// commands can't be cancelled so drop the connection instead
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	_, err = k3s.StreamCommand(conn, "true", nil)
+	if err != nil {
+		return false, fmt.Errorf("could not run commands as root on %s: %w", server.Host, err)
+	}
+
+	// skip servers that are already part of a cluster
+	_, err = k3s.StreamCommand(conn, "test ! -e /usr/local/bin/k3s", nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// convert a server in the inventory to our generic format
+func convertVMInfoToGenericFormat(server Server, reachable bool) core.VMInfo {
+
+	var vmInfo core.VMInfo
+
+	vmInfo.ID = server.Host
+	vmInfo.Name = server.Host
+	vmInfo.Status = "unreachable"
+	if reachable {
+		vmInfo.Status = "running"
+	}
+	vmInfo.Region = core.RegionInfo{Slug: Region}
+
+	vmInfo.Networks = core.NetworkInfo{
+		V4Info: []core.V4NetworkInfo{},
+		V6Info: []core.V6NetworkInfo{},
+	}
+	// the host is used as the address of the cluster (even if it is a hostname)
+	// so the ssh login for it can be looked up later
+	vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+		IPAddress: server.Host,
+		Type:      "public",
+	})
+
+	vmInfo.Tags = []string{"eezhee"}
+
+	return vmInfo
+}
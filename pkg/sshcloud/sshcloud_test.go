@@ -0,0 +1,209 @@
+package sshcloud_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	"github.com/eezhee/eezhee/pkg/fake"
+	"github.com/eezhee/eezhee/pkg/k3s"
+	"github.com/eezhee/eezhee/pkg/sshcloud"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestServers starts a local sshd and returns an inventory with an unreachable
+// server followed by the local one
+func newTestServers(t *testing.T) (*fake.SSHServer, []sshcloud.Server) {
+
+	sshd, err := fake.StartSSHServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sshd.Close() })
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a port nothing is listening on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	return sshd, []sshcloud.Server{
+		{Host: "localhost", Port: closedPort, KeyFile: keyFile},
+		{Host: "127.0.0.1", User: "eezhee", Port: sshd.Port(), KeyFile: keyFile},
+	}
+}
+
+func TestCreateAndDelete(t *testing.T) {
+
+	ctx := context.Background()
+	sshd, servers := newTestServers(t)
+	manager, err := sshcloud.NewManager(servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vms, err := manager.ListVMs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 2 || vms[0].Status != "unreachable" || vms[1].Status != "running" {
+		t.Fatalf("expected an unreachable and a running server, got %+v", vms)
+	}
+
+	// the unreachable server is skipped
+	vmInfo, err := manager.CreateVM(ctx, "test", "", "", sshcloud.Region, core.SSHKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vmInfo.ID != "127.0.0.1" || vmInfo.Name != "test" {
+		t.Fatalf("expected local server to be picked, got %+v", vmInfo)
+	}
+
+	// servers with k3s on them aren't used again
+	conn, err := k3s.Connect(vmInfo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = k3s.RunCommand(conn, "curl -sfL https://get.k3s.io | sh -")
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = manager.CreateVM(ctx, "test", "", "", sshcloud.Region, core.SSHKey{})
+	if err == nil {
+		t.Fatal("expected no server to be available")
+	}
+
+	err = manager.DeleteVM(ctx, vmInfo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sshd.Installed() {
+		t.Fatal("expected k3s to be uninstalled")
+	}
+	_, err = manager.CreateVM(ctx, "test", "", "", sshcloud.Region, core.SSHKey{})
+	if err != nil {
+		t.Fatal("expected server to be available after delete: ", err)
+	}
+
+	_, err = manager.GetVMInfo(ctx, "10.0.0.1")
+	if !errors.Is(err, core.ErrNotFound) {
+		t.Fatal("expected not found for a server that isn't in the inventory, got ", err)
+	}
+}
+
+func TestCreateCancelled(t *testing.T) {
+
+	_, servers := newTestServers(t)
+	manager, err := sshcloud.NewManager(servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = manager.CreateVM(ctx, "test", "", "", sshcloud.Region, core.SSHKey{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("expected create to be cancelled, got ", err)
+	}
+}
+
+func TestSetLogins(t *testing.T) {
+
+	_, servers := newTestServers(t)
+
+	// a cluster that is already built is connected to without a manager
+	// note: the sshd isn't on port 22 so this only works if the login was set
+	sshcloud.SetLogins(servers[1:])
+	conn, err := k3s.Connect(servers[1].Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestNonRootLogin(t *testing.T) {
+
+	ctx := context.Background()
+	sshd, servers := newTestServers(t)
+
+	// non-root logins run everything with sudo as the installers need root
+	manager, err := sshcloud.NewManager(servers[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmInfo, err := manager.CreateVM(ctx, "test", "", "", sshcloud.Region, core.SSHKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := k3s.Connect(vmInfo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = k3s.RunCommand(conn, "echo 'it''s' > /etc/motd")
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`sudo -n sh -c 'true'`,
+		`sudo -n sh -c 'test ! -e /usr/local/bin/k3s'`,
+		`sudo -n sh -c 'echo '\''it'\'''\''s'\'' > /etc/motd'`,
+	}
+	commands := sshd.Commands()
+	if len(commands) != len(want) {
+		t.Fatalf("expected %d commands, got %q", len(want), commands)
+	}
+	for i := range want {
+		if commands[i] != want[i] {
+			t.Errorf("command %d is %q, want %q", i, commands[i], want[i])
+		}
+	}
+}
+
+func TestRootLogin(t *testing.T) {
+
+	ctx := context.Background()
+	sshd, servers := newTestServers(t)
+
+	server := servers[1]
+	server.User = "root"
+	manager, err := sshcloud.NewManager([]sshcloud.Server{server})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = manager.CreateVM(ctx, "test", "", "", sshcloud.Region, core.SSHKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// root doesn't need sudo
+	commands := sshd.Commands()
+	if len(commands) != 2 || commands[0] != "true" || commands[1] != "test ! -e /usr/local/bin/k3s" {
+		t.Fatalf("expected commands to be run as is, got %q", commands)
+	}
+}
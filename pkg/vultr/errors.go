@@ -0,0 +1,54 @@
+package vultr
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/eezhee/eezhee/pkg/core"
+)
+
+// vultr api errors look like {"error":"Invalid API token.","status":401}
+type apiError struct {
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+// convertError maps govultr errors to the kinds of errors in core
+// note: govultr only gives us the body of the response so the status comes from there
+func convertError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+
+	// govultr retries rate limits and server errors itself before giving up
+	gaveUp := strings.HasPrefix(message, "gave up after")
+	if gaveUp {
+		_, body, found := strings.Cut(message, "last error: ")
+		if !found {
+			return core.NewProviderError(core.ErrTransient, err)
+		}
+		unquoted, unquoteErr := strconv.Unquote(body)
+		if unquoteErr == nil {
+			body = unquoted
+		}
+		message = body
+	}
+
+	var response apiError
+	if json.Unmarshal([]byte(message), &response) != nil || response.Status == 0 {
+		if gaveUp {
+			return core.NewProviderError(core.ErrTransient, err)
+		}
+		return core.ErrorFromResponse(nil, err)
+	}
+
+	kind := core.KindFromStatus(response.Status, response.Error)
+	if kind == nil {
+		return err
+	}
+
+	return core.NewProviderError(kind, err)
+}
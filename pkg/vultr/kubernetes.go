@@ -0,0 +1,183 @@
+package vultr
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/eezhee/eezhee/pkg/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/vultr/govultr/v2"
+)
+
+// vke clusters can't be tagged, so their node pools are
+// note: pool tags end up on the nodes so 'eezhee' is not used (or they would show up as k3s VMs)
+const clusterTag = "eezhee-managed"
+
+// CreateCluster will create a Vultr Kubernetes Engine (VKE) cluster
+// version can be 'latest', a kubernetes minor version (ie v1.31) or an exact vke version
+func (m *Manager) CreateCluster(ctx context.Context, name string, version string, region string, nodePools []core.NodePool) (core.ClusterInfo, error) {
+
+	var clusterInfo core.ClusterInfo
+
+	// vke needs an exact version (ie v1.31.2+1)
+	version, err := m.findVKEVersion(ctx, version)
+	if err != nil {
+		return clusterInfo, err
+	}
+
+	createRequest := &govultr.ClusterReq{
+		Label:   name,
+		Region:  region,
+		Version: version,
+	}
+	for _, pool := range nodePools {
+		createRequest.NodePools = append(createRequest.NodePools, govultr.NodePoolReq{
+			NodeQuantity: pool.Count,
+			Label:        pool.Name,
+			Plan:         pool.Size,
+			Tag:          clusterTag,
+		})
+	}
+
+	cluster, err := m.api.Kubernetes.CreateCluster(ctx, createRequest)
+	if err != nil {
+		return clusterInfo, convertError(err)
+	}
+
+	return convertClusterInfoToGenericFormat(*cluster), nil
+}
+
+// GetClusterInfo will get details of a VKE cluster
+func (m *Manager) GetClusterInfo(ctx context.Context, clusterID string) (core.ClusterInfo, error) {
+
+	var clusterInfo core.ClusterInfo
+
+	cluster, err := m.api.Kubernetes.GetCluster(ctx, clusterID)
+	if err != nil {
+		return clusterInfo, convertError(err)
+	}
+
+	return convertClusterInfoToGenericFormat(*cluster), nil
+}
+
+// ListClusters will return all VKE clusters created by eezhee
+func (m *Manager) ListClusters(ctx context.Context) (clusterInfo []core.ClusterInfo, err error) {
+
+	options := &govultr.ListOptions{}
+	for {
+		clusters, meta, err := m.api.Kubernetes.ListClusters(ctx, options)
+		if err != nil {
+			return nil, convertError(err)
+		}
+
+		for _, cluster := range clusters {
+			info := convertClusterInfoToGenericFormat(cluster)
+			if contains(info.Tags, "eezhee") {
+				clusterInfo = append(clusterInfo, info)
+			}
+		}
+
+		if meta == nil || meta.Links == nil || len(meta.Links.Next) == 0 {
+			break
+		}
+		options.Cursor = meta.Links.Next
+	}
+
+	return clusterInfo, nil
+}
+
+// GetKubeConfig will get the kubeconfig for a VKE cluster
+func (m *Manager) GetKubeConfig(ctx context.Context, clusterID string) ([]byte, error) {
+
+	config, err := m.api.Kubernetes.GetKubeConfig(ctx, clusterID)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	// vultr returns the kubeconfig base64 encoded
+	return base64.StdEncoding.DecodeString(config.KubeConfig)
+}
+
+// DeleteCluster will delete a VKE cluster along with its load balancers and volumes
+func (m *Manager) DeleteCluster(ctx context.Context, clusterID string) error {
+
+	err := m.api.Kubernetes.DeleteClusterWithResources(ctx, clusterID)
+	if err != nil {
+		return convertError(err)
+	}
+
+	log.Debug("cluster ", clusterID, " deleted")
+
+	return nil
+}
+
+// findVKEVersion converts the requested version into one vke supports
+func (m *Manager) findVKEVersion(ctx context.Context, version string) (string, error) {
+
+	versions, err := m.api.Kubernetes.GetVersions(ctx)
+	if err != nil {
+		return "", convertError(err)
+	}
+	if len(versions.Versions) == 0 {
+		return "", errors.New("vultr did not return any vke versions")
+	}
+
+	// vultr lists the newest version first
+	if len(version) == 0 || version == "latest" {
+		return versions.Versions[0], nil
+	}
+
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	for _, v := range versions.Versions {
+		if v == version || strings.HasPrefix(v, version+".") || strings.HasPrefix(v, version+"+") {
+			return v, nil
+		}
+	}
+
+	return "", errors.New("vke does not support kubernetes " + version)
+}
+
+// convert vke cluster info into our generic format
+func convertClusterInfoToGenericFormat(cluster govultr.Cluster) core.ClusterInfo {
+
+	var clusterInfo core.ClusterInfo
+
+	clusterInfo.ID = cluster.ID
+	clusterInfo.Name = cluster.Label
+	clusterInfo.Region = cluster.Region
+	clusterInfo.Version = cluster.Version
+	clusterInfo.Endpoint = cluster.Endpoint
+
+	created, err := time.Parse(time.RFC3339, cluster.DateCreated)
+	if err == nil {
+		clusterInfo.CreatedAt = created.UTC().Format(time.RFC3339)
+	}
+
+	// need to convert final status to standard format
+	switch cluster.Status {
+	case "active":
+		clusterInfo.Status = "running"
+	case "failed":
+		clusterInfo.Status = "failed"
+	default:
+		clusterInfo.Status = cluster.Status
+	}
+
+	for _, pool := range cluster.NodePools {
+		clusterInfo.NodePools = append(clusterInfo.NodePools, core.NodePool{
+			Name:  pool.Label,
+			Size:  pool.Plan,
+			Count: pool.NodeQuantity,
+		})
+		if pool.Tag == clusterTag && !contains(clusterInfo.Tags, "eezhee") {
+			clusterInfo.Tags = append(clusterInfo.Tags, "eezhee")
+		}
+	}
+
+	return clusterInfo
+}
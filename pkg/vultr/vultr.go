@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eezhee/eezhee/pkg/core"
 	log "github.com/sirupsen/logrus"
@@ -51,6 +53,15 @@ var regionIPs = []core.IPPingTime{
 	{ID: "syd", Address: "syd-au-ping.vultr.com"},
 }
 
+// Regions are the regions vultr has (from the catalog built into eezhee)
+var Regions core.Regions = core.NewRegionCatalog("vultr", regionIPs)
+
+// Sizes are the VM sizes vultr has (from the catalog built into eezhee)
+var Sizes core.VMSizes = core.NewSizeCatalog("vultr")
+
+// time between checks of a snapshot being created
+const snapshotCheckDelay = 10 * time.Second
+
 // Manager controls access to AWS
 type Manager struct {
 	APIToken string
@@ -85,6 +96,20 @@ func NewManager(providerAPIToken string) (core.VMManager, error) {
 	return manager, nil
 }
 
+// NewManagerWithClient creates a manager that talks to the given endpoint with the given client
+// used to point the manager at a stand-in for the vultr api
+func NewManagerWithClient(endpoint string, client *http.Client) (*Manager, error) {
+
+	manager := new(Manager)
+	manager.api = govultr.NewClient(client)
+	err := manager.api.SetBaseURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
+
 // getPlans will get all active plans and sort by price
 // func (m *Manager) getCurentPlans() error {
 
@@ -134,12 +159,12 @@ func (m *Manager) FindAuthToken() string {
 }
 
 // IsSSHKeyUploaded checks if ssh key already uploaded to Vultr
-func (m *Manager) IsSSHKeyUploaded(desiredSSHKey core.SSHKey) (keyID string, err error) {
+func (m *Manager) IsSSHKeyUploaded(ctx context.Context, desiredSSHKey core.SSHKey) (keyID string, err error) {
 
 	// get all keys that are on vutrl
-	keys, _, err := m.api.SSHKey.List(context.Background(), nil)
+	keys, _, err := m.api.SSHKey.List(ctx, nil)
 	if err != nil {
-		return "", err
+		return "", convertError(err)
 	}
 
 	// see if desired key is on the list
@@ -170,7 +195,7 @@ func (m *Manager) IsSSHKeyUploaded(desiredSSHKey core.SSHKey) (keyID string, err
 }
 
 // UploadSSHKey will upload an SSH key to the cloud provider
-func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (keyID string, err error) {
+func (m *Manager) UploadSSHKey(ctx context.Context, keyName string, sshKey core.SSHKey) (keyID string, err error) {
 
 	// if provider account shared with  more than one person, key name needs to be unique
 	// let's add first few characters  fingerprint
@@ -182,10 +207,9 @@ func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (keyID string
 		SSHKey: sshKey.GetPublicKey(),
 	}
 
-	key, err := m.api.SSHKey.Create(context.Background(), newKey)
+	key, err := m.api.SSHKey.Create(ctx, newKey)
 	if err != nil {
-		msg := fmt.Sprintf("could not upload ssh key: %s", err)
-		return "", errors.New(msg)
+		return "", fmt.Errorf("could not upload ssh key: %w", convertError(err))
 	}
 	keyID = key.ID
 
@@ -194,88 +218,147 @@ func (m *Manager) UploadSSHKey(keyName string, sshKey core.SSHKey) (keyID string
 }
 
 // SelectClosestRegion will ping all regions and return the ID of the closest
-func (m *Manager) SelectClosestRegion() (closestRegion string, err error) {
-	closestRegion, err = core.GetPingTimes(regionIPs)
-	// note regionsIPs is now filled with ping times
-	return closestRegion, err
+func (m *Manager) SelectClosestRegion(ctx context.Context) (closestRegion string, err error) {
+	return core.ClosestRegion(ctx, "vultr", regionIPs)
 }
 
-// GetVMInfo will get details of a VM
-func (m *Manager) GetVMInfo(vmID string) (vmInfo core.VMInfo, err error) {
+// ListRegions gets all of vultr's regions and the plans available in each
+func (m *Manager) ListRegions(ctx context.Context) ([]core.RegionInfo, error) {
 
-	server, err := m.api.Instance.Get(context.Background(), vmID)
+	regions, _, err := m.api.Region.List(ctx, &govultr.ListOptions{PerPage: 500})
 	if err != nil {
-		return vmInfo, err
+		return nil, convertError(err)
 	}
 
-	//Convert info to our format
-	vmInfo.ID = server.ID
-	vmInfo.Name = server.Label
-	vmInfo.Region = core.RegionInfo{
-		// Name: server.Region,
-		Slug: server.Region,
+	// each plan has the regions it can be deployed in
+	plans, _, err := m.api.Plan.List(ctx, "", &govultr.ListOptions{PerPage: 500})
+	if err != nil {
+		return nil, convertError(err)
 	}
-	//TODO set RAM, Disk, VPSCpus, Cost (both in size and in vminfo)
-	// issue is these are not standard formats
-	vmInfo.Size = core.SizeInfo{
-		Slug: server.Plan,
+
+	var regionInfo []core.RegionInfo
+	for _, region := range regions {
+		var sizes []string
+		for _, plan := range plans {
+			if contains(plan.Locations, region.ID) {
+				sizes = append(sizes, plan.ID)
+			}
+		}
+		regionInfo = append(regionInfo, core.RegionInfo{
+			Name:      region.City,
+			Slug:      region.ID,
+			Available: true,
+			City:      region.City,
+			Country:   region.Country,
+			Sizes:     sizes,
+			Features:  region.Options,
+		})
 	}
-	imageID, _ := strconv.Atoi(server.Os)
-	vmInfo.Image = core.ImageInfo{
-		ID:   imageID,
-		Name: server.Os,
+
+	return regionInfo, nil
+}
+
+// ListImages gets the vultr os for each supported os
+// names have the version and arch. ie 'Ubuntu 24.04 LTS x64' or 'Debian 12 x64 (bookworm)'
+func (m *Manager) ListImages(ctx context.Context) ([]core.ImageInfo, error) {
+
+	osList, _, err := m.api.OS.List(ctx, &govultr.ListOptions{PerPage: 500})
+	if err != nil {
+		return nil, convertError(err)
 	}
-	vmInfo.CreatedAt = server.DateCreated
-	vmInfo.Tags = server.Tags
 
-	// only status that needs to be standardized is final one that server is up
-	// at vultr that is "ok"
-	if strings.Compare(server.ServerStatus, "ok") == 0 {
-		vmInfo.Status = "running"
-	} else {
-		if strings.Compare(server.Status, "pending") == 0 { // TODO: powerstatus = 'stopped' show that rather than 'locked'
-			// serverstatus will be 'none' so use status instead
-			vmInfo.Status = server.Status
-		} else {
-			vmInfo.Status = server.ServerStatus
+	var imageInfo []core.ImageInfo
+	for _, vultrOS := range osList {
+		fields := strings.Fields(vultrOS.Name)
+		if len(fields) < 2 || vultrOS.Arch != "x64" {
+			continue
 		}
+		os, ok := core.MatchOperatingSystem(vultrOS.Family, fields[1])
+		if !ok {
+			continue
+		}
+		imageInfo = append(imageInfo, core.ImageInfo{
+			ID:           vultrOS.ID,
+			Name:         vultrOS.Name,
+			Distrubution: vultrOS.Family,
+			Slug:         strconv.Itoa(vultrOS.ID),
+			OS:           os.Name,
+			Arch:         "amd64",
+			Public:       true,
+		})
 	}
-	// get public IP address
-	vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
-		IPAddress: server.MainIP,
-		Netmask:   server.NetmaskV4,
-		Gateway:   server.GatewayV4,
-		Type:      "public",
-	})
 
-	return vmInfo, nil
+	return imageInfo, nil
+}
+
+// ListSizes gets all of vultr's plans and their prices
+// a plan without any locations can't be deployed anymore
+func (m *Manager) ListSizes(ctx context.Context) ([]core.SizeInfo, error) {
+
+	plans, _, err := m.api.Plan.List(ctx, "", &govultr.ListOptions{PerPage: 500})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	var sizeInfo []core.SizeInfo
+	for _, plan := range plans {
+		sizeInfo = append(sizeInfo, core.SizeInfo{
+			Slug:         plan.ID,
+			Arch:         "amd64",
+			Memory:       plan.RAM,
+			VCPUs:        plan.VCPUCount,
+			Disk:         plan.Disk,
+			PriceMonthly: plan.MonthlyCost,
+			Regions:      plan.Locations,
+			Available:    len(plan.Locations) > 0,
+			Transfer:     plan.Bandwidth,
+		})
+	}
+
+	return sizeInfo, nil
+}
+
+// GetVMInfo will get details of a VM
+func (m *Manager) GetVMInfo(ctx context.Context, vmID string) (vmInfo core.VMInfo, err error) {
+
+	server, err := m.api.Instance.Get(ctx, vmID)
+	if err != nil {
+		return vmInfo, convertError(err)
+	}
+
+	return convertVMInfoToGenericFormat(*server)
 }
 
 // CreateVM will create a new VM
-func (m *Manager) CreateVM(name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
+func (m *Manager) CreateVM(ctx context.Context, name string, image string, size string, region string, sshKey core.SSHKey) (core.VMInfo, error) {
 	var vmInfo core.VMInfo
 
 	// find the ssh ID to use
-	keyID, err := m.IsSSHKeyUploaded(sshKey)
+	keyID, err := m.IsSSHKeyUploaded(ctx, sshKey)
 	if err != nil {
 		return vmInfo, err
 	}
 	keyIDs := []string{keyID}
 
-	imageInt, _ := strconv.Atoi(image)
 	options := &govultr.InstanceCreateReq{
 		Region:     region,
 		Plan:       size,
-		OsID:       imageInt,
 		Label:      name,
 		SSHKeys:    keyIDs,
 		EnableIPv6: govultr.BoolToBoolPtr(true),
 		Tag:        "eezhee",
 	}
+	// os ids are numbers and snapshot ids are uuids
+	imageInt, err := strconv.Atoi(image)
+	if err == nil {
+		options.OsID = imageInt
+	} else {
+		options.SnapshotID = image
+	}
 
-	server, err := m.api.Instance.Create(context.Background(), options)
+	server, err := m.api.Instance.Create(ctx, options)
 	if err != nil {
-		return vmInfo, err
+		return vmInfo, convertError(err)
 	}
 	log.Info("vm ", server.ID, " created")
 
@@ -285,11 +368,11 @@ func (m *Manager) CreateVM(name string, image string, size string, region string
 }
 
 // ListVMs will return a list of all VMs created by eezhee
-func (m *Manager) ListVMs() (vmInfo []core.VMInfo, err error) {
+func (m *Manager) ListVMs(ctx context.Context) (vmInfo []core.VMInfo, err error) {
 
-	instances, _, err := m.api.Instance.List(context.Background(), nil)
+	instances, _, err := m.api.Instance.List(ctx, nil)
 	if err != nil {
-		return vmInfo, err
+		return vmInfo, convertError(err)
 	}
 	for _, instance := range instances {
 		if len(instance.Tags) > 0 {
@@ -329,9 +412,27 @@ func convertVMInfoToGenericFormat(instance govultr.Instance) (core.VMInfo, error
 	vmInfo.Disk = instance.Disk
 
 	vmInfo.Region = core.RegionInfo{Slug: instance.Region}
-	vmInfo.Status = string(instance.ServerStatus)
 
-	vmInfo.CreatedAt = instance.DateCreated
+	// only status that needs to be standardized is final one that server is up
+	// at vultr that is "ok"
+	if strings.Compare(instance.ServerStatus, "ok") == 0 {
+		vmInfo.Status = "running"
+	} else {
+		if strings.Compare(instance.Status, "pending") == 0 { // TODO: powerstatus = 'stopped' show that rather than 'locked'
+			// serverstatus will be 'none' so use status instead
+			vmInfo.Status = instance.Status
+		} else {
+			vmInfo.Status = instance.ServerStatus
+		}
+	}
+
+	// vultr uses local time with an offset (ie 2020-10-10T01:56:20+00:00)
+	created, err := time.Parse(time.RFC3339, instance.DateCreated)
+	if err == nil {
+		vmInfo.CreatedAt = created.UTC().Format(time.RFC3339)
+	} else {
+		vmInfo.CreatedAt = instance.DateCreated
+	}
 
 	vmInfo.Image = core.ImageInfo{
 		ID:   instance.OsID,
@@ -348,19 +449,30 @@ func convertVMInfoToGenericFormat(instance govultr.Instance) (core.VMInfo, error
 		V6Info: []core.V6NetworkInfo{},
 	}
 
-	v4NetworkInfo := core.V4NetworkInfo{
-		IPAddress: instance.MainIP,
-		Gateway:   instance.GatewayV4,
-		Netmask:   instance.NetmaskV4,
+	// ips are 0.0.0.0 and empty until they have been assigned
+	if len(instance.MainIP) > 0 && instance.MainIP != "0.0.0.0" {
+		vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+			IPAddress: instance.MainIP,
+			Gateway:   instance.GatewayV4,
+			Netmask:   instance.NetmaskV4,
+			Type:      "public",
+		})
+	}
+	if len(instance.InternalIP) > 0 {
+		vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, core.V4NetworkInfo{
+			IPAddress: instance.InternalIP,
+			Type:      "private",
+		})
 	}
-	vmInfo.Networks.V4Info = append(vmInfo.Networks.V4Info, v4NetworkInfo)
 
-	v6NetworkInfo := core.V6NetworkInfo{
-		IPAddress: instance.V6MainIP,
-		Gateway:   instance.V6Network,
-		Netmask:   instance.V6NetworkSize,
+	if len(instance.V6MainIP) > 0 {
+		vmInfo.Networks.V6Info = append(vmInfo.Networks.V6Info, core.V6NetworkInfo{
+			IPAddress: instance.V6MainIP,
+			Gateway:   instance.V6Network,
+			Netmask:   instance.V6NetworkSize,
+			Type:      "public",
+		})
 	}
-	vmInfo.Networks.V6Info = append(vmInfo.Networks.V6Info, v6NetworkInfo)
 
 	vmInfo.Tags = instance.Tags
 
@@ -368,14 +480,87 @@ func convertVMInfoToGenericFormat(instance govultr.Instance) (core.VMInfo, error
 }
 
 // DeleteVM will delete a given VM
-func (m *Manager) DeleteVM(ID string) error {
+func (m *Manager) DeleteVM(ctx context.Context, ID string) error {
 
 	// NOTE: if current status is 'pending' then can't delete (yet)
 	//       need to wait until build completed first
 
-	err := m.api.Instance.Delete(context.Background(), ID)
+	err := m.api.Instance.Delete(ctx, ID)
+	if err != nil {
+		return convertError(err)
+	}
+
+	return nil
+}
+
+// ResizeVM changes the plan of an instance.  vultr restarts it
+// note: vultr only allows moving to a larger plan
+func (m *Manager) ResizeVM(ctx context.Context, vmID string, size string) error {
+
+	_, err := m.api.Instance.Update(ctx, vmID, &govultr.InstanceUpdateReq{Plan: size})
+	if err != nil {
+		return convertError(err)
+	}
+
+	return nil
+}
+
+// SnapshotVM halts an instance and starts saving it as a snapshot
+// note: snapshots can be used in any region
+func (m *Manager) SnapshotVM(ctx context.Context, vmID string, name string) (core.ImageInfo, error) {
+
+	err := m.api.Instance.Halt(ctx, vmID)
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("could not halt instance: %w", convertError(err))
+	}
+
+	snapshot, err := m.api.Snapshot.Create(ctx, &govultr.SnapshotReq{InstanceID: vmID, Description: name})
+	if err != nil {
+		return core.ImageInfo{}, fmt.Errorf("could not create snapshot: %w", convertError(err))
+	}
+
+	return convertSnapshot(snapshot), nil
+}
+
+// WaitForImage waits until a snapshot is complete
+func (m *Manager) WaitForImage(ctx context.Context, imageID string) (core.ImageInfo, error) {
+
+	snapshot, err := m.api.Snapshot.Get(ctx, imageID)
+	if err != nil {
+		return core.ImageInfo{}, convertError(err)
+	}
+	for snapshot.Status != "complete" {
+		select {
+		case <-ctx.Done():
+			return core.ImageInfo{}, ctx.Err()
+		case <-time.After(snapshotCheckDelay):
+		}
+		snapshot, err = m.api.Snapshot.Get(ctx, snapshot.ID)
+		if err != nil {
+			return core.ImageInfo{}, convertError(err)
+		}
+	}
+
+	return convertSnapshot(snapshot), nil
+}
+
+// convertSnapshot converts a vultr snapshot into our generic format
+func convertSnapshot(snapshot *govultr.Snapshot) core.ImageInfo {
+	return core.ImageInfo{
+		Name:          snapshot.Description,
+		Slug:          snapshot.ID,
+		SizeGigabytes: float64(snapshot.Size) / (1024 * 1024 * 1024),
+		CreatedAt:     snapshot.DateCreated,
+		Status:        snapshot.Status,
+	}
+}
+
+// DeleteImage deletes a snapshot
+func (m *Manager) DeleteImage(ctx context.Context, imageID string) error {
+
+	err := m.api.Snapshot.Delete(ctx, imageID)
 	if err != nil {
-		return err
+		return convertError(err)
 	}
 
 	return nil
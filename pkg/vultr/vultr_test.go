@@ -0,0 +1,59 @@
+package vultr
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/eezhee/eezhee/pkg/core/conformance"
+	"github.com/vultr/govultr/v2"
+)
+
+func TestConformance(t *testing.T) {
+
+	server := conformance.Replay(t, []conformance.Fixture{
+		{Method: "GET", Path: "/v2/instances", File: "testdata/instances.json"},
+		{Method: "GET", Path: "/v2/instances/cb676a46-66fd-4dfb-b839-443f2e6c0b60", File: "testdata/instance.json"},
+		{Method: "GET", Path: "/v2/instances/4f0f12e5-1f84-404f-aa84-85f431ea5ec2", File: "testdata/instance-pending.json"},
+		{Method: "GET", Path: "/v2/instances/missing", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+		{Method: "DELETE", Path: "/v2/instances/missing", Status: http.StatusNotFound, File: "testdata/not-found.json"},
+	})
+	manager, err := NewManagerWithClient(server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejecting := conformance.Unauthorized(t, "testdata/unauthorized.json")
+	unauthorized, err := NewManagerWithClient(rejecting.URL, rejecting.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conformance.Run(t, manager, unauthorized, conformance.Expect{
+		RunningID: "cb676a46-66fd-4dfb-b839-443f2e6c0b60",
+		PendingID: "4f0f12e5-1f84-404f-aa84-85f431ea5ec2",
+		MissingID: "missing",
+		Name:      "webapp-main",
+		PublicIP:  "149.28.112.21",
+		CreatedAt: "2024-03-01T12:00:00Z",
+		NumListed: 2,
+	})
+}
+
+func TestClusterStatus(t *testing.T) {
+
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"pending", "pending"},
+		{"active", "running"},
+		{"failed", "failed"},
+	}
+
+	for _, test := range tests {
+		clusterInfo := convertClusterInfoToGenericFormat(govultr.Cluster{Status: test.status})
+		if clusterInfo.Status != test.want {
+			t.Errorf("status of %s cluster = %q, want %q", test.status, clusterInfo.Status, test.want)
+		}
+	}
+}